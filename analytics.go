@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// maxAnalyticsChunks and maxAnalyticsLinks bound /api/analytics, whose
+// betweenness runs Dijkstra from every chunk; /api/graph serves centrality
+// precomputed at --cluster-threshold for larger graphs
+const (
+	maxAnalyticsChunks = 5000
+	maxAnalyticsLinks  = 100000
+)
+
+// AnalyticsChunk is a chunk's centrality with the labels needed to show it
+type AnalyticsChunk struct {
+	analysis.Centrality
+	Summary string `json:"summary"`
+	Section string `json:"section,omitempty"`
+	Cluster int    `json:"cluster"`
+}
+
+// handleAnalytics serves /api/analytics: centrality of every chunk, highest
+// betweenness first, and the maximum spanning tree of the similarity graph.
+// Chunks with high betweenness that link chunks of different clusters are
+// the bridges between otherwise distinct themes.
+func (s *APIServer) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	minSimilarity := s.clusterThreshold
+	if sim := r.URL.Query().Get("min_similarity"); sim != "" {
+		parsed, err := strconv.ParseFloat(sim, 64)
+		if err != nil {
+			respondWithError(w, "invalid min_similarity parameter", http.StatusBadRequest)
+			return
+		}
+		minSimilarity = parsed
+	}
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 0 {
+			respondWithError(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	all, err := db.GetAllChunks()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	similarities, err := db.GetAllSimilarities()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get similarities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Same node filters as /api/graph
+	includeOutliers := r.URL.Query().Get("include_outliers") == "true"
+	languages := parseLanguages(r.URL.Query())
+	var chunks []database.TextChunk
+	for _, chunk := range all {
+		if chunk.IsOutlier && !includeOutliers {
+			continue
+		}
+		if languages != nil && !languages[chunk.Language] {
+			continue
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(chunks) > maxAnalyticsChunks {
+		respondWithError(w, fmt.Sprintf("%d chunks is too many for analytics (at most %d); filter by language or leave out outliers", len(chunks), maxAnalyticsChunks), http.StatusBadRequest)
+		return
+	}
+
+	byID := make(map[int]database.TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+	links := 0
+	for _, sim := range similarities {
+		_, ok1 := byID[sim.ChunkID1]
+		_, ok2 := byID[sim.ChunkID2]
+		if ok1 && ok2 && sim.Similarity >= minSimilarity {
+			links++
+		}
+	}
+	if links > maxAnalyticsLinks {
+		respondWithError(w, fmt.Sprintf("%d links at min_similarity %g is too many for analytics (at most %d); raise min_similarity", links, minSimilarity, maxAnalyticsLinks), http.StatusBadRequest)
+		return
+	}
+	clusterOf := make(map[int]int, len(chunks))
+	for _, cluster := range analysis.FindClusters(chunks, similarities, minSimilarity) {
+		for _, id := range cluster.ChunkIDs {
+			clusterOf[id] = cluster.ID
+		}
+	}
+
+	analytics := analysis.AnalyzeGraph(chunks, similarities, minSimilarity)
+	centrality := analytics.Centrality
+	if limit > 0 && len(centrality) > limit {
+		centrality = centrality[:limit]
+	}
+	result := make([]AnalyticsChunk, len(centrality))
+	for i, c := range centrality {
+		result[i] = AnalyticsChunk{
+			Centrality: c,
+			Summary:    byID[c.ChunkID].Summary,
+			Section:    byID[c.ChunkID].Section,
+			Cluster:    clusterOf[c.ChunkID],
+		}
+	}
+
+	respondWithJSON(w, map[string]interface{}{
+		"min_similarity": minSimilarity,
+		"chunks":         result,
+		"spanning_tree":  analytics.SpanningTree,
+	})
+}
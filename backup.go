@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+)
+
+// zstdMagic starts every zstd frame, so restore can tell compressed
+// snapshots from plain database copies
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+type backupOptions struct {
+	dbPath     string
+	outPath    string
+	passphrase string
+}
+
+type restoreOptions struct {
+	snapshot   string
+	dbPath     string
+	force      bool
+	passphrase string
+}
+
+func createBackupCommand() *cobra.Command {
+	var opts backupOptions
+
+	cmd := &cobra.Command{
+		Use:   "backup <database.db>",
+		Short: "Save a compressed snapshot of a database",
+		Long:  "Copy a database with SQLite's online backup API, which takes a consistent snapshot even while serve or another process writes to it, and compress it with zstd. Take one before risky operations like merges, migrations or prune, and bring it back with restore. An --out path not ending in .zst is written uncompressed.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := backupDatabase(opts); err != nil {
+				log.Fatalf("Error backing up database: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.outPath, "out", "o", "", "Snapshot file (default: <database>-<timestamp>.db.zst beside the database)")
+	addPassphraseFlag(cmd, &opts.passphrase)
+
+	return cmd
+}
+
+func createRestoreCommand() *cobra.Command {
+	var opts restoreOptions
+
+	cmd := &cobra.Command{
+		Use:   "restore <snapshot.db.zst> <database.db>",
+		Short: "Restore a database from a snapshot",
+		Long:  "Decompress a snapshot written by backup, check that it is a sound bluffy database, and move it into place. Replacing an existing database requires --force; stop serve and other processes using it first.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.snapshot, opts.dbPath = args[0], args[1]
+			if err := restoreDatabase(opts); err != nil {
+				log.Fatalf("Error restoring database: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Replace the database if it exists")
+	addPassphraseFlag(cmd, &opts.passphrase)
+
+	return cmd
+}
+
+func backupDatabase(opts backupOptions) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	if err := usePassphrase(opts.passphrase); err != nil {
+		return err
+	}
+	if opts.outPath == "" {
+		base := strings.TrimSuffix(opts.dbPath, filepath.Ext(opts.dbPath))
+		opts.outPath = fmt.Sprintf("%s-%s.db.zst", base, time.Now().Format("20060102-150405"))
+	}
+	if _, err := os.Stat(opts.outPath); err == nil {
+		return fmt.Errorf("%s already exists", opts.outPath)
+	}
+
+	db, err := database.OpenDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// Backing up isn't a reason to migrate, so the snapshot keeps the
+	// schema version the database had
+	if err := db.CheckBluffy(); err != nil {
+		return err
+	}
+
+	// The backup API writes a database file, which is then compressed
+	temp, err := tempPathBeside(opts.outPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+	if err := db.Backup(temp); err != nil {
+		return err
+	}
+	dbInfo, err := os.Stat(temp)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(opts.outPath, ".zst") {
+		if err := os.Rename(temp, opts.outPath); err != nil {
+			return fmt.Errorf("failed to write %s: %w", opts.outPath, err)
+		}
+		fmt.Printf("Backed up %s to %s (%s)\n", opts.dbPath, opts.outPath, formatBytes(dbInfo.Size()))
+		return nil
+	}
+
+	if err := compressFile(temp, opts.outPath); err != nil {
+		return err
+	}
+	outInfo, err := os.Stat(opts.outPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s (%s, %s uncompressed)\n", opts.dbPath, opts.outPath, formatBytes(outInfo.Size()), formatBytes(dbInfo.Size()))
+	return nil
+}
+
+func restoreDatabase(opts restoreOptions) error {
+	if _, err := os.Stat(opts.snapshot); err != nil {
+		return fmt.Errorf("cannot access snapshot: %w", err)
+	}
+	if _, err := os.Stat(opts.dbPath); err == nil && !opts.force {
+		return fmt.Errorf("%s already exists; pass --force to replace it", opts.dbPath)
+	}
+	if err := usePassphrase(opts.passphrase); err != nil {
+		return err
+	}
+
+	temp, err := tempPathBeside(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+	if err := decompressFile(opts.snapshot, temp); err != nil {
+		return err
+	}
+	if err := checkSnapshot(opts.snapshot, temp); err != nil {
+		return err
+	}
+
+	// A write-ahead log left by the old database would be replayed into
+	// the restored one
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(opts.dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", opts.dbPath+suffix, err)
+		}
+	}
+	if err := os.Rename(temp, opts.dbPath); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", opts.dbPath, err)
+	}
+	fmt.Printf("Restored %s from %s\n", opts.dbPath, opts.snapshot)
+	return nil
+}
+
+// checkSnapshot fails unless the decompressed snapshot at path is a sound
+// bluffy database
+func checkSnapshot(snapshot, path string) error {
+	db, err := database.OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.CheckBluffy(); err != nil {
+		return fmt.Errorf("%s doesn't hold a bluffy database: %w", snapshot, err)
+	}
+	problems, err := db.CheckIntegrity()
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is damaged: %s", snapshot, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// tempPathBeside returns an unused path in the directory of path, so the
+// finished file can be renamed into place
+func tempPathBeside(path string) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	file.Close()
+	// The backup API creates the file itself
+	os.Remove(file.Name())
+	return file.Name(), nil
+}
+
+// compressFile writes src to dst compressed with zstd
+func compressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	encoder, err := zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(encoder, in); err != nil {
+		encoder.Close()
+		return fmt.Errorf("failed to compress %s: %w", dst, err)
+	}
+	return encoder.Close()
+}
+
+// decompressFile writes the zstd-compressed src to dst, or copies src if
+// it is a plain database
+func decompressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	reader := bufio.NewReader(in)
+	magic, _ := reader.Peek(len(zstdMagic))
+	if !bytes.Equal(magic, zstdMagic) {
+		_, err = io.Copy(out, reader)
+		return err
+	}
+	decoder, err := zstd.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+	if _, err := io.Copy(out, decoder); err != nil {
+		return fmt.Errorf("failed to decompress %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// defaultBatchSize is how many chunks summarize and embed finish before
+// storing them
+const defaultBatchSize = 50
+
+// processInBatches calls fn on every chunk with up to workers goroutines
+// and passes each batch of finished chunks to store, so an interrupted
+// command keeps the batches stored before it stopped. It returns the
+// number of chunks stored.
+func processInBatches(chunks []database.TextChunk, batchSize, workers int, label string, fn func(chunk *database.TextChunk) error, store func(batch []database.TextChunk) error) (int, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	if batchSize <= 0 {
+		batchSize = len(chunks)
+	}
+
+	reporter := newProgress(os.Stdout)
+	stored := 0
+	for start := 0; start < len(chunks); start += batchSize {
+		batch := chunks[start:min(start+batchSize, len(chunks))]
+
+		jobs := make(chan int, len(batch))
+		for i := range batch {
+			jobs <- i
+		}
+		close(jobs)
+
+		var (
+			mu       sync.Mutex
+			firstErr error
+			wg       sync.WaitGroup
+		)
+		completed := stored
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					mu.Lock()
+					failed := firstErr != nil
+					mu.Unlock()
+					if failed {
+						return
+					}
+					err := fn(&batch[i])
+
+					mu.Lock()
+					if err != nil && firstErr == nil {
+						firstErr = fmt.Errorf("chunk %d: %w", batch[i].ID, err)
+					}
+					completed++
+					reporter.Report(label, completed, len(chunks))
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return stored, firstErr
+		}
+		if err := store(batch); err != nil {
+			return stored, err
+		}
+		stored += len(batch)
+	}
+	return stored, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// benchTolerance is how close to the best throughput a worker count must
+// come to be recommended; the smallest such count wins, since extra
+// workers only add load once the backend is saturated
+const benchTolerance = 0.9
+
+// benchParagraph is repeated to build the benchmark texts
+const benchParagraph = "The river rose through the night and by morning the lower town was under water. Boats moved between the houses, carrying families and what they could save to the church on the hill, where the bell rang every hour to guide them. "
+
+// benchOptions holds the settings for a benchmark
+type benchOptions struct {
+	ollamaHost     string
+	embeddingModel string
+	workerCounts   []int
+	requests       int
+	textSize       int
+	save           bool
+	ollama         ollamaFlags
+}
+
+// benchLevel is the measured embedding performance at one worker count
+type benchLevel struct {
+	workers int
+	rate    float64
+	p50     time.Duration
+	p95     time.Duration
+}
+
+func createBenchCommand() *cobra.Command {
+	var opts benchOptions
+
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure embedding throughput and recommend a worker count",
+		Long:  "Send embedding requests to the Ollama backend at increasing worker counts, report throughput and latency at each, and recommend the smallest worker count that comes within 10% of the best throughput. The recommendation is saved as process.embed-workers in the selected config profile, so later runs use it for embedding requests. Every request embeds one text, so worker count is the only setting measured.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			configPath, _ := cmd.Flags().GetString("config")
+			profile, _ := cmd.Flags().GetString("profile")
+			if err := runBench(opts, configPath, profile); err != nil {
+				log.Fatalf("Error running benchmark: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", embedding.DefaultEmbeddingModel, "Ollama model used for embeddings")
+	addOllamaFlags(cmd, &opts.ollama, true)
+	addAutoPullFlag(cmd, &opts.ollama)
+	cmd.Flags().IntSliceVar(&opts.workerCounts, "worker-counts", []int{1, 2, 4, 8, 16}, "Worker counts to measure")
+	cmd.Flags().IntVar(&opts.requests, "requests", 32, "Embedding requests sent at each worker count")
+	cmd.Flags().IntVar(&opts.textSize, "text-size", 4000, "Characters per embedded text; match your --chunk-size")
+	cmd.Flags().BoolVar(&opts.save, "save", true, "Save the recommended worker count to the config profile")
+
+	return cmd
+}
+
+// runBench measures worker counts alone: every embedding request carries one
+// text, so there is no request batch size to tune alongside them
+func runBench(opts benchOptions, configPath, profileName string) error {
+	if opts.requests <= 0 {
+		return fmt.Errorf("requests must be positive, got %d", opts.requests)
+	}
+	if opts.textSize <= 0 {
+		return fmt.Errorf("text size must be positive, got %d", opts.textSize)
+	}
+	counts := append([]int(nil), opts.workerCounts...)
+	if len(counts) == 0 {
+		return fmt.Errorf("at least one worker count is required")
+	}
+	for _, workers := range counts {
+		if workers <= 0 {
+			return fmt.Errorf("worker counts must be positive, got %d", workers)
+		}
+	}
+	sort.Ints(counts)
+
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+	client := newOllamaClient(opts.ollamaHost, opts.embeddingModel, "", clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return err
+	}
+	if err := client.CheckModelsAvailable(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Benchmarking %s on %s with %d-character texts\n", client.Model(), client.Host(), opts.textSize)
+
+	// The first request loads the model, which would skew the first level
+	start := time.Now()
+	if _, err := client.GetEmbedding(benchText(0, opts.textSize)); err != nil {
+		return fmt.Errorf("failed to embed warm-up text: %w", err)
+	}
+	fmt.Printf("Cold start: %s\n\n", time.Since(start).Round(time.Millisecond))
+
+	fmt.Printf("%-8s  %12s  %10s  %10s\n", "Workers", "Embeddings/s", "p50", "p95")
+	var levels []benchLevel
+	for i, workers := range counts {
+		// Distinct texts per request, so nothing in front of the backend
+		// can answer from a cache
+		texts := make([]string, opts.requests)
+		for j := range texts {
+			texts[j] = benchText(1+i*opts.requests+j, opts.textSize)
+		}
+		level, err := measureWorkers(client, texts, workers)
+		if err != nil {
+			return fmt.Errorf("benchmark failed with %d workers: %w", workers, err)
+		}
+		levels = append(levels, level)
+		fmt.Printf("%-8d  %12.2f  %10s  %10s\n", level.workers, level.rate,
+			level.p50.Round(100*time.Microsecond), level.p95.Round(100*time.Microsecond))
+	}
+
+	recommended := recommendWorkers(levels)
+	fmt.Printf("\nRecommended: --workers %d\n", recommended)
+
+	if opts.save {
+		path, profile, err := saveProfileWorkers(configPath, profileName, recommended)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved as process.embed-workers in profile %q of %s\n", profile, path)
+	}
+	return nil
+}
+
+// measureWorkers embeds texts with the given number of concurrent workers
+// and returns the throughput and latency percentiles
+func measureWorkers(client *embedding.OllamaClient, texts []string, workers int) (benchLevel, error) {
+	jobs := make(chan string, len(texts))
+	for _, text := range texts {
+		jobs <- text
+	}
+	close(jobs)
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for text := range jobs {
+				requestStart := time.Now()
+				_, err := client.GetEmbedding(text)
+				elapsed := time.Since(requestStart)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				latencies = append(latencies, elapsed)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	total := time.Since(start)
+
+	if firstErr != nil {
+		return benchLevel{}, firstErr
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return benchLevel{
+		workers: workers,
+		rate:    float64(len(texts)) / total.Seconds(),
+		p50:     latencies[len(latencies)/2],
+		p95:     latencies[(len(latencies)*95-1)/100],
+	}, nil
+}
+
+// recommendWorkers returns the smallest worker count reaching
+// benchTolerance of the best throughput
+func recommendWorkers(levels []benchLevel) int {
+	best := 0.0
+	for _, level := range levels {
+		if level.rate > best {
+			best = level.rate
+		}
+	}
+	for _, level := range levels {
+		if level.rate >= best*benchTolerance {
+			return level.workers
+		}
+	}
+	return 1
+}
+
+// benchText returns a distinct text of size characters
+func benchText(n, size int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Passage %d. ", n)
+	for b.Len() < size {
+		b.WriteString(benchParagraph)
+	}
+	return b.String()[:size]
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// bibDocumentExtensions are the formats an entry's document is read in,
+// most preferred first. PDFs aren't read directly but through their text.
+var bibDocumentExtensions = []string{".md", ".txt", ".tex", ".docx", ".epub"}
+
+// zoteroFullTextCache is the file Zotero keeps the extracted text of a PDF
+// in, next to it in its storage folder
+const zoteroFullTextCache = ".zotero-ft-cache"
+
+// processBibliography processes the documents of the entries of a BibTeX
+// or BibLaTeX bibliography, such as a Zotero export, into one database
+// named after it, with a run per entry named by its citation key. Each
+// run records the entry's authors, year, title and venue as its metadata.
+// Entries without a readable document are processed from their abstract.
+func processBibliography(opts processOptions) error {
+	entries, err := textproc.ReadBibTeX(opts.bib)
+	if err != nil {
+		return fmt.Errorf("failed to read bibliography: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s has no entries", opts.bib)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	bibDir := filepath.Dir(opts.bib)
+	filesDir := opts.bibFiles
+	if filesDir == "" {
+		filesDir = bibDir
+	}
+
+	files := make([]*dirFile, len(entries))
+	for i, entry := range entries {
+		file := &dirFile{path: bibDocument(entry, bibDir, filesDir), rel: entry.Key}
+		file.report, file.err = readBibEntry(entry, file.path, opts)
+		if file.report != nil && file.path == "" {
+			file.note = "abstract only"
+		}
+		files[i] = file
+	}
+	return processFiles(opts, files, opts.bib, "Bibliography")
+}
+
+// readBibEntry reads the document of an entry from path, or its abstract
+// if path is empty, and attaches the entry's metadata
+func readBibEntry(entry textproc.BibEntry, path string, opts processOptions) (*textproc.ValidationReport, error) {
+	metadata := entry.Metadata()
+	if path != "" {
+		report, err := readInput(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		// A note's aliases still resolve wikilinks to it
+		if report.Metadata != nil {
+			metadata.Aliases = report.Metadata.Aliases
+		}
+		report.Metadata = metadata
+		return report, nil
+	}
+
+	abstract := entry.Field("abstract")
+	if abstract == "" {
+		return nil, fmt.Errorf("no readable document or abstract; attach a %s file or the text of its PDF", strings.Join(bibDocumentExtensions, ", "))
+	}
+	chunks, err := textproc.ChunkText(abstract, textproc.ChunkOptions{Size: opts.chunkSize, Overlap: opts.chunkOverlap})
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk the abstract: %w", err)
+	}
+	report := &textproc.ValidationReport{
+		Path:     opts.bib,
+		Size:     int64(len(abstract)),
+		Format:   textproc.FormatText,
+		Encoding: textproc.EncodingUTF8,
+		Metadata: metadata,
+		Chunks:   chunks,
+	}
+	return filterInput(report, opts.bib+" ("+entry.Key+")", opts)
+}
+
+// bibDocument returns the file holding the text of an entry, or "" if it
+// has none. Attachments in the file field are tried in order, relative to
+// the bibliography; a PDF is used through a .txt or .md file of the same
+// name next to it, such as pdftotext writes, or through Zotero's full-text
+// cache. Failing those, a document named by the citation key is looked for
+// in filesDir.
+func bibDocument(entry textproc.BibEntry, bibDir, filesDir string) string {
+	var candidates []string
+	for _, attachment := range entry.Attachments() {
+		path := filepath.FromSlash(attachment)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(bibDir, path)
+		}
+		if strings.EqualFold(filepath.Ext(path), ".pdf") {
+			base := strings.TrimSuffix(path, filepath.Ext(path))
+			candidates = append(candidates, base+".txt", base+".md", filepath.Join(filepath.Dir(path), zoteroFullTextCache))
+			continue
+		}
+		// Other attachments, such as saved web pages, aren't documents
+		// bluffy reads
+		if slices.Contains(bibDocumentExtensions, strings.ToLower(filepath.Ext(path))) {
+			candidates = append(candidates, path)
+		}
+	}
+	for _, ext := range bibDocumentExtensions {
+		candidates = append(candidates, filepath.Join(filesDir, entry.Key+ext))
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+			return candidate
+		}
+	}
+	return ""
+}
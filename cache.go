@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the response cache; the oldest entry is evicted
+// when it is full
+const maxCacheEntries = 256
+
+// responseCache holds GET responses keyed by database modification time,
+// path, and query parameters, so an entry is never served after the
+// database changes even before its TTL expires
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	created time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *responseCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	if time.Since(entry.created) > c.ttl {
+		delete(c.entries, key)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *responseCache) put(key string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCacheEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.created.Before(oldest) {
+				oldestKey, oldest = k, e.created
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	c.entries[key] = entry
+}
+
+// invalidate drops every entry and returns how many were dropped
+func (c *responseCache) invalidate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]cacheEntry)
+	return n
+}
+
+// dbModTime returns the latest modification time of the database and its
+// write-ahead log, which is where recent writes land before a checkpoint
+func dbModTime(dbPath string) time.Time {
+	var latest time.Time
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func cacheKey(dbPath string, r *http.Request) string {
+	query := r.URL.Query()
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		sorted := append([]string(nil), values...)
+		sort.Strings(sorted)
+		params = append(params, name+"="+strings.Join(sorted, ","))
+	}
+	sort.Strings(params)
+
+	return fmt.Sprintf("%d|%s|%s", dbModTime(dbPath).UnixNano(), r.URL.Path, strings.Join(params, "&"))
+}
+
+// recordingWriter tracks a response's status and, if record is set,
+// captures its body so it can be stored in the cache
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	record bool
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	if status != http.StatusOK {
+		// Errors must not be revalidated as if they were the resource
+		w.Header().Del("ETag")
+		w.Header().Del("Cache-Control")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.record {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// cached serves GET requests from the response cache and stores successful
+// responses in it. Caching is disabled when the TTL is zero. Responses also
+// carry an ETag derived from the cache key, so clients that send it back in
+// If-None-Match get a 304 until the database changes.
+func (s *APIServer) cached(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			handler(w, r)
+			return
+		}
+
+		key := cacheKey(s.dbPath, r)
+		tag := etag(key)
+		if etagMatches(r.Header.Get("If-None-Match"), tag) {
+			w.Header().Set("ETag", tag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", tag)
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if s.cache == nil {
+			handler(&recordingWriter{ResponseWriter: w}, r)
+			return
+		}
+
+		if entry, ok := s.cache.get(key); ok {
+			for name, values := range entry.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		recorder := &recordingWriter{ResponseWriter: w, status: http.StatusOK, record: true}
+		handler(recorder, r)
+
+		if recorder.status == http.StatusOK {
+			header := w.Header().Clone()
+			header.Del("X-Cache")
+			// CORS and Vary headers depend on the request, and are set again
+			// for each one before the cached response is replayed
+			for name := range header {
+				if strings.HasPrefix(name, "Access-Control-") || name == "Vary" {
+					header.Del(name)
+				}
+			}
+			s.cache.put(key, cacheEntry{
+				status:  recorder.status,
+				header:  header,
+				body:    recorder.body.Bytes(),
+				created: time.Now(),
+			})
+		}
+	}
+}
+
+func (s *APIServer) handleCacheInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropped := 0
+	if s.cache != nil {
+		dropped = s.cache.invalidate()
+	}
+
+	respondWithJSON(w, map[string]int{"invalidated": dropped})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// captureRunName is the run that passages saved by the capture endpoint
+// belong to
+const captureRunName = "captures"
+
+// captureRequest is sent by a web clipper for a highlighted passage
+type captureRequest struct {
+	Text  string `json:"text"`
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// captureConfig controls the token-authenticated capture endpoint
+type captureConfig struct {
+	token    string
+	origins  []string
+	maxBytes int64
+}
+
+func (c captureConfig) enabled() bool {
+	return c.token != ""
+}
+
+func (c captureConfig) originAllowed(origin string) bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureCORS applies the capture origin allowlist instead of the wildcard
+// CORS policy used by the read-only endpoints. Requests without an Origin
+// header (scripts, curl) are not subject to CORS and pass through.
+func (s *APIServer) captureCORS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !s.capture.originAllowed(origin) {
+				respondWithError(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		}
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *APIServer) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if !s.capture.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.readonly {
+		respondWithError(w, "Server is read-only; restart it with --readonly=false to enable capture", http.StatusForbidden)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.capture.token)) != 1 {
+		respondWithError(w, "Invalid or missing capture token", http.StatusUnauthorized)
+		return
+	}
+
+	if r.ContentLength > s.capture.maxBytes {
+		respondWithError(w, fmt.Sprintf("Payload exceeds %d bytes", s.capture.maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req captureRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.capture.maxBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		respondWithError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	// The page title (or URL) is kept as the chunk's section so captured
+	// passages can be traced back to where they were clipped
+	section := req.Title
+	if section == "" {
+		section = req.URL
+	}
+
+	chunk, neighbors, err := s.ingestSnippet(req.Text, section, captureRunName, defaultSnippetNeighbors)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, snippetResponse{
+		Chunk:     newNode(*chunk),
+		Neighbors: neighbors,
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// errPassageEdit rejects edits to passages, which are derived from their
+// parent chunk's text
+var errPassageEdit = errors.New("passages cannot be edited")
+
+type chunkUpdateRequest struct {
+	Text string `json:"text"`
+	// Version is the chunk version the edit is based on; the update is
+	// rejected if the chunk has changed since
+	Version int `json:"version"`
+}
+
+// handleChunk serves /api/chunks/{id}. PUT replaces the chunk's text,
+// re-embeds and re-summarizes it, and recomputes its similarity rows.
+// GET /api/chunks/{id}/parent returns the chunk a passage was split from,
+// GET /api/chunks/{id}/context the chunk with its neighbors, and
+// /api/chunks/{id}/tags manages the chunk's tags.
+func (s *APIServer) handleChunk(w http.ResponseWriter, r *http.Request) {
+	path, parent := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/chunks/"), "/parent")
+	path, tags := strings.CutSuffix(path, "/tags")
+	path, context := strings.CutSuffix(path, "/context")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		respondWithError(w, "Invalid chunk ID", http.StatusBadRequest)
+		return
+	}
+
+	if tags {
+		s.handleChunkTags(w, r, id)
+		return
+	}
+
+	if parent {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleChunkParent(w, id)
+		return
+	}
+	if context {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleChunkContext(w, r, id)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req chunkUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		respondWithError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if req.Version <= 0 {
+		respondWithError(w, "version is required: send the version of the chunk being edited", http.StatusBadRequest)
+		return
+	}
+
+	chunk, err := s.updateChunk(id, req.Text, req.Version)
+	if errors.Is(err, database.ErrChunkNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errPassageEdit) {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, database.ErrVersionConflict) {
+		respondWithError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, newNode(*chunk))
+}
+
+func (s *APIServer) handleChunkParent(w http.ResponseWriter, id int) {
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunk, err := db.GetChunk(id)
+	if errors.Is(err, database.ErrChunkNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if chunk.ParentID == 0 {
+		respondWithError(w, fmt.Sprintf("chunk %d is not a passage and has no parent", id), http.StatusNotFound)
+		return
+	}
+
+	parent, err := db.GetChunk(chunk.ParentID)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, newNode(*parent))
+}
+
+// updateChunk replaces a chunk's text and regenerates everything derived
+// from it, provided the chunk is still at the given version
+func (s *APIServer) updateChunk(id int, text string, version int) (*database.TextChunk, error) {
+	text = strings.TrimSpace(text)
+
+	// Check the chunk exists before spending time on Ollama calls
+	db, err := s.openDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	current, err := db.GetChunk(id)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	normalized, err := db.RunNormalized(current.RunID)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	projection, err := db.Projection()
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+	if current.ParentID != 0 {
+		return nil, fmt.Errorf("chunk %d is a passage of chunk %d; edit that chunk instead: %w", id, current.ParentID, errPassageEdit)
+	}
+	if current.Version != version {
+		return nil, fmt.Errorf("chunk %d is at version %d, not %d: %w", id, current.Version, version, database.ErrVersionConflict)
+	}
+
+	// The chunk is embedded again by the model that embedded it, such as
+	// the model of its language with process --language-model, so it stays
+	// comparable with the chunks it was linked to
+	embedder := s.client
+	if current.EmbeddingModel != "" && current.EmbeddingModel != embedder.Model() {
+		embedder = embedder.WithEmbeddingModel(current.EmbeddingModel)
+	}
+	embeddingVector, err := embedder.GetEmbedding(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed chunk: %w", err)
+	}
+	// Chunks of a projected database are projected like the others
+	if projection != nil {
+		if embeddingVector, err = projection.Project(embeddingVector); err != nil {
+			return nil, err
+		}
+	}
+	// Chunks of a --normalize run stay unit length
+	if normalized {
+		embeddingVector = similarity.Normalize(embeddingVector)
+	}
+	// The new summary and title are written in the language of the old ones
+	client := s.client.WithSummaryLanguage(current.SummaryLanguage)
+	summary, err := client.GetSummary(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize chunk: %w", err)
+	}
+	// A scored chunk is scored again so its tone matches the new text
+	var sentiment *float64
+	if current.Sentiment != nil {
+		score, err := s.client.GetSentiment(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to score chunk sentiment: %w", err)
+		}
+		sentiment = &score
+	}
+	// Likewise a titled chunk gets a title for its new text
+	var title string
+	if current.Title != "" {
+		if title, err = client.GetTitle(text); err != nil {
+			return nil, fmt.Errorf("failed to title chunk: %w", err)
+		}
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	db, err = s.openDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	chunk, err := db.GetChunk(id)
+	if err != nil {
+		return nil, err
+	}
+	// UpdateChunk rejects the edit if another update landed while Ollama
+	// was busy
+	chunk.Version = version
+	chunk.Text = text
+	chunk.Language = textproc.DetectLanguage(text)
+	chunk.TokenCount = embedding.CountTokens(embedder.Model(), text)
+	chunk.Embedding = embeddingVector
+	chunk.EmbeddingModel = embedder.Model()
+	chunk.Summary = summary
+	chunk.Sentiment = sentiment
+	chunk.Title = title
+
+	all, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	metric, err := db.SimilarityMetric()
+	if err != nil {
+		return nil, err
+	}
+	similarities, err := similarity.SimilaritiesTo(*chunk, embeddedWith(all, embedder.Model()), metric)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.UpdateChunk(chunk, similarities); err != nil {
+		return nil, err
+	}
+	if err := db.RefreshChunkNeighbors([]int{chunk.ID}); err != nil {
+		return nil, err
+	}
+
+	return chunk, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// allCommands is the profile section applied to every command that has
+// the named flag
+const allCommands = "all"
+
+// Config is the bluffy configuration file. Each profile maps a command name
+// (or "all") to flag values, so a profile can bundle chunking, model,
+// threshold and analysis settings for one kind of corpus:
+//
+//	{
+//	  "default_profile": "notes",
+//	  "profiles": {
+//	    "books": {
+//	      "all":     {"ollama-host": "http://gpu-box:11434"},
+//	      "process": {"chunk-size": 6000, "keywords": "tfidf"},
+//	      "serve":   {"cluster-threshold": 0.85}
+//	    }
+//	  }
+//	}
+type Config struct {
+	DefaultProfile string             `json:"default_profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// Profile holds flag values by command name
+type Profile map[string]map[string]interface{}
+
+// configPaths lists where the config file is looked for when --config is
+// not given, in order
+func configPaths() []string {
+	paths := []string{"bluffy.json"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "bluffy", "config.json"))
+	}
+	return paths
+}
+
+// loadConfig reads the config file at path, or the first file found in the
+// default locations if path is empty. It returns nil if no file exists.
+func loadConfig(path string) (*Config, string, error) {
+	candidates := configPaths()
+	if path != "" {
+		candidates = []string{path}
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if os.IsNotExist(err) && path == "" {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var config Config
+		if err := decoder.Decode(&config); err != nil {
+			return nil, "", fmt.Errorf("failed to parse config file %s: %w", candidate, err)
+		}
+		return &config, candidate, nil
+	}
+
+	return nil, "", nil
+}
+
+// applyProfile sets the flags of cmd from the selected profile. Flags given
+// on the command line always win over the profile.
+func applyProfile(cmd *cobra.Command, configPath, profileName string) error {
+	config, path, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		if profileName != "" {
+			return fmt.Errorf("profile %q requested but no config file found (looked in %s)", profileName, strings.Join(configPaths(), ", "))
+		}
+		return nil
+	}
+
+	if profileName == "" {
+		profileName = config.DefaultProfile
+	}
+	if profileName == "" {
+		return nil
+	}
+
+	profile, ok := config.Profiles[profileName]
+	if !ok {
+		names := make([]string, 0, len(config.Profiles))
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile %q not found in %s (available: %s)", profileName, path, strings.Join(names, ", "))
+	}
+
+	// Command-specific values override values for all commands
+	for name, value := range profile[allCommands] {
+		if cmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		if err := setProfileFlag(cmd, name, value); err != nil {
+			return fmt.Errorf("profile %q: %w", profileName, err)
+		}
+	}
+	for name, value := range profile[cmd.Name()] {
+		if cmd.Flags().Lookup(name) == nil {
+			return fmt.Errorf("profile %q: %s has no --%s flag", profileName, cmd.Name(), name)
+		}
+		if err := setProfileFlag(cmd, name, value); err != nil {
+			return fmt.Errorf("profile %q: %w", profileName, err)
+		}
+	}
+
+	return nil
+}
+
+// setProfileFlag sets a flag from a profile value unless it was given on
+// the command line. Setting the value directly leaves flag.Changed false,
+// so a command-specific value can still replace one set for all commands.
+func setProfileFlag(cmd *cobra.Command, name string, value interface{}) error {
+	flag := cmd.Flags().Lookup(name)
+	if flag.Changed {
+		return nil
+	}
+
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		values := make([]string, len(list))
+		for i, v := range list {
+			values[i] = fmt.Sprint(v)
+		}
+		return slice.Replace(values)
+	}
+
+	if err := flag.Value.Set(fmt.Sprint(value)); err != nil {
+		return fmt.Errorf("invalid value %v for --%s: %w", value, name, err)
+	}
+	return nil
+}
+
+// reloadProfile reads the config file again and re-applies the selected
+// profile to cmd. Flags not given on the command line are reset to their
+// defaults first, so settings removed from the file don't linger.
+func reloadProfile(cmd *cobra.Command, configPath, profileName string) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || err != nil {
+			return
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			values, parseErr := sliceDefault(flag.DefValue)
+			if parseErr == nil {
+				parseErr = slice.Replace(values)
+			}
+			if parseErr != nil {
+				err = fmt.Errorf("failed to reset --%s: %w", flag.Name, parseErr)
+			}
+			return
+		}
+		if flag.Value.Type() == "stringToString" {
+			// Profiles can't set maps, so these only ever come from the
+			// command line
+			return
+		}
+		if setErr := flag.Value.Set(flag.DefValue); setErr != nil {
+			err = fmt.Errorf("failed to reset --%s: %w", flag.Name, setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return applyProfile(cmd, configPath, profileName)
+}
+
+// sliceDefault parses the default of a slice flag, which pflag records as
+// its values in CSV between brackets, such as [GET,POST]
+func sliceDefault(defValue string) ([]string, error) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(defValue, "["), "]")
+	if inner == "" {
+		return nil, nil
+	}
+	return csv.NewReader(strings.NewReader(inner)).Read()
+}
+
+// flagValues returns the value of every flag of cmd by name
+func flagValues(cmd *cobra.Command) map[string]string {
+	values := make(map[string]string)
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		values[flag.Name] = flag.Value.String()
+	})
+	return values
+}
+
+// writeConfig writes config to path, creating its directory if needed
+func writeConfig(path string, config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// saveProfileWorkers records workers as process.embed-workers in the
+// selected profile, creating the config file and profile if needed. Without a
+// selected profile it uses the file's default profile, or creates one
+// named "default" and makes it the default. It returns the file and
+// profile written.
+func saveProfileWorkers(configPath, profileName string, workers int) (string, string, error) {
+	config, path, err := loadConfig(configPath)
+	if err != nil {
+		return "", "", err
+	}
+	if config == nil {
+		config = &Config{}
+		path = configPath
+		if path == "" {
+			paths := configPaths()
+			path = paths[len(paths)-1]
+		}
+	}
+
+	if profileName == "" {
+		profileName = config.DefaultProfile
+	}
+	if profileName == "" {
+		profileName = "default"
+		config.DefaultProfile = profileName
+	}
+
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]Profile)
+	}
+	profile := config.Profiles[profileName]
+	if profile == nil {
+		profile = make(Profile)
+		config.Profiles[profileName] = profile
+	}
+	if profile["process"] == nil {
+		profile["process"] = make(map[string]interface{})
+	}
+	profile["process"]["embed-workers"] = workers
+
+	if err := writeConfig(path, config); err != nil {
+		return "", "", err
+	}
+	return path, profileName, nil
+}
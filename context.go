@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// defaultContextChunks is how many chunks /api/chunks/{id}/context adds on
+// each side, and maxContextChunks the most it allows
+const (
+	defaultContextChunks = 2
+	maxContextChunks     = 20
+)
+
+// minContextOverlap is the shortest repeated text dropped when neighboring
+// chunks are joined, so a chunk starting with the word its predecessor
+// ends with isn't mistaken for overlap
+const minContextOverlap = 20
+
+// ChunkContext is a chunk with the chunks around it in its document
+type ChunkContext struct {
+	Chunk  Node   `json:"chunk"`
+	Before []Node `json:"before"`
+	After  []Node `json:"after"`
+	// Text joins the text of Before, Chunk and After in order, without
+	// the overlap repeated between consecutive chunks
+	Text string `json:"text"`
+}
+
+// handleChunkContext serves GET /api/chunks/{id}/context?before=2&after=2
+func (s *APIServer) handleChunkContext(w http.ResponseWriter, r *http.Request, id int) {
+	before, err := contextCount(r, "before")
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, err := contextCount(r, "after")
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunk, err := db.GetChunk(id)
+	if errors.Is(err, database.ErrChunkNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	preceding, following, err := db.GetAdjacentChunks(*chunk, before, after)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := ChunkContext{
+		Chunk:  newNode(*chunk),
+		Before: make([]Node, len(preceding)),
+		After:  make([]Node, len(following)),
+	}
+	texts := make([]string, 0, len(preceding)+1+len(following))
+	for i, c := range preceding {
+		result.Before[i] = newNode(c)
+		texts = append(texts, c.Text)
+	}
+	texts = append(texts, chunk.Text)
+	for i, c := range following {
+		result.After[i] = newNode(c)
+		texts = append(texts, c.Text)
+	}
+	result.Text = joinChunkTexts(texts)
+
+	respondWithJSON(w, result)
+}
+
+// contextCount reads the before or after parameter
+func contextCount(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultContextChunks, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > maxContextChunks {
+		return 0, fmt.Errorf("invalid %s parameter: must be between 0 and %d", name, maxContextChunks)
+	}
+	return n, nil
+}
+
+// joinChunkTexts joins consecutive chunks into one text. Chunks overlap by
+// up to --chunk-overlap characters, so the start of each chunk that repeats
+// the end of the one before is dropped.
+func joinChunkTexts(texts []string) string {
+	var b strings.Builder
+	previous := ""
+	for _, text := range texts {
+		next := text[chunkOverlap(previous, text):]
+		next = strings.TrimLeftFunc(next, unicode.IsSpace)
+		if b.Len() > 0 && next != "" {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(next)
+		previous = text
+	}
+	return b.String()
+}
+
+// chunkOverlap returns the length of the longest start of next, ending at a
+// word boundary, that previous ends with
+func chunkOverlap(previous, next string) int {
+	for k := min(len(previous), len(next)); k >= minContextOverlap; k-- {
+		if k < len(next) && !unicode.IsSpace(rune(next[k])) {
+			continue
+		}
+		if strings.HasSuffix(previous, next[:k]) {
+			return k
+		}
+	}
+	return 0
+}
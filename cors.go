@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Defaults of the --cors-* flags
+var (
+	defaultCORSOrigins = []string{"*"}
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization"}
+)
+
+// corsPolicy is which browser origins may call the API, and with which
+// methods, headers and credentials
+type corsPolicy struct {
+	// origins lists the allowed origins; "*" allows any and an empty list
+	// sends no CORS headers at all
+	origins     []string
+	credentials bool
+	methods     []string
+	headers     []string
+}
+
+// cors is the policy of every enableCORS handler. serve sets it when it
+// starts and on each reload, like the database settings.
+var cors atomic.Pointer[corsPolicy]
+
+func init() {
+	cors.Store(&corsPolicy{origins: defaultCORSOrigins, methods: defaultCORSMethods, headers: defaultCORSHeaders})
+}
+
+// newCORSPolicy checks the --cors-* flags of opts
+func newCORSPolicy(opts serveOptions) (*corsPolicy, error) {
+	policy := &corsPolicy{credentials: opts.corsCredentials}
+	for _, origin := range opts.corsOrigins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			policy.origins = append(policy.origins, origin)
+		}
+	}
+	for _, method := range opts.corsMethods {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			policy.methods = append(policy.methods, method)
+		}
+	}
+	for _, header := range opts.corsHeaders {
+		if header = strings.TrimSpace(header); header != "" {
+			policy.headers = append(policy.headers, http.CanonicalHeaderKey(header))
+		}
+	}
+
+	if policy.credentials {
+		if len(policy.origins) == 0 {
+			return nil, fmt.Errorf("--cors-credentials needs --cors-origins")
+		}
+		for _, origin := range policy.origins {
+			if origin == "*" {
+				return nil, fmt.Errorf("--cors-credentials can't be combined with --cors-origins *, which would let any site make requests with your users' cookies; list the origins instead")
+			}
+		}
+	}
+	return policy, nil
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or empty if the origin isn't allowed
+func (p *corsPolicy) allowedOrigin(origin string) string {
+	for _, allowed := range p.origins {
+		switch {
+		case allowed == "*" && !p.credentials:
+			return "*"
+		case allowed == "*", strings.EqualFold(allowed, origin):
+			return origin
+		}
+	}
+	return ""
+}
+
+// preflightAllowed reports whether the method and headers a preflight
+// request asks for are all allowed
+func (p *corsPolicy) preflightAllowed(r *http.Request) bool {
+	if method := r.Header.Get("Access-Control-Request-Method"); method != "" && !containsFold(p.methods, method) {
+		return false
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" && !containsFold(p.headers, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// enableCORS answers preflight requests and adds the CORS headers of the
+// serve policy to responses for allowed origins. Requests from other
+// origins are still served, without the headers, so browsers don't let
+// the page read them; preflights from them are refused.
+func enableCORS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy := cors.Load()
+		origin := r.Header.Get("Origin")
+		allowed := policy.allowedOrigin(origin)
+		if allowed != "*" && len(policy.origins) > 0 {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if allowed != "" && origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if policy.credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.headers, ", "))
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			if preflight && (allowed == "" || !policy.preflightAllowed(r)) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// csvFlushRows is how many rows are written between flushes, so large
+// exports reach the client while they are being read from the database
+const csvFlushRows = 500
+
+// csvColumn is a column of a CSV export. Text columns hold user text and
+// are guarded against spreadsheet formula injection.
+type csvColumn[T any] struct {
+	name  string
+	text  bool
+	value func(T) string
+}
+
+var chunkCSVColumns = []csvColumn[database.TextChunk]{
+	{name: "id", value: func(c database.TextChunk) string { return strconv.Itoa(c.ID) }},
+	{name: "stable_id", value: func(c database.TextChunk) string { return c.StableID }},
+	{name: "run_id", value: func(c database.TextChunk) string { return strconv.Itoa(c.RunID) }},
+	{name: "index", value: func(c database.TextChunk) string { return strconv.Itoa(c.ChunkIndex) }},
+	{name: "section", text: true, value: func(c database.TextChunk) string { return c.Section }},
+	{name: "language", value: func(c database.TextChunk) string { return c.Language }},
+	{name: "summary", text: true, value: func(c database.TextChunk) string { return c.Summary }},
+	{name: "text", text: true, value: func(c database.TextChunk) string { return c.Text }},
+	{name: "summary_sentence", text: true, value: func(c database.TextChunk) string { return c.SummarySentence }},
+	{name: "summary_paragraph", text: true, value: func(c database.TextChunk) string { return c.SummaryParagraph }},
+	{name: "summary_bullets", text: true, value: func(c database.TextChunk) string { return c.SummaryBullets }},
+	{name: "outlier", value: func(c database.TextChunk) string { return strconv.FormatBool(c.IsOutlier) }},
+	{name: "version", value: func(c database.TextChunk) string { return strconv.Itoa(c.Version) }},
+	{name: "redacted", value: func(c database.TextChunk) string { return strconv.FormatBool(c.Redacted) }},
+	{name: "speaker", text: true, value: func(c database.TextChunk) string { return c.Speaker }},
+	{name: "start_seconds", value: func(c database.TextChunk) string { return csvOptionalFloat(c.StartSeconds) }},
+	{name: "end_seconds", value: func(c database.TextChunk) string { return csvOptionalFloat(c.EndSeconds) }},
+	{name: "token_count", value: func(c database.TextChunk) string { return strconv.Itoa(c.TokenCount) }},
+	{name: "sentiment", value: func(c database.TextChunk) string { return csvOptionalFloat(c.Sentiment) }},
+	{name: "title", text: true, value: func(c database.TextChunk) string { return c.Title }},
+	{name: "kind", value: func(c database.TextChunk) string { return c.Kind }},
+	{name: "summary_language", value: func(c database.TextChunk) string { return c.SummaryLanguage }},
+}
+
+// defaultChunkCSVColumns are exported when ?columns= is not given
+var defaultChunkCSVColumns = []string{"id", "index", "section", "language", "summary", "text"}
+
+// similarityCSVRow is a similarity with the summaries of its chunks, which
+// are only looked up when the summary columns are selected
+type similarityCSVRow struct {
+	database.ChunkSimilarity
+	summaries map[int]string
+}
+
+var similarityCSVColumns = []csvColumn[similarityCSVRow]{
+	{name: "id", value: func(s similarityCSVRow) string { return strconv.Itoa(s.ID) }},
+	{name: "chunk_id_1", value: func(s similarityCSVRow) string { return strconv.Itoa(s.ChunkID1) }},
+	{name: "chunk_id_2", value: func(s similarityCSVRow) string { return strconv.Itoa(s.ChunkID2) }},
+	{name: "similarity", value: func(s similarityCSVRow) string { return strconv.FormatFloat(s.Similarity, 'f', -1, 64) }},
+	{name: "distance", value: func(s similarityCSVRow) string { return strconv.FormatFloat(s.Distance, 'f', -1, 64) }},
+	{name: "summary_1", text: true, value: func(s similarityCSVRow) string { return s.summaries[s.ChunkID1] }},
+	{name: "summary_2", text: true, value: func(s similarityCSVRow) string { return s.summaries[s.ChunkID2] }},
+}
+
+var defaultSimilarityCSVColumns = []string{"chunk_id_1", "chunk_id_2", "similarity", "summary_1", "summary_2"}
+
+// selectCSVColumns returns the columns named by ?columns=, or the defaults
+func selectCSVColumns[T any](r *http.Request, all []csvColumn[T], defaults []string) ([]csvColumn[T], error) {
+	names := defaults
+	if param := r.URL.Query().Get("columns"); param != "" {
+		names = strings.Split(param, ",")
+	}
+
+	byName := make(map[string]csvColumn[T], len(all))
+	valid := make([]string, len(all))
+	for i, column := range all {
+		byName[column.name] = column
+		valid[i] = column.name
+	}
+
+	selected := make([]csvColumn[T], 0, len(names))
+	for _, name := range names {
+		column, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (valid columns: %s)", name, strings.Join(valid, ", "))
+		}
+		selected = append(selected, column)
+	}
+	return selected, nil
+}
+
+// csvWriter writes rows of the selected columns to a CSV response
+type csvWriter[T any] struct {
+	columns []csvColumn[T]
+	writer  *csv.Writer
+	record  []string
+	rows    int
+}
+
+// newCSVWriter starts a CSV download and writes the header. The response
+// starts with a UTF-8 byte order mark so Excel doesn't read it as ANSI, and
+// uses CRLF line endings as RFC 4180 specifies.
+func newCSVWriter[T any](w http.ResponseWriter, filename string, columns []csvColumn[T]) (*csvWriter[T], error) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+
+	cw := &csvWriter[T]{columns: columns, writer: csv.NewWriter(w), record: make([]string, len(columns))}
+	cw.writer.UseCRLF = true
+	for i, column := range columns {
+		cw.record[i] = column.name
+	}
+	return cw, cw.writer.Write(cw.record)
+}
+
+func (cw *csvWriter[T]) write(row T) error {
+	for i, column := range cw.columns {
+		value := column.value(row)
+		if column.text {
+			value = escapeCSVFormula(value)
+		}
+		cw.record[i] = value
+	}
+	if err := cw.writer.Write(cw.record); err != nil {
+		return err
+	}
+	cw.rows++
+	if cw.rows%csvFlushRows == 0 {
+		cw.writer.Flush()
+		return cw.writer.Error()
+	}
+	return nil
+}
+
+func (cw *csvWriter[T]) close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// escapeCSVFormula prefixes text that a spreadsheet would evaluate as a
+// formula with an apostrophe, which Excel and LibreOffice hide
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func csvOptionalFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// handleChunksCSV serves GET /api/chunks.csv: every chunk, in the columns
+// named by ?columns= and optionally limited to ?language=
+func (s *APIServer) handleChunksCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	columns, err := selectCSVColumns(r, chunkCSVColumns, defaultChunkCSVColumns)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	languages := parseLanguages(r.URL.Query())
+
+	// Errors past this point happen mid-response, once the status is sent
+	cw, err := newCSVWriter(w, "chunks.csv", columns)
+	if err == nil {
+		for _, chunk := range chunks {
+			if languages != nil && !languages[chunk.Language] {
+				continue
+			}
+			if err = cw.write(chunk); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = cw.close()
+	}
+	if err != nil {
+		log.Printf("Error writing chunks CSV: %v", err)
+	}
+}
+
+// handleSimilaritiesCSV serves GET /api/similarities.csv: the similarity
+// rows at or above ?min_similarity=, most similar first, streamed from the
+// database
+func (s *APIServer) handleSimilaritiesCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	columns, err := selectCSVColumns(r, similarityCSVColumns, defaultSimilarityCSVColumns)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minSimilarity := math.Inf(-1)
+	if value := r.URL.Query().Get("min_similarity"); value != "" {
+		if minSimilarity, err = strconv.ParseFloat(value, 64); err != nil {
+			respondWithError(w, "invalid min_similarity parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	var summaries map[int]string
+	for _, column := range columns {
+		if column.name != "summary_1" && column.name != "summary_2" {
+			continue
+		}
+		chunks, err := db.GetAllChunks()
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+			return
+		}
+		summaries = make(map[int]string, len(chunks))
+		for _, chunk := range chunks {
+			summaries[chunk.ID] = chunk.Summary
+		}
+		break
+	}
+
+	cw, err := newCSVWriter(w, "similarities.csv", columns)
+	if err == nil {
+		err = db.EachSimilarity(minSimilarity, func(sim database.ChunkSimilarity) error {
+			return cw.write(similarityCSVRow{ChunkSimilarity: sim, summaries: summaries})
+		})
+	}
+	if err == nil {
+		err = cw.close()
+	}
+	if err != nil {
+		log.Printf("Error writing similarities CSV: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// addDebugSQLFlag registers --debug-sql on commands that read or write
+// databases
+func addDebugSQLFlag(cmd *cobra.Command, debug *bool) {
+	cmd.Flags().BoolVar(debug, "debug-sql", false, "Log every SQL statement with its duration and row count to stderr, and the totals and slowest statement whenever a database is closed")
+}
+
+// useQueryLogger logs the statements of every database opened afterwards
+// if debug is set. A serve reload without --debug-sql turns it off.
+func useQueryLogger(debug bool) {
+	if !debug {
+		database.SetQueryLogger(nil)
+		return
+	}
+	database.SetQueryLogger(log.New(os.Stderr, "", log.LstdFlags))
+}
+
+// statusRecorder remembers the status a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps /api/events streaming
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// logRequests logs every request with its status and duration once it is
+// handled. Handlers open and close their database while handling a
+// request, so with --debug-sql its statements and totals are logged just
+// before it.
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		log.Printf("%s %s: %d in %s", r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Microsecond))
+	})
+}
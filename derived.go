@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+)
+
+// derivedData is analysis computed from the database ahead of time so that
+// requests don't have to recompute it
+type derivedData struct {
+	ComputedAt       time.Time            `json:"computed_at"`
+	ClusterThreshold float64              `json:"cluster_threshold"`
+	Stats            analysis.CorpusStats `json:"stats"`
+	Clusters         []analysis.Cluster   `json:"clusters"`
+	// Centrality is keyed by chunk ID, at ClusterThreshold
+	Centrality map[int]analysis.Centrality `json:"-"`
+}
+
+// derivedEvent is posted to webhooks whenever derived data is refreshed
+type derivedEvent struct {
+	Event      string               `json:"event"`
+	Database   string               `json:"database"`
+	ComputedAt time.Time            `json:"computed_at"`
+	Stats      analysis.CorpusStats `json:"stats"`
+	Clusters   int                  `json:"clusters"`
+}
+
+const derivedRefreshedEvent = "derived_data.refreshed"
+
+// parseSchedule accepts a Go duration ("15m") or a cron-style descriptor:
+// @hourly, @daily, @weekly, or "@every <duration>"
+func parseSchedule(spec string) (time.Duration, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "":
+		return 0, nil
+	case "@hourly":
+		return time.Hour, nil
+	case "@daily", "@midnight":
+		return 24 * time.Hour, nil
+	case "@weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every")))
+	if err != nil {
+		return 0, fmt.Errorf("invalid refresh schedule %q: use a duration like 15m, \"@every 1h\", @hourly, @daily or @weekly", spec)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("refresh interval must be positive, got %s", interval)
+	}
+	return interval, nil
+}
+
+// scheduleRefresh recomputes derived data now and then at every interval
+func (s *APIServer) scheduleRefresh(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.refreshDerived(); err != nil {
+				log.Printf("Scheduled refresh failed: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// refreshDerived recomputes stats and clusters, then notifies webhooks
+func (s *APIServer) refreshDerived() (*derivedData, error) {
+	db, err := s.openDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+	similarities, err := db.GetAllSimilarities()
+	if err != nil {
+		return nil, err
+	}
+	metric, err := db.SimilarityMetric()
+	if err != nil {
+		return nil, err
+	}
+	if metric == "" {
+		metric = similarity.MetricCosine
+	}
+	projection, err := db.Projection()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &derivedData{
+		ComputedAt:       time.Now().UTC(),
+		ClusterThreshold: s.clusterThreshold,
+		Stats:            analysis.ComputeStats(chunks, similarities),
+		Clusters:         analysis.FindClusters(chunks, similarities, s.clusterThreshold),
+	}
+	data.Stats.SimilarityMetric = metric
+	data.Stats.Projection = projection
+	data.Centrality = make(map[int]analysis.Centrality, len(chunks))
+	for _, c := range analysis.AnalyzeGraph(chunks, similarities, s.clusterThreshold).Centrality {
+		data.Centrality[c.ChunkID] = c
+	}
+
+	s.derivedMu.Lock()
+	s.derived = data
+	s.derivedMu.Unlock()
+
+	log.Printf("Refreshed derived data: %d chunks, %d clusters", data.Stats.Chunks, len(data.Clusters))
+	s.notifyWebhooks(derivedEvent{
+		Event:      derivedRefreshedEvent,
+		Database:   s.dbPath,
+		ComputedAt: data.ComputedAt,
+		Stats:      data.Stats,
+		Clusters:   len(data.Clusters),
+	})
+
+	return data, nil
+}
+
+// currentDerived returns the latest derived data, computing it if no
+// refresh has happened yet
+func (s *APIServer) currentDerived() (*derivedData, error) {
+	s.derivedMu.RLock()
+	data := s.derived
+	s.derivedMu.RUnlock()
+
+	if data != nil {
+		return data, nil
+	}
+	return s.refreshDerived()
+}
+
+func (s *APIServer) notifyWebhooks(event derivedEvent) {
+	if len(s.webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode webhook event: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, url := range s.webhooks {
+		go func(url string) {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+			if err != nil {
+				log.Printf("Webhook %s failed: %v", url, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				log.Printf("Webhook %s responded with status %d", url, resp.StatusCode)
+			}
+		}(url)
+	}
+}
+
+// addNodeMetrics sets the degree of graph nodes from the similarity links
+// returned with them, and their precomputed centrality
+func (s *APIServer) addNodeMetrics(nodes []Node, links []Link) error {
+	data, err := s.currentDerived()
+	if err != nil {
+		return err
+	}
+
+	degree := make(map[int]int, len(nodes))
+	weighted := make(map[int]float64, len(nodes))
+	for _, link := range links {
+		if link.Type != database.EdgeTypeSimilarity {
+			continue
+		}
+		for _, id := range []int{link.Source, link.Target} {
+			degree[id]++
+			weighted[id] += link.Similarity
+		}
+	}
+	for i := range nodes {
+		id := nodes[i].ID
+		nodes[i].Degree = degree[id]
+		nodes[i].WeightedDegree = weighted[id]
+		nodes[i].Betweenness = data.Centrality[id].Betweenness
+		nodes[i].Eigenvector = data.Centrality[id].Eigenvector
+	}
+	return nil
+}
+
+func (s *APIServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := s.currentDerived()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to compute stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, map[string]interface{}{
+		"computed_at": data.ComputedAt,
+		"stats":       data.Stats,
+	})
+}
+
+func (s *APIServer) handleClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := s.currentDerived()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to compute clusters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, map[string]interface{}{
+		"computed_at": data.ComputedAt,
+		"threshold":   data.ClusterThreshold,
+		"clusters":    data.Clusters,
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+	"github.com/spf13/cobra"
+)
+
+// diffOptions holds the settings for comparing a file with its stored run.
+// The chunking options must match those the run was processed with.
+type diffOptions struct {
+	dbPath  string
+	runName string
+	process processOptions
+}
+
+// Kinds of chunk changes
+const (
+	chunkUnchanged = "unchanged"
+	chunkChanged   = "changed"
+	chunkAdded     = "added"
+	chunkDeleted   = "deleted"
+)
+
+// chunkChange is a chunk of the file, of the stored run, or of both
+type chunkChange struct {
+	Kind string
+	// Stored is the chunk in the database; nil for added chunks
+	Stored *database.TextChunk
+	// Updated is the chunk of the file; nil for deleted chunks
+	Updated *database.TextChunk
+}
+
+func createDiffCommand() *cobra.Command {
+	var opts diffOptions
+
+	cmd := &cobra.Command{
+		Use:   "diff <database.db>",
+		Short: "Show which stored chunks an edited file would change",
+		Long:  "Chunk an edited source file the way process does and compare it with the chunks stored for it, by the content hashes of their text (stable IDs), to see which chunks would change, be added or be deleted before re-processing. Nothing is embedded or written. The file is compared with the latest run processed from a file of the same name, or with --run; pass the chunking flags the run was processed with.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runDiff(os.Stdout, opts); err != nil {
+				log.Fatalf("Error comparing file: %v", err)
+			}
+		},
+	}
+
+	p := &opts.process
+	cmd.Flags().StringVarP(&p.inputFile, "file", "f", "", "Edited input file")
+	cmd.Flags().StringVar(&opts.runName, "run", "", "Run to compare with (default: the latest run processed from a file of the same name)")
+	cmd.Flags().IntVar(&p.chunkSize, "chunk-size", textproc.DefaultChunkOptions.Size, "Maximum chunk size in characters")
+	cmd.Flags().IntVar(&p.chunkOverlap, "chunk-overlap", textproc.DefaultChunkOptions.Overlap, "Characters shared between consecutive chunks")
+	cmd.Flags().DurationVar(&p.transcriptWindow, "transcript-window", 0, "Chunk transcripts into time windows of this length")
+	cmd.Flags().BoolVar(&p.notebookCode, "notebook-code", false, "Also chunk the code cells of Jupyter notebooks")
+	cmd.Flags().BoolVar(&p.transcode, "transcode", false, "Convert UTF-16 and Latin-1 input to UTF-8 instead of rejecting it")
+	cmd.Flags().StringSliceVar(&p.redact, "redact", nil, "Mask personal data as process does: email, phone, ssn, or all")
+	cmd.Flags().StringArrayVar(&p.redactPatterns, "redact-pattern", nil, "Also mask matches of this regular expression (repeatable)")
+	cmd.Flags().IntVar(&p.minChunkLength, "min-chunk-length", 0, "Skip chunks shorter than this many characters")
+	cmd.Flags().StringArrayVar(&p.skipPatterns, "skip-pattern", nil, "Skip chunks whose whole text matches this regular expression (repeatable)")
+	cmd.Flags().Float64Var(&p.minLetterRatio, "min-letter-ratio", 0, "Skip chunks in which letters make up less than this share of the characters")
+	cmd.Flags().BoolVar(&p.skipStopwordOnly, "skip-stopword-only", false, "Skip chunks whose words are all stopwords")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+func runDiff(out io.Writer, opts diffOptions) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	report, err := readInput(opts.process.inputFile, opts.process)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	run, err := diffRun(db, opts)
+	if err != nil {
+		return err
+	}
+	stored, err := db.GetChunksByRun(run.ID)
+	if err != nil {
+		return err
+	}
+	// Passages are split from their chunk, not from the file
+	chunks := stored[:0]
+	for _, chunk := range stored {
+		if chunk.ParentID == 0 {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	changes := diffChunks(chunks, report.Chunks)
+	printChunkChanges(out, opts.process.inputFile, run, len(chunks), len(report.Chunks), changes)
+	return nil
+}
+
+// diffRun returns the run named by --run, or else the latest run whose
+// source is the file, or a file of the same name
+func diffRun(db *database.DB, opts diffOptions) (*database.Run, error) {
+	if opts.runName != "" {
+		return db.GetRunByName(opts.runName)
+	}
+	runs, err := db.GetRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	path := opts.process.inputFile
+	abs, _ := filepath.Abs(path)
+	var sameName *database.Run
+	// Runs are ordered by ID, so later matches are more recent
+	for i := range runs {
+		run := &runs[i]
+		if run.Source == "" {
+			continue
+		}
+		if runAbs, _ := filepath.Abs(run.Source); run.Source == path || runAbs == abs {
+			return latestRunFrom(runs[i:], run.Source), nil
+		}
+		if documentName(*run) == filepath.Base(path) {
+			sameName = run
+		}
+	}
+	if sameName == nil {
+		return nil, fmt.Errorf("no run of %s was found in %s; name the run to compare with --run", filepath.Base(path), opts.dbPath)
+	}
+	return sameName, nil
+}
+
+// latestRunFrom returns the last of runs processed from source
+func latestRunFrom(runs []database.Run, source string) *database.Run {
+	var latest *database.Run
+	for i := range runs {
+		if runs[i].Source == source {
+			latest = &runs[i]
+		}
+	}
+	return latest
+}
+
+// diffChunks pairs the chunks of a file with the stored chunks of its run.
+// Chunks with the same stable ID are unchanged wherever they moved; of the
+// rest, a file chunk and a stored chunk at the same index are a change,
+// and the others were added to or deleted from the file. Changes are
+// ordered by their index in the file, then in the run.
+func diffChunks(stored, updated []database.TextChunk) []chunkChange {
+	byStableID := make(map[string][]int)
+	for i, chunk := range stored {
+		id := chunk.StableID
+		if id == "" {
+			id = database.StableID(chunk.Text)
+		}
+		byStableID[id] = append(byStableID[id], i)
+	}
+
+	matched := make([]bool, len(stored))
+	var changes []chunkChange
+	var unmatched []int
+	for i := range updated {
+		id := database.StableID(updated[i].Text)
+		if candidates := byStableID[id]; len(candidates) > 0 {
+			byStableID[id] = candidates[1:]
+			matched[candidates[0]] = true
+			changes = append(changes, chunkChange{Kind: chunkUnchanged, Stored: &stored[candidates[0]], Updated: &updated[i]})
+			continue
+		}
+		unmatched = append(unmatched, i)
+	}
+
+	remaining := make(map[int]int)
+	for i, chunk := range stored {
+		if !matched[i] {
+			remaining[chunk.ChunkIndex] = i
+		}
+	}
+	for _, i := range unmatched {
+		if j, ok := remaining[updated[i].ChunkIndex]; ok {
+			delete(remaining, updated[i].ChunkIndex)
+			changes = append(changes, chunkChange{Kind: chunkChanged, Stored: &stored[j], Updated: &updated[i]})
+			continue
+		}
+		changes = append(changes, chunkChange{Kind: chunkAdded, Updated: &updated[i]})
+	}
+	for _, j := range remaining {
+		changes = append(changes, chunkChange{Kind: chunkDeleted, Stored: &stored[j]})
+	}
+
+	sort.SliceStable(changes, func(a, b int) bool {
+		return changeIndex(changes[a]) < changeIndex(changes[b])
+	})
+	return changes
+}
+
+// changeIndex orders a change by where it is in the file, or for deleted
+// chunks where it was
+func changeIndex(change chunkChange) int {
+	if change.Updated != nil {
+		return change.Updated.ChunkIndex
+	}
+	return change.Stored.ChunkIndex
+}
+
+func printChunkChanges(out io.Writer, path string, run *database.Run, storedCount, fileCount int, changes []chunkChange) {
+	counts := make(map[string]int)
+	for _, change := range changes {
+		counts[change.Kind]++
+	}
+
+	fmt.Fprintf(out, "Comparing %s (%d chunks) with run %q (%d chunks)\n", path, fileCount, run.Name, storedCount)
+	fmt.Fprintf(out, "Unchanged: %d\n", counts[chunkUnchanged])
+	fmt.Fprintf(out, "Changed:   %d\n", counts[chunkChanged])
+	fmt.Fprintf(out, "Added:     %d\n", counts[chunkAdded])
+	fmt.Fprintf(out, "Deleted:   %d\n", counts[chunkDeleted])
+	if counts[chunkUnchanged] == len(changes) {
+		fmt.Fprintln(out, "\nNo changes; re-processing would store the same chunks")
+		return
+	}
+
+	fmt.Fprintln(out)
+	for _, change := range changes {
+		switch change.Kind {
+		case chunkChanged:
+			fmt.Fprintf(out, "~ chunk %d (id %d)\n", change.Updated.ChunkIndex, change.Stored.ID)
+			fmt.Fprintf(out, "    was: %s\n", diffPreview(*change.Stored))
+			fmt.Fprintf(out, "    now: %s\n", diffPreview(*change.Updated))
+		case chunkAdded:
+			fmt.Fprintf(out, "+ chunk %d: %s\n", change.Updated.ChunkIndex, diffPreview(*change.Updated))
+		case chunkDeleted:
+			fmt.Fprintf(out, "- chunk %d (id %d): %s\n", change.Stored.ChunkIndex, change.Stored.ID, diffPreview(*change.Stored))
+		}
+	}
+}
+
+// diffPreview shortens a chunk's text, rather than its summary, which
+// edits often leave the same
+func diffPreview(chunk database.TextChunk) string {
+	return preview(database.TextChunk{Text: chunk.Text}, 80)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// Rough per-item storage costs used to estimate database size. Embeddings
+// are stored as JSON, so each nomic-embed-text dimension costs about 20 bytes.
+const (
+	estimatedEmbeddingDims   = 768
+	estimatedBytesPerDim     = 20
+	estimatedSummaryBytes    = 300
+	estimatedChunkRowBytes   = 64
+	estimatedSimilarityBytes = 48
+)
+
+// printChunkingPlan reports what processing a file would do with the current
+// chunking options, without contacting Ollama
+func printChunkingPlan(report *textproc.ValidationReport, opts processOptions) {
+	n := len(report.Chunks)
+	lengths := make([]int, n)
+	textBytes := 0
+	for i, chunk := range report.Chunks {
+		lengths[i] = len(chunk.Text)
+		textBytes += lengths[i]
+	}
+	sort.Ints(lengths)
+
+	percentile := func(p int) int {
+		return lengths[(n-1)*p/100]
+	}
+
+	llmCalls := n
+	switch {
+	case opts.summaryMode == summaryModeStatistical:
+		llmCalls = 0
+	case opts.summaryBatch > 1:
+		// At least; batches also close early once their text gets long
+		llmCalls = (n + opts.summaryBatch - 1) / opts.summaryBatch
+	}
+	for _, style := range opts.summaryStyles {
+		if style != embedding.SummaryTopic {
+			llmCalls += n
+		}
+	}
+	if opts.keywordMethod == keywordMethodLLM {
+		llmCalls += n
+	}
+	similarityRows := n * (n - 1) / 2
+
+	dbBytes := textBytes +
+		n*(estimatedEmbeddingDims*estimatedBytesPerDim+estimatedSummaryBytes+estimatedChunkRowBytes) +
+		similarityRows*estimatedSimilarityBytes
+
+	fmt.Println("Dry run: nothing will be embedded or written")
+	fmt.Printf("File:            %s (%d bytes)\n", report.Path, report.Size)
+	switch {
+	case textproc.IsTranscript(report.Format) && opts.transcriptWindow > 0:
+		fmt.Printf("Chunking:        %s windows of cues, at most %d characters\n", opts.transcriptWindow, opts.chunkSize)
+	case textproc.IsTranscript(report.Format):
+		fmt.Printf("Chunking:        speaker turns, at most %d characters\n", opts.chunkSize)
+	default:
+		fmt.Printf("Chunking:        size %d, overlap %d characters\n", opts.chunkSize, opts.chunkOverlap)
+	}
+	fmt.Printf("Chunks:          %d\n", n)
+	if skipped := report.Skipped.Total(); skipped > 0 {
+		fmt.Printf("Skipped chunks:  %d (%s)\n", skipped, describeSkipped(report.Skipped, opts))
+	}
+	fmt.Printf("Chunk sizes:     min %d, p25 %d, median %d, p75 %d, max %d (avg %d characters)\n",
+		lengths[0], percentile(25), percentile(50), percentile(75), lengths[n-1], textBytes/n)
+	tokens := make([]int, n)
+	for i, chunk := range report.Chunks {
+		tokens[i] = chunk.TokenCount
+	}
+	sort.Ints(tokens)
+	fmt.Printf("Chunk tokens:    min %d, median %d, max %d (estimated for %s)\n", tokens[0], tokens[(n-1)/2], tokens[n-1], opts.embedder.model(opts.embeddingModel))
+	fmt.Printf("Embedding calls: %d\n", n)
+	fmt.Printf("LLM calls:       %d\n", llmCalls)
+	fmt.Printf("Similarity rows: %d\n", similarityRows)
+	fmt.Printf("Estimated size:  %s\n", formatBytes(int64(dbBytes)))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// dupesOptions holds the settings for a duplicates report
+type dupesOptions struct {
+	dbPath        string
+	threshold     float64
+	crossDocument bool
+	json          bool
+}
+
+// DuplicateGroup is the near-duplicate chunk pairs between two documents,
+// or within one when both names are the same
+type DuplicateGroup struct {
+	Document1 string          `json:"document_1"`
+	Document2 string          `json:"document_2"`
+	Pairs     []DuplicateInfo `json:"pairs"`
+}
+
+// DuplicateInfo is a near-duplicate pair with both chunks
+type DuplicateInfo struct {
+	Similarity float64 `json:"similarity"`
+	Chunk1     Node    `json:"chunk_1"`
+	Chunk2     Node    `json:"chunk_2"`
+}
+
+func createDupesCommand() *cobra.Command {
+	var opts dupesOptions
+
+	cmd := &cobra.Command{
+		Use:   "dupes <database.db>",
+		Short: "List near-duplicate chunks, grouped by document",
+		Long:  "Compare the embeddings of every pair of chunks and list the pairs at or above a similarity threshold, grouped by the documents they come from, to find copied passages and redundant notes. Only the latest run of each document is compared, so re-processing a file does not report every chunk as a copy of itself.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runDupes(os.Stdout, opts); err != nil {
+				log.Fatalf("Error finding duplicates: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().Float64VarP(&opts.threshold, "threshold", "t", 0.95, "Minimum similarity for a pair to count as near-duplicate")
+	cmd.Flags().BoolVar(&opts.crossDocument, "cross-document", false, "Only list pairs whose chunks come from different documents")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the groups as JSON")
+
+	return cmd
+}
+
+func runDupes(out io.Writer, opts dupesOptions) error {
+	if opts.threshold <= 0 || opts.threshold > 1 {
+		return fmt.Errorf("threshold must be in (0, 1], got %g", opts.threshold)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	runs, err := db.GetRuns()
+	if err != nil {
+		return err
+	}
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return err
+	}
+
+	// Runs are ordered by ID, so the last run of a document is its latest
+	runByID := make(map[int]database.Run, len(runs))
+	latest := make(map[string]int)
+	for _, run := range runs {
+		runByID[run.ID] = run
+		latest[documentName(run)] = run.ID
+	}
+
+	// Only chunks embedded with the same model can be compared
+	byModel := make(map[string][]database.TextChunk)
+	chunkByID := make(map[int]database.TextChunk, len(chunks))
+	chunkDocument := make(map[int]string, len(chunks))
+	for _, chunk := range chunks {
+		document := "(no run)"
+		if run, ok := runByID[chunk.RunID]; ok {
+			document = documentName(run)
+			if latest[document] != run.ID {
+				continue
+			}
+		}
+		chunkByID[chunk.ID] = chunk
+		chunkDocument[chunk.ID] = document
+		byModel[chunk.EmbeddingModel] = append(byModel[chunk.EmbeddingModel], chunk)
+	}
+
+	groups := make(map[[2]string]*DuplicateGroup)
+	for _, modelChunks := range byModel {
+		for _, pair := range analysis.FindDuplicates(modelChunks, opts.threshold) {
+			chunk1, chunk2 := chunkByID[pair.ChunkID1], chunkByID[pair.ChunkID2]
+			document1, document2 := chunkDocument[chunk1.ID], chunkDocument[chunk2.ID]
+			if opts.crossDocument && document1 == document2 {
+				continue
+			}
+			if document2 < document1 {
+				document1, document2 = document2, document1
+				chunk1, chunk2 = chunk2, chunk1
+			}
+
+			key := [2]string{document1, document2}
+			group, ok := groups[key]
+			if !ok {
+				group = &DuplicateGroup{Document1: document1, Document2: document2}
+				groups[key] = group
+			}
+			group.Pairs = append(group.Pairs, DuplicateInfo{
+				Similarity: pair.Similarity,
+				Chunk1:     newNode(chunk1),
+				Chunk2:     newNode(chunk2),
+			})
+		}
+	}
+
+	// Groups with the most pairs first; pairs most similar first
+	sorted := make([]DuplicateGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.SliceStable(group.Pairs, func(i, j int) bool {
+			return group.Pairs[i].Similarity > group.Pairs[j].Similarity
+		})
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].Pairs) != len(sorted[j].Pairs) {
+			return len(sorted[i].Pairs) > len(sorted[j].Pairs)
+		}
+		if sorted[i].Document1 != sorted[j].Document1 {
+			return sorted[i].Document1 < sorted[j].Document1
+		}
+		return sorted[i].Document2 < sorted[j].Document2
+	})
+
+	if opts.json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sorted)
+	}
+
+	if len(sorted) == 0 {
+		fmt.Fprintf(out, "No chunk pairs at or above %.2f similarity among %d chunks\n", opts.threshold, len(chunkByID))
+		return nil
+	}
+	for i, group := range sorted {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		count := fmt.Sprintf("%d pairs", len(group.Pairs))
+		if len(group.Pairs) == 1 {
+			count = "1 pair"
+		}
+		if group.Document1 == group.Document2 {
+			fmt.Fprintf(out, "Within %s (%s)\n", group.Document1, count)
+		} else {
+			fmt.Fprintf(out, "%s and %s (%s)\n", group.Document1, group.Document2, count)
+		}
+		for _, pair := range group.Pairs {
+			fmt.Fprintf(out, "  %.4f  chunk %d (index %d) %s\n", pair.Similarity, pair.Chunk1.ID, pair.Chunk1.Index, previewNode(pair.Chunk1, 50))
+			fmt.Fprintf(out, "          chunk %d (index %d) %s\n", pair.Chunk2.ID, pair.Chunk2.Index, previewNode(pair.Chunk2, 50))
+		}
+	}
+	return nil
+}
+
+// documentName names the document a run was processed from: the base name
+// of its source file, or the run name for runs without one (snippets,
+// captures)
+func documentName(run database.Run) string {
+	if run.Source != "" {
+		return filepath.Base(run.Source)
+	}
+	return run.Name
+}
+
+// previewNode shortens a node's text for one line of output. The text is
+// shown rather than the summary, since near-duplicates usually share one.
+func previewNode(node Node, n int) string {
+	return preview(database.TextChunk{Text: node.Text}, n)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/pipeline"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+// embedOptions holds the settings for embedding the chunks of a database
+// again
+type embedOptions struct {
+	dbPath         string
+	maxWorkers     int
+	batchSize      int
+	ollamaHost     string
+	embeddingModel string
+	runName        string
+	all            bool
+	ollama         ollamaFlags
+	embedder       embedderFlags
+}
+
+func createEmbedCommand() *cobra.Command {
+	var opts embedOptions
+
+	cmd := &cobra.Command{
+		Use:   "embed <database.db>",
+		Short: "Embed the stored chunks of a database again, with another model",
+		Long:  "Replace the embeddings of the chunks and passages of an existing database with ones from another model or provider, without re-chunking or re-summarizing anything, then recalculate the similarities as recalc does. Embeddings are stored after every --batch-size chunks with the model that computed them, so an interrupted run continues where it stopped when started again.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runEmbed(opts); err != nil {
+				log.Fatalf("Error embedding chunks: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers (0 = number of CPUs)")
+	cmd.Flags().IntVar(&opts.batchSize, "batch-size", defaultBatchSize, "Store embeddings after every this many chunks")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", embedding.DefaultEmbeddingModel, "Model used for embeddings (default with a hosted --embed-provider: the provider's)")
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only embed the chunks of this run")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Also embed chunks already embedded with the model, e.g. after the model was updated")
+	addEmbedderFlags(cmd, &opts.embedder)
+	addOllamaFlags(cmd, &opts.ollama, true)
+	addAutoPullFlag(cmd, &opts.ollama)
+
+	return cmd
+}
+
+func runEmbed(opts embedOptions) error {
+	if err := opts.embedder.validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	embedder, provider, model, err := opts.documentEmbedder(clientOptions)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Embeddings from the model are compared at full size, so a projection
+	// only survives if every chunk is embedded again
+	projection, err := db.Projection()
+	if err != nil {
+		return err
+	}
+	if projection != nil {
+		if !opts.all || opts.runName != "" {
+			return fmt.Errorf("the embeddings of %s were projected to %d dimensions; embed every chunk again at full size with --all and without --run-name", opts.dbPath, projection.Dimensions())
+		}
+		if err := db.RemoveProjection(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the %d-dimensional projection; embeddings are stored at full size\n", projection.Dimensions())
+	}
+
+	var runs []database.Run
+	if opts.runName != "" {
+		run, err := db.GetRunByName(opts.runName)
+		if err != nil {
+			return err
+		}
+		runs = []database.Run{*run}
+	} else if runs, err = db.GetRuns(); err != nil {
+		return err
+	}
+	normalized := make(map[int]bool, len(runs))
+	for _, run := range runs {
+		normalized[run.ID] = run.Normalized
+	}
+
+	chunks, err := chunksOfRun(db, opts.runName)
+	if err != nil {
+		return err
+	}
+	passages, err := db.GetPassages()
+	if err != nil {
+		return err
+	}
+	for _, passage := range passages {
+		if _, ok := normalized[passage.RunID]; ok || opts.runName == "" {
+			chunks = append(chunks, passage)
+		}
+	}
+
+	done := make(map[int]bool)
+	if !opts.all {
+		if done, err = db.ChunksEmbeddedWith(model); err != nil {
+			return err
+		}
+	}
+	var pending []database.TextChunk
+	for _, chunk := range chunks {
+		if !done[chunk.ID] {
+			pending = append(pending, chunk)
+		}
+	}
+
+	if len(pending) > 0 {
+		if checker, ok := embedder.(pipeline.Checker); ok {
+			if err := checker.Check(context.Background()); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("Embedding %d of %d chunks and passages with %s...\n", len(pending), len(chunks), model)
+		stored, err := processInBatches(pending, opts.batchSize, opts.maxWorkers, "Embeddings", func(chunk *database.TextChunk) error {
+			vector, err := embedder.Embed(context.Background(), chunk.Text)
+			if err != nil {
+				return err
+			}
+			if normalized[chunk.RunID] {
+				vector = similarity.Normalize(vector)
+			}
+			chunk.Embedding = vector
+			chunk.TokenCount = embedding.CountTokens(model, chunk.Text)
+			return nil
+		}, func(batch []database.TextChunk) error {
+			return db.SetEmbeddings(batch, model)
+		})
+		if err != nil {
+			if stored > 0 {
+				fmt.Printf("\nStored embeddings for %d of %d chunks; run the same command again to continue\n", stored, len(pending))
+			}
+			return err
+		}
+		fmt.Printf("Stored embeddings for %d chunks\n", stored)
+	} else {
+		fmt.Printf("Every chunk is already embedded with %s\n", model)
+	}
+
+	// Every chunk of the runs is now embedded with the model, so the runs
+	// record it
+	dimensions := 0
+	if len(pending) > 0 {
+		dimensions = len(pending[0].Embedding)
+	}
+	for _, run := range runs {
+		if err := db.SetRunEmbeddingModel(run.ID, model); err != nil {
+			return err
+		}
+		if dimensions == 0 {
+			continue
+		}
+		if err := db.SetRunEmbeddingInfo(run.ID, provider, dimensions); err != nil {
+			return err
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+	_, err = recalculate(recalcOptions{dbPath: opts.dbPath, keepSequential: true})
+	return err
+}
+
+// documentEmbedder returns the embedder for the stored chunks, with the
+// provider and model it records on them. Ollama is only checked for the
+// embedding model, since nothing is summarized.
+func (opts embedOptions) documentEmbedder(clientOptions embedding.ClientOptions) (pipeline.Embedder, string, string, error) {
+	if opts.embedder.hosted() {
+		client, err := opts.embedder.hostedClient(opts.embeddingModel, opts.ollama.truncate)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return &pipeline.Hosted{Client: client}, client.Provider(), client.Model(), nil
+	}
+
+	client := newOllamaClient(opts.ollamaHost, opts.embeddingModel, "", clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return nil, "", "", err
+	}
+	missing, err := client.MissingModels()
+	if err != nil {
+		return nil, "", "", err
+	}
+	if slices.Contains(missing, client.Model()) {
+		if !opts.ollama.autoPull {
+			return nil, "", "", fmt.Errorf("embedding model %s is not installed; pull it with \"ollama pull %s\" or pass --auto-pull", client.Model(), client.Model())
+		}
+		if err := client.PullModel(client.Model(), newProgress(os.Stdout)); err != nil {
+			return nil, "", "", err
+		}
+	}
+	return embeddingOnly{client}, embedding.ProviderOllama, client.Model(), nil
+}
+
+// embeddingOnly embeds with an Ollama client without the summary model
+// checks of pipeline.Ollama
+type embeddingOnly struct {
+	client *embedding.OllamaClient
+}
+
+// Embed implements pipeline.Embedder
+func (e embeddingOnly) Embed(ctx context.Context, text string) ([]float64, error) {
+	return e.client.GetEmbedding(text)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// embedRequest is the body of POST /api/embed
+type embedRequest struct {
+	Text string `json:"text"`
+	// K is how many of the nearest stored chunks to return; 0 returns the
+	// embedding alone
+	K int `json:"k"`
+}
+
+type embedResponse struct {
+	Model      string        `json:"model"`
+	Dimensions int           `json:"dimensions"`
+	Embedding  []float64     `json:"embedding"`
+	Neighbors  []QuickResult `json:"neighbors,omitempty"`
+}
+
+// handleEmbed serves POST /api/embed: the embedding of arbitrary text from
+// the server's embedding model and, with k, the stored chunks and passages
+// nearest to it. Nothing is stored, so it works on read-only servers.
+func (s *APIServer) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req embedRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		respondWithError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if req.K < 0 || req.K > maxSearchLimit {
+		respondWithError(w, fmt.Sprintf("k must be between 0 and %d", maxSearchLimit), http.StatusBadRequest)
+		return
+	}
+
+	vector, err := s.client.GetEmbedding(text)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to embed text: %v", err), http.StatusBadGateway)
+		return
+	}
+	response := embedResponse{
+		Model:      s.client.Model(),
+		Dimensions: len(vector),
+		Embedding:  vector,
+	}
+
+	if req.K > 0 {
+		// Searching may update the vector index
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+
+		db, err := s.openDB()
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		if response.Neighbors, err = searchChunks(db, vector, s.client.Model(), req.K); err != nil {
+			respondWithError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	respondWithJSON(w, response)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// embedderFlags select the provider that embeds text: the Ollama server,
+// or a hosted API
+type embedderFlags struct {
+	provider   string
+	url        string
+	dimensions int
+}
+
+// addEmbedderFlags registers the embedding provider flags
+func addEmbedderFlags(cmd *cobra.Command, flags *embedderFlags) {
+	cmd.Flags().StringVar(&flags.provider, "embed-provider", embedding.ProviderOllama, "Embedding provider: ollama, cohere, voyage or jina (hosted providers read COHERE_API_KEY, VOYAGE_API_KEY or JINA_API_KEY)")
+	cmd.Flags().StringVar(&flags.url, "embed-provider-url", "", "Endpoint of the hosted embedding API, e.g. a proxy (default: the provider's)")
+	cmd.Flags().IntVar(&flags.dimensions, "embed-dimensions", 0, "Ask hosted models that support it for embeddings of this length (0 = the model's default)")
+}
+
+// hosted reports whether a hosted API embeds instead of Ollama
+func (f embedderFlags) hosted() bool {
+	return f.provider != embedding.ProviderOllama
+}
+
+// validate checks the provider exists and that hosted-only flags aren't
+// given for Ollama
+func (f embedderFlags) validate() error {
+	if !slices.Contains(embedding.Providers, f.provider) {
+		return fmt.Errorf("unknown embedding provider %q (valid providers: %s)", f.provider, strings.Join(embedding.Providers, ", "))
+	}
+	if !f.hosted() && (f.url != "" || f.dimensions != 0) {
+		return fmt.Errorf("--embed-provider-url and --embed-dimensions need a hosted --embed-provider")
+	}
+	return nil
+}
+
+// model returns the embedding model that is used. With a hosted provider
+// the default Ollama model name stands for the provider's default model, so
+// --embedding-model only has to be given to pick another one.
+func (f embedderFlags) model(model string) string {
+	if f.hosted() && model == embedding.DefaultEmbeddingModel {
+		return embedding.DefaultHostedModel(f.provider)
+	}
+	return model
+}
+
+// hostedClient creates the client of a hosted provider
+func (f embedderFlags) hostedClient(model string, truncate bool) (*embedding.HostedClient, error) {
+	return embedding.NewHostedClient(f.provider, embedding.HostedOptions{
+		Model:      f.model(model),
+		URL:        f.url,
+		Dimensions: f.dimensions,
+		Truncate:   truncate,
+	})
+}
+
+// queryEmbedder returns a function embedding search queries, with the
+// hosted provider's query input type or with Ollama
+func queryEmbedder(ollamaHost, model string, ollama ollamaFlags, embedder embedderFlags) (func(string) ([]float64, error), error) {
+	if err := embedder.validate(); err != nil {
+		return nil, err
+	}
+	if embedder.hosted() {
+		client, err := embedder.hostedClient(model, ollama.truncate)
+		if err != nil {
+			return nil, err
+		}
+		return client.GetQueryEmbedding, nil
+	}
+
+	clientOptions, err := ollama.options()
+	if err != nil {
+		return nil, err
+	}
+	return newOllamaClient(ollamaHost, model, "", clientOptions).GetEmbedding, nil
+}
+
+// embeddedWith returns the chunks whose embeddings were computed by model,
+// the only ones a vector from model can be compared with. Chunks without a
+// recorded model are kept, and every chunk if model is empty.
+func embeddedWith(chunks []database.TextChunk, model string) []database.TextChunk {
+	kept := make([]database.TextChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if model == "" || chunk.EmbeddingModel == "" || chunk.EmbeddingModel == model {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
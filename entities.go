@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+func createEntitiesCommand() *cobra.Command {
+	var maxWorkers int
+	var ollamaHost string
+	var summaryModel string
+	var ollama ollamaFlags
+
+	cmd := &cobra.Command{
+		Use:   "entities <database.db>",
+		Short: "Extract people, places and organizations from every chunk in a database",
+		Long:  "Ask the LLM for the people, places and organizations named in each chunk and store them in the entities table, linked to the chunks that mention them, so the graph can be filtered to every chunk mentioning an entity.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runEntities(args[0], maxWorkers, ollamaHost, summaryModel, ollama); err != nil {
+				log.Fatalf("Error extracting entities: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers (0 = number of CPUs)")
+	cmd.Flags().StringVar(&ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used to extract entities")
+	addOllamaFlags(cmd, &ollama, false)
+	addAutoPullFlag(cmd, &ollama)
+
+	return cmd
+}
+
+func runEntities(dbPath string, maxWorkers int, ollamaHost, summaryModel string, ollama ollamaFlags) error {
+	clientOptions, err := ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return err
+	}
+
+	client := newOllamaClient(ollamaHost, "", summaryModel, clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return err
+	}
+	if err := client.CheckModelsAvailable(); err != nil {
+		return err
+	}
+
+	found, err := extractEntities(db, client, chunks, maxWorkers)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored %d entity mentions for %d chunks in %s\n", found, len(chunks), db.Path())
+	return nil
+}
+
+// extractEntities asks the LLM for the entities in each chunk, replaces the
+// chunks' stored entities and returns the number of mentions found
+func extractEntities(db *database.DB, client *embedding.OllamaClient, chunks []database.TextChunk, maxWorkers int) (int, error) {
+	fmt.Println("Extracting entities with the LLM...")
+
+	texts := make([]string, len(chunks))
+	chunkIDs := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+		chunkIDs[i] = chunk.ID
+	}
+
+	reporter := newProgress(os.Stdout)
+	results, err := client.GetEntitiesConcurrent(texts, maxWorkers, func(completed, total int) {
+		reporter.Report("Entities", completed, total)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var entities []database.ChunkEntity
+	for i, chunk := range chunks {
+		for _, entity := range results[i] {
+			entity.ChunkID = chunk.ID
+			entities = append(entities, entity)
+		}
+	}
+
+	if err := db.ReplaceEntities(chunkIDs, entities); err != nil {
+		return 0, fmt.Errorf("failed to store entities: %w", err)
+	}
+	return len(entities), nil
+}
+
+// EntitySummary is an entity and the chunks that mention it
+type EntitySummary struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Count    int    `json:"count"`
+	ChunkIDs []int  `json:"chunk_ids"`
+}
+
+func (s *APIServer) handleEntities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var types map[string]bool
+	if filter := r.URL.Query().Get("type"); filter != "" {
+		types = make(map[string]bool)
+		for _, entityType := range strings.Split(filter, ",") {
+			entityType = strings.ToLower(strings.TrimSpace(entityType))
+			if !isEntityType(entityType) {
+				respondWithError(w, fmt.Sprintf("unknown entity type %q (valid types: %s)", entityType, strings.Join(database.EntityTypes, ", ")), http.StatusBadRequest)
+				return
+			}
+			types[entityType] = true
+		}
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	entities, err := db.GetAllEntities()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get entities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	byKey := make(map[[2]string]*EntitySummary)
+	for _, entity := range entities {
+		if types != nil && !types[entity.Type] {
+			continue
+		}
+		key := [2]string{entity.Type, entity.Name}
+		summary, ok := byKey[key]
+		if !ok {
+			summary = &EntitySummary{Name: entity.Name, Type: entity.Type}
+			byKey[key] = summary
+		}
+		summary.Count++
+		summary.ChunkIDs = append(summary.ChunkIDs, entity.ChunkID)
+	}
+
+	result := make([]EntitySummary, 0, len(byKey))
+	for _, summary := range byKey {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Type < result[j].Type
+	})
+
+	respondWithJSON(w, result)
+}
+
+func isEntityType(entityType string) bool {
+	for _, valid := range database.EntityTypes {
+		if entityType == valid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// evalOptions holds the settings for a retrieval evaluation
+type evalOptions struct {
+	dbPath         string
+	queriesPath    string
+	top            int
+	json           bool
+	ollamaHost     string
+	embeddingModel string
+	vecExtension   string
+	ollama         ollamaFlags
+	embedder       embedderFlags
+}
+
+// evalQuery is one line of the queries file
+type evalQuery struct {
+	Query    string `json:"query"`
+	Relevant []int  `json:"relevant"`
+}
+
+// EvalResult is the score of one query and the chunks it retrieved
+type EvalResult struct {
+	Query    string `json:"query"`
+	Relevant []int  `json:"relevant"`
+	Ranked   []int  `json:"ranked"`
+	analysis.RetrievalScore
+}
+
+// EvalReport is the score of every query and their means
+type EvalReport struct {
+	K       int          `json:"k"`
+	Queries []EvalResult `json:"queries"`
+	// MeanRecall, MRR and MeanNDCG average the per-query scores
+	MeanRecall float64 `json:"mean_recall"`
+	MRR        float64 `json:"mrr"`
+	MeanNDCG   float64 `json:"mean_ndcg"`
+}
+
+func createEvalCommand() *cobra.Command {
+	var opts evalOptions
+
+	cmd := &cobra.Command{
+		Use:   "eval <database.db>",
+		Short: "Score retrieval quality against a labeled query set",
+		Long:  `Run each query of a JSONL query set through the same search as "bluffy search" and report recall@k, MRR and nDCG@k against the chunks expected for it, to compare chunk sizes, embedding models and similarity metrics objectively. Each line holds {"query": "...", "relevant": [12, 15]}, where relevant lists the IDs of the chunks that answer the query; a passage hit counts as a hit on the chunk it was split from.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runEval(os.Stdout, opts); err != nil {
+				log.Fatalf("Error evaluating: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.queriesPath, "queries", "q", "", "JSONL file of queries and the IDs of their relevant chunks")
+	cmd.Flags().IntVarP(&opts.top, "top", "k", defaultSearchLimit, "Number of results scored per query (the k of recall@k and nDCG@k)")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the scores as JSON")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", embedding.DefaultEmbeddingModel, "Model used to embed the queries; must match the model the database was built with")
+	addOllamaFlags(cmd, &opts.ollama, true)
+	addEmbedderFlags(cmd, &opts.embedder)
+	cmd.Flags().StringVar(&opts.vecExtension, "vec-extension", "", "Path to the sqlite-vec loadable extension (e.g. ./vec0.so) to evaluate the in-database vector index")
+	cmd.MarkFlagRequired("queries")
+
+	return cmd
+}
+
+func runEval(out io.Writer, opts evalOptions) error {
+	if opts.top <= 0 {
+		return fmt.Errorf("top must be positive, got %d", opts.top)
+	}
+	queries, err := readEvalQueries(opts.queriesPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	if opts.vecExtension != "" {
+		database.LoadVectorExtension(opts.vecExtension)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	embed, err := queryEmbedder(opts.ollamaHost, opts.embeddingModel, opts.ollama, opts.embedder)
+	if err != nil {
+		return err
+	}
+
+	report := EvalReport{K: opts.top, Queries: make([]EvalResult, 0, len(queries))}
+	for _, query := range queries {
+		queryEmbedding, err := embed(query.Query)
+		if err != nil {
+			return fmt.Errorf("failed to embed query %q: %w", query.Query, err)
+		}
+		results, err := searchChunks(db, queryEmbedding, opts.embedder.model(opts.embeddingModel), opts.top)
+		if err != nil {
+			return err
+		}
+
+		ranked := make([]int, len(results))
+		for i, result := range results {
+			ranked[i] = result.ID
+			if result.ParentID != 0 {
+				ranked[i] = result.ParentID
+			}
+		}
+		score := analysis.ScoreRetrieval(ranked, query.Relevant, opts.top)
+		report.Queries = append(report.Queries, EvalResult{
+			Query:          query.Query,
+			Relevant:       query.Relevant,
+			Ranked:         ranked,
+			RetrievalScore: score,
+		})
+		report.MeanRecall += score.Recall
+		report.MRR += score.ReciprocalRank
+		report.MeanNDCG += score.NDCG
+	}
+	n := float64(len(report.Queries))
+	report.MeanRecall /= n
+	report.MRR /= n
+	report.MeanNDCG /= n
+
+	if opts.json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return writeEvalReport(out, report)
+}
+
+// readEvalQueries reads a JSONL queries file, skipping blank lines
+func readEvalQueries(path string) ([]evalQuery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queries file: %w", err)
+	}
+	defer file.Close()
+
+	var queries []evalQuery
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var query evalQuery
+		if err := json.Unmarshal([]byte(text), &query); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid query: %w", path, line, err)
+		}
+		if strings.TrimSpace(query.Query) == "" {
+			return nil, fmt.Errorf("%s:%d: query is required", path, line)
+		}
+		if len(query.Relevant) == 0 {
+			return nil, fmt.Errorf("%s:%d: relevant must list at least one chunk ID", path, line)
+		}
+		queries = append(queries, query)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queries file: %w", err)
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries in %s", path)
+	}
+	return queries, nil
+}
+
+// writeEvalReport prints a table of per-query scores followed by the means
+func writeEvalReport(out io.Writer, report EvalReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Query\tRecall@%d\tRR\tnDCG@%d\n", report.K, report.K)
+	for _, result := range report.Queries {
+		fmt.Fprintf(w, "%s\t%.3f\t%.3f\t%.3f\n", tsvField(result.Query), result.Recall, result.ReciprocalRank, result.NDCG)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n%d queries: recall@%d %.3f, MRR %.3f, nDCG@%d %.3f\n",
+		len(report.Queries), report.K, report.MeanRecall, report.MRR, report.K, report.MeanNDCG)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// databaseChangedEvent is sent to /api/events clients when the database
+// file is modified, e.g. by process or watch
+const databaseChangedEvent = "database.changed"
+
+// eventKeepAlive is how often an idle event stream gets a comment line, so
+// proxies don't close it
+const eventKeepAlive = 30 * time.Second
+
+// changeEvent is the data of a server-sent event
+type changeEvent struct {
+	Event      string    `json:"event"`
+	Database   string    `json:"database"`
+	ModifiedAt time.Time `json:"modified_at"`
+	// Job is the job a job.updated event is about
+	Job *Job `json:"job,omitempty"`
+}
+
+// eventHub fans events out to the connected /api/events clients
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan changeEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan changeEvent]struct{})}
+}
+
+func (h *eventHub) subscribe() chan changeEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan changeEvent, 8)
+	h.clients[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan changeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, ch)
+}
+
+// publish sends an event to every client. Clients too slow to take it miss
+// it; the next event tells them to reload anyway.
+func (h *eventHub) publish(event changeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// watchDatabase polls the modification time of the database at every
+// interval. When it changes, cached responses and derived data are dropped
+// and connected clients are told to reload.
+func (s *APIServer) watchDatabase(interval time.Duration) {
+	go func() {
+		last := dbModTime(s.dbPath)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+
+			modified := dbModTime(s.dbPath)
+			if modified.Equal(last) {
+				continue
+			}
+			last = modified
+
+			dropped := 0
+			if s.cache != nil {
+				dropped = s.cache.invalidate()
+			}
+			s.derivedMu.Lock()
+			s.derived = nil
+			s.derivedMu.Unlock()
+			log.Printf("Database %s changed; dropped %d cached responses", s.dbPath, dropped)
+
+			s.events.publish(changeEvent{
+				Event:      databaseChangedEvent,
+				Database:   s.dbPath,
+				ModifiedAt: modified.UTC(),
+			})
+		}
+	}()
+}
+
+// handleEvents streams server-sent events. Clients such as the visualizer
+// listen for database.changed and refetch their data.
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			// The server was unmounted or reloaded; clients reconnect to
+			// its replacement
+			return
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
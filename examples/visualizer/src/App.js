@@ -1,4 +1,4 @@
-import React, { useEffect, useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
 import ForceGraph from './ForceGraph';
 
 function App() {
@@ -7,13 +7,17 @@ function App() {
   const [error, setError] = useState(null);
   const [minSimilarity, setMinSimilarity] = useState(0.8);
   const [apiUrl, setApiUrl] = useState('http://localhost:8080');
+  // Shows only the links between chunks of different documents
+  const [crossDocument, setCrossDocument] = useState(false);
+  // Set once the saved threshold was read, so it isn't overwritten first
+  const settingsLoaded = useRef(false);
 
   const fetchGraphData = async () => {
     setLoading(true);
     setError(null);
     
     try {
-      const response = await fetch(`${apiUrl}/api/graph?min_similarity=${minSimilarity}`);
+      const response = await fetch(`${apiUrl}/api/graph?min_similarity=${minSimilarity}${crossDocument ? '&cross_document=true' : ''}`);
       const result = await response.json();
       
       if (result.success) {
@@ -30,7 +34,51 @@ function App() {
 
   useEffect(() => {
     fetchGraphData();
-  }, [minSimilarity, apiUrl]); // eslint-disable-line react-hooks/exhaustive-deps
+  }, [minSimilarity, apiUrl, crossDocument]); // eslint-disable-line react-hooks/exhaustive-deps
+
+  // Start from the threshold chosen last time, or the one the server
+  // suggests for the corpus
+  useEffect(() => {
+    settingsLoaded.current = false;
+    fetch(`${apiUrl}/api/settings`)
+      .then((response) => response.json())
+      .then(async (result) => {
+        if (result.success && result.data.min_similarity !== undefined) {
+          setMinSimilarity(result.data.min_similarity);
+          return;
+        }
+        const histogram = await fetch(`${apiUrl}/api/similarities/histogram`).then((response) => response.json());
+        if (histogram.success && histogram.data.total > 0) {
+          setMinSimilarity(Math.floor(histogram.data.suggested_threshold * 100) / 100);
+        }
+      })
+      .catch(() => {})
+      .finally(() => {
+        settingsLoaded.current = true;
+      });
+  }, [apiUrl]);
+
+  // Save the threshold once the slider rests
+  useEffect(() => {
+    if (!settingsLoaded.current) {
+      return undefined;
+    }
+    const timer = setTimeout(() => {
+      fetch(`${apiUrl}/api/settings`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ min_similarity: minSimilarity }),
+      }).catch(() => {});
+    }, 500);
+    return () => clearTimeout(timer);
+  }, [minSimilarity]); // eslint-disable-line react-hooks/exhaustive-deps
+
+  // Reload when the server reports that the database changed
+  useEffect(() => {
+    const events = new EventSource(`${apiUrl}/api/events`);
+    events.addEventListener('database.changed', () => fetchGraphData());
+    return () => events.close();
+  }, [minSimilarity, apiUrl, crossDocument]); // eslint-disable-line react-hooks/exhaustive-deps
 
   return (
     <div className="min-h-screen bg-dark-bg">
@@ -89,6 +137,15 @@ function App() {
                 {minSimilarity.toFixed(2)}
               </span>
             </div>
+
+            <label className="flex items-center space-x-2 text-sm font-medium text-dark-muted">
+              <input
+                type="checkbox"
+                checked={crossDocument}
+                onChange={(e) => setCrossDocument(e.target.checked)}
+              />
+              <span>Cross-document links only</span>
+            </label>
             
             <button 
               onClick={fetchGraphData}
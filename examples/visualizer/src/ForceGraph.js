@@ -12,6 +12,12 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
     const svg = d3.select(svgRef.current);
     svg.selectAll("*").remove(); // Clear previous render
 
+    // Well-connected chunks are drawn larger, by their degree at the
+    // current threshold
+    const maxDegree = d3.max(data.nodes, d => d.degree || 0) || 1;
+    const radius = (d, zoom) => Math.max(12, 15 / Math.sqrt(zoom)) * (0.8 + 0.6 * Math.sqrt((d.degree || 0) / maxDegree));
+    const documents = [...new Set(data.nodes.map(d => d.document_id))].sort((a, b) => a - b);
+
     // Create zoom behavior
     const zoom = d3.zoom()
       .scaleExtent([0.05, 8])
@@ -19,7 +25,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
         container.attr("transform", event.transform);
         setCurrentZoom(event.transform.k);
         // Update node sizes immediately on zoom
-        node.attr("r", d => Math.max(12, 15 / Math.sqrt(event.transform.k)));
+        node.attr("r", d => radius(d, event.transform.k));
       });
 
     // Apply zoom to SVG
@@ -33,7 +39,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
       .force("link", d3.forceLink(data.links).id(d => d.id).distance(d => (1 - d.similarity) * 200 + 50))
       .force("charge", d3.forceManyBody().strength(-300))
       .force("center", d3.forceCenter(width / 2, height / 2))
-      .force("collision", d3.forceCollide().radius(20));
+      .force("collision", d3.forceCollide().radius(d => radius(d, 1) + 5));
 
     // Create links
     const link = container.append("g")
@@ -53,7 +59,15 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
       .enter().append("circle")
       .attr("r", 10)
       .attr("fill", d => {
+        // Scored chunks are colored by tone, from red (negative) to green (positive)
+        if (d.sentiment !== undefined) {
+          return d3.interpolateRdYlGn((d.sentiment + 1) / 2);
+        }
         const colors = ['#3b82f6', '#8b5cf6', '#06b6d4', '#10b981', '#f59e0b', '#ef4444', '#ec4899', '#84cc16'];
+        // With several documents each one gets a color of its own
+        if (documents.length > 1) {
+          return colors[documents.indexOf(d.document_id) % colors.length];
+        }
         return colors[d.index % colors.length];
       })
       .attr("stroke", "#1a1a2e")
@@ -68,7 +82,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
         setSelectedNode(d);
       })
       .on("mouseover", function(event, d) {
-        d3.select(this).attr("r", Math.max(16, 18 / Math.sqrt(currentZoom)));
+        d3.select(this).attr("r", radius(d, currentZoom) * 1.25);
         console.log(d)
         
         // Show tooltip
@@ -81,7 +95,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
           .style("font-size", "12px")
           .style("fill", "#e2e8f0")
           .style("font-weight", "500")
-          .text(d.summary || d.text.substring(0, 40) + (d.text.length > 40 ? "..." : ""));
+          .text(d.title || d.summary || d.text.substring(0, 40) + (d.text.length > 40 ? "..." : ""));
         
         const bbox = text.node().getBBox();
         tooltip.insert("rect", "text")
@@ -96,7 +110,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
           .style("filter", "drop-shadow(0 4px 6px rgba(0, 0, 0, 0.3))");
       })
       .on("mouseout", function(event, d) {
-        d3.select(this).attr("r", Math.max(12, 15 / Math.sqrt(currentZoom)));
+        d3.select(this).attr("r", radius(d, currentZoom));
         container.select("#tooltip").remove();
       });
 
@@ -112,7 +126,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
       .style("font-weight", "500")
       .style("fill", "#94a3b8")
       .style("pointer-events", "none")
-      .text(d => d.summary || `C${d.index}`);
+      .text(d => d.title || d.summary || `C${d.index}`);
 
     // Update positions on simulation tick
     simulation.on("tick", () => {
@@ -125,7 +139,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
       node
         .attr("cx", d => d.x)
         .attr("cy", d => d.y)
-        .attr("r", d => Math.max(12, 15 / Math.sqrt(currentZoom)));
+        .attr("r", d => radius(d, currentZoom));
 
       label
         .attr("x", d => d.x)
@@ -223,7 +237,7 @@ const ForceGraph = ({ data, width = 800, height = 600 }) => {
                   {selectedNode.index}
                 </div>
                 <h3 className="text-lg font-semibold text-dark-text">
-                {selectedNode.summary}
+                {selectedNode.title || selectedNode.summary}
                 </h3>
               </div>
               <button 
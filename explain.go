@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// SimilarityExplanation is the LLM's explanation of why the chunks of a
+// similarity are related
+type SimilarityExplanation struct {
+	SimilarityID int     `json:"similarity_id"`
+	ChunkID1     int     `json:"chunk_id_1"`
+	ChunkID2     int     `json:"chunk_id_2"`
+	Similarity   float64 `json:"similarity"`
+	Explanation  string  `json:"explanation"`
+	Model        string  `json:"model"`
+	// Cached is true when the explanation was generated earlier
+	Cached bool `json:"cached"`
+}
+
+// explainSimilarity returns the cached explanation of a similarity, or asks
+// the generation model for one and caches it. Explanations are cached by
+// the chunks' content, so they survive recalc but not edits; refresh
+// replaces the cached one. writeMu, if set, is held while the explanation
+// is stored, but not while it is generated.
+func explainSimilarity(db *database.DB, client *embedding.OllamaClient, sim *database.ChunkSimilarity, refresh bool, writeMu sync.Locker) (*SimilarityExplanation, error) {
+	chunk1, err := db.GetChunk(sim.ChunkID1)
+	if err != nil {
+		return nil, err
+	}
+	chunk2, err := db.GetChunk(sim.ChunkID2)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SimilarityExplanation{
+		SimilarityID: sim.ID,
+		ChunkID1:     sim.ChunkID1,
+		ChunkID2:     sim.ChunkID2,
+		Similarity:   sim.Similarity,
+	}
+	if !refresh {
+		cached, err := db.GetExplanation(chunk1.StableID, chunk2.StableID)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			result.Explanation, result.Model, result.Cached = cached.Explanation, cached.Model, true
+			return result, nil
+		}
+	}
+
+	explanation, err := client.WithSummaryLanguage(chunk1.SummaryLanguage).ExplainSimilarity(chunk1.Text, chunk2.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain similarity: %w", err)
+	}
+	// A read-only server explains again every time rather than cache
+	if !db.ReadOnly() {
+		if writeMu != nil {
+			writeMu.Lock()
+		}
+		err := db.SetExplanation(chunk1.StableID, chunk2.StableID, explanation, client.GenerationModel())
+		if writeMu != nil {
+			writeMu.Unlock()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.Explanation, result.Model = explanation, client.GenerationModel()
+	return result, nil
+}
+
+// handleSimilarity serves GET /api/similarities/{id}/explain: why the two
+// chunks of a similarity are related, in one sentence from the server's
+// generation model, cached in the database. refresh=true generates it
+// again.
+func (s *APIServer) handleSimilarity(w http.ResponseWriter, r *http.Request) {
+	path, explain := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/similarities/"), "/explain")
+	if !explain {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		respondWithError(w, "Invalid similarity ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	sim, err := db.GetSimilarity(id)
+	if errors.Is(err, database.ErrSimilarityNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to load similarity: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := explainSimilarity(db, s.client, sim, r.URL.Query().Get("refresh") == "true", &s.writeMu)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	respondWithJSON(w, result)
+}
+
+// explainOptions holds the settings for explaining a similarity
+type explainOptions struct {
+	dbPath       string
+	similarityID int
+	chunks       []int
+	ollamaHost   string
+	summaryModel string
+	refresh      bool
+	json         bool
+	ollama       ollamaFlags
+}
+
+func createExplainCommand() *cobra.Command {
+	var opts explainOptions
+
+	cmd := &cobra.Command{
+		Use:   "explain <database.db> [similarity-id]",
+		Short: "Explain in one sentence why two similar chunks are related",
+		Long:  "Ask the LLM why the two chunks of a stored similarity are related, given by its ID as in /api/similarities or by the chunk IDs with --chunks. The one-sentence explanation is cached in the database, as it is by GET /api/similarities/{id}/explain, so asking again is instant until either chunk is edited; --refresh generates it again.",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if len(args) == 2 {
+				id, err := strconv.Atoi(args[1])
+				if err != nil {
+					log.Fatalf("Invalid similarity ID %q", args[1])
+				}
+				opts.similarityID = id
+			}
+			if err := runExplain(os.Stdout, opts); err != nil {
+				log.Fatalf("Error explaining similarity: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntSliceVar(&opts.chunks, "chunks", nil, "IDs of the two chunks whose similarity is explained, instead of a similarity ID")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model that writes the explanation")
+	cmd.Flags().BoolVar(&opts.refresh, "refresh", false, "Generate the explanation again instead of using the cached one")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the explanation as JSON")
+	addOllamaFlags(cmd, &opts.ollama, false)
+
+	return cmd
+}
+
+func runExplain(out io.Writer, opts explainOptions) error {
+	if (opts.similarityID == 0) == (len(opts.chunks) == 0) {
+		return fmt.Errorf("give either a similarity ID or --chunks")
+	}
+	if len(opts.chunks) > 0 && len(opts.chunks) != 2 {
+		return fmt.Errorf("--chunks takes two chunk IDs, got %d", len(opts.chunks))
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var sim *database.ChunkSimilarity
+	if len(opts.chunks) == 2 {
+		sim, err = db.GetSimilarityBetween(opts.chunks[0], opts.chunks[1])
+	} else {
+		sim, err = db.GetSimilarity(opts.similarityID)
+	}
+	if err != nil {
+		return err
+	}
+
+	clientOptions.GenerationOnly = true
+	client := newOllamaClient(opts.ollamaHost, "", opts.summaryModel, clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return err
+	}
+
+	result, err := explainSimilarity(db, client, sim, opts.refresh, nil)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	fmt.Fprintf(out, "Chunks %d and %d (similarity %.3f):\n%s\n", result.ChunkID1, result.ChunkID2, result.Similarity, result.Explanation)
+	if result.Cached {
+		fmt.Fprintf(out, "(cached, from %s)\n", result.Model)
+	}
+	return nil
+}
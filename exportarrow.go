@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// arrowBatchRows is how many chunks are written per Arrow record batch
+const arrowBatchRows = 1024
+
+// exportArrowOptions holds the settings for an Arrow export
+type exportArrowOptions struct {
+	dbPath  string
+	output  string
+	runName string
+	noText  bool
+}
+
+func createExportArrowCommand() *cobra.Command {
+	var opts exportArrowOptions
+
+	cmd := &cobra.Command{
+		Use:   "export-arrow <database.db>",
+		Short: "Export chunks and their embeddings as an Apache Arrow IPC file",
+		Long:  "Write every chunk with its embedding to an Apache Arrow IPC file, which pandas, Polars, DuckDB and NumPy load as columns without parsing the JSON embedding strings stored in the database. Embeddings are stored as float32 lists, of fixed size when every chunk has the same number of dimensions.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := exportArrow(opts); err != nil {
+				log.Fatalf("Error exporting embeddings: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Arrow file to write (default: the database name with .arrow)")
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only export the chunks of this run")
+	cmd.Flags().BoolVar(&opts.noText, "no-text", false, "Leave out the chunk text to keep the file small")
+
+	return cmd
+}
+
+func exportArrow(opts exportArrowOptions) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	if opts.output == "" {
+		opts.output = strings.TrimSuffix(opts.dbPath, filepath.Ext(opts.dbPath)) + ".arrow"
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	runs, err := db.GetRuns()
+	if err != nil {
+		return err
+	}
+	runByID := make(map[int]database.Run, len(runs))
+	for _, run := range runs {
+		runByID[run.ID] = run
+	}
+
+	var chunks []database.TextChunk
+	if opts.runName != "" {
+		run, err := db.GetRunByName(opts.runName)
+		if err != nil {
+			return err
+		}
+		chunks, err = db.GetChunksByRun(run.ID)
+		if err != nil {
+			return err
+		}
+	} else {
+		chunks, err = db.GetAllChunks()
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(opts.output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", opts.output, err)
+	}
+	if err := writeArrow(file, chunks, runByID, !opts.noText); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.output, err)
+	}
+
+	fmt.Printf("Exported %d chunks to %s\n", len(chunks), opts.output)
+	return nil
+}
+
+// arrowSchema describes the exported columns. Embeddings are fixed-size
+// lists when dimensions is positive, so they load as a 2-D array.
+func arrowSchema(dimensions int, withText bool) *arrow.Schema {
+	embeddingType := arrow.DataType(arrow.ListOf(arrow.PrimitiveTypes.Float32))
+	if dimensions > 0 {
+		embeddingType = arrow.FixedSizeListOf(int32(dimensions), arrow.PrimitiveTypes.Float32)
+	}
+
+	fields := []arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "stable_id", Type: arrow.BinaryTypes.String},
+		{Name: "run_id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "run", Type: arrow.BinaryTypes.String},
+		{Name: "chunk_index", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "section", Type: arrow.BinaryTypes.String},
+		{Name: "language", Type: arrow.BinaryTypes.String},
+		{Name: "summary", Type: arrow.BinaryTypes.String},
+		{Name: "token_count", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "embedding_model", Type: arrow.BinaryTypes.String},
+		{Name: "embedding", Type: embeddingType},
+	}
+	if withText {
+		fields = append(fields, arrow.Field{Name: "text", Type: arrow.BinaryTypes.String})
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// writeArrow writes chunks as an Arrow IPC file in batches of
+// arrowBatchRows
+func writeArrow(file *os.File, chunks []database.TextChunk, runByID map[int]database.Run, withText bool) error {
+	// Chunks embedded with different models can have different lengths
+	dimensions := -1
+	for _, chunk := range chunks {
+		if dimensions == -1 {
+			dimensions = len(chunk.Embedding)
+		} else if len(chunk.Embedding) != dimensions {
+			dimensions = 0
+			break
+		}
+	}
+
+	mem := memory.NewGoAllocator()
+	schema := arrowSchema(dimensions, withText)
+	writer, err := ipc.NewFileWriter(file, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	if err != nil {
+		return fmt.Errorf("failed to start Arrow file: %w", err)
+	}
+
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+
+	for start := 0; start < len(chunks); start += arrowBatchRows {
+		for _, chunk := range chunks[start:min(start+arrowBatchRows, len(chunks))] {
+			run := runByID[chunk.RunID]
+			builder.Field(0).(*array.Int64Builder).Append(int64(chunk.ID))
+			builder.Field(1).(*array.StringBuilder).Append(chunk.StableID)
+			builder.Field(2).(*array.Int64Builder).Append(int64(chunk.RunID))
+			builder.Field(3).(*array.StringBuilder).Append(run.Name)
+			builder.Field(4).(*array.Int32Builder).Append(int32(chunk.ChunkIndex))
+			builder.Field(5).(*array.StringBuilder).Append(chunk.Section)
+			builder.Field(6).(*array.StringBuilder).Append(chunk.Language)
+			builder.Field(7).(*array.StringBuilder).Append(chunk.Summary)
+			builder.Field(8).(*array.Int32Builder).Append(int32(chunk.TokenCount))
+			builder.Field(9).(*array.StringBuilder).Append(chunk.EmbeddingModel)
+
+			values := make([]float32, len(chunk.Embedding))
+			for i, v := range chunk.Embedding {
+				values[i] = float32(v)
+			}
+			if dimensions > 0 {
+				list := builder.Field(10).(*array.FixedSizeListBuilder)
+				list.Append(true)
+				list.ValueBuilder().(*array.Float32Builder).AppendValues(values, nil)
+			} else {
+				list := builder.Field(10).(*array.ListBuilder)
+				list.Append(true)
+				list.ValueBuilder().(*array.Float32Builder).AppendValues(values, nil)
+			}
+
+			if withText {
+				builder.Field(11).(*array.StringBuilder).Append(chunk.Text)
+			}
+		}
+
+		record := builder.NewRecord()
+		err := writer.Write(record)
+		record.Release()
+		if err != nil {
+			return fmt.Errorf("failed to write Arrow record batch: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish Arrow file: %w", err)
+	}
+	return nil
+}
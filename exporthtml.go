@@ -0,0 +1,141 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/spf13/cobra"
+)
+
+// exportHTMLTemplate renders a graph as a page with the graph data and the
+// script drawing it inlined, so it opens from disk without a server
+//
+//go:embed exporthtml.tmpl
+var exportHTMLTemplate string
+
+// exportHTMLOptions holds the settings for an HTML export
+type exportHTMLOptions struct {
+	dbPath           string
+	output           string
+	title            string
+	strategy         string
+	k                int
+	minSimilarity    float64
+	types            string
+	sequential       bool
+	includeOutliers  bool
+	tags             string
+	language         string
+	documents        string
+	crossDocument    bool
+	clusterThreshold float64
+}
+
+func createExportHTMLCommand() *cobra.Command {
+	var opts exportHTMLOptions
+
+	cmd := &cobra.Command{
+		Use:   "export-html <database.db>",
+		Short: "Export the graph as a self-contained interactive HTML page",
+		Long:  "Write the chunk graph to a single HTML file with the graph data and the script that draws it inlined, so it can be shared and explored in a browser without bluffy or a server. The graph is the one GET /api/graph returns for the same options: nodes can be dragged, searched and clicked to read their text and linked chunks, and weak similarity links hidden with a slider.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := exportHTML(opts, cmd.Flags().Changed("sequential")); err != nil {
+				log.Fatalf("Error exporting graph: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "HTML file to write (default: the database name with .html)")
+	cmd.Flags().StringVar(&opts.title, "title", "", "Page title (default: the database name)")
+	cmd.Flags().StringVar(&opts.strategy, "strategy", analysis.StrategyThreshold, "Similarity links to draw: "+strings.Join(analysis.GraphStrategies, ", "))
+	cmd.Flags().IntVarP(&opts.k, "top", "k", defaultGraphK, "Neighbors per chunk for the knn and mutual_knn strategies")
+	cmd.Flags().Float64Var(&opts.minSimilarity, "min-similarity", 0, "Leave out similarity links below this value; lower ones can't be shown by the page's slider")
+	cmd.Flags().StringVar(&opts.types, "types", "", "Comma-separated link types to draw (default: every type but sequence)")
+	cmd.Flags().BoolVar(&opts.sequential, "sequential", false, "Also link each chunk to the next one in its document")
+	cmd.Flags().BoolVar(&opts.includeOutliers, "include-outliers", false, "Include chunks flagged as outliers")
+	cmd.Flags().StringVar(&opts.tags, "tags", "", "Only include chunks with one of these comma-separated tags")
+	cmd.Flags().StringVar(&opts.language, "language", "", "Only include chunks in these comma-separated languages (und = undetected)")
+	cmd.Flags().StringVar(&opts.documents, "documents", "", "Only include the chunks of these comma-separated document (run) IDs")
+	cmd.Flags().BoolVar(&opts.crossDocument, "cross-document", false, "Only draw links between chunks of different documents")
+	cmd.Flags().Float64Var(&opts.clusterThreshold, "cluster-threshold", 0.8, "Minimum similarity linking chunks when computing node centrality, as in serve")
+
+	return cmd
+}
+
+func exportHTML(opts exportHTMLOptions, sequentialSet bool) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	if opts.output == "" {
+		opts.output = strings.TrimSuffix(opts.dbPath, filepath.Ext(opts.dbPath)) + ".html"
+	}
+	if opts.title == "" {
+		opts.title = filepath.Base(opts.dbPath)
+	}
+
+	// The same parameters select the graph as in GET /api/graph
+	query := url.Values{}
+	query.Set("strategy", opts.strategy)
+	query.Set("k", strconv.Itoa(opts.k))
+	query.Set("min_similarity", strconv.FormatFloat(opts.minSimilarity, 'f', -1, 64))
+	query.Set("include_outliers", strconv.FormatBool(opts.includeOutliers))
+	if opts.types != "" {
+		query.Set("types", opts.types)
+	}
+	if sequentialSet {
+		query.Set("sequential", strconv.FormatBool(opts.sequential))
+	}
+	if opts.tags != "" {
+		query.Set("tags", opts.tags)
+	}
+	if opts.language != "" {
+		query.Set("language", opts.language)
+	}
+	if opts.documents != "" {
+		query.Set("documents", opts.documents)
+	}
+	if opts.crossDocument {
+		query.Set("cross_document", "true")
+	}
+
+	server := &APIServer{dbPath: opts.dbPath, clusterThreshold: opts.clusterThreshold}
+	graph, err := server.buildGraph(query)
+	if err != nil {
+		return err
+	}
+
+	page, err := template.New("graph").Parse(exportHTMLTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse page template: %w", err)
+	}
+	file, err := os.Create(opts.output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", opts.output, err)
+	}
+	err = page.Execute(file, struct {
+		Title    string
+		Exported string
+		Graph    GraphData
+	}{opts.title, time.Now().Format("2006-01-02 15:04"), graph})
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to render %s: %w", opts.output, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.output, err)
+	}
+
+	fmt.Printf("Exported %d chunks and %d links to %s\n", len(graph.Nodes), len(graph.Links), opts.output)
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+func createGCCommand() *cobra.Command {
+	var vacuum bool
+
+	cmd := &cobra.Command{
+		Use:   "gc <database.db>",
+		Short: "Remove orphaned rows left behind by deleted chunks",
+		Long:  "Delete similarities, edges, citations and keywords that reference chunks which no longer exist, and runs with no chunks. Databases at the latest schema cascade chunk deletions automatically; this cleans up deletions made by older releases or with foreign keys disabled.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := collectGarbage(args[0], vacuum); err != nil {
+				log.Fatalf("Error collecting garbage: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&vacuum, "vacuum", false, "Rebuild the database file afterwards to reclaim disk space")
+
+	return cmd
+}
+
+func collectGarbage(dbPath string, vacuum bool) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	db, err := database.OpenExistingDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.CollectGarbage()
+	if err != nil {
+		return err
+	}
+	printGCReport(report)
+
+	if report.Similarities > 0 {
+		if err := db.RefreshNeighbors(); err != nil {
+			return err
+		}
+	}
+
+	if vacuum {
+		fmt.Println("Vacuuming database...")
+		if err := db.Vacuum(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printGCReport prints the rows removed by garbage collection
+func printGCReport(report *database.GCReport) {
+	fmt.Printf("Removed %d orphaned similarities\n", report.Similarities)
+	fmt.Printf("Removed %d orphaned edges\n", report.Edges)
+	fmt.Printf("Removed %d orphaned citations\n", report.Citations)
+	fmt.Printf("Removed %d orphaned keywords\n", report.Keywords)
+	fmt.Printf("Removed %d orphaned entity mentions\n", report.Entities)
+	fmt.Printf("Removed %d orphaned passages\n", report.Passages)
+	fmt.Printf("Removed %d empty runs\n", report.Runs)
+}
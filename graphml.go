@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// graphMLContentType is the media type of GET /api/graph?format=graphml
+const graphMLContentType = "application/graphml+xml"
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID       string        `xml:"id,attr"`
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed string        `xml:"directed,attr,omitempty"`
+	Data     []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys declares the node and edge attributes, which Gephi and
+// Cytoscape import as columns
+var graphMLKeys = []graphMLKey{
+	{ID: "label", For: "node", Name: "label", Type: "string"},
+	{ID: "stable_id", For: "node", Name: "stable_id", Type: "string"},
+	{ID: "index", For: "node", Name: "index", Type: "int"},
+	{ID: "section", For: "node", Name: "section", Type: "string"},
+	{ID: "language", For: "node", Name: "language", Type: "string"},
+	{ID: "document", For: "node", Name: "document", Type: "int"},
+	{ID: "keywords", For: "node", Name: "keywords", Type: "string"},
+	{ID: "outlier", For: "node", Name: "outlier", Type: "boolean"},
+	{ID: "text", For: "node", Name: "text", Type: "string"},
+	{ID: "length", For: "node", Name: "length", Type: "int"},
+	{ID: "betweenness", For: "node", Name: "betweenness", Type: "double"},
+	{ID: "eigenvector", For: "node", Name: "eigenvector", Type: "double"},
+	{ID: "type", For: "edge", Name: "type", Type: "string"},
+	{ID: "similarity", For: "edge", Name: "similarity", Type: "double"},
+	{ID: "weight", For: "edge", Name: "weight", Type: "double"},
+	{ID: "edge_label", For: "edge", Name: "label", Type: "string"},
+}
+
+// directedEdgeTypes are the edge types that point from one chunk to
+// another; the rest are symmetric
+var directedEdgeTypes = map[string]bool{
+	database.EdgeTypeSequence: true,
+	database.EdgeTypeWikilink: true,
+	database.EdgeTypeCitation: true,
+}
+
+// writeGraphML writes graph as GraphML. Similarity links carry their
+// similarity as the edge weight so layout algorithms pull similar chunks
+// together.
+func writeGraphML(w io.Writer, graph GraphData) error {
+	doc := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{ID: "bluffy", EdgeDefault: "undirected"},
+	}
+
+	for _, node := range graph.Nodes {
+		label := node.Summary
+		if node.Title != "" {
+			label = node.Title
+		}
+		data := []graphMLData{
+			{Key: "label", Value: label},
+			{Key: "stable_id", Value: node.StableID},
+			{Key: "index", Value: strconv.Itoa(node.Index)},
+		}
+		if node.Section != "" {
+			data = append(data, graphMLData{Key: "section", Value: node.Section})
+		}
+		if node.Language != "" {
+			data = append(data, graphMLData{Key: "language", Value: node.Language})
+		}
+		if node.DocumentID != 0 {
+			data = append(data, graphMLData{Key: "document", Value: strconv.Itoa(node.DocumentID)})
+		}
+		if len(node.Keywords) > 0 {
+			data = append(data, graphMLData{Key: "keywords", Value: strings.Join(node.Keywords, ", ")})
+		}
+		data = append(data,
+			graphMLData{Key: "outlier", Value: strconv.FormatBool(node.Outlier)},
+			graphMLData{Key: "text", Value: node.Text},
+			graphMLData{Key: "length", Value: strconv.Itoa(node.Length)},
+			graphMLData{Key: "betweenness", Value: strconv.FormatFloat(node.Betweenness, 'f', -1, 64)},
+			graphMLData{Key: "eigenvector", Value: strconv.FormatFloat(node.Eigenvector, 'f', -1, 64)},
+		)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: graphMLNodeID(node.ID), Data: data})
+	}
+
+	for i, link := range graph.Links {
+		edge := graphMLEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: graphMLNodeID(link.Source),
+			Target: graphMLNodeID(link.Target),
+			Data:   []graphMLData{{Key: "type", Value: link.Type}},
+		}
+		if directedEdgeTypes[link.Type] {
+			edge.Directed = "true"
+		}
+		weight := link.Weight
+		if link.Type == database.EdgeTypeSimilarity {
+			weight = link.Similarity
+			edge.Data = append(edge.Data, graphMLData{Key: "similarity", Value: strconv.FormatFloat(link.Similarity, 'f', -1, 64)})
+		}
+		if weight != 0 {
+			edge.Data = append(edge.Data, graphMLData{Key: "weight", Value: strconv.FormatFloat(weight, 'f', -1, 64)})
+		}
+		if link.Label != "" {
+			edge.Data = append(edge.Data, graphMLData{Key: "edge_label", Value: link.Label})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write GraphML: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func graphMLNodeID(id int) string {
+	return "n" + strconv.Itoa(id)
+}
@@ -0,0 +1,778 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// graphQLSchema complements the REST handlers with nested queries, such as
+// chunks with their nearest neighbors and the neighbors' summaries. Each
+// run is a document: one processed source file, or the snippets and
+// captures added through the API.
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# A chunk or passage by ID
+	chunk(id: Int!): Chunk
+	# Chunks in document order
+	chunks(document: String, section: String, language: String, keyword: String, includeOutliers: Boolean = false, offset: Int = 0, limit: Int = 100): [Chunk!]!
+	# Similarity links, most similar first
+	similarities(chunk: Int, minSimilarity: Float = 0, offset: Int = 0, limit: Int = 100): [Similarity!]!
+	# Clusters of chunks linked at or above threshold (default: the server's --cluster-threshold)
+	clusters(threshold: Float, minSize: Int = 1): [Cluster!]!
+	documents: [Document!]!
+}
+
+type Chunk {
+	id: Int!
+	stableId: String!
+	text: String!
+	index: Int!
+	summary: String!
+	# Readable heading, if generated with --titles or "bluffy retitle"
+	title: String
+	section: String
+	language: String
+	# markdown or code for chunks of Jupyter notebooks
+	kind: String
+	# Language the summaries were requested in with --summary-language
+	summaryLanguage: String
+	# Transcript speakers and time span in seconds
+	speaker: String
+	startSeconds: Float
+	endSeconds: Float
+	# Estimated token count for the embedding model
+	tokens: Int
+	# Emotional valence from -1 (negative) to 1 (positive), if scored
+	sentiment: Float
+	version: Int!
+	outlier: Boolean!
+	keywords: [String!]!
+	document: Document
+	# The most similar chunks, most similar first
+	neighbors(k: Int = 5, minSimilarity: Float = 0): [Neighbor!]!
+	# The chunk a passage was split from
+	parent: Chunk
+	passages: [Chunk!]!
+}
+
+type Neighbor {
+	chunk: Chunk!
+	similarity: Float!
+	distance: Float!
+}
+
+type Similarity {
+	source: Chunk!
+	target: Chunk!
+	similarity: Float!
+	distance: Float!
+}
+
+type Cluster {
+	id: Int!
+	label: String!
+	size: Int!
+	chunks: [Chunk!]!
+}
+
+type Document {
+	id: Int!
+	name: String!
+	source: String!
+	createdAt: String!
+	embeddingModel: String
+	embeddingProvider: String
+	embeddingDimensions: Int
+	# Whether embeddings were stored at unit length with process --normalize
+	normalized: Boolean!
+	title: String
+	date: String
+	tags: [String!]!
+	aliases: [String!]!
+	# The bibliography entry of documents processed with --bib
+	citation: Citation
+	chunks(offset: Int = 0, limit: Int = 100): [Chunk!]!
+}
+
+type Citation {
+	key: String!
+	# BibTeX entry type, e.g. article or book
+	type: String
+	authors: [String!]!
+	year: String
+	# Journal, book, publisher or institution
+	venue: String
+	doi: String
+	url: String
+	# Author-year label such as "Smith et al. 2020"
+	label: String!
+}
+`
+
+// maxGraphQLLimit caps the limit argument of list fields
+const maxGraphQLLimit = 1000
+
+// maxGraphQLDepth caps how deeply fields nest, e.g. neighbors of
+// neighbors, and maxGraphQLNodes how many objects one query resolves across
+// all its lists. Nested lists multiply, so the limit of each list alone
+// doesn't bound a query.
+const (
+	maxGraphQLDepth = 8
+	maxGraphQLNodes = 20000
+)
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type graphQLDataKey struct{}
+
+// handleGraphQL serves /graphql. Queries are accepted as a POST body or in
+// the query, operationName and variables URL parameters of a GET.
+func (s *APIServer) handleGraphQL(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if variables := r.URL.Query().Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+					respondWithError(w, fmt.Sprintf("Invalid variables: %v", err), http.StatusBadRequest)
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetBytes)).Decode(&req); err != nil {
+				respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			respondWithError(w, "query is required", http.StatusBadRequest)
+			return
+		}
+
+		db, err := s.openDB()
+		if err != nil {
+			respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		ctx := context.WithValue(r.Context(), graphQLDataKey{}, &graphQLData{db: db})
+		response := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// graphQLData loads the tables a query touches, once per request. Fields
+// are resolved concurrently, so every table is loaded under a sync.Once.
+type graphQLData struct {
+	db *database.DB
+
+	// nodes counts the objects returned by list fields so far
+	nodes atomic.Int64
+
+	chunksOnce sync.Once
+	chunks     []database.TextChunk
+	byID       map[int]*database.TextChunk
+	passages   map[int][]*database.TextChunk
+	chunksErr  error
+
+	similaritiesOnce sync.Once
+	similarities     []database.ChunkSimilarity
+	neighbors        map[int][]database.ChunkSimilarity
+	similaritiesErr  error
+
+	keywordsOnce sync.Once
+	keywords     map[int][]string
+	keywordsErr  error
+
+	runsOnce sync.Once
+	runs     []database.Run
+	runsErr  error
+}
+
+func graphQLDataFrom(ctx context.Context) *graphQLData {
+	return ctx.Value(graphQLDataKey{}).(*graphQLData)
+}
+
+func (d *graphQLData) loadChunks() error {
+	d.chunksOnce.Do(func() {
+		chunks, err := d.db.GetAllChunks()
+		if err != nil {
+			d.chunksErr = err
+			return
+		}
+		passages, err := d.db.GetPassages()
+		if err != nil {
+			d.chunksErr = err
+			return
+		}
+
+		d.chunks = chunks
+		d.byID = make(map[int]*database.TextChunk, len(chunks)+len(passages))
+		for i := range chunks {
+			d.byID[chunks[i].ID] = &chunks[i]
+		}
+		d.passages = make(map[int][]*database.TextChunk)
+		for i := range passages {
+			d.byID[passages[i].ID] = &passages[i]
+			d.passages[passages[i].ParentID] = append(d.passages[passages[i].ParentID], &passages[i])
+		}
+	})
+	return d.chunksErr
+}
+
+func (d *graphQLData) loadSimilarities() error {
+	d.similaritiesOnce.Do(func() {
+		similarities, err := d.db.GetAllSimilarities()
+		if err != nil {
+			d.similaritiesErr = err
+			return
+		}
+		sort.SliceStable(similarities, func(i, j int) bool {
+			return similarities[i].Similarity > similarities[j].Similarity
+		})
+
+		d.similarities = similarities
+		d.neighbors = make(map[int][]database.ChunkSimilarity)
+		for _, sim := range similarities {
+			d.neighbors[sim.ChunkID1] = append(d.neighbors[sim.ChunkID1], sim)
+			d.neighbors[sim.ChunkID2] = append(d.neighbors[sim.ChunkID2], sim)
+		}
+	})
+	return d.similaritiesErr
+}
+
+func (d *graphQLData) loadKeywords() error {
+	d.keywordsOnce.Do(func() {
+		keywords, err := d.db.GetAllKeywords()
+		if err != nil {
+			d.keywordsErr = err
+			return
+		}
+		d.keywords = make(map[int][]string)
+		for _, keyword := range keywords {
+			d.keywords[keyword.ChunkID] = append(d.keywords[keyword.ChunkID], keyword.Keyword)
+		}
+	})
+	return d.keywordsErr
+}
+
+func (d *graphQLData) loadRuns() error {
+	d.runsOnce.Do(func() {
+		d.runs, d.runsErr = d.db.GetRuns()
+	})
+	return d.runsErr
+}
+
+// spend counts n more resolved objects against maxGraphQLNodes
+func (d *graphQLData) spend(n int) error {
+	if d.nodes.Add(int64(n)) > maxGraphQLNodes {
+		return fmt.Errorf("query resolves more than %d objects; lower the limits of nested lists", maxGraphQLNodes)
+	}
+	return nil
+}
+
+// spendOn counts the objects of a list field against maxGraphQLNodes
+func spendOn[T any](ctx context.Context, list []T) ([]T, error) {
+	if err := graphQLDataFrom(ctx).spend(len(list)); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (d *graphQLData) chunk(id int) (*chunkResolver, error) {
+	if err := d.loadChunks(); err != nil {
+		return nil, err
+	}
+	chunk, ok := d.byID[id]
+	if !ok {
+		return nil, nil
+	}
+	return &chunkResolver{chunk: chunk}, nil
+}
+
+// window applies offset and limit to n items, returning the bounds of the
+// page
+func window(n int, offset, limit int32) (int, int, error) {
+	if offset < 0 || limit < 0 {
+		return 0, 0, fmt.Errorf("offset and limit must not be negative")
+	}
+	if limit > maxGraphQLLimit {
+		return 0, 0, fmt.Errorf("limit must be at most %d", maxGraphQLLimit)
+	}
+	start := int(offset)
+	if start > n {
+		start = n
+	}
+	end := start + int(limit)
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+type graphQLResolver struct {
+	s *APIServer
+}
+
+type chunkArgs struct {
+	ID int32
+}
+
+func (q *graphQLResolver) Chunk(ctx context.Context, args chunkArgs) (*chunkResolver, error) {
+	return graphQLDataFrom(ctx).chunk(int(args.ID))
+}
+
+type chunksArgs struct {
+	Document        *string
+	Section         *string
+	Language        *string
+	Keyword         *string
+	IncludeOutliers bool
+	Offset          int32
+	Limit           int32
+}
+
+func (q *graphQLResolver) Chunks(ctx context.Context, args chunksArgs) ([]*chunkResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadChunks(); err != nil {
+		return nil, err
+	}
+
+	runID := -1
+	if args.Document != nil {
+		if err := data.loadRuns(); err != nil {
+			return nil, err
+		}
+		for _, run := range data.runs {
+			if run.Name == *args.Document {
+				runID = run.ID
+			}
+		}
+		if runID < 0 {
+			return nil, fmt.Errorf("document %q not found", *args.Document)
+		}
+	}
+	var tagged map[int]bool
+	if args.Keyword != nil {
+		if err := data.loadKeywords(); err != nil {
+			return nil, err
+		}
+		tagged = make(map[int]bool)
+		keyword := strings.ToLower(strings.TrimSpace(*args.Keyword))
+		for id, keywords := range data.keywords {
+			for _, k := range keywords {
+				if k == keyword {
+					tagged[id] = true
+				}
+			}
+		}
+	}
+
+	var matched []*chunkResolver
+	for i := range data.chunks {
+		chunk := &data.chunks[i]
+		if chunk.IsOutlier && !args.IncludeOutliers {
+			continue
+		}
+		if runID >= 0 && chunk.RunID != runID {
+			continue
+		}
+		if args.Section != nil && chunk.Section != *args.Section {
+			continue
+		}
+		if args.Language != nil && chunk.Language != *args.Language {
+			continue
+		}
+		if tagged != nil && !tagged[chunk.ID] {
+			continue
+		}
+		matched = append(matched, &chunkResolver{chunk: chunk})
+	}
+
+	start, end, err := window(len(matched), args.Offset, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return spendOn(ctx, matched[start:end])
+}
+
+type similaritiesArgs struct {
+	Chunk         *int32
+	MinSimilarity float64
+	Offset        int32
+	Limit         int32
+}
+
+func (q *graphQLResolver) Similarities(ctx context.Context, args similaritiesArgs) ([]*similarityResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadSimilarities(); err != nil {
+		return nil, err
+	}
+
+	similarities := data.similarities
+	if args.Chunk != nil {
+		similarities = data.neighbors[int(*args.Chunk)]
+	}
+
+	var matched []*similarityResolver
+	for _, sim := range similarities {
+		if sim.Similarity < args.MinSimilarity {
+			// Sorted most similar first, so nothing later matches
+			break
+		}
+		matched = append(matched, &similarityResolver{sim: sim})
+	}
+
+	start, end, err := window(len(matched), args.Offset, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return spendOn(ctx, matched[start:end])
+}
+
+type clustersArgs struct {
+	Threshold *float64
+	MinSize   int32
+}
+
+func (q *graphQLResolver) Clusters(ctx context.Context, args clustersArgs) ([]*clusterResolver, error) {
+	var clusters []analysis.Cluster
+	if args.Threshold == nil {
+		derived, err := q.s.currentDerived()
+		if err != nil {
+			return nil, err
+		}
+		clusters = derived.Clusters
+	} else {
+		data := graphQLDataFrom(ctx)
+		if err := data.loadChunks(); err != nil {
+			return nil, err
+		}
+		if err := data.loadSimilarities(); err != nil {
+			return nil, err
+		}
+		clusters = analysis.FindClusters(data.chunks, data.similarities, *args.Threshold)
+	}
+
+	var result []*clusterResolver
+	for _, cluster := range clusters {
+		if len(cluster.ChunkIDs) >= int(args.MinSize) {
+			result = append(result, &clusterResolver{cluster: cluster})
+		}
+	}
+	return spendOn(ctx, result)
+}
+
+func (q *graphQLResolver) Documents(ctx context.Context) ([]*documentResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadRuns(); err != nil {
+		return nil, err
+	}
+	result := make([]*documentResolver, len(data.runs))
+	for i := range data.runs {
+		result[i] = &documentResolver{run: &data.runs[i]}
+	}
+	return spendOn(ctx, result)
+}
+
+type chunkResolver struct {
+	chunk *database.TextChunk
+}
+
+func (c *chunkResolver) ID() int32        { return int32(c.chunk.ID) }
+func (c *chunkResolver) StableID() string { return c.chunk.StableID }
+func (c *chunkResolver) Text() string     { return c.chunk.Text }
+func (c *chunkResolver) Index() int32     { return int32(c.chunk.ChunkIndex) }
+func (c *chunkResolver) Summary() string  { return c.chunk.Summary }
+func (c *chunkResolver) Version() int32   { return int32(c.chunk.Version) }
+func (c *chunkResolver) Outlier() bool    { return c.chunk.IsOutlier }
+
+func (c *chunkResolver) Title() *string    { return optionalString(c.chunk.Title) }
+func (c *chunkResolver) Section() *string  { return optionalString(c.chunk.Section) }
+func (c *chunkResolver) Language() *string { return optionalString(c.chunk.Language) }
+func (c *chunkResolver) Speaker() *string  { return optionalString(c.chunk.Speaker) }
+func (c *chunkResolver) Kind() *string     { return optionalString(c.chunk.Kind) }
+func (c *chunkResolver) SummaryLanguage() *string {
+	return optionalString(c.chunk.SummaryLanguage)
+}
+
+func (c *chunkResolver) StartSeconds() *float64 { return c.chunk.StartSeconds }
+func (c *chunkResolver) EndSeconds() *float64   { return c.chunk.EndSeconds }
+func (c *chunkResolver) Sentiment() *float64    { return c.chunk.Sentiment }
+
+func (c *chunkResolver) Tokens() *int32 {
+	if c.chunk.TokenCount == 0 {
+		return nil
+	}
+	tokens := int32(c.chunk.TokenCount)
+	return &tokens
+}
+
+func (c *chunkResolver) Keywords(ctx context.Context) ([]string, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadKeywords(); err != nil {
+		return nil, err
+	}
+	keywords := data.keywords[c.chunk.ID]
+	if keywords == nil {
+		keywords = []string{}
+	}
+	return keywords, nil
+}
+
+func (c *chunkResolver) Document(ctx context.Context) (*documentResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadRuns(); err != nil {
+		return nil, err
+	}
+	for i := range data.runs {
+		if data.runs[i].ID == c.chunk.RunID {
+			return &documentResolver{run: &data.runs[i]}, nil
+		}
+	}
+	return nil, nil
+}
+
+type neighborsArgs struct {
+	K             int32
+	MinSimilarity float64
+}
+
+func (c *chunkResolver) Neighbors(ctx context.Context, args neighborsArgs) ([]*neighborResolver, error) {
+	if args.K < 0 || args.K > maxGraphQLLimit {
+		return nil, fmt.Errorf("k must be between 0 and %d", maxGraphQLLimit)
+	}
+	data := graphQLDataFrom(ctx)
+	if err := data.loadSimilarities(); err != nil {
+		return nil, err
+	}
+
+	var result []*neighborResolver
+	for _, sim := range data.neighbors[c.chunk.ID] {
+		if len(result) == int(args.K) || sim.Similarity < args.MinSimilarity {
+			break
+		}
+		other := sim.ChunkID2
+		if other == c.chunk.ID {
+			other = sim.ChunkID1
+		}
+		result = append(result, &neighborResolver{id: other, sim: sim})
+	}
+	return spendOn(ctx, result)
+}
+
+func (c *chunkResolver) Parent(ctx context.Context) (*chunkResolver, error) {
+	if c.chunk.ParentID == 0 {
+		return nil, nil
+	}
+	return graphQLDataFrom(ctx).chunk(c.chunk.ParentID)
+}
+
+func (c *chunkResolver) Passages(ctx context.Context) ([]*chunkResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadChunks(); err != nil {
+		return nil, err
+	}
+	result := []*chunkResolver{}
+	for _, passage := range data.passages[c.chunk.ID] {
+		result = append(result, &chunkResolver{chunk: passage})
+	}
+	return spendOn(ctx, result)
+}
+
+type neighborResolver struct {
+	id  int
+	sim database.ChunkSimilarity
+}
+
+func (n *neighborResolver) Chunk(ctx context.Context) (*chunkResolver, error) {
+	return requireChunk(ctx, n.id)
+}
+
+func (n *neighborResolver) Similarity() float64 { return n.sim.Similarity }
+func (n *neighborResolver) Distance() float64   { return n.sim.Distance }
+
+type similarityResolver struct {
+	sim database.ChunkSimilarity
+}
+
+func (s *similarityResolver) Source(ctx context.Context) (*chunkResolver, error) {
+	return requireChunk(ctx, s.sim.ChunkID1)
+}
+
+func (s *similarityResolver) Target(ctx context.Context) (*chunkResolver, error) {
+	return requireChunk(ctx, s.sim.ChunkID2)
+}
+
+func (s *similarityResolver) Similarity() float64 { return s.sim.Similarity }
+func (s *similarityResolver) Distance() float64   { return s.sim.Distance }
+
+type clusterResolver struct {
+	cluster analysis.Cluster
+}
+
+func (c *clusterResolver) ID() int32     { return int32(c.cluster.ID) }
+func (c *clusterResolver) Label() string { return c.cluster.Label }
+func (c *clusterResolver) Size() int32   { return int32(len(c.cluster.ChunkIDs)) }
+
+func (c *clusterResolver) Chunks(ctx context.Context) ([]*chunkResolver, error) {
+	if err := graphQLDataFrom(ctx).spend(len(c.cluster.ChunkIDs)); err != nil {
+		return nil, err
+	}
+	result := make([]*chunkResolver, 0, len(c.cluster.ChunkIDs))
+	for _, id := range c.cluster.ChunkIDs {
+		chunk, err := requireChunk(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, chunk)
+	}
+	return result, nil
+}
+
+type documentResolver struct {
+	run *database.Run
+}
+
+func (d *documentResolver) ID() int32               { return int32(d.run.ID) }
+func (d *documentResolver) Name() string            { return d.run.Name }
+func (d *documentResolver) Source() string          { return d.run.Source }
+func (d *documentResolver) CreatedAt() string       { return d.run.CreatedAt }
+func (d *documentResolver) EmbeddingModel() *string { return optionalString(d.run.EmbeddingModel) }
+func (d *documentResolver) EmbeddingProvider() *string {
+	return optionalString(d.run.EmbeddingProvider)
+}
+
+func (d *documentResolver) EmbeddingDimensions() *int32 {
+	if d.run.EmbeddingDimensions == 0 {
+		return nil
+	}
+	dimensions := int32(d.run.EmbeddingDimensions)
+	return &dimensions
+}
+
+func (d *documentResolver) Normalized() bool { return d.run.Normalized }
+
+// Title, Date, Tags and Aliases come from the frontmatter of Markdown notes
+// or the bibliography entry of the document
+func (d *documentResolver) Title() *string {
+	if d.run.Metadata == nil {
+		return nil
+	}
+	return optionalString(d.run.Metadata.Title)
+}
+
+func (d *documentResolver) Date() *string {
+	if d.run.Metadata == nil {
+		return nil
+	}
+	return optionalString(d.run.Metadata.Date)
+}
+
+func (d *documentResolver) Tags() []string {
+	if d.run.Metadata == nil || d.run.Metadata.Tags == nil {
+		return []string{}
+	}
+	return d.run.Metadata.Tags
+}
+
+func (d *documentResolver) Aliases() []string {
+	if d.run.Metadata == nil || d.run.Metadata.Aliases == nil {
+		return []string{}
+	}
+	return d.run.Metadata.Aliases
+}
+
+func (d *documentResolver) Citation() *citationResolver {
+	if d.run.Metadata == nil || d.run.Metadata.Citation == nil {
+		return nil
+	}
+	return &citationResolver{d.run.Metadata.Citation}
+}
+
+type citationResolver struct {
+	citation *database.Citation
+}
+
+func (c *citationResolver) Key() string    { return c.citation.Key }
+func (c *citationResolver) Type() *string  { return optionalString(c.citation.Type) }
+func (c *citationResolver) Year() *string  { return optionalString(c.citation.Year) }
+func (c *citationResolver) Venue() *string { return optionalString(c.citation.Venue) }
+func (c *citationResolver) DOI() *string   { return optionalString(c.citation.DOI) }
+func (c *citationResolver) URL() *string   { return optionalString(c.citation.URL) }
+func (c *citationResolver) Label() string  { return c.citation.Label() }
+
+func (c *citationResolver) Authors() []string {
+	if c.citation.Authors == nil {
+		return []string{}
+	}
+	return c.citation.Authors
+}
+
+type documentChunksArgs struct {
+	Offset int32
+	Limit  int32
+}
+
+func (d *documentResolver) Chunks(ctx context.Context, args documentChunksArgs) ([]*chunkResolver, error) {
+	data := graphQLDataFrom(ctx)
+	if err := data.loadChunks(); err != nil {
+		return nil, err
+	}
+	var matched []*chunkResolver
+	for i := range data.chunks {
+		if data.chunks[i].RunID == d.run.ID {
+			matched = append(matched, &chunkResolver{chunk: &data.chunks[i]})
+		}
+	}
+	start, end, err := window(len(matched), args.Offset, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return spendOn(ctx, matched[start:end])
+}
+
+// requireChunk resolves a chunk that a similarity row or cluster refers to
+func requireChunk(ctx context.Context, id int) (*chunkResolver, error) {
+	chunk, err := graphQLDataFrom(ctx).chunk(id)
+	if err != nil {
+		return nil, err
+	}
+	if chunk == nil {
+		return nil, fmt.Errorf("chunk %d not found", id)
+	}
+	return chunk, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
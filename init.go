@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+	"github.com/spf13/cobra"
+)
+
+// benchmarkWorkerCounts are the worker pool sizes tried when measuring
+// embedding throughput
+var benchmarkWorkerCounts = []int{1, 2, 4, 8}
+
+// sampleDocument is processed at the end of init to check the whole pipeline
+const sampleDocument = `# The Lighthouse Keeper
+
+The lighthouse stood at the end of a narrow spit of rock, and for forty years the same family had kept its lamp burning. Every evening the keeper climbed the spiral stairs, trimmed the wick, and polished the great lens until it threw a clean white beam across the water.
+
+Ships passing in the night relied on that beam to find the channel between the reefs. On clear nights it could be seen for twenty miles; in fog the keeper sounded a horn every thirty seconds until dawn.
+
+# The Storm
+
+In the autumn of the last year the family kept the light, a storm came in from the west and lasted three days. Waves broke over the gallery rail and the lamp room windows cracked under the wind.
+
+The keeper's daughter spent the second night holding a canvas sheet across the broken glass so the flame would not go out. By morning the wind had dropped, and a fishing boat that had been lost in the dark came safely into the harbour.
+
+# Automation
+
+The following spring the lighthouse service installed an electric lamp with a clockwork timer. The family packed their belongings onto a cart and moved to the village, and the tower has been unmanned ever since.
+
+People still walk out along the rock on summer evenings to watch the beam come on by itself, and some of them say they can hear the old horn in the fog.
+`
+
+type initOptions struct {
+	ollamaHost string
+	configPath string
+	sampleDir  string
+	skipSample bool
+	yes        bool
+}
+
+func createInitCommand() *cobra.Command {
+	var opts initOptions
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Set up bluffy for first use",
+		Long:  "Detect the Ollama server, offer to pull the recommended models, benchmark embedding throughput to choose a worker count, write a starter config file, and process a sample document end-to-end.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if opts.configPath == "" {
+				paths := configPaths()
+				opts.configPath = paths[len(paths)-1]
+			}
+			if err := runInit(opts, bufio.NewReader(os.Stdin)); err != nil {
+				log.Fatalf("Setup failed: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.configPath, "write-config", "", "Where to write the starter config (default: user config directory)")
+	cmd.Flags().StringVar(&opts.sampleDir, "sample-dir", "bluffy-sample", "Directory for the sample document and its database")
+	cmd.Flags().BoolVar(&opts.skipSample, "skip-sample", false, "Don't process the sample document")
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "Answer yes to every prompt")
+
+	return cmd
+}
+
+func runInit(opts initOptions, input *bufio.Reader) error {
+	ask := func(question string) bool {
+		if opts.yes {
+			fmt.Printf("%s [Y/n] y\n", question)
+			return true
+		}
+		fmt.Printf("%s [Y/n] ", question)
+		answer, _ := input.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "" || answer == "y" || answer == "yes"
+	}
+
+	fmt.Printf("Step 1/5: Looking for Ollama at %s\n", opts.ollamaHost)
+	client := newOllamaClient(opts.ollamaHost, embedding.DefaultEmbeddingModel, embedding.DefaultGenerationModel, embedding.ClientOptions{})
+	if err := client.CheckConnection(); err != nil {
+		fmt.Println("Ollama is not reachable. Install it from https://ollama.com, start it with 'ollama serve', then run 'bluffy init' again.")
+		return err
+	}
+	fmt.Println("  Ollama is running")
+
+	fmt.Println("Step 2/5: Checking models")
+	missing, err := client.MissingModels()
+	if err != nil {
+		return err
+	}
+	for _, model := range missing {
+		if !ask(fmt.Sprintf("  Model %s is not installed. Pull it now?", model)) {
+			return fmt.Errorf("model %s is required; install it with 'ollama pull %s'", model, model)
+		}
+		fmt.Printf("  Pulling %s (this can take a few minutes)...\n", model)
+		if err := client.PullModel(model, newProgress(os.Stdout)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("  %s and %s are installed\n", embedding.DefaultEmbeddingModel, embedding.DefaultGenerationModel)
+
+	fmt.Println("Step 3/5: Benchmarking throughput")
+	workers, err := benchmarkWorkers(client)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if _, err := client.GetSummary(sampleParagraphs()[0]); err != nil {
+		return fmt.Errorf("failed to generate a test summary: %w", err)
+	}
+	fmt.Printf("  One summary took %s\n", time.Since(start).Round(time.Millisecond))
+	fmt.Printf("  Using %d workers\n", workers)
+
+	fmt.Printf("Step 4/5: Writing config to %s\n", opts.configPath)
+	if _, err := os.Stat(opts.configPath); err == nil && !ask("  A config file already exists. Overwrite it?") {
+		fmt.Println("  Keeping the existing config")
+	} else if err := writeStarterConfig(opts.configPath, opts.ollamaHost, workers); err != nil {
+		return err
+	}
+
+	if opts.skipSample {
+		fmt.Println("Step 5/5: Skipping the sample document")
+	} else {
+		fmt.Println("Step 5/5: Processing a sample document")
+		if err := os.MkdirAll(opts.sampleDir, 0755); err != nil {
+			return fmt.Errorf("failed to create sample directory: %w", err)
+		}
+		samplePath := filepath.Join(opts.sampleDir, "lighthouse.md")
+		if err := os.WriteFile(samplePath, []byte(sampleDocument), 0644); err != nil {
+			return fmt.Errorf("failed to write sample document: %w", err)
+		}
+		err := processFile(processOptions{
+			inputFile:      samplePath,
+			outputDir:      opts.sampleDir,
+			maxWorkers:     workers,
+			ollamaHost:     opts.ollamaHost,
+			embeddingModel: embedding.DefaultEmbeddingModel,
+			summaryModel:   embedding.DefaultGenerationModel,
+			burst:          1,
+			chunkSize:      textproc.DefaultChunkOptions.Size,
+			chunkOverlap:   textproc.DefaultChunkOptions.Overlap,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to process sample document: %w", err)
+		}
+	}
+
+	fmt.Println("\nSetup complete. Next steps:")
+	fmt.Println("  bluffy process -f your-document.md")
+	if !opts.skipSample {
+		fmt.Printf("  bluffy serve %s\n", filepath.Join(opts.sampleDir, "lighthouse_embeddings.db"))
+	}
+	return nil
+}
+
+// sampleParagraphs returns the non-empty paragraphs of the sample document
+func sampleParagraphs() []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(sampleDocument, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" && !strings.HasPrefix(paragraph, "#") {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// benchmarkWorkers embeds the sample paragraphs with increasing worker
+// counts and returns the count with the highest throughput. It stops early
+// once adding workers no longer helps.
+func benchmarkWorkers(client *embedding.OllamaClient) (int, error) {
+	paragraphs := sampleParagraphs()
+	// Repeat the paragraphs so each round has enough work for 8 workers
+	var texts []string
+	for len(texts) < 16 {
+		texts = append(texts, paragraphs...)
+	}
+
+	best, bestRate := 1, 0.0
+	for _, workers := range benchmarkWorkerCounts {
+		level, err := measureWorkers(client, texts, workers)
+		if err != nil {
+			return 0, fmt.Errorf("benchmark failed: %w", err)
+		}
+		fmt.Printf("  %d workers: %.1f embeddings/s\n", workers, level.rate)
+
+		if level.rate <= bestRate*1.1 {
+			break
+		}
+		best, bestRate = workers, level.rate
+	}
+	return best, nil
+}
+
+// writeStarterConfig writes a config file with a default profile that
+// records the Ollama host and benchmarked worker count
+func writeStarterConfig(path, ollamaHost string, workers int) error {
+	config := Config{
+		DefaultProfile: "default",
+		Profiles: map[string]Profile{
+			"default": {
+				allCommands: {"ollama-host": ollamaHost},
+				"process":   {"workers": workers},
+			},
+		},
+	}
+
+	return writeConfig(path, &config)
+}
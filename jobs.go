@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// Job types
+const (
+	jobTypeProcess  = "process"
+	jobTypeRecalc   = "recalc"
+	jobTypeClusters = "clusters"
+	jobTypeOutliers = "outliers"
+)
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+const (
+	// jobUpdatedEvent is sent to /api/events clients when a job starts,
+	// makes progress or finishes
+	jobUpdatedEvent = "job.updated"
+
+	// maxJobTextBytes limits the text of a process job, which may be a
+	// whole book
+	maxJobTextBytes = 32 << 20
+	// maxQueuedJobs is how many jobs may wait to run
+	maxQueuedJobs = 100
+	// maxFinishedJobs is how many finished jobs GET /api/jobs remembers
+	maxFinishedJobs = 100
+	// jobProgressInterval is how often a running job's progress is sent to
+	// /api/events clients
+	jobProgressInterval = 500 * time.Millisecond
+)
+
+// Job is a long-running operation queued with POST /api/jobs
+type Job struct {
+	ID       int          `json:"id"`
+	Type     string       `json:"type"`
+	Status   string       `json:"status"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	// Result is set once the job succeeded; its fields depend on the type
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// JobProgress is how far the current stage of a running job is
+type JobProgress struct {
+	Stage     string `json:"stage"`
+	Completed int    `json:"completed"`
+	Total     int    `json:"total"`
+}
+
+// jobRequest is the body of POST /api/jobs. The fields after Type apply to
+// the job type in their comment.
+type jobRequest struct {
+	Type string `json:"type"`
+
+	// process
+	Text    string `json:"text"`
+	Section string `json:"section"`
+	Run     string `json:"run"`
+
+	// recalc
+	Metric        string   `json:"metric"`
+	StoreTopK     int      `json:"store_top_k"`
+	MinSimilarity *float64 `json:"min_similarity"`
+	AllRuns       bool     `json:"all_runs"`
+
+	// outliers
+	Threshold float64 `json:"threshold"`
+}
+
+// jobWork runs a job, reporting its progress, and returns its result
+type jobWork func(reporter progress.Reporter) (interface{}, error)
+
+// queuedJob is a job waiting to run on the server that queued it
+type queuedJob struct {
+	server *APIServer
+	job    *Job
+	work   jobWork
+}
+
+// jobQueue runs a database's jobs one at a time in the order they were
+// queued, so expensive operations don't compete for Ollama and the
+// database. Jobs are kept in memory and lost when the process exits.
+type jobQueue struct {
+	mu sync.Mutex
+	// jobs holds the queued, running and most recently finished jobs,
+	// oldest first
+	jobs    []*Job
+	nextID  int
+	pending chan queuedJob
+	// events is the event hub of the database's current server, which
+	// job updates are sent to
+	events *eventHub
+}
+
+var (
+	jobQueuesMu sync.Mutex
+	// jobQueues holds the job queue of every database served, by path.
+	// A reload builds new servers but keeps their queues, so queued and
+	// finished jobs survive it.
+	jobQueues = make(map[string]*jobQueue)
+)
+
+// jobQueueFor returns the job queue of the database at dbPath, starting
+// it if the database wasn't served before, and sends its job updates to
+// events from now on
+func jobQueueFor(dbPath string, events *eventHub) *jobQueue {
+	jobQueuesMu.Lock()
+	defer jobQueuesMu.Unlock()
+
+	q, ok := jobQueues[dbPath]
+	if !ok {
+		q = &jobQueue{nextID: 1, pending: make(chan queuedJob, maxQueuedJobs)}
+		jobQueues[dbPath] = q
+		go q.run()
+	}
+	q.mu.Lock()
+	q.events = events
+	q.mu.Unlock()
+	return q
+}
+
+// run runs queued jobs for as long as the process lives, each with the
+// server that queued it
+func (q *jobQueue) run() {
+	for queued := range q.pending {
+		queued.server.runJob(queued)
+	}
+}
+
+func (s *APIServer) runJob(queued queuedJob) {
+	job := queued.job
+	s.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.Status = jobRunning
+		job.StartedAt = &now
+	})
+
+	result, err := queued.work(&jobReporter{s: s, job: job})
+
+	s.updateJob(job, func() {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = jobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = jobSucceeded
+		job.Result = result
+	})
+	if err != nil {
+		log.Printf("Job %d (%s) failed: %v", job.ID, job.Type, err)
+	} else {
+		log.Printf("Job %d (%s) finished", job.ID, job.Type)
+	}
+}
+
+// enqueue queues work as a job of type jobType
+func (s *APIServer) enqueue(jobType string, work jobWork) (Job, error) {
+	q := s.jobs
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := &Job{ID: q.nextID, Type: jobType, Status: jobQueued, CreatedAt: time.Now().UTC()}
+	select {
+	case q.pending <- queuedJob{server: s, job: job, work: work}:
+	default:
+		return Job{}, fmt.Errorf("%d jobs are already queued; try again once some have finished", maxQueuedJobs)
+	}
+	q.nextID++
+	q.jobs = append(q.jobs, job)
+	q.forgetFinished()
+	return *job, nil
+}
+
+// forgetFinished drops the oldest finished jobs beyond maxFinishedJobs
+func (q *jobQueue) forgetFinished() {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.FinishedAt != nil {
+			finished++
+		}
+	}
+	kept := q.jobs[:0]
+	for _, job := range q.jobs {
+		if job.FinishedAt != nil && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+}
+
+// updateJob changes a job under the queue's lock and tells /api/events
+// clients
+func (s *APIServer) updateJob(job *Job, update func()) {
+	s.jobs.mu.Lock()
+	update()
+	snapshot := *job
+	s.jobs.forgetFinished()
+	events := s.jobs.events
+	s.jobs.mu.Unlock()
+
+	events.publish(changeEvent{
+		Event:      jobUpdatedEvent,
+		Database:   s.dbPath,
+		ModifiedAt: time.Now().UTC(),
+		Job:        &snapshot,
+	})
+}
+
+// job returns a copy of the job with the given ID
+func (q *jobQueue) job(id int) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// list returns copies of every job, newest first
+func (q *jobQueue) list() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[len(jobs)-1-i] = *job
+	}
+	return jobs
+}
+
+// jobReporter records the progress of a running job, sending it to
+// /api/events clients at most every jobProgressInterval and when a stage
+// finishes
+type jobReporter struct {
+	s    *APIServer
+	job  *Job
+	mu   sync.Mutex
+	sent time.Time
+}
+
+func (r *jobReporter) Report(stage string, completed, total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update := func() {
+		r.job.Progress = &JobProgress{Stage: stage, Completed: completed, Total: total}
+	}
+	if completed < total && time.Since(r.sent) < jobProgressInterval {
+		r.s.jobs.mu.Lock()
+		update()
+		r.s.jobs.mu.Unlock()
+		return
+	}
+	r.sent = time.Now()
+	r.s.updateJob(r.job, update)
+}
+
+// handleJobs serves /api/jobs: GET lists the queued, running and recently
+// finished jobs, newest first, and POST queues a job
+func (s *APIServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondWithJSON(w, s.jobs.list())
+	case http.MethodPost:
+		s.handleCreateJob(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleJob serves GET /api/jobs/{id}: the status, progress and result of
+// a job
+func (s *APIServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/jobs/"))
+	if err != nil {
+		respondWithError(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, ok := s.jobs.job(id)
+	if !ok {
+		respondWithError(w, fmt.Sprintf("job %d not found", id), http.StatusNotFound)
+		return
+	}
+	respondWithJSON(w, job)
+}
+
+func (s *APIServer) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobTextBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var work jobWork
+	var err error
+	switch req.Type {
+	case jobTypeProcess:
+		work, err = s.processJob(req)
+	case jobTypeRecalc:
+		work, err = s.recalcJob(req)
+	case jobTypeClusters:
+		work = s.clustersJob
+	case jobTypeOutliers:
+		work, err = s.outliersJob(req)
+	default:
+		err = fmt.Errorf("unknown job type %q (valid types: %s, %s, %s, %s)", req.Type, jobTypeProcess, jobTypeRecalc, jobTypeClusters, jobTypeOutliers)
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Clustering only reads the database
+	if req.Type != jobTypeClusters && s.readonly {
+		respondWithError(w, fmt.Sprintf("Server is read-only; restart it with --readonly=false to enable %s jobs", req.Type), http.StatusForbidden)
+		return
+	}
+
+	job, err := s.enqueue(req.Type, work)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	respondWithJSON(w, job)
+}
+
+// processJobResult is the result of a process job
+type processJobResult struct {
+	Run    string `json:"run"`
+	Chunks []int  `json:"chunk_ids"`
+}
+
+// processJob chunks text now, so bad input is rejected before it is
+// queued, and returns the work of embedding, summarizing and storing it
+// as POST /api/chunks does
+func (s *APIServer) processJob(req jobRequest) (jobWork, error) {
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, fmt.Errorf("text is required")
+	}
+	runName := strings.TrimSpace(req.Run)
+	if runName == "" {
+		runName = snippetRunName
+	}
+	pieces, err := textproc.ChunkText(req.Text, textproc.DefaultChunkOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk text: %w", err)
+	}
+	texts := make([]string, len(pieces))
+	for i, piece := range pieces {
+		texts[i] = piece.Text
+	}
+
+	return func(reporter progress.Reporter) (interface{}, error) {
+		stored, _, _, err := s.ingestChunks(texts, strings.TrimSpace(req.Section), runName, reporter)
+		if err != nil {
+			return nil, err
+		}
+		result := processJobResult{Run: runName, Chunks: make([]int, len(stored))}
+		for i, chunk := range stored {
+			result.Chunks[i] = chunk.ID
+		}
+		return result, nil
+	}, nil
+}
+
+// recalcJob recalculates the similarities as the recalc command does
+func (s *APIServer) recalcJob(req jobRequest) (jobWork, error) {
+	if err := similarity.ValidateMetric(req.Metric); err != nil {
+		return nil, err
+	}
+	if req.StoreTopK < 0 {
+		return nil, fmt.Errorf("store_top_k must not be negative, got %d", req.StoreTopK)
+	}
+	opts := recalcOptions{
+		dbPath:         s.dbPath,
+		metric:         req.Metric,
+		storeTopK:      req.StoreTopK,
+		allRuns:        req.AllRuns,
+		keepSequential: true,
+		out:            log.Writer(),
+	}
+	if req.MinSimilarity != nil {
+		opts.minSimilarity, opts.minSimilaritySet = *req.MinSimilarity, true
+	}
+
+	return func(reporter progress.Reporter) (interface{}, error) {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+
+		opts.reporter = reporter
+		return recalculate(opts)
+	}, nil
+}
+
+// clustersJob recomputes the stats, clusters and centrality served by
+// /api/stats and /api/clusters
+func (s *APIServer) clustersJob(reporter progress.Reporter) (interface{}, error) {
+	data, err := s.refreshDerived()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"computed_at": data.ComputedAt,
+		"threshold":   data.ClusterThreshold,
+		"clusters":    len(data.Clusters),
+	}, nil
+}
+
+// outliersJob flags outliers as the outliers command does
+func (s *APIServer) outliersJob(req jobRequest) (jobWork, error) {
+	threshold := req.Threshold
+	if threshold == 0 {
+		threshold = defaultOutlierThreshold
+	}
+	if threshold < 0 {
+		return nil, fmt.Errorf("threshold must be positive, got %g", threshold)
+	}
+
+	return func(reporter progress.Reporter) (interface{}, error) {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+
+		db, err := s.openDB()
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+
+		outliers, chunks, err := flagOutliers(db, threshold)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int, len(outliers))
+		for i, outlier := range outliers {
+			ids[i] = outlier.ChunkID
+		}
+		return map[string]interface{}{
+			"chunks":      len(chunks),
+			"outlier_ids": ids,
+		}, nil
+	}, nil
+}
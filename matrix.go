@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// maxDenseMatrixChunks limits format=dense, which grows with the square of
+// the number of chunks
+const maxDenseMatrixChunks = 2000
+
+// MatrixData is the similarity matrix of the chunks, for heatmap views.
+// Chunks labels both the rows and the columns.
+type MatrixData struct {
+	Order  string        `json:"order"`
+	Chunks []MatrixChunk `json:"chunks"`
+	// Values is the dense matrix; null where no similarity is stored, such
+	// as between chunks embedded with different models
+	Values [][]*float64 `json:"values,omitempty"`
+	// Cells is the sparse matrix: the upper triangle (row < col) at or
+	// above min_similarity
+	Cells []MatrixCell `json:"cells,omitempty"`
+}
+
+// MatrixChunk labels a row and column of the matrix
+type MatrixChunk struct {
+	ID      int    `json:"id"`
+	Index   int    `json:"index"`
+	Summary string `json:"summary"`
+	Section string `json:"section,omitempty"`
+	Cluster int    `json:"cluster"`
+}
+
+// MatrixCell is one entry of a sparse matrix
+type MatrixCell struct {
+	Row        int     `json:"row"`
+	Col        int     `json:"col"`
+	Similarity float64 `json:"similarity"`
+}
+
+// handleMatrix serves /api/matrix. order=index (default) keeps the chunks
+// in narrative order, so repeated themes show up as off-diagonal blocks;
+// order=cluster groups them by similarity cluster, largest first.
+func (s *APIServer) handleMatrix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	order := r.URL.Query().Get("order")
+	if order == "" {
+		order = "index"
+	}
+	if order != "index" && order != "cluster" {
+		respondWithError(w, fmt.Sprintf("unknown order %q (valid orders: index, cluster)", order), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "dense"
+	}
+	if format != "dense" && format != "sparse" {
+		respondWithError(w, fmt.Sprintf("unknown format %q (valid formats: dense, sparse)", format), http.StatusBadRequest)
+		return
+	}
+	minSimilarity := 0.0
+	if sim := r.URL.Query().Get("min_similarity"); sim != "" {
+		parsed, err := strconv.ParseFloat(sim, 64)
+		if err != nil {
+			respondWithError(w, "invalid min_similarity parameter", http.StatusBadRequest)
+			return
+		}
+		minSimilarity = parsed
+	}
+	threshold := s.clusterThreshold
+	if value := r.URL.Query().Get("cluster_threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			respondWithError(w, "invalid cluster_threshold parameter", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	all, err := db.GetAllChunks()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	similarities, err := db.GetAllSimilarities()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get similarities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Same node filters as /api/graph
+	includeOutliers := r.URL.Query().Get("include_outliers") == "true"
+	languages := parseLanguages(r.URL.Query())
+	var chunks []database.TextChunk
+	for _, chunk := range all {
+		if chunk.IsOutlier && !includeOutliers {
+			continue
+		}
+		if languages != nil && !languages[chunk.Language] {
+			continue
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if format == "dense" && len(chunks) > maxDenseMatrixChunks {
+		respondWithError(w, fmt.Sprintf("%d chunks is too many for a dense matrix (at most %d); use format=sparse", len(chunks), maxDenseMatrixChunks), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSON(w, buildMatrix(chunks, similarities, order, format, minSimilarity, threshold))
+}
+
+// buildMatrix orders chunks and lays out their similarities as a dense or
+// sparse matrix. Chunks are clustered either way so the frontend can color
+// rows by cluster.
+func buildMatrix(chunks []database.TextChunk, similarities []database.ChunkSimilarity, order, format string, minSimilarity, threshold float64) MatrixData {
+	clusterOf := make(map[int]int, len(chunks))
+	for _, cluster := range analysis.FindClusters(chunks, similarities, threshold) {
+		for _, id := range cluster.ChunkIDs {
+			clusterOf[id] = cluster.ID
+		}
+	}
+
+	ordered := make([]database.TextChunk, len(chunks))
+	copy(ordered, chunks)
+	if order == "cluster" {
+		// Clusters are numbered largest first; within a cluster chunks
+		// keep their narrative order
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return clusterOf[ordered[i].ID] < clusterOf[ordered[j].ID]
+		})
+	}
+
+	data := MatrixData{Order: order, Chunks: make([]MatrixChunk, len(ordered))}
+	position := make(map[int]int, len(ordered))
+	for i, chunk := range ordered {
+		position[chunk.ID] = i
+		data.Chunks[i] = MatrixChunk{
+			ID:      chunk.ID,
+			Index:   chunk.ChunkIndex,
+			Summary: chunk.Summary,
+			Section: chunk.Section,
+			Cluster: clusterOf[chunk.ID],
+		}
+	}
+
+	if format == "dense" {
+		one := 1.0
+		data.Values = make([][]*float64, len(ordered))
+		for i := range data.Values {
+			data.Values[i] = make([]*float64, len(ordered))
+			data.Values[i][i] = &one
+		}
+		for _, sim := range similarities {
+			row, ok1 := position[sim.ChunkID1]
+			col, ok2 := position[sim.ChunkID2]
+			if !ok1 || !ok2 {
+				continue
+			}
+			value := sim.Similarity
+			data.Values[row][col] = &value
+			data.Values[col][row] = &value
+		}
+		return data
+	}
+
+	data.Cells = []MatrixCell{}
+	for _, sim := range similarities {
+		row, ok1 := position[sim.ChunkID1]
+		col, ok2 := position[sim.ChunkID2]
+		if !ok1 || !ok2 || sim.Similarity < minSimilarity {
+			continue
+		}
+		if row > col {
+			row, col = col, row
+		}
+		data.Cells = append(data.Cells, MatrixCell{Row: row, Col: col, Similarity: sim.Similarity})
+	}
+	sort.Slice(data.Cells, func(i, j int) bool {
+		if data.Cells[i].Row != data.Cells[j].Row {
+			return data.Cells[i].Row < data.Cells[j].Row
+		}
+		return data.Cells[i].Col < data.Cells[j].Col
+	})
+	return data
+}
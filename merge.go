@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+type mergeOptions struct {
+	outPath     string
+	inputs      []string
+	crossLinks  bool
+	allowModels bool
+}
+
+func createMergeCommand() *cobra.Command {
+	var opts mergeOptions
+
+	cmd := &cobra.Command{
+		Use:   "merge <out.db> <in1.db> <in2.db> [more.db...]",
+		Short: "Combine several databases into one",
+		Long:  "Copy the runs, chunks, passages, similarities, edges, citations, keywords and entities of each input database into a new database, assigning new chunk IDs. Inputs must use the same embedding dimensions and, where recorded, the same embedding model.",
+		Args:  cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.outPath = args[0]
+			opts.inputs = args[1:]
+			if err := mergeDatabases(opts); err != nil {
+				log.Fatalf("Error merging databases: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.crossLinks, "cross-similarities", false, "Calculate similarities between chunks that came from different inputs so the merged graph is connected")
+	cmd.Flags().BoolVar(&opts.allowModels, "allow-model-mismatch", false, "Merge inputs recorded with different embedding models if their dimensions match")
+
+	return cmd
+}
+
+func mergeDatabases(opts mergeOptions) error {
+	if _, err := os.Stat(opts.outPath); err == nil {
+		return fmt.Errorf("%s already exists; merge writes a new database", opts.outPath)
+	}
+
+	inputs := make([]*database.DB, 0, len(opts.inputs))
+	defer func() {
+		for _, db := range inputs {
+			db.Close()
+		}
+	}()
+	for _, path := range opts.inputs {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot access database: %w", err)
+		}
+		db, err := database.OpenDB(path)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, db)
+
+		version, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		if version < database.LatestSchemaVersion() {
+			return fmt.Errorf("%s is at schema version %d; run 'bluffy migrate %s' first", path, version, path)
+		}
+	}
+
+	if err := checkMergeCompatible(opts.inputs, inputs, opts.allowModels); err != nil {
+		return err
+	}
+	metric, err := mergedSimilarityMetric(opts.inputs, inputs)
+	if err != nil {
+		return err
+	}
+
+	out, err := database.CreateDB(opts.outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer out.Close()
+
+	// Don't leave a partial merge behind
+	merged := false
+	defer func() {
+		if !merged {
+			out.Close()
+			os.Remove(opts.outPath)
+		}
+	}()
+
+	if err := out.SetSimilarityMetric(metric); err != nil {
+		return err
+	}
+
+	// groups holds the merged chunks of each input, for cross similarities
+	groups := make([][]database.TextChunk, len(inputs))
+	var outliers []int
+	// neighborsK keeps the most nearest neighbors any input stored
+	neighborsK := 0
+	for i, db := range inputs {
+		k, err := db.NeighborsK()
+		if err != nil {
+			return err
+		}
+		neighborsK = max(neighborsK, k)
+
+		label := strings.TrimSuffix(filepath.Base(opts.inputs[i]), filepath.Ext(opts.inputs[i]))
+		report, err := out.Merge(db, label)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %w", opts.inputs[i], err)
+		}
+		fmt.Printf("%s: %d runs, %d chunks, %d passages, %d similarities, %d edges, %d citations, %d keywords, %d entities, %d tags\n",
+			opts.inputs[i], report.Runs, report.Chunks, report.Passages, report.Similarities, report.Edges, report.Citations, report.Keywords, report.Entities, report.Tags)
+
+		chunks, err := db.GetAllChunks()
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			chunk.ID = report.ChunkIDs[chunk.ID]
+			if chunk.IsOutlier {
+				outliers = append(outliers, chunk.ID)
+			}
+			groups[i] = append(groups[i], chunk)
+		}
+	}
+	if len(outliers) > 0 {
+		if err := out.SetOutliers(outliers); err != nil {
+			return err
+		}
+	}
+
+	// Wikilinks between notes that were processed into separate databases
+	// only resolve once the notes share one
+	linked, err := storeWikilinks(out)
+	if err != nil {
+		return err
+	}
+	if linked > 0 {
+		fmt.Printf("Linked %d chunk pairs by wikilinks\n", linked)
+	}
+
+	if opts.crossLinks {
+		fmt.Println("Calculating similarities between inputs...")
+		total, err := storeCrossSimilarities(out, groups)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d cross-input similarities\n", total)
+	}
+
+	if neighborsK > 0 {
+		if err := storeNeighbors(out, neighborsK); err != nil {
+			return err
+		}
+	}
+
+	merged = true
+	fmt.Printf("Merged %d databases into %s\n", len(inputs), opts.outPath)
+	return nil
+}
+
+// storeCrossSimilarities compares each chunk with the chunks of the groups
+// before its own that were embedded by the same model, storing the
+// similarities between chunks of different groups. It returns how many were
+// stored.
+func storeCrossSimilarities(db *database.DB, groups [][]database.TextChunk) (int, error) {
+	metric, err := db.SimilarityMetric()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var earlier []database.TextChunk
+	for _, group := range groups {
+		for _, chunk := range group {
+			if len(earlier) == 0 {
+				break
+			}
+			similarities, err := similarity.SimilaritiesTo(chunk, embeddedWith(earlier, chunk.EmbeddingModel), metric)
+			if err != nil {
+				return total, err
+			}
+			if err := db.BatchInsertSimilarities(similarities); err != nil {
+				return total, err
+			}
+			total += len(similarities)
+		}
+		earlier = append(earlier, group...)
+	}
+	return total, nil
+}
+
+// mergedSimilarityMetric returns the similarity metric shared by the
+// inputs, failing if they were recalculated with different ones
+func mergedSimilarityMetric(paths []string, inputs []*database.DB) (string, error) {
+	metrics := make([]string, len(inputs))
+	for i, db := range inputs {
+		metric, err := db.SimilarityMetric()
+		if err != nil {
+			return "", err
+		}
+		if metric == "" {
+			metric = similarity.MetricCosine
+		}
+		metrics[i] = metric
+		if metric != metrics[0] {
+			return "", fmt.Errorf("%s scores similarities by %s but %s by %s; run 'bluffy recalc --metric' on one of them first", paths[0], metrics[0], paths[i], metric)
+		}
+	}
+	return metrics[0], nil
+}
+
+// checkMergeCompatible fails if the inputs' embeddings of one model have
+// different dimensions or were projected, or if their runs record different
+// embedding models. Chunks routed to a model of their own by process
+// --language-model only have to match the chunks of that model.
+func checkMergeCompatible(paths []string, inputs []*database.DB, allowModels bool) error {
+	dimensions := make(map[string]int)
+	dimensionsFrom := make(map[string]string)
+	models := make(map[string]bool)
+
+	for i, db := range inputs {
+		// Each projection has components of its own, so projected
+		// embeddings of different databases don't compare
+		projection, err := db.Projection()
+		if err != nil {
+			return err
+		}
+		if projection != nil {
+			return fmt.Errorf("the embeddings of %s were projected to %d dimensions; merge databases with full-size embeddings and project the merged one", paths[i], projection.Dimensions())
+		}
+
+		chunks, err := db.GetAllChunks()
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			expected, ok := dimensions[chunk.EmbeddingModel]
+			if !ok {
+				dimensions[chunk.EmbeddingModel], dimensionsFrom[chunk.EmbeddingModel] = len(chunk.Embedding), paths[i]
+				continue
+			}
+			if len(chunk.Embedding) != expected {
+				return fmt.Errorf("%s has %d-dimensional embeddings but %s has %d; inputs must use the same embedding model",
+					paths[i], len(chunk.Embedding), dimensionsFrom[chunk.EmbeddingModel], expected)
+			}
+		}
+
+		runs, err := db.GetRuns()
+		if err != nil {
+			return err
+		}
+		for _, run := range runs {
+			if run.EmbeddingModel != "" {
+				models[run.EmbeddingModel] = true
+			}
+		}
+	}
+
+	if len(models) > 1 && !allowModels {
+		var names []string
+		for model := range models {
+			names = append(names, model)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("inputs were embedded with different models (%s); pass --allow-model-mismatch to merge anyway", strings.Join(names, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// databaseDirectory serves every .db file in a directory, each under
+// /api/{dbname}/ where dbname is the file name without its extension.
+// The directory is rescanned whenever an unknown name is requested or the
+// database list is fetched, so new databases are picked up without a restart.
+type databaseDirectory struct {
+	dir             string
+	opts            serveOptions
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	databases map[string]*mountedDatabase
+	// stopped is set once the directory is replaced by a reload, so
+	// requests still in flight don't mount databases nothing will stop
+	stopped bool
+}
+
+type mountedDatabase struct {
+	server  *APIServer
+	handler http.Handler
+}
+
+// DatabaseInfo describes a database available in directory mode
+type DatabaseInfo struct {
+	Name     string    `json:"name"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func newDatabaseDirectory(opts serveOptions, refreshInterval time.Duration) *databaseDirectory {
+	return &databaseDirectory{
+		dir:             opts.dbPath,
+		opts:            opts,
+		refreshInterval: refreshInterval,
+		databases:       make(map[string]*mountedDatabase),
+	}
+}
+
+func (d *databaseDirectory) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/databases", enableCORS(d.handleDatabases))
+	mux.HandleFunc("/api/", d.handleDatabaseRoute)
+	return mux
+}
+
+// scan discovers .db files in the directory, mounting new ones and
+// unmounting ones that were removed
+func (d *databaseDirectory) scan() ([]DatabaseInfo, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database directory: %w", err)
+	}
+
+	var infos []DatabaseInfo
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".db" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, DatabaseInfo{
+			Name:     strings.TrimSuffix(entry.Name(), ".db"),
+			File:     entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		present[info.Name] = true
+		if _, ok := d.databases[info.Name]; ok || d.stopped {
+			continue
+		}
+
+		path := filepath.Join(d.dir, info.File)
+		if d.opts.readonly {
+			if err := migrateServedDB(path); err != nil {
+				log.Printf("Warning: failed to migrate %s: %v", info.File, err)
+			}
+		}
+		server := newAPIServer(path, d.opts)
+		if d.refreshInterval > 0 {
+			server.scheduleRefresh(d.refreshInterval)
+		}
+		if d.opts.watchInterval > 0 {
+			server.watchDatabase(d.opts.watchInterval)
+		}
+		d.databases[info.Name] = &mountedDatabase{server: server, handler: server.routes()}
+		log.Printf("Mounted database %s at /api/%s/", info.File, info.Name)
+	}
+
+	for name, mounted := range d.databases {
+		if !present[name] {
+			mounted.server.stop()
+			delete(d.databases, name)
+			log.Printf("Unmounted database %s (file removed)", name)
+		}
+	}
+
+	return infos, nil
+}
+
+// stop stops every mounted database's server
+func (d *databaseDirectory) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+	for _, mounted := range d.databases {
+		mounted.server.stop()
+	}
+}
+
+func (d *databaseDirectory) lookup(name string) (*mountedDatabase, error) {
+	d.mu.Lock()
+	mounted, ok := d.databases[name]
+	d.mu.Unlock()
+	if ok {
+		return mounted, nil
+	}
+
+	if _, err := d.scan(); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.databases[name], nil
+}
+
+func (d *databaseDirectory) handleDatabases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	infos, err := d.scan()
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if infos == nil {
+		infos = []DatabaseInfo{}
+	}
+
+	respondWithJSON(w, infos)
+}
+
+// handleDatabaseRoute forwards /api/{dbname}/rest to the mounted database's
+// own /api/rest handler
+func (d *databaseDirectory) handleDatabaseRoute(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/")
+	name, route, found := strings.Cut(rest, "/")
+	if !found || name == "" || route == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	mounted, err := d.lookup(name)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mounted == nil {
+		respondWithError(w, fmt.Sprintf("Database %q not found", name), http.StatusNotFound)
+		return
+	}
+
+	forwarded := r.Clone(r.Context())
+	forwarded.URL.Path = "/api/" + route
+	forwarded.URL.RawPath = ""
+	mounted.handler.ServeHTTP(w, forwarded)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// neighborsOptions holds the settings for a neighbors lookup
+type neighborsOptions struct {
+	dbPath        string
+	chunkID       int
+	top           int
+	minSimilarity float64
+	json          bool
+}
+
+// NeighborsResult is a chunk and the chunks most similar to it
+type NeighborsResult struct {
+	Chunk     Node          `json:"chunk"`
+	Neighbors []QuickResult `json:"neighbors"`
+}
+
+func createNeighborsCommand() *cobra.Command {
+	var opts neighborsOptions
+
+	cmd := &cobra.Command{
+		Use:   "neighbors <database.db>",
+		Short: "Print a chunk and the chunks most similar to it",
+		Long:  "Print a chunk's summary and text followed by its nearest neighbors, ranked by the similarities stored when the database was processed. Nothing is embedded, so Ollama is not needed.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runNeighbors(os.Stdout, opts); err != nil {
+				log.Fatalf("Error finding neighbors: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.chunkID, "chunk", "c", 0, "ID of the chunk whose neighbors are printed")
+	cmd.Flags().IntVarP(&opts.top, "top", "k", 10, "Number of neighbors")
+	cmd.Flags().Float64Var(&opts.minSimilarity, "min-similarity", 0, "Leave out neighbors less similar than this")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the chunk and its neighbors as JSON")
+	cmd.MarkFlagRequired("chunk")
+
+	return cmd
+}
+
+func runNeighbors(out io.Writer, opts neighborsOptions) error {
+	if opts.top <= 0 {
+		return fmt.Errorf("top must be positive, got %d", opts.top)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chunk, err := db.GetChunk(opts.chunkID)
+	if errors.Is(err, database.ErrChunkNotFound) {
+		return fmt.Errorf("no chunk with ID %d in %s", opts.chunkID, opts.dbPath)
+	}
+	if err != nil {
+		return err
+	}
+	if chunk.ParentID != 0 {
+		return fmt.Errorf("chunk %d is a passage of chunk %d; passages are not linked by similarity, use --chunk %d", chunk.ID, chunk.ParentID, chunk.ParentID)
+	}
+
+	// chunk_neighbors answers without reading the chunk's other similarities
+	similarities, ok, err := db.GetChunkNeighbors(chunk.ID, opts.minSimilarity, opts.top)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		similarities, err = db.GetChunkSimilarities(chunk.ID, opts.minSimilarity, opts.top)
+		if err != nil {
+			return err
+		}
+	}
+	ids := make([]int, len(similarities))
+	for i, sim := range similarities {
+		ids[i] = sim.ChunkID1
+		if ids[i] == chunk.ID {
+			ids[i] = sim.ChunkID2
+		}
+	}
+	neighbors, err := db.GetChunksByID(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]database.TextChunk, len(neighbors))
+	for _, neighbor := range neighbors {
+		byID[neighbor.ID] = neighbor
+	}
+
+	result := NeighborsResult{Chunk: newNode(*chunk), Neighbors: make([]QuickResult, 0, len(ids))}
+	for i, id := range ids {
+		neighbor, ok := byID[id]
+		if !ok {
+			continue
+		}
+		result.Neighbors = append(result.Neighbors, newQuickResult(neighbor, similarities[i].Similarity))
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return writeNeighbors(out, result)
+}
+
+// writeNeighbors prints the chunk followed by a table of its neighbors
+func writeNeighbors(out io.Writer, result NeighborsResult) error {
+	chunk := result.Chunk
+	fmt.Fprintf(out, "Chunk %d (index %d", chunk.ID, chunk.Index)
+	if chunk.Section != "" {
+		fmt.Fprintf(out, ", section %q", chunk.Section)
+	}
+	fmt.Fprintf(out, "): %s\n\n%s\n\n", chunk.Summary, chunk.Text)
+
+	if len(result.Neighbors) == 0 {
+		fmt.Fprintln(out, "No neighbors found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Rank\tSimilarity\tID\tIndex\tSummary")
+	for i, neighbor := range result.Neighbors {
+		fmt.Fprintf(w, "%d\t%.4f\t%d\t%d\t%s\n", i+1, neighbor.Similarity, neighbor.ID, neighbor.Index, tsvField(neighbor.Summary))
+	}
+	return w.Flush()
+}
+
+// defaultNeighborsK is how many nearest neighbors process stores per chunk
+const defaultNeighborsK = 10
+
+// storeNeighbors rebuilds the chunk_neighbors table with the k nearest
+// neighbors of every chunk. With k 0 the table isn't built, but one built
+// by an earlier run is refreshed so it doesn't go stale.
+func storeNeighbors(db *database.DB, k int) error {
+	if k <= 0 {
+		return db.RefreshNeighbors()
+	}
+	stored, err := db.RebuildNeighbors(k)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stored %d nearest-neighbor rows (k = %d)\n", stored, k)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// defaultOutlierThreshold is how many standard deviations below the mean
+// a chunk's average similarity must be to flag it
+const defaultOutlierThreshold = 2.0
+
+func createOutliersCommand() *cobra.Command {
+	var threshold float64
+
+	cmd := &cobra.Command{
+		Use:   "outliers <database.db>",
+		Short: "Flag chunks that are unlike the rest of the corpus",
+		Long:  "Find chunks whose average similarity to every other chunk is unusually low (OCR garbage, off-topic passages, boilerplate), print them, and store an is_outlier flag. Flagged chunks are hidden from /api/graph unless include_outliers=true is passed.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runOutliers(args[0], threshold); err != nil {
+				log.Fatalf("Error finding outliers: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().Float64VarP(&threshold, "threshold", "z", defaultOutlierThreshold, "Standard deviations below the mean average similarity at which a chunk is flagged")
+
+	return cmd
+}
+
+func runOutliers(dbPath string, threshold float64) error {
+	if threshold <= 0 {
+		return fmt.Errorf("threshold must be positive, got %g", threshold)
+	}
+
+	db, err := database.OpenExistingDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	outliers, chunks, err := flagOutliers(db, threshold)
+	if err != nil {
+		return err
+	}
+
+	if len(outliers) == 0 {
+		fmt.Printf("No outliers found among %d chunks\n", len(chunks))
+		return nil
+	}
+
+	byID := make(map[int]database.TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+
+	fmt.Printf("Flagged %d of %d chunks as outliers:\n", len(outliers), len(chunks))
+	for _, outlier := range outliers {
+		fmt.Printf("  chunk %d  avg similarity %.3f  z %.2f  %s\n",
+			outlier.ChunkID, outlier.AverageSimilarity, outlier.ZScore, preview(byID[outlier.ChunkID], 60))
+	}
+
+	return nil
+}
+
+// flagOutliers replaces the outlier flags of a database with the chunks
+// threshold standard deviations below the mean, returning them and every
+// chunk
+func flagOutliers(db *database.DB, threshold float64) ([]analysis.Outlier, []database.TextChunk, error) {
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, nil, err
+	}
+	similarities, err := db.GetAllSimilarities()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outliers := analysis.FindOutliers(similarities, threshold)
+
+	ids := make([]int, len(outliers))
+	for i, outlier := range outliers {
+		ids[i] = outlier.ChunkID
+	}
+	if err := db.SetOutliers(ids); err != nil {
+		return nil, nil, err
+	}
+	return outliers, chunks, nil
+}
+
+// preview returns a chunk's summary, or the start of its text if it has
+// none, cut to at most n characters
+func preview(chunk database.TextChunk, n int) string {
+	text := chunk.Summary
+	if text == "" {
+		text = chunk.Text
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return text
+}
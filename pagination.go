@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// pagination is an offset/limit window over a list endpoint. A zero limit
+// returns everything after offset.
+type pagination struct {
+	offset int
+	limit  int
+}
+
+func parsePagination(r *http.Request) (pagination, error) {
+	var p pagination
+	for name, target := range map[string]*int{"offset": &p.offset, "limit": &p.limit} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return pagination{}, fmt.Errorf("invalid %s parameter", name)
+		}
+		*target = n
+	}
+	return p, nil
+}
+
+// paginate returns the requested window of items and reports the total
+// number of items in the X-Total-Count header. Items must already be in
+// their documented order so pages stay consistent between requests.
+func paginate[T any](w http.ResponseWriter, items []T, p pagination) []T {
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+
+	if p.offset >= len(items) {
+		return []T{}
+	}
+	items = items[p.offset:]
+	if p.limit > 0 && p.limit < len(items) {
+		items = items[:p.limit]
+	}
+	return items
+}
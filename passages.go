@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/pipeline"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// storePassages splits each chunk into smaller passages, embeds them and
+// stores them as children of the chunk. Passages are not summarized or
+// linked by similarity; they exist so searches can hit a precise passage
+// and show the chunk around it. Chunks that already have passages, from an
+// interrupted attempt, are skipped. Token counts are estimated for model.
+func storePassages(ctx context.Context, db *database.DB, embedder pipeline.Embedder, model string, chunks []database.TextChunk, opts textproc.ChunkOptions, workers int) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	existing, err := db.GetPassagesByRun(chunks[0].RunID)
+	if err != nil {
+		return err
+	}
+	split := make(map[int]bool)
+	for _, passage := range existing {
+		split[passage.ParentID] = true
+	}
+
+	var passages []database.TextChunk
+	for _, chunk := range chunks {
+		if split[chunk.ID] {
+			continue
+		}
+		pieces, err := textproc.ChunkText(chunk.Text, opts)
+		if err != nil {
+			return err
+		}
+		// A chunk that fits in one passage would only duplicate itself
+		if len(pieces) < 2 {
+			continue
+		}
+		for _, piece := range pieces {
+			passages = append(passages, database.TextChunk{
+				Text:         piece.Text,
+				ChunkIndex:   chunk.ChunkIndex,
+				Section:      chunk.Section,
+				RunID:        chunk.RunID,
+				ParentID:     chunk.ID,
+				Language:     chunk.Language,
+				Redacted:     chunk.Redacted,
+				Speaker:      chunk.Speaker,
+				Kind:         chunk.Kind,
+				StartSeconds: chunk.StartSeconds,
+				EndSeconds:   chunk.EndSeconds,
+				TokenCount:   embedding.CountTokens(model, piece.Text),
+			})
+		}
+	}
+	if len(passages) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Embedding %d passages...\n", len(passages))
+	if err := embedPassages(ctx, embedder, passages, workers); err != nil {
+		return err
+	}
+
+	for i := range passages {
+		if err := db.InsertChunk(&passages[i]); err != nil {
+			return fmt.Errorf("failed to store passage: %w", err)
+		}
+	}
+	return nil
+}
+
+// embedPassages embeds passages in place using up to workers goroutines
+func embedPassages(ctx context.Context, embedder pipeline.Embedder, passages []database.TextChunk, workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	jobs := make(chan int, len(passages))
+	for i := range passages {
+		jobs <- i
+	}
+	close(jobs)
+
+	reporter := newProgress(os.Stdout)
+	var (
+		mu        sync.Mutex
+		completed int
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed || ctx.Err() != nil {
+					return
+				}
+				embedding, err := embedder.Embed(ctx, passages[i].Text)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("failed to embed passage of chunk %d: %w", passages[i].ParentID, err)
+				}
+				passages[i].Embedding = embedding
+				if router, ok := embedder.(pipeline.ModelRouter); ok {
+					passages[i].EmbeddingModel = router.ModelFor(passages[i].Text)
+				}
+				completed++
+				reporter.Report("Passages", completed, len(passages))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
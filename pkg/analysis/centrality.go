@@ -0,0 +1,246 @@
+package analysis
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// eigenvectorIterations bounds the power iteration of eigenvector centrality
+const eigenvectorIterations = 200
+
+// Centrality describes how central a chunk is in the similarity graph
+type Centrality struct {
+	ChunkID int `json:"chunk_id"`
+	// Degree is the number of links, and WeightedDegree the sum of their
+	// similarities
+	Degree         int     `json:"degree"`
+	WeightedDegree float64 `json:"weighted_degree"`
+	// Betweenness is the share of shortest paths between other chunks that
+	// pass through this one, from 0 to 1. High values mark bridges between
+	// otherwise separate themes.
+	Betweenness float64 `json:"betweenness"`
+	// Eigenvector is high for chunks linked to other well-linked chunks,
+	// scaled so the most central chunk has 1
+	Eigenvector float64 `json:"eigenvector"`
+}
+
+// GraphAnalytics holds the centrality of every chunk and the maximum
+// spanning tree of the similarity graph
+type GraphAnalytics struct {
+	Centrality   []Centrality               `json:"centrality"`
+	SpanningTree []database.ChunkSimilarity `json:"spanning_tree"`
+}
+
+// AnalyzeGraph computes centrality over the graph of chunks linked by
+// similarities at or above minSimilarity, and the maximum spanning tree
+// over all of their similarities. Shortest paths treat 1 - similarity as
+// the length of a link, so paths through close chunks are preferred.
+// Centrality is returned highest betweenness first; links of the spanning
+// tree most similar first.
+func AnalyzeGraph(chunks []database.TextChunk, similarities []database.ChunkSimilarity, minSimilarity float64) GraphAnalytics {
+	index := make(map[int]int, len(chunks))
+	for i, chunk := range chunks {
+		index[chunk.ID] = i
+	}
+
+	var links []database.ChunkSimilarity
+	for _, sim := range similarities {
+		_, ok1 := index[sim.ChunkID1]
+		_, ok2 := index[sim.ChunkID2]
+		if ok1 && ok2 && sim.ChunkID1 != sim.ChunkID2 {
+			links = append(links, sim)
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Similarity > links[j].Similarity
+	})
+
+	analytics := GraphAnalytics{
+		Centrality:   make([]Centrality, len(chunks)),
+		SpanningTree: []database.ChunkSimilarity{},
+	}
+	for i, inTree := range spanningTreeLinks(links) {
+		if inTree {
+			analytics.SpanningTree = append(analytics.SpanningTree, links[i])
+		}
+	}
+
+	adjacency := make([][]neighbor, len(chunks))
+	for _, sim := range links {
+		if sim.Similarity < minSimilarity {
+			continue
+		}
+		a, b := index[sim.ChunkID1], index[sim.ChunkID2]
+		adjacency[a] = append(adjacency[a], neighbor{node: b, similarity: sim.Similarity})
+		adjacency[b] = append(adjacency[b], neighbor{node: a, similarity: sim.Similarity})
+	}
+
+	betweenness := betweennessCentrality(adjacency)
+	eigenvector := eigenvectorCentrality(adjacency)
+	for i, chunk := range chunks {
+		c := Centrality{
+			ChunkID:     chunk.ID,
+			Degree:      len(adjacency[i]),
+			Betweenness: betweenness[i],
+			Eigenvector: eigenvector[i],
+		}
+		for _, n := range adjacency[i] {
+			c.WeightedDegree += n.similarity
+		}
+		analytics.Centrality[i] = c
+	}
+	sort.SliceStable(analytics.Centrality, func(i, j int) bool {
+		a, b := analytics.Centrality[i], analytics.Centrality[j]
+		if a.Betweenness != b.Betweenness {
+			return a.Betweenness > b.Betweenness
+		}
+		return a.ChunkID < b.ChunkID
+	})
+	return analytics
+}
+
+// neighbor is a link in the adjacency lists of the similarity graph
+type neighbor struct {
+	node       int
+	similarity float64
+}
+
+// linkLength is the distance along a link; very similar chunks are close
+func linkLength(similarity float64) float64 {
+	return math.Max(1-similarity, 1e-9)
+}
+
+// betweennessCentrality computes normalized betweenness with Brandes'
+// algorithm, running Dijkstra from every chunk
+func betweennessCentrality(adjacency [][]neighbor) []float64 {
+	n := len(adjacency)
+	centrality := make([]float64, n)
+	if n < 3 {
+		return centrality
+	}
+
+	dist := make([]float64, n)
+	paths := make([]float64, n)
+	dependency := make([]float64, n)
+	predecessors := make([][]int, n)
+	for source := 0; source < n; source++ {
+		for i := range dist {
+			dist[i] = math.Inf(1)
+			paths[i] = 0
+			dependency[i] = 0
+			predecessors[i] = predecessors[i][:0]
+		}
+		dist[source] = 0
+		paths[source] = 1
+
+		// Chunks in order of increasing distance from source
+		var order []int
+		queue := &distanceQueue{{node: source}}
+		for queue.Len() > 0 {
+			item := heap.Pop(queue).(distanceItem)
+			if item.dist > dist[item.node] {
+				continue
+			}
+			order = append(order, item.node)
+			for _, next := range adjacency[item.node] {
+				d := dist[item.node] + linkLength(next.similarity)
+				switch {
+				case d < dist[next.node]:
+					dist[next.node] = d
+					paths[next.node] = paths[item.node]
+					predecessors[next.node] = append(predecessors[next.node][:0], item.node)
+					heap.Push(queue, distanceItem{node: next.node, dist: d})
+				case d == dist[next.node]:
+					paths[next.node] += paths[item.node]
+					predecessors[next.node] = append(predecessors[next.node], item.node)
+				}
+			}
+		}
+
+		for i := len(order) - 1; i >= 0; i-- {
+			w := order[i]
+			for _, v := range predecessors[w] {
+				dependency[v] += paths[v] / paths[w] * (1 + dependency[w])
+			}
+			if w != source {
+				centrality[w] += dependency[w]
+			}
+		}
+	}
+
+	// Every pair was counted from both ends
+	scale := 1 / float64((n-1)*(n-2))
+	for i := range centrality {
+		centrality[i] *= scale
+	}
+	return centrality
+}
+
+// eigenvectorCentrality finds the principal eigenvector of the weighted
+// adjacency matrix by power iteration. The identity is added to the matrix
+// so the iteration converges on bipartite graphs too.
+func eigenvectorCentrality(adjacency [][]neighbor) []float64 {
+	n := len(adjacency)
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = 1
+	}
+
+	next := make([]float64, n)
+	for iteration := 0; iteration < eigenvectorIterations; iteration++ {
+		for i := range next {
+			next[i] = scores[i]
+			for _, nb := range adjacency[i] {
+				next[i] += nb.similarity * scores[nb.node]
+			}
+		}
+
+		largest := 0.0
+		for _, v := range next {
+			largest = math.Max(largest, v)
+		}
+		if largest == 0 {
+			break
+		}
+		change := 0.0
+		for i := range next {
+			next[i] /= largest
+			change += math.Abs(next[i] - scores[i])
+		}
+		scores, next = next, scores
+		if change < 1e-9*float64(n) {
+			break
+		}
+	}
+
+	// Unlinked chunks have no centrality
+	for i := range scores {
+		if len(adjacency[i]) == 0 {
+			scores[i] = 0
+		}
+	}
+	return scores
+}
+
+// distanceItem is a chunk waiting in Dijkstra's queue
+type distanceItem struct {
+	node int
+	dist float64
+}
+
+// distanceQueue is a min-heap of chunks by distance
+type distanceQueue []distanceItem
+
+func (q distanceQueue) Len() int            { return len(q) }
+func (q distanceQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q distanceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *distanceQueue) Push(x interface{}) { *q = append(*q, x.(distanceItem)) }
+func (q *distanceQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Cluster is a group of chunks connected by similarity links at or above a
+// threshold
+type Cluster struct {
+	ID       int    `json:"id"`
+	Label    string `json:"label"`
+	ChunkIDs []int  `json:"chunk_ids"`
+}
+
+// FindClusters groups chunks into the connected components of the graph
+// formed by similarity links at or above threshold. Clusters are returned
+// largest first, and each is labeled with its most common chunk summary.
+func FindClusters(chunks []database.TextChunk, similarities []database.ChunkSimilarity, threshold float64) []Cluster {
+	parent := make(map[int]int, len(chunks))
+	for _, chunk := range chunks {
+		parent[chunk.ID] = chunk.ID
+	}
+
+	var find func(id int) int
+	find = func(id int) int {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+
+	for _, sim := range similarities {
+		if sim.Similarity < threshold {
+			continue
+		}
+		if _, ok := parent[sim.ChunkID1]; !ok {
+			continue
+		}
+		if _, ok := parent[sim.ChunkID2]; !ok {
+			continue
+		}
+		a, b := find(sim.ChunkID1), find(sim.ChunkID2)
+		if a != b {
+			parent[b] = a
+		}
+	}
+
+	members := make(map[int][]database.TextChunk)
+	for _, chunk := range chunks {
+		root := find(chunk.ID)
+		members[root] = append(members[root], chunk)
+	}
+
+	clusters := make([]Cluster, 0, len(members))
+	for _, group := range members {
+		cluster := Cluster{Label: dominantSummary(group)}
+		for _, chunk := range group {
+			cluster.ChunkIDs = append(cluster.ChunkIDs, chunk.ID)
+		}
+		sort.Ints(cluster.ChunkIDs)
+		clusters = append(clusters, cluster)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].ChunkIDs) != len(clusters[j].ChunkIDs) {
+			return len(clusters[i].ChunkIDs) > len(clusters[j].ChunkIDs)
+		}
+		return clusters[i].ChunkIDs[0] < clusters[j].ChunkIDs[0]
+	})
+	for i := range clusters {
+		clusters[i].ID = i + 1
+	}
+
+	return clusters
+}
+
+func dominantSummary(chunks []database.TextChunk) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, chunk := range chunks {
+		topic := normalizeTopic(chunk.Summary)
+		if topic == "" {
+			continue
+		}
+		counts[topic]++
+		if counts[topic] > counts[best] || (counts[topic] == counts[best] && topic < best) {
+			best = topic
+		}
+	}
+	return best
+}
+
+func normalizeTopic(summary string) string {
+	return strings.ToLower(strings.Join(strings.Fields(summary), " "))
+}
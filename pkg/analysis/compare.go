@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"crypto/sha256"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Cluster change statuses reported by CompareSnapshots
+const (
+	ClusterGrew      = "grew"
+	ClusterShrank    = "shrank"
+	ClusterUnchanged = "unchanged"
+	ClusterNew       = "new"
+	ClusterDissolved = "dissolved"
+)
+
+// Snapshot is the state of the corpus as of one processing run
+type Snapshot struct {
+	Name         string
+	Chunks       []database.TextChunk
+	Similarities []database.ChunkSimilarity
+}
+
+// ClusterChange describes how a cluster in one snapshot corresponds to a
+// cluster in the other
+type ClusterChange struct {
+	Status    string `json:"status"`
+	FromLabel string `json:"from_label,omitempty"`
+	ToLabel   string `json:"to_label,omitempty"`
+	FromSize  int    `json:"from_size"`
+	ToSize    int    `json:"to_size"`
+	Shared    int    `json:"shared"`
+}
+
+// SnapshotComparison summarizes what changed between two snapshots
+type SnapshotComparison struct {
+	From              string          `json:"from"`
+	To                string          `json:"to"`
+	Threshold         float64         `json:"threshold"`
+	ChunksAdded       int             `json:"chunks_added"`
+	ChunksRemoved     int             `json:"chunks_removed"`
+	Clusters          []ClusterChange `json:"clusters"`
+	TopicsAppeared    []string        `json:"topics_appeared"`
+	TopicsDisappeared []string        `json:"topics_disappeared"`
+}
+
+// CompareSnapshots clusters both snapshots at threshold and matches
+// clusters across them by the chunk texts they share. Chunks are identified
+// by content rather than ID, because re-processing assigns new IDs.
+func CompareSnapshots(from, to Snapshot, threshold float64) SnapshotComparison {
+	comparison := SnapshotComparison{
+		From:              from.Name,
+		To:                to.Name,
+		Threshold:         threshold,
+		Clusters:          []ClusterChange{},
+		TopicsAppeared:    []string{},
+		TopicsDisappeared: []string{},
+	}
+
+	fromKeys := contentKeys(from.Chunks)
+	toKeys := contentKeys(to.Chunks)
+
+	fromContent := make(map[string]bool, len(fromKeys))
+	for _, key := range fromKeys {
+		fromContent[key] = true
+	}
+	toContent := make(map[string]bool, len(toKeys))
+	for _, key := range toKeys {
+		toContent[key] = true
+	}
+	for key := range toContent {
+		if !fromContent[key] {
+			comparison.ChunksAdded++
+		}
+	}
+	for key := range fromContent {
+		if !toContent[key] {
+			comparison.ChunksRemoved++
+		}
+	}
+
+	fromClusters := FindClusters(from.Chunks, from.Similarities, threshold)
+	toClusters := FindClusters(to.Chunks, to.Similarities, threshold)
+
+	fromSets := clusterContent(fromClusters, fromKeys)
+	toSets := clusterContent(toClusters, toKeys)
+
+	matchedFrom := make(map[int]bool)
+	for i, toCluster := range toClusters {
+		best, bestShared := -1, 0
+		for j := range fromClusters {
+			shared := overlap(toSets[i], fromSets[j])
+			if shared > bestShared {
+				best, bestShared = j, shared
+			}
+		}
+
+		change := ClusterChange{
+			ToLabel: toCluster.Label,
+			ToSize:  len(toCluster.ChunkIDs),
+			Shared:  bestShared,
+		}
+		if best < 0 {
+			change.Status = ClusterNew
+		} else {
+			matchedFrom[best] = true
+			change.FromLabel = fromClusters[best].Label
+			change.FromSize = len(fromClusters[best].ChunkIDs)
+			switch {
+			case change.ToSize > change.FromSize:
+				change.Status = ClusterGrew
+			case change.ToSize < change.FromSize:
+				change.Status = ClusterShrank
+			default:
+				change.Status = ClusterUnchanged
+			}
+		}
+		comparison.Clusters = append(comparison.Clusters, change)
+	}
+
+	for j, fromCluster := range fromClusters {
+		if matchedFrom[j] {
+			continue
+		}
+		comparison.Clusters = append(comparison.Clusters, ClusterChange{
+			Status:    ClusterDissolved,
+			FromLabel: fromCluster.Label,
+			FromSize:  len(fromCluster.ChunkIDs),
+		})
+	}
+
+	fromTopics := topics(from.Chunks)
+	toTopics := topics(to.Chunks)
+	for topic := range toTopics {
+		if !fromTopics[topic] {
+			comparison.TopicsAppeared = append(comparison.TopicsAppeared, topic)
+		}
+	}
+	for topic := range fromTopics {
+		if !toTopics[topic] {
+			comparison.TopicsDisappeared = append(comparison.TopicsDisappeared, topic)
+		}
+	}
+	sort.Strings(comparison.TopicsAppeared)
+	sort.Strings(comparison.TopicsDisappeared)
+
+	return comparison
+}
+
+// contentKeys maps chunk IDs to a hash of their whitespace-normalized text
+func contentKeys(chunks []database.TextChunk) map[int]string {
+	keys := make(map[int]string, len(chunks))
+	for _, chunk := range chunks {
+		sum := sha256.Sum256([]byte(strings.Join(strings.Fields(chunk.Text), " ")))
+		keys[chunk.ID] = string(sum[:])
+	}
+	return keys
+}
+
+func clusterContent(clusters []Cluster, keys map[int]string) []map[string]bool {
+	sets := make([]map[string]bool, len(clusters))
+	for i, cluster := range clusters {
+		sets[i] = make(map[string]bool, len(cluster.ChunkIDs))
+		for _, id := range cluster.ChunkIDs {
+			sets[i][keys[id]] = true
+		}
+	}
+	return sets
+}
+
+func overlap(a, b map[string]bool) int {
+	shared := 0
+	for key := range a {
+		if b[key] {
+			shared++
+		}
+	}
+	return shared
+}
+
+func topics(chunks []database.TextChunk) map[string]bool {
+	set := make(map[string]bool)
+	for _, chunk := range chunks {
+		if topic := normalizeTopic(chunk.Summary); topic != "" {
+			set[topic] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// DuplicatePair is a pair of chunks whose embeddings are nearly identical
+type DuplicatePair struct {
+	ChunkID1   int     `json:"chunk_id_1"`
+	ChunkID2   int     `json:"chunk_id_2"`
+	Similarity float64 `json:"similarity"`
+}
+
+// FindDuplicates compares every pair of chunks by the cosine similarity of
+// their embeddings and returns the pairs at or above threshold, most
+// similar first. Stored similarities are not used because chunks of
+// different documents are usually never compared when processed. Chunks
+// whose embeddings differ in length are skipped, so the chunks should all
+// come from the same embedding model.
+func FindDuplicates(chunks []database.TextChunk, threshold float64) []DuplicatePair {
+	// Normalizing once turns each comparison into a dot product
+	normalized := make([][]float64, len(chunks))
+	for i, chunk := range chunks {
+		var norm float64
+		for _, v := range chunk.Embedding {
+			norm += v * v
+		}
+		if norm == 0 {
+			continue
+		}
+		norm = math.Sqrt(norm)
+		vector := make([]float64, len(chunk.Embedding))
+		for j, v := range chunk.Embedding {
+			vector[j] = v / norm
+		}
+		normalized[i] = vector
+	}
+
+	var pairs []DuplicatePair
+	for i := range chunks {
+		a := normalized[i]
+		if a == nil {
+			continue
+		}
+		for j := i + 1; j < len(chunks); j++ {
+			b := normalized[j]
+			if len(b) != len(a) {
+				continue
+			}
+			var dot float64
+			for d := range a {
+				dot += a[d] * b[d]
+			}
+			if dot >= threshold {
+				pairs = append(pairs, DuplicatePair{ChunkID1: chunks[i].ID, ChunkID2: chunks[j].ID, Similarity: dot})
+			}
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Similarity > pairs[j].Similarity
+	})
+	return pairs
+}
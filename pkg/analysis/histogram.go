@@ -0,0 +1,96 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// HistogramBin counts the similarities from Min up to Max; the last bin
+// includes Max
+type HistogramBin struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// SimilarityHistogram is the distribution of the similarities in a
+// database, over equal-width bins between the lowest and highest
+type SimilarityHistogram struct {
+	Bins  []HistogramBin `json:"bins"`
+	Total int            `json:"total"`
+	Min   float64        `json:"min"`
+	Max   float64        `json:"max"`
+	// SuggestedThreshold is a graph threshold that keeps the strong tail of
+	// the distribution; see KneeThreshold
+	SuggestedThreshold float64 `json:"suggested_threshold"`
+}
+
+// ComputeHistogram bins similarities into bins bins and suggests a
+// threshold for them
+func ComputeHistogram(similarities []database.ChunkSimilarity, bins int) SimilarityHistogram {
+	values := make([]float64, len(similarities))
+	for i, sim := range similarities {
+		values[i] = sim.Similarity
+	}
+	sort.Float64s(values)
+
+	histogram := SimilarityHistogram{Total: len(values), Bins: []HistogramBin{}}
+	if len(values) == 0 {
+		return histogram
+	}
+	histogram.Min, histogram.Max = values[0], values[len(values)-1]
+	histogram.SuggestedThreshold = KneeThreshold(values)
+
+	width := (histogram.Max - histogram.Min) / float64(bins)
+	if width == 0 {
+		// Every similarity is the same
+		histogram.Bins = append(histogram.Bins, HistogramBin{Min: histogram.Min, Max: histogram.Max, Count: len(values)})
+		return histogram
+	}
+	histogram.Bins = make([]HistogramBin, bins)
+	for i := range histogram.Bins {
+		histogram.Bins[i].Min = histogram.Min + float64(i)*width
+		histogram.Bins[i].Max = histogram.Min + float64(i+1)*width
+	}
+	histogram.Bins[bins-1].Max = histogram.Max
+	for _, value := range values {
+		bin := min(int((value-histogram.Min)/width), bins-1)
+		histogram.Bins[bin].Count++
+	}
+	return histogram
+}
+
+// KneeThreshold returns the similarity at the knee of the upper half of
+// sorted, ascending values: ranked from most similar down to the median,
+// similarities fall steeply through the few strong pairs and then level
+// off into the bulk of unrelated ones, and the knee is where the curve is
+// farthest from the straight line between its ends. Pairs at least this
+// similar are the ones that stand out from the corpus.
+func KneeThreshold(sorted []float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	// Most similar first, down to the median
+	upper := make([]float64, 0, len(sorted)/2+1)
+	for i := len(sorted) - 1; i >= len(sorted)/2; i-- {
+		upper = append(upper, sorted[i])
+	}
+	if len(upper) < 3 || upper[0] == upper[len(upper)-1] {
+		return upper[len(upper)-1]
+	}
+
+	// Normalized to the unit square, the ends are (0, 1) and (1, 0), so
+	// the distance to the line between them is proportional to 1-x-y
+	top, bottom := upper[0], upper[len(upper)-1]
+	knee, farthest := 0, math.Inf(-1)
+	for i, value := range upper {
+		x := float64(i) / float64(len(upper)-1)
+		y := (value - bottom) / (top - bottom)
+		if distance := 1 - x - y; distance > farthest {
+			knee, farthest = i, distance
+		}
+	}
+	return upper[knee]
+}
@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Outlier is a chunk whose average similarity to the rest of the corpus is
+// unusually low
+type Outlier struct {
+	ChunkID           int     `json:"chunk_id"`
+	AverageSimilarity float64 `json:"average_similarity"`
+	ZScore            float64 `json:"z_score"`
+}
+
+// FindOutliers averages each chunk's similarity to every other chunk and
+// returns the chunks whose average lies more than threshold standard
+// deviations below the corpus mean, lowest first. Chunks without any
+// similarity rows are ignored.
+func FindOutliers(similarities []database.ChunkSimilarity, threshold float64) []Outlier {
+	sums := make(map[int]float64)
+	counts := make(map[int]int)
+	for _, sim := range similarities {
+		sums[sim.ChunkID1] += sim.Similarity
+		sums[sim.ChunkID2] += sim.Similarity
+		counts[sim.ChunkID1]++
+		counts[sim.ChunkID2]++
+	}
+	if len(sums) < 2 {
+		return nil
+	}
+
+	averages := make(map[int]float64, len(sums))
+	mean := 0.0
+	for id, sum := range sums {
+		averages[id] = sum / float64(counts[id])
+		mean += averages[id]
+	}
+	mean /= float64(len(averages))
+
+	variance := 0.0
+	for _, avg := range averages {
+		variance += (avg - mean) * (avg - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(averages)))
+	if stddev == 0 {
+		return nil
+	}
+
+	var outliers []Outlier
+	for id, avg := range averages {
+		z := (avg - mean) / stddev
+		if z < -threshold {
+			outliers = append(outliers, Outlier{ChunkID: id, AverageSimilarity: avg, ZScore: z})
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool {
+		if outliers[i].ZScore != outliers[j].ZScore {
+			return outliers[i].ZScore < outliers[j].ZScore
+		}
+		return outliers[i].ChunkID < outliers[j].ChunkID
+	})
+
+	return outliers
+}
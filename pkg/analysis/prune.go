@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Graph strategies accepted by PruneSimilarities
+const (
+	// StrategyThreshold keeps every link at or above the minimum similarity
+	StrategyThreshold = "threshold"
+	// StrategyKNN keeps each chunk's k most similar links
+	StrategyKNN = "knn"
+	// StrategyMutualKNN keeps links that are among the k most similar of
+	// both of their chunks
+	StrategyMutualKNN = "mutual_knn"
+	// StrategyMSTPlusThreshold keeps a maximum spanning tree, so every
+	// connected chunk stays reachable, plus every link at or above the
+	// minimum similarity
+	StrategyMSTPlusThreshold = "mst_plus_threshold"
+)
+
+// GraphStrategies lists the valid graph strategies
+var GraphStrategies = []string{StrategyThreshold, StrategyKNN, StrategyMutualKNN, StrategyMSTPlusThreshold}
+
+// PruneSimilarities selects the similarity links drawn in a graph. A plain
+// threshold either over-connects a large corpus or fragments it; the k-NN
+// strategies bound each chunk's degree instead, and mst_plus_threshold
+// keeps the graph connected. For knn and mutual_knn, links below
+// minSimilarity are dropped after the neighbors are chosen. Links are
+// returned most similar first.
+func PruneSimilarities(similarities []database.ChunkSimilarity, strategy string, k int, minSimilarity float64) ([]database.ChunkSimilarity, error) {
+	switch strategy {
+	case StrategyThreshold, StrategyKNN, StrategyMutualKNN, StrategyMSTPlusThreshold:
+	default:
+		return nil, fmt.Errorf("unknown strategy %q (valid strategies: %s, %s, %s, %s)", strategy, StrategyThreshold, StrategyKNN, StrategyMutualKNN, StrategyMSTPlusThreshold)
+	}
+	if (strategy == StrategyKNN || strategy == StrategyMutualKNN) && k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", k)
+	}
+
+	sorted := make([]database.ChunkSimilarity, len(similarities))
+	copy(sorted, similarities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Similarity > sorted[j].Similarity
+	})
+
+	pruned := make([]database.ChunkSimilarity, 0, len(sorted))
+	switch strategy {
+	case StrategyKNN, StrategyMutualKNN:
+		for i, inTopK := range nearestNeighborLinks(sorted, k) {
+			selected := inTopK[0] || inTopK[1]
+			if strategy == StrategyMutualKNN {
+				selected = inTopK[0] && inTopK[1]
+			}
+			if selected && sorted[i].Similarity >= minSimilarity {
+				pruned = append(pruned, sorted[i])
+			}
+		}
+	case StrategyMSTPlusThreshold:
+		for i, inTree := range spanningTreeLinks(sorted) {
+			if inTree || sorted[i].Similarity >= minSimilarity {
+				pruned = append(pruned, sorted[i])
+			}
+		}
+	default:
+		for _, sim := range sorted {
+			if sim.Similarity >= minSimilarity {
+				pruned = append(pruned, sim)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// nearestNeighborLinks reports, for each link of similarities (sorted most
+// similar first), whether it is among the k most similar links of its
+// first and of its second chunk
+func nearestNeighborLinks(similarities []database.ChunkSimilarity, k int) [][2]bool {
+	degree := make(map[int]int)
+	inTopK := make([][2]bool, len(similarities))
+	for i, sim := range similarities {
+		inTopK[i] = [2]bool{degree[sim.ChunkID1] < k, degree[sim.ChunkID2] < k}
+		degree[sim.ChunkID1]++
+		degree[sim.ChunkID2]++
+	}
+	return inTopK
+}
+
+// spanningTreeLinks reports which links of similarities (sorted most
+// similar first) form a maximum spanning forest, found with Kruskal's
+// algorithm
+func spanningTreeLinks(similarities []database.ChunkSimilarity) []bool {
+	parent := make(map[int]int)
+	var find func(id int) int
+	find = func(id int) int {
+		p, ok := parent[id]
+		if !ok {
+			parent[id] = id
+			return id
+		}
+		if p != id {
+			parent[id] = find(p)
+		}
+		return parent[id]
+	}
+
+	inTree := make([]bool, len(similarities))
+	for i, sim := range similarities {
+		a, b := find(sim.ChunkID1), find(sim.ChunkID2)
+		if a != b {
+			parent[b] = a
+			inTree[i] = true
+		}
+	}
+	return inTree
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import "math"
+
+// RetrievalScore holds the ranking metrics of one query
+type RetrievalScore struct {
+	// Recall is the share of relevant chunks found in the top k
+	Recall float64 `json:"recall"`
+	// ReciprocalRank is 1/rank of the first relevant chunk, or 0 if none
+	// was found; averaged over queries it is the MRR
+	ReciprocalRank float64 `json:"reciprocal_rank"`
+	// NDCG is the normalized discounted cumulative gain of the top k with
+	// binary relevance
+	NDCG float64 `json:"ndcg"`
+}
+
+// ScoreRetrieval scores a ranked list of chunk IDs against the IDs known to
+// be relevant, looking at the first k results. An ID that appears more than
+// once only counts at its first rank.
+func ScoreRetrieval(ranked []int, relevant []int, k int) RetrievalScore {
+	var score RetrievalScore
+	if len(relevant) == 0 || k <= 0 {
+		return score
+	}
+
+	wanted := make(map[int]bool, len(relevant))
+	for _, id := range relevant {
+		wanted[id] = true
+	}
+
+	found := make(map[int]bool)
+	var dcg float64
+	for i, id := range ranked {
+		if i >= k {
+			break
+		}
+		if !wanted[id] || found[id] {
+			continue
+		}
+		found[id] = true
+		if score.ReciprocalRank == 0 {
+			score.ReciprocalRank = 1 / float64(i+1)
+		}
+		dcg += 1 / math.Log2(float64(i+2))
+	}
+
+	var ideal float64
+	for i := 0; i < min(len(wanted), k); i++ {
+		ideal += 1 / math.Log2(float64(i+2))
+	}
+
+	score.Recall = float64(len(found)) / float64(len(wanted))
+	score.NDCG = dcg / ideal
+	return score
+}
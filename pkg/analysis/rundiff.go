@@ -0,0 +1,233 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+)
+
+// ChunkRef identifies a chunk in a run diff
+type ChunkRef struct {
+	ID       int    `json:"id"`
+	StableID string `json:"stable_id"`
+	Index    int    `json:"index"`
+	Summary  string `json:"summary"`
+}
+
+// ChunkDrift is a chunk whose text appears in both runs, with the cosine
+// similarity between its embedding in each. Anything below 1 means the
+// embedding moved even though the text didn't.
+type ChunkDrift struct {
+	StableID   string  `json:"stable_id"`
+	FromID     int     `json:"from_id"`
+	ToID       int     `json:"to_id"`
+	Summary    string  `json:"summary"`
+	Similarity float64 `json:"similarity"`
+}
+
+// PairChange is a pair of chunks present in both runs whose similarity to
+// each other changed
+type PairChange struct {
+	StableID1      string  `json:"stable_id1"`
+	StableID2      string  `json:"stable_id2"`
+	FromSimilarity float64 `json:"from_similarity"`
+	ToSimilarity   float64 `json:"to_similarity"`
+	Delta          float64 `json:"delta"`
+}
+
+// RunDiff lists what changed between two processing runs of a corpus
+type RunDiff struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Threshold float64 `json:"threshold"`
+
+	Added     []ChunkRef `json:"added"`
+	Removed   []ChunkRef `json:"removed"`
+	Unchanged int        `json:"unchanged"`
+
+	MeanDrift float64      `json:"mean_drift"`
+	Drifted   []ChunkDrift `json:"drifted"`
+
+	EdgesGained []PairChange `json:"edges_gained"`
+	EdgesLost   []PairChange `json:"edges_lost"`
+	Shifts      []PairChange `json:"largest_shifts"`
+}
+
+// DiffRuns matches chunks across two runs by stable ID and reports added
+// and removed chunks, how far the embeddings of unchanged chunks drifted,
+// and how similarities between unchanged chunks moved. Edges are pairs at
+// or above threshold; limit caps the drifted and largest_shifts lists.
+func DiffRuns(from, to Snapshot, threshold float64, limit int) RunDiff {
+	diff := RunDiff{
+		From:        from.Name,
+		To:          to.Name,
+		Threshold:   threshold,
+		Added:       []ChunkRef{},
+		Removed:     []ChunkRef{},
+		Drifted:     []ChunkDrift{},
+		EdgesGained: []PairChange{},
+		EdgesLost:   []PairChange{},
+		Shifts:      []PairChange{},
+	}
+
+	fromChunks := byStableID(from.Chunks)
+	toChunks := byStableID(to.Chunks)
+
+	for _, chunk := range to.Chunks {
+		if _, ok := fromChunks[chunk.StableID]; !ok && toChunks[chunk.StableID].ID == chunk.ID {
+			diff.Added = append(diff.Added, chunkRef(chunk))
+		}
+	}
+	for _, chunk := range from.Chunks {
+		if _, ok := toChunks[chunk.StableID]; !ok && fromChunks[chunk.StableID].ID == chunk.ID {
+			diff.Removed = append(diff.Removed, chunkRef(chunk))
+		}
+	}
+
+	var drifts []ChunkDrift
+	totalDrift := 0.0
+	for stableID, toChunk := range toChunks {
+		fromChunk, ok := fromChunks[stableID]
+		if !ok {
+			continue
+		}
+		diff.Unchanged++
+
+		sim, err := similarity.CosineSimilarity(fromChunk.Embedding, toChunk.Embedding)
+		if err != nil {
+			// Different dimensions, e.g. the embedding model changed
+			sim = 0
+		}
+		if sim > 1-driftEpsilon {
+			sim = 1
+		}
+		totalDrift += 1 - sim
+		drifts = append(drifts, ChunkDrift{
+			StableID:   stableID,
+			FromID:     fromChunk.ID,
+			ToID:       toChunk.ID,
+			Summary:    toChunk.Summary,
+			Similarity: sim,
+		})
+	}
+	if diff.Unchanged > 0 {
+		diff.MeanDrift = totalDrift / float64(diff.Unchanged)
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Similarity != drifts[j].Similarity {
+			return drifts[i].Similarity < drifts[j].Similarity
+		}
+		return drifts[i].StableID < drifts[j].StableID
+	})
+	for _, drift := range drifts {
+		if len(diff.Drifted) >= limit {
+			break
+		}
+		if drift.Similarity < 1 {
+			diff.Drifted = append(diff.Drifted, drift)
+		}
+	}
+
+	fromPairs := pairSimilarities(from, fromChunks)
+	toPairs := pairSimilarities(to, toChunks)
+
+	var changes []PairChange
+	for key, toSim := range toPairs {
+		fromSim, ok := fromPairs[key]
+		if !ok {
+			continue
+		}
+		change := PairChange{
+			StableID1:      key.a,
+			StableID2:      key.b,
+			FromSimilarity: fromSim,
+			ToSimilarity:   toSim,
+			Delta:          toSim - fromSim,
+		}
+		switch {
+		case fromSim < threshold && toSim >= threshold:
+			diff.EdgesGained = append(diff.EdgesGained, change)
+		case fromSim >= threshold && toSim < threshold:
+			diff.EdgesLost = append(diff.EdgesLost, change)
+		}
+		if change.Delta != 0 {
+			changes = append(changes, change)
+		}
+	}
+	sortPairChanges(diff.EdgesGained)
+	sortPairChanges(diff.EdgesLost)
+	sortPairChanges(changes)
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	diff.Shifts = append(diff.Shifts, changes...)
+
+	return diff
+}
+
+// driftEpsilon absorbs floating point error when comparing an embedding
+// with an identical one
+const driftEpsilon = 1e-9
+
+type stablePair struct{ a, b string }
+
+// byStableID indexes chunks by stable ID. If a run holds the same text more
+// than once, the first chunk wins.
+func byStableID(chunks []database.TextChunk) map[string]database.TextChunk {
+	index := make(map[string]database.TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		if _, ok := index[chunk.StableID]; !ok {
+			index[chunk.StableID] = chunk
+		}
+	}
+	return index
+}
+
+// pairSimilarities returns the similarities between chunks of the snapshot,
+// keyed by stable ID pair. Similarities to chunks outside the snapshot are
+// ignored.
+func pairSimilarities(snapshot Snapshot, chunks map[string]database.TextChunk) map[stablePair]float64 {
+	stableIDs := make(map[int]string, len(chunks))
+	for stableID, chunk := range chunks {
+		stableIDs[chunk.ID] = stableID
+	}
+
+	pairs := make(map[stablePair]float64)
+	for _, sim := range snapshot.Similarities {
+		a, ok1 := stableIDs[sim.ChunkID1]
+		b, ok2 := stableIDs[sim.ChunkID2]
+		if !ok1 || !ok2 || a == b {
+			continue
+		}
+		if a > b {
+			a, b = b, a
+		}
+		pairs[stablePair{a, b}] = sim.Similarity
+	}
+	return pairs
+}
+
+// sortPairChanges orders changes by the size of the shift, largest first
+func sortPairChanges(changes []PairChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		di, dj := math.Abs(changes[i].Delta), math.Abs(changes[j].Delta)
+		if di != dj {
+			return di > dj
+		}
+		if changes[i].StableID1 != changes[j].StableID1 {
+			return changes[i].StableID1 < changes[j].StableID1
+		}
+		return changes[i].StableID2 < changes[j].StableID2
+	})
+}
+
+func chunkRef(chunk database.TextChunk) ChunkRef {
+	return ChunkRef{
+		ID:       chunk.ID,
+		StableID: chunk.StableID,
+		Index:    chunk.ChunkIndex,
+		Summary:  chunk.Summary,
+	}
+}
@@ -0,0 +1,94 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// CorpusStats summarizes the chunks and similarities in a database
+type CorpusStats struct {
+	Chunks            int     `json:"chunks"`
+	Similarities      int     `json:"similarities"`
+	AverageChunkChars float64 `json:"average_chunk_chars"`
+	MinSimilarity     float64 `json:"min_similarity"`
+	MaxSimilarity     float64 `json:"max_similarity"`
+	MeanSimilarity    float64 `json:"mean_similarity"`
+	MedianSimilarity  float64 `json:"median_similarity"`
+	EmbeddingDims     int     `json:"embedding_dims"`
+	// Token counts are estimates for the embedding model, and only cover
+	// chunks stored since counts were recorded
+	TotalTokens        int     `json:"total_tokens"`
+	AverageChunkTokens float64 `json:"average_chunk_tokens"`
+	MaxChunkTokens     int     `json:"max_chunk_tokens"`
+	// Languages counts chunks by detected language; "und" counts chunks
+	// whose language could not be detected
+	Languages map[string]int `json:"languages"`
+	// SimilarityMetric is the metric the similarities were scored with,
+	// set by the caller since it is recorded in the database
+	SimilarityMetric string `json:"similarity_metric,omitempty"`
+	// Projection is the PCA projection the embeddings were reduced with,
+	// if any, with the share of variance it kept; also set by the caller
+	Projection *database.Projection `json:"projection,omitempty"`
+}
+
+// ComputeStats calculates corpus-wide statistics
+func ComputeStats(chunks []database.TextChunk, similarities []database.ChunkSimilarity) CorpusStats {
+	stats := CorpusStats{
+		Chunks:       len(chunks),
+		Similarities: len(similarities),
+		Languages:    make(map[string]int),
+	}
+
+	totalChars := 0
+	counted := 0
+	for _, chunk := range chunks {
+		totalChars += len(chunk.Text)
+		if chunk.TokenCount > 0 {
+			counted++
+			stats.TotalTokens += chunk.TokenCount
+			stats.MaxChunkTokens = max(stats.MaxChunkTokens, chunk.TokenCount)
+		}
+		language := chunk.Language
+		if language == "" {
+			language = "und"
+		}
+		stats.Languages[language]++
+		if stats.EmbeddingDims == 0 {
+			stats.EmbeddingDims = len(chunk.Embedding)
+		}
+	}
+	if len(chunks) > 0 {
+		stats.AverageChunkChars = float64(totalChars) / float64(len(chunks))
+	}
+	if counted > 0 {
+		stats.AverageChunkTokens = float64(stats.TotalTokens) / float64(counted)
+	}
+
+	if len(similarities) == 0 {
+		return stats
+	}
+
+	values := make([]float64, len(similarities))
+	sum := 0.0
+	stats.MinSimilarity = math.Inf(1)
+	stats.MaxSimilarity = math.Inf(-1)
+	for i, sim := range similarities {
+		values[i] = sim.Similarity
+		sum += sim.Similarity
+		stats.MinSimilarity = math.Min(stats.MinSimilarity, sim.Similarity)
+		stats.MaxSimilarity = math.Max(stats.MaxSimilarity, sim.Similarity)
+	}
+	stats.MeanSimilarity = sum / float64(len(values))
+
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		stats.MedianSimilarity = (values[mid-1] + values[mid]) / 2
+	} else {
+		stats.MedianSimilarity = values[mid]
+	}
+
+	return stats
+}
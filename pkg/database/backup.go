@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the database to a new file at path with SQLite's online
+// backup API. The copy is a consistent snapshot even while other
+// processes, such as serve, write to the database, and is encrypted with
+// the same passphrase.
+func (db *DB) Backup(path string) error {
+	dest, err := OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	srcConn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", db.path, err)
+	}
+	defer srcConn.Close()
+	destConn, err := dest.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer destConn.Close()
+
+	return rawSQLite(destConn, func(to *sqlite3.SQLiteConn) error {
+		return rawSQLite(srcConn, func(from *sqlite3.SQLiteConn) error {
+			backup, err := to.Backup("main", from, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup of %s: %w", db.path, err)
+			}
+			// Copying every page in one step holds a read transaction on
+			// the source, which in WAL mode doesn't block writers
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to back up %s: %w", db.path, err)
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// rawSQLite calls f with the SQLite connection underneath conn, unwrapping
+// the connections that log queries
+func rawSQLite(conn *sql.Conn, f func(*sqlite3.SQLiteConn) error) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		if logging, ok := driverConn.(*loggingConn); ok {
+			driverConn = logging.Conn
+		}
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("backups need a SQLite connection, got %T", driverConn)
+		}
+		return f(sqliteConn)
+	})
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// EmbeddingCache maps the SHA-256 of a model name and text to the text's
+// embedding. It lives in its own database file, shared by every document
+// database, so text embedded before (overlapping chunks, re-processed
+// files, boilerplate repeated across documents) is not embedded again.
+type EmbeddingCache struct {
+	conn *sql.DB
+	path string
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// OpenEmbeddingCache opens the cache at path, creating it if needed
+func OpenEmbeddingCache(path string) (*EmbeddingCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create embedding cache directory: %w", err)
+	}
+
+	// Several bluffy processes may share the cache, so wait for locks
+	// instead of failing
+	conn, err := sql.Open("sqlite3", fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d", path, busyTimeoutMillis))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache: %w", err)
+	}
+
+	_, err = conn.Exec(`
+	CREATE TABLE IF NOT EXISTS embeddings (
+		key TEXT PRIMARY KEY,
+		model TEXT NOT NULL,
+		embedding TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	) WITHOUT ROWID`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create embedding cache table: %w", err)
+	}
+
+	return &EmbeddingCache{conn: conn, path: path}, nil
+}
+
+// Close closes the cache database
+func (c *EmbeddingCache) Close() error {
+	return c.conn.Close()
+}
+
+// Path returns the cache database file
+func (c *EmbeddingCache) Path() string {
+	return c.path
+}
+
+// Get returns the cached embedding of text by model, if any
+func (c *EmbeddingCache) Get(model, text string) ([]float64, bool, error) {
+	var embeddingJSON string
+	err := c.conn.QueryRow("SELECT embedding FROM embeddings WHERE key = ?", embeddingCacheKey(model, text)).Scan(&embeddingJSON)
+	if err == sql.ErrNoRows {
+		c.misses.Add(1)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read embedding cache: %w", err)
+	}
+
+	var embedding []float64
+	if err := json.Unmarshal([]byte(embeddingJSON), &embedding); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal cached embedding: %w", err)
+	}
+	c.hits.Add(1)
+	return embedding, true, nil
+}
+
+// Put stores the embedding of text by model
+func (c *EmbeddingCache) Put(model, text string, embedding []float64) error {
+	embeddingJSON, err := json.Marshal(embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+
+	_, err = c.conn.Exec("INSERT OR IGNORE INTO embeddings (key, model, embedding) VALUES (?, ?, ?)",
+		embeddingCacheKey(model, text), model, string(embeddingJSON))
+	if err != nil {
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+	return nil
+}
+
+// Stats returns how many lookups found an embedding and how many did not
+// since the cache was opened
+func (c *EmbeddingCache) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func embeddingCacheKey(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
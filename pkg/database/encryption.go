@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// passphrase is the SQLCipher key of every database opened, or empty for
+// plaintext databases
+var passphrase string
+
+var (
+	driverMu    sync.Mutex
+	driverCount int
+)
+
+// ErrEncryptionUnsupported is returned when a passphrase is set but the
+// SQLite library bluffy is linked against is not SQLCipher
+var ErrEncryptionUnsupported = errors.New("this build of bluffy cannot encrypt databases: build it with -tags libsqlite3 against SQLCipher")
+
+// SetPassphrase makes every database opened afterwards encrypted at rest
+// with SQLCipher using passphrase: new databases are created encrypted and
+// existing ones must have been created with the same passphrase. It must be
+// called before opening any database, and fails with
+// ErrEncryptionUnsupported if SQLCipher isn't available.
+func SetPassphrase(p string) error {
+	passphrase = p
+	configureDriver()
+
+	conn, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Ping()
+}
+
+// Encrypted reports whether SetPassphrase has been called with a passphrase
+func Encrypted() bool {
+	return passphrase != ""
+}
+
+// configureDriver registers a driver for the current vector extension and
+// passphrase and opens databases with it from now on. database/sql drivers
+// can't be unregistered, so each configuration gets a new name.
+func configureDriver() {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+
+	d := &sqlite3.SQLiteDriver{}
+	if vectorExtension != "" {
+		d.Extensions = []string{vectorExtension}
+	}
+	if passphrase != "" {
+		key := passphrase
+		d.ConnectHook = func(conn *sqlite3.SQLiteConn) error {
+			return unlock(conn, key)
+		}
+	}
+
+	driverCount++
+	driverName = fmt.Sprintf("sqlite3_bluffy_%d", driverCount)
+	sql.Register(driverName, d)
+}
+
+// unlock keys a new connection. The key has to be the first statement that
+// reads the file, so the write-ahead log dsn normally enables is switched
+// on here instead.
+func unlock(conn *sqlite3.SQLiteConn, key string) error {
+	// SQLite without SQLCipher silently ignores PRAGMA key, which would
+	// leave the database in plaintext
+	version, err := pragmaValue(conn, "PRAGMA cipher_version")
+	if err != nil {
+		return fmt.Errorf("failed to check for SQLCipher: %w", err)
+	}
+	if version == "" {
+		return ErrEncryptionUnsupported
+	}
+
+	if _, err := conn.Exec(fmt.Sprintf("PRAGMA key = '%s'", strings.ReplaceAll(key, "'", "''")), nil); err != nil {
+		return fmt.Errorf("failed to set database key: %w", err)
+	}
+	// A wrong key only shows when the first page is read
+	if _, err := pragmaValue(conn, "SELECT count(*) FROM sqlite_master"); err != nil {
+		return fmt.Errorf("failed to unlock database (wrong passphrase, or a plaintext database?): %w", err)
+	}
+	if _, err := conn.Exec("PRAGMA journal_mode = WAL", nil); err != nil {
+		return fmt.Errorf("failed to enable write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// pragmaValue returns the first column of the first row of query, or an
+// empty string if it returns no rows
+func pragmaValue(conn *sqlite3.SQLiteConn, query string) (string, error) {
+	rows, err := conn.Query(query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	values := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(values); err != nil {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", err
+	}
+	if len(values) == 0 || values[0] == nil {
+		return "", nil
+	}
+	return fmt.Sprint(values[0]), nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSimilarityNotFound is returned for a similarity that isn't stored
+var ErrSimilarityNotFound = errors.New("similarity not found")
+
+// SimilarityExplanation is a cached LLM explanation of why two chunks are
+// similar
+type SimilarityExplanation struct {
+	Explanation string    `json:"explanation"`
+	Model       string    `json:"model"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GetSimilarity returns a stored similarity by ID
+func (db *DB) GetSimilarity(id int) (*ChunkSimilarity, error) {
+	var sim ChunkSimilarity
+	err := db.conn.QueryRow(`SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities WHERE id = ?`, id).Scan(&sim.ID, &sim.ChunkID1, &sim.ChunkID2, &sim.Distance, &sim.Similarity)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("similarity %d: %w", id, ErrSimilarityNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similarity %d: %w", id, err)
+	}
+	return &sim, nil
+}
+
+// GetSimilarityBetween returns the stored similarity of two chunks, in
+// either order
+func (db *DB) GetSimilarityBetween(chunkID1, chunkID2 int) (*ChunkSimilarity, error) {
+	var sim ChunkSimilarity
+	err := db.conn.QueryRow(`SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities WHERE (chunk_id_1 = ? AND chunk_id_2 = ?) OR (chunk_id_1 = ? AND chunk_id_2 = ?) LIMIT 1`, chunkID1, chunkID2, chunkID2, chunkID1).Scan(&sim.ID, &sim.ChunkID1, &sim.ChunkID2, &sim.Distance, &sim.Similarity)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("chunks %d and %d: %w", chunkID1, chunkID2, ErrSimilarityNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similarity of chunks %d and %d: %w", chunkID1, chunkID2, err)
+	}
+	return &sim, nil
+}
+
+// GetExplanation returns the cached explanation of two chunks' similarity
+// by their stable IDs, in either order, or nil if there is none
+func (db *DB) GetExplanation(stableID1, stableID2 string) (*SimilarityExplanation, error) {
+	stableID1, stableID2 = explanationKey(stableID1, stableID2)
+	var explanation SimilarityExplanation
+	err := db.conn.QueryRow(`SELECT explanation, model, created_at FROM similarity_explanations WHERE stable_id_1 = ? AND stable_id_2 = ?`, stableID1, stableID2).Scan(&explanation.Explanation, &explanation.Model, &explanation.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query explanation: %w", err)
+	}
+	return &explanation, nil
+}
+
+// SetExplanation caches the explanation of two chunks' similarity by their
+// stable IDs, replacing any earlier one
+func (db *DB) SetExplanation(stableID1, stableID2, explanation, model string) error {
+	stableID1, stableID2 = explanationKey(stableID1, stableID2)
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO similarity_explanations (stable_id_1, stable_id_2, explanation, model, created_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`, stableID1, stableID2, explanation, model)
+	if err != nil {
+		return fmt.Errorf("failed to store explanation: %w", err)
+	}
+	return nil
+}
+
+// explanationKey orders a pair of stable IDs, so a pair is cached once
+func explanationKey(a, b string) (string, string) {
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
@@ -0,0 +1,254 @@
+package database
+
+import "fmt"
+
+// GCReport counts the rows removed by CollectGarbage
+type GCReport struct {
+	Similarities int64 `json:"similarities"`
+	Edges        int64 `json:"edges"`
+	Citations    int64 `json:"citations"`
+	Keywords     int64 `json:"keywords"`
+	Entities     int64 `json:"entities"`
+	Passages     int64 `json:"passages"`
+	Runs         int64 `json:"runs"`
+}
+
+// Total returns the number of rows removed
+func (r GCReport) Total() int64 {
+	return r.Similarities + r.Edges + r.Citations + r.Keywords + r.Entities + r.Passages + r.Runs
+}
+
+// CollectGarbage deletes rows and passages that reference chunks that no
+// longer exist, which can be left behind by deletions made with foreign keys
+// disabled, and runs that no longer have any chunks. Runs whose chunks all
+// failed are kept so they can be retried.
+func (db *DB) CollectGarbage() (*GCReport, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	report := &GCReport{}
+	steps := []struct {
+		query string
+		count *int64
+	}{
+		// Passages go first so the rows referencing them are collected too
+		{`DELETE FROM text_chunks WHERE parent_chunk_id IS NOT NULL AND parent_chunk_id NOT IN (SELECT id FROM text_chunks)`, &report.Passages},
+		{`DELETE FROM chunk_similarities WHERE chunk_id_1 NOT IN (SELECT id FROM text_chunks) OR chunk_id_2 NOT IN (SELECT id FROM text_chunks)`, &report.Similarities},
+		{`DELETE FROM chunk_edges WHERE source_chunk_id NOT IN (SELECT id FROM text_chunks) OR target_chunk_id NOT IN (SELECT id FROM text_chunks)`, &report.Edges},
+		{`DELETE FROM chunk_citations WHERE chunk_id NOT IN (SELECT id FROM text_chunks)`, &report.Citations},
+		{`DELETE FROM chunk_keywords WHERE chunk_id NOT IN (SELECT id FROM text_chunks)`, &report.Keywords},
+		{`DELETE FROM chunk_entities WHERE chunk_id NOT IN (SELECT id FROM text_chunks)`, &report.Entities},
+		{`DELETE FROM runs WHERE id NOT IN (SELECT run_id FROM text_chunks WHERE run_id IS NOT NULL) AND id NOT IN (SELECT run_id FROM failed_chunks)`, &report.Runs},
+	}
+
+	for _, step := range steps {
+		result, err := tx.Exec(step.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect garbage: %w", err)
+		}
+		if *step.count, err = result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to count removed rows: %w", err)
+		}
+	}
+
+	// Entities are shared between chunks, so they are only removed once no
+	// chunk mentions them; the report counts the removed mentions
+	if _, err := tx.Exec(`DELETE FROM entities WHERE id NOT IN (SELECT entity_id FROM chunk_entities)`); err != nil {
+		return nil, fmt.Errorf("failed to collect garbage: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return report, nil
+}
+
+// Vacuum rebuilds the database file to reclaim space freed by deletions
+func (db *DB) Vacuum() error {
+	if _, err := db.conn.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// PruneSimilarities deletes the similarities below minSimilarity, which
+// databases storing every pair accumulate by the million. With
+// keepSequential, the similarity of each chunk to the next chunk of its run
+// is kept so sequence links and the timeline keep their values. It returns
+// the number of rows deleted.
+func (db *DB) PruneSimilarities(minSimilarity float64, keepSequential bool) (int64, error) {
+	query := `DELETE FROM chunk_similarities WHERE similarity < ?`
+	if keepSequential {
+		query += ` AND NOT EXISTS (
+			SELECT 1 FROM text_chunks a JOIN text_chunks b ON a.run_id = b.run_id
+			WHERE a.id = chunk_similarities.chunk_id_1 AND b.id = chunk_similarities.chunk_id_2
+				AND abs(a.chunk_index - b.chunk_index) = 1
+		)`
+	}
+
+	result, err := db.conn.Exec(query, minSimilarity)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune similarities: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pruned similarities: %w", err)
+	}
+	return n, nil
+}
+
+// Analyze refreshes the statistics SQLite's query planner uses to pick
+// indexes
+func (db *DB) Analyze() error {
+	if _, err := db.conn.Exec(`ANALYZE`); err != nil {
+		return fmt.Errorf("failed to analyze database: %w", err)
+	}
+	return nil
+}
+
+// FreeBytes returns the space of unused pages inside the database file,
+// which VACUUM returns to the file system
+func (db *DB) FreeBytes() (int64, error) {
+	var pages, pageSize int64
+	if err := db.conn.QueryRow(`PRAGMA freelist_count`).Scan(&pages); err != nil {
+		return 0, fmt.Errorf("failed to count free pages: %w", err)
+	}
+	if err := db.conn.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size: %w", err)
+	}
+	return pages * pageSize, nil
+}
+
+// ReplaceSimilarities replaces every stored similarity with similarities,
+// scored with metric, in one transaction, so a failure leaves the old
+// table in place. Callers should refresh chunk_neighbors afterwards.
+func (db *DB) ReplaceSimilarities(similarities []ChunkSimilarity, metric string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chunk_similarities`); err != nil {
+		return fmt.Errorf("failed to clear similarities: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO chunk_similarities (chunk_id_1, chunk_id_2, distance, similarity) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, similarity := range similarities {
+		if _, err := stmt.Exec(similarity.ChunkID1, similarity.ChunkID2, similarity.Distance, similarity.Similarity); err != nil {
+			return fmt.Errorf("failed to insert similarity %d-%d: %w", similarity.ChunkID1, similarity.ChunkID2, err)
+		}
+	}
+	if err := setSetting(tx, settingSimilarityMetric, metric); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ComparedChunkGroups returns the chunks, without passages, in groups whose
+// every pair processing compares: the chunks of a run, joined with the
+// chunks of other runs when a stored similarity links the two, as
+// processing a directory, merging and the API do, or of every run with
+// allRuns. Chunks in one of
+// separateLanguages were embedded with a model of their own and are only
+// grouped with chunks of the same language. Chunks recorded as embedded by
+// different models, or whose embeddings differ in length, can't be compared
+// and are never grouped; chunks without a recorded model join the others
+// unless the database records several models.
+func (db *DB) ComparedChunkGroups(separateLanguages []string, allRuns bool) ([][]TextChunk, error) {
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+
+	// Runs are joined by the similarities stored between their chunks
+	parent := make(map[int]int)
+	var find func(run int) int
+	find = func(run int) int {
+		p, ok := parent[run]
+		if !ok || p == run {
+			return run
+		}
+		root := find(p)
+		parent[run] = root
+		return root
+	}
+
+	rows, err := db.conn.Query(`SELECT DISTINCT COALESCE(a.run_id, 0), COALESCE(b.run_id, 0)
+		FROM chunk_similarities s
+		JOIN text_chunks a ON a.id = s.chunk_id_1
+		JOIN text_chunks b ON b.id = s.chunk_id_2
+		WHERE COALESCE(a.run_id, 0) != COALESCE(b.run_id, 0)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query linked runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a, b int
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, fmt.Errorf("failed to scan linked runs: %w", err)
+		}
+		if rootA, rootB := find(a), find(b); rootA != rootB {
+			parent[rootA] = rootB
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating linked runs: %w", err)
+	}
+
+	separate := make(map[string]bool, len(separateLanguages))
+	for _, language := range separateLanguages {
+		separate[language] = true
+	}
+	models, err := db.EmbeddingModels()
+	if err != nil {
+		return nil, err
+	}
+	recorded := 0
+	for _, model := range models {
+		if model != "" {
+			recorded++
+		}
+	}
+
+	type groupKey struct {
+		root       int
+		language   string
+		model      string
+		dimensions int
+	}
+	index := make(map[groupKey]int)
+	var groups [][]TextChunk
+	for _, chunk := range chunks {
+		key := groupKey{dimensions: len(chunk.Embedding)}
+		if !allRuns {
+			key.root = find(chunk.RunID)
+		}
+		if separate[chunk.Language] {
+			key.language = chunk.Language
+		}
+		if recorded > 1 {
+			key.model = chunk.EmbeddingModel
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], chunk)
+	}
+	return groups, nil
+}
@@ -0,0 +1,211 @@
+package database
+
+import "fmt"
+
+// MergeReport counts the rows copied by Merge. ChunkIDs maps each chunk ID
+// in the source database to its new ID.
+type MergeReport struct {
+	Runs         int
+	Chunks       int
+	Passages     int
+	Similarities int
+	Edges        int
+	Citations    int
+	Keywords     int
+	Entities     int
+	Tags         int
+	ChunkIDs     map[int]int
+}
+
+// Merge copies every run, chunk and passage from src into db, along with
+// the similarities, edges, citations, keywords, entities and tags that
+// reference them. Chunks and runs get new IDs; a run whose name is already taken is
+// renamed to "name (label)".
+func (db *DB) Merge(src *DB, label string) (*MergeReport, error) {
+	report := &MergeReport{ChunkIDs: make(map[int]int)}
+
+	runs, err := src.GetRuns()
+	if err != nil {
+		return nil, err
+	}
+	runIDs := make(map[int]int, len(runs))
+	for _, run := range runs {
+		name := run.Name
+		if _, err := db.GetRunByName(name); err == nil {
+			name = fmt.Sprintf("%s (%s)", run.Name, label)
+		}
+		created, err := db.CreateRun(name, run.Source)
+		if err != nil {
+			return nil, err
+		}
+		if run.EmbeddingModel != "" {
+			if err := db.SetRunEmbeddingModel(created.ID, run.EmbeddingModel); err != nil {
+				return nil, err
+			}
+		}
+		if run.EmbeddingProvider != "" {
+			if err := db.SetRunEmbeddingInfo(created.ID, run.EmbeddingProvider, run.EmbeddingDimensions); err != nil {
+				return nil, err
+			}
+		}
+		if run.Normalized {
+			if err := db.SetRunNormalized(created.ID, true); err != nil {
+				return nil, err
+			}
+		}
+		if run.Metadata != nil {
+			if err := db.SetRunMetadata(created.ID, *run.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		runIDs[run.ID] = created.ID
+		report.Runs++
+	}
+
+	chunks, err := src.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		oldID := chunk.ID
+		chunk.RunID = runIDs[chunk.RunID]
+		if err := db.InsertChunk(&chunk); err != nil {
+			return nil, err
+		}
+		report.ChunkIDs[oldID] = chunk.ID
+		report.Chunks++
+	}
+
+	passages, err := src.GetPassages()
+	if err != nil {
+		return nil, err
+	}
+	for _, passage := range passages {
+		oldID := passage.ID
+		passage.RunID = runIDs[passage.RunID]
+		passage.ParentID = report.ChunkIDs[passage.ParentID]
+		if err := db.InsertChunk(&passage); err != nil {
+			return nil, err
+		}
+		report.ChunkIDs[oldID] = passage.ID
+		report.Passages++
+	}
+
+	similarities, err := src.GetAllSimilarities()
+	if err != nil {
+		return nil, err
+	}
+	var remappedSimilarities []ChunkSimilarity
+	for _, sim := range similarities {
+		id1, ok1 := report.ChunkIDs[sim.ChunkID1]
+		id2, ok2 := report.ChunkIDs[sim.ChunkID2]
+		if !ok1 || !ok2 {
+			continue
+		}
+		sim.ChunkID1, sim.ChunkID2 = id1, id2
+		remappedSimilarities = append(remappedSimilarities, sim)
+	}
+	if err := db.BatchInsertSimilarities(remappedSimilarities); err != nil {
+		return nil, err
+	}
+	report.Similarities = len(remappedSimilarities)
+
+	edges, err := src.GetEdges()
+	if err != nil {
+		return nil, err
+	}
+	var remappedEdges []ChunkEdge
+	for _, edge := range edges {
+		source, ok1 := report.ChunkIDs[edge.SourceID]
+		target, ok2 := report.ChunkIDs[edge.TargetID]
+		if !ok1 || !ok2 {
+			continue
+		}
+		edge.SourceID, edge.TargetID = source, target
+		remappedEdges = append(remappedEdges, edge)
+	}
+	if err := db.BatchInsertEdges(remappedEdges); err != nil {
+		return nil, err
+	}
+	report.Edges = len(remappedEdges)
+
+	citations, err := src.GetAllCitations()
+	if err != nil {
+		return nil, err
+	}
+	var remappedCitations []ChunkCitation
+	for _, citation := range citations {
+		id, ok := report.ChunkIDs[citation.ChunkID]
+		if !ok {
+			continue
+		}
+		citation.ChunkID = id
+		remappedCitations = append(remappedCitations, citation)
+	}
+	if err := db.BatchInsertCitations(remappedCitations); err != nil {
+		return nil, err
+	}
+	report.Citations = len(remappedCitations)
+
+	keywords, err := src.GetAllKeywords()
+	if err != nil {
+		return nil, err
+	}
+	var chunkIDs []int
+	var remappedKeywords []ChunkKeyword
+	seen := make(map[int]bool)
+	for _, keyword := range keywords {
+		id, ok := report.ChunkIDs[keyword.ChunkID]
+		if !ok {
+			continue
+		}
+		keyword.ChunkID = id
+		remappedKeywords = append(remappedKeywords, keyword)
+		if !seen[id] {
+			seen[id] = true
+			chunkIDs = append(chunkIDs, id)
+		}
+	}
+	if err := db.ReplaceKeywords(chunkIDs, remappedKeywords); err != nil {
+		return nil, err
+	}
+	report.Keywords = len(remappedKeywords)
+
+	entities, err := src.GetAllEntities()
+	if err != nil {
+		return nil, err
+	}
+	var remappedEntities []ChunkEntity
+	for _, entity := range entities {
+		id, ok := report.ChunkIDs[entity.ChunkID]
+		if !ok {
+			continue
+		}
+		entity.ChunkID = id
+		remappedEntities = append(remappedEntities, entity)
+	}
+	if err := db.ReplaceEntities(nil, remappedEntities); err != nil {
+		return nil, err
+	}
+	report.Entities = len(remappedEntities)
+
+	tags, err := src.GetAllTags()
+	if err != nil {
+		return nil, err
+	}
+	var remappedTags []ChunkTag
+	for _, tag := range tags {
+		id, ok := report.ChunkIDs[tag.ChunkID]
+		if !ok {
+			continue
+		}
+		tag.ChunkID = id
+		remappedTags = append(remappedTags, tag)
+	}
+	if err := db.AddChunkTags(remappedTags); err != nil {
+		return nil, err
+	}
+	report.Tags = len(remappedTags)
+
+	return report, nil
+}
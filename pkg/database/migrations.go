@@ -0,0 +1,894 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// MigrationInfo describes a schema migration for reporting purposes
+type MigrationInfo struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// migrations are applied in order. Never edit or reorder an existing entry;
+// append a new one with the next version number instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create text_chunks and chunk_similarities tables",
+		up:          createBaseSchema,
+	},
+	{
+		version:     2,
+		description: "add summary column to text_chunks",
+		up:          addSummaryColumn,
+	},
+	{
+		version:     3,
+		description: "create chunk_edges table for typed edges",
+		up:          createChunkEdges,
+	},
+	{
+		version:     4,
+		description: "create chunk_citations table",
+		up:          createChunkCitations,
+	},
+	{
+		version:     5,
+		description: "add section column to text_chunks",
+		up:          addSectionColumn,
+	},
+	{
+		version:     6,
+		description: "create runs table and tag chunks with their run",
+		up:          createRuns,
+	},
+	{
+		version:     7,
+		description: "create chunk_keywords table",
+		up:          createChunkKeywords,
+	},
+	{
+		version:     8,
+		description: "add stable_id content hash to text_chunks",
+		up:          addStableIDColumn,
+	},
+	{
+		version:     9,
+		description: "cascade chunk deletions to similarities, edges, citations and keywords",
+		up:          cascadeChunkDeletes,
+	},
+	{
+		version:     10,
+		description: "add is_outlier flag to text_chunks",
+		up:          addOutlierColumn,
+	},
+	{
+		version:     11,
+		description: "add embedding_model column to runs",
+		up:          addRunEmbeddingModel,
+	},
+	{
+		version:     12,
+		description: "add sentence, paragraph and bullet summary columns to text_chunks",
+		up:          addSummaryStyleColumns,
+	},
+	{
+		version:     13,
+		description: "add language column to text_chunks",
+		up:          addLanguageColumn,
+	},
+	{
+		version:     14,
+		description: "create entities and chunk_entities tables",
+		up:          createEntities,
+	},
+	{
+		version:     15,
+		description: "add version column to text_chunks for optimistic locking",
+		up:          addChunkVersionColumn,
+	},
+	{
+		version:     16,
+		description: "add parent_chunk_id column to text_chunks for passages",
+		up:          addParentChunkColumn,
+	},
+	{
+		version:     17,
+		description: "add redacted column to text_chunks",
+		up:          addRedactedColumn,
+	},
+	{
+		version:     18,
+		description: "create chunk_tags table",
+		up:          createChunkTags,
+	},
+	{
+		version:     19,
+		description: "add speaker and timestamp columns to text_chunks",
+		up:          addTranscriptColumns,
+	},
+	{
+		version:     20,
+		description: "add embedding_provider and embedding_dimensions columns to runs",
+		up:          addRunEmbeddingInfo,
+	},
+	{
+		version:     21,
+		description: "create failed_chunks table",
+		up:          createFailedChunks,
+	},
+	{
+		version:     22,
+		description: "add token_count column to text_chunks",
+		up:          addTokenCountColumn,
+	},
+	{
+		version:     23,
+		description: "add sentiment column to text_chunks",
+		up:          addSentimentColumn,
+	},
+	{
+		version:     24,
+		description: "add metadata column to runs",
+		up:          addRunMetadataColumn,
+	},
+	{
+		version:     25,
+		description: "add title column to text_chunks",
+		up:          addTitleColumn,
+	},
+	{
+		version:     26,
+		description: "add kind column to text_chunks",
+		up:          addKindColumn,
+	},
+	{
+		version:     27,
+		description: "add normalized column to runs",
+		up:          addNormalizedColumn,
+	},
+	{
+		version:     28,
+		description: "create chunk_neighbors table",
+		up:          createChunkNeighbors,
+	},
+	{
+		version:     29,
+		description: "add summary_language column to text_chunks",
+		up:          addSummaryLanguageColumn,
+	},
+	{
+		version:     30,
+		description: "create database_settings table",
+		up:          createDatabaseSettings,
+	},
+	{
+		version:     31,
+		description: "add embedding_model column to text_chunks",
+		up:          addChunkEmbeddingModelColumn,
+	},
+	{
+		version:     32,
+		description: "create similarity_explanations table",
+		up:          createSimilarityExplanations,
+	},
+	{
+		version:     33,
+		description: "create embedding_projection table",
+		up:          createEmbeddingProjection,
+	},
+}
+
+// LatestSchemaVersion returns the schema version this build of bluffy writes
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func createBaseSchema(tx *sql.Tx) error {
+	// Databases created before schema versioning already have these tables,
+	// so every statement has to be idempotent.
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS text_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			embedding TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS chunk_similarities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chunk_id_1 INTEGER NOT NULL,
+			chunk_id_2 INTEGER NOT NULL,
+			distance REAL NOT NULL,
+			similarity REAL NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (chunk_id_1) REFERENCES text_chunks (id),
+			FOREIGN KEY (chunk_id_2) REFERENCES text_chunks (id),
+			UNIQUE(chunk_id_1, chunk_id_2)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_similarities_chunk1 ON chunk_similarities(chunk_id_1)`,
+		`CREATE INDEX IF NOT EXISTS idx_similarities_chunk2 ON chunk_similarities(chunk_id_2)`,
+		`CREATE INDEX IF NOT EXISTS idx_similarities_distance ON chunk_similarities(distance)`,
+	}
+
+	return execAll(tx, queries)
+}
+
+func addSummaryColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "summary")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN summary TEXT DEFAULT ''`)
+	return err
+}
+
+func createChunkEdges(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS chunk_edges (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source_chunk_id INTEGER NOT NULL,
+			target_chunk_id INTEGER NOT NULL,
+			edge_type TEXT NOT NULL,
+			weight REAL NOT NULL DEFAULT 1,
+			label TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (source_chunk_id) REFERENCES text_chunks (id),
+			FOREIGN KEY (target_chunk_id) REFERENCES text_chunks (id),
+			UNIQUE(source_chunk_id, target_chunk_id, edge_type, label)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_edges_type ON chunk_edges(edge_type)`,
+	})
+}
+
+func createChunkCitations(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS chunk_citations (
+			chunk_id INTEGER NOT NULL,
+			citation_key TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			FOREIGN KEY (chunk_id) REFERENCES text_chunks (id),
+			PRIMARY KEY (chunk_id, citation_key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_citations_key ON chunk_citations(citation_key)`,
+	})
+}
+
+func addSectionColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "section")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN section TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func createRuns(tx *sql.Tx) error {
+	err := execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			source TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE text_chunks ADD COLUMN run_id INTEGER REFERENCES runs (id)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_run ON text_chunks(run_id)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Chunks stored before runs existed all belong to one initial run
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM text_chunks`).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	return execAll(tx, []string{
+		`INSERT INTO runs (name, created_at) SELECT 'initial', MIN(created_at) FROM text_chunks`,
+		`UPDATE text_chunks SET run_id = (SELECT id FROM runs WHERE name = 'initial')`,
+	})
+}
+
+func createChunkKeywords(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS chunk_keywords (
+			chunk_id INTEGER NOT NULL,
+			keyword TEXT NOT NULL,
+			score REAL NOT NULL DEFAULT 0,
+			FOREIGN KEY (chunk_id) REFERENCES text_chunks (id),
+			PRIMARY KEY (chunk_id, keyword)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_keywords_keyword ON chunk_keywords(keyword)`,
+	})
+}
+
+func addStableIDColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "stable_id")
+	if err != nil || exists {
+		return err
+	}
+
+	err = execAll(tx, []string{
+		`ALTER TABLE text_chunks ADD COLUMN stable_id TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_stable_id ON text_chunks(stable_id)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	// SQLite has no built-in SHA-256, so existing chunks are hashed here
+	rows, err := tx.Query(`SELECT id, text FROM text_chunks`)
+	if err != nil {
+		return err
+	}
+	hashes := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes[id] = StableID(text)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, hash := range hashes {
+		if _, err := tx.Exec(`UPDATE text_chunks SET stable_id = ? WHERE id = ?`, hash, id); err != nil {
+			return fmt.Errorf("failed to set stable_id for chunk %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// cascadeChunkDeletes rebuilds the tables that reference text_chunks with
+// ON DELETE CASCADE, since SQLite cannot alter an existing foreign key. Rows
+// that already reference missing chunks are dropped along the way.
+func cascadeChunkDeletes(tx *sql.Tx) error {
+	tables := []struct {
+		name    string
+		create  string
+		columns string
+		valid   string
+		indexes []string
+	}{
+		{
+			name: "chunk_similarities",
+			create: `CREATE TABLE chunk_similarities (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				chunk_id_1 INTEGER NOT NULL,
+				chunk_id_2 INTEGER NOT NULL,
+				distance REAL NOT NULL,
+				similarity REAL NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (chunk_id_1) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				FOREIGN KEY (chunk_id_2) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				UNIQUE(chunk_id_1, chunk_id_2)
+			)`,
+			columns: "id, chunk_id_1, chunk_id_2, distance, similarity, created_at",
+			valid:   "chunk_id_1 IN (SELECT id FROM text_chunks) AND chunk_id_2 IN (SELECT id FROM text_chunks)",
+			indexes: []string{
+				`CREATE INDEX IF NOT EXISTS idx_similarities_chunk1 ON chunk_similarities(chunk_id_1)`,
+				`CREATE INDEX IF NOT EXISTS idx_similarities_chunk2 ON chunk_similarities(chunk_id_2)`,
+				`CREATE INDEX IF NOT EXISTS idx_similarities_distance ON chunk_similarities(distance)`,
+			},
+		},
+		{
+			name: "chunk_edges",
+			create: `CREATE TABLE chunk_edges (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				source_chunk_id INTEGER NOT NULL,
+				target_chunk_id INTEGER NOT NULL,
+				edge_type TEXT NOT NULL,
+				weight REAL NOT NULL DEFAULT 1,
+				label TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (source_chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				FOREIGN KEY (target_chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				UNIQUE(source_chunk_id, target_chunk_id, edge_type, label)
+			)`,
+			columns: "id, source_chunk_id, target_chunk_id, edge_type, weight, label, created_at",
+			valid:   "source_chunk_id IN (SELECT id FROM text_chunks) AND target_chunk_id IN (SELECT id FROM text_chunks)",
+			indexes: []string{
+				`CREATE INDEX IF NOT EXISTS idx_edges_type ON chunk_edges(edge_type)`,
+			},
+		},
+		{
+			name: "chunk_citations",
+			create: `CREATE TABLE chunk_citations (
+				chunk_id INTEGER NOT NULL,
+				citation_key TEXT NOT NULL,
+				kind TEXT NOT NULL,
+				FOREIGN KEY (chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				PRIMARY KEY (chunk_id, citation_key)
+			)`,
+			columns: "chunk_id, citation_key, kind",
+			valid:   "chunk_id IN (SELECT id FROM text_chunks)",
+			indexes: []string{
+				`CREATE INDEX IF NOT EXISTS idx_citations_key ON chunk_citations(citation_key)`,
+			},
+		},
+		{
+			name: "chunk_keywords",
+			create: `CREATE TABLE chunk_keywords (
+				chunk_id INTEGER NOT NULL,
+				keyword TEXT NOT NULL,
+				score REAL NOT NULL DEFAULT 0,
+				FOREIGN KEY (chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+				PRIMARY KEY (chunk_id, keyword)
+			)`,
+			columns: "chunk_id, keyword, score",
+			valid:   "chunk_id IN (SELECT id FROM text_chunks)",
+			indexes: []string{
+				`CREATE INDEX IF NOT EXISTS idx_keywords_keyword ON chunk_keywords(keyword)`,
+			},
+		},
+	}
+
+	for _, table := range tables {
+		queries := []string{
+			`ALTER TABLE ` + table.name + ` RENAME TO ` + table.name + `_old`,
+			table.create,
+			`INSERT INTO ` + table.name + ` (` + table.columns + `) SELECT ` + table.columns + ` FROM ` + table.name + `_old WHERE ` + table.valid,
+			`DROP TABLE ` + table.name + `_old`,
+		}
+		if err := execAll(tx, append(queries, table.indexes...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addOutlierColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "is_outlier")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN is_outlier INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+func addRunEmbeddingModel(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "runs", "embedding_model")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE runs ADD COLUMN embedding_model TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addSummaryStyleColumns(tx *sql.Tx) error {
+	for _, column := range []string{"summary_sentence", "summary_paragraph", "summary_bullets"} {
+		exists, err := columnExists(tx, "text_chunks", column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE text_chunks ADD COLUMN ` + column + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addLanguageColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "language")
+	if err != nil || exists {
+		return err
+	}
+
+	return execAll(tx, []string{
+		`ALTER TABLE text_chunks ADD COLUMN language TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_language ON text_chunks(language)`,
+	})
+}
+
+func execAll(tx *sql.Tx, queries []string) error {
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute query: %s, error: %w", query, err)
+		}
+	}
+	return nil
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan table info for %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func (db *DB) ensureVersionTable() error {
+	_, err := db.conn.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration version applied to the
+// database, or 0 if the database predates schema versioning.
+func (db *DB) SchemaVersion() (int, error) {
+	var exists int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check for schema_version table: %w", err)
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+
+	var version sql.NullInt64
+	if err := db.conn.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+// PendingMigrations lists the migrations that have not been applied yet
+func (db *DB) PendingMigrations() ([]MigrationInfo, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []MigrationInfo
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, MigrationInfo{Version: m.version, Description: m.description})
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate applies all pending migrations, each in its own transaction, and
+// returns the ones that were applied.
+func (db *DB) Migrate() ([]MigrationInfo, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if current > LatestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d; please upgrade bluffy", current, LatestSchemaVersion())
+	}
+
+	if current == LatestSchemaVersion() {
+		return nil, nil
+	}
+
+	if err := db.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationInfo
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		if err := db.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		applied = append(applied, MigrationInfo{Version: m.version, Description: m.description})
+	}
+
+	return applied, nil
+}
+
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func createEntities(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS entities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			UNIQUE(name, type)
+		)`,
+		`CREATE TABLE IF NOT EXISTS chunk_entities (
+			chunk_id INTEGER NOT NULL,
+			entity_id INTEGER NOT NULL,
+			FOREIGN KEY (chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+			FOREIGN KEY (entity_id) REFERENCES entities (id) ON DELETE CASCADE,
+			PRIMARY KEY (chunk_id, entity_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunk_entities_entity ON chunk_entities(entity_id)`,
+	})
+}
+
+func addChunkVersionColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "version")
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN version INTEGER NOT NULL DEFAULT 1`)
+	return err
+}
+
+func addParentChunkColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "parent_chunk_id")
+	if err != nil || exists {
+		return err
+	}
+
+	return execAll(tx, []string{
+		`ALTER TABLE text_chunks ADD COLUMN parent_chunk_id INTEGER REFERENCES text_chunks (id) ON DELETE CASCADE`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_parent ON text_chunks(parent_chunk_id)`,
+	})
+}
+
+func addRedactedColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "redacted")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN redacted INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+func createChunkTags(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS chunk_tags (
+			chunk_id INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+			PRIMARY KEY (chunk_id, tag)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunk_tags_tag ON chunk_tags(tag)`,
+	})
+}
+
+func addTranscriptColumns(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "speaker")
+	if err != nil || exists {
+		return err
+	}
+
+	return execAll(tx, []string{
+		`ALTER TABLE text_chunks ADD COLUMN speaker TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE text_chunks ADD COLUMN start_seconds REAL`,
+		`ALTER TABLE text_chunks ADD COLUMN end_seconds REAL`,
+	})
+}
+
+func addRunEmbeddingInfo(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "runs", "embedding_provider")
+	if err != nil || exists {
+		return err
+	}
+
+	return execAll(tx, []string{
+		`ALTER TABLE runs ADD COLUMN embedding_provider TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE runs ADD COLUMN embedding_dimensions INTEGER NOT NULL DEFAULT 0`,
+	})
+}
+
+func createFailedChunks(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS failed_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id INTEGER NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			chunk TEXT NOT NULL,
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (run_id) REFERENCES runs (id) ON DELETE CASCADE,
+			UNIQUE(run_id, chunk_index)
+		)`,
+	})
+}
+
+func addTokenCountColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "token_count")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN token_count INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+// addSentimentColumn stores each chunk's emotional valence; NULL until the
+// chunk is scored
+func addSentimentColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "sentiment")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN sentiment REAL`)
+	return err
+}
+
+// addRunMetadataColumn stores document frontmatter as JSON; empty for
+// documents without any
+func addRunMetadataColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "runs", "metadata")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE runs ADD COLUMN metadata TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addTitleColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "title")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN title TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addKindColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "kind")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN kind TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func addSummaryLanguageColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "summary_language")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN summary_language TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+func createChunkNeighbors(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS chunk_neighbors (
+			chunk_id INTEGER NOT NULL,
+			neighbor_id INTEGER NOT NULL,
+			rank INTEGER NOT NULL,
+			similarity REAL NOT NULL,
+			distance REAL NOT NULL,
+			FOREIGN KEY (chunk_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+			FOREIGN KEY (neighbor_id) REFERENCES text_chunks (id) ON DELETE CASCADE,
+			PRIMARY KEY (chunk_id, rank)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunk_neighbors_neighbor ON chunk_neighbors(neighbor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunk_neighbors_rank ON chunk_neighbors(rank)`,
+	})
+}
+
+func addNormalizedColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "runs", "normalized")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE runs ADD COLUMN normalized INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+func createDatabaseSettings(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS database_settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`,
+	})
+}
+
+// addChunkEmbeddingModelColumn records the model that embedded a chunk when
+// "bluffy embed" or process --language-model used another than its run's;
+// empty for chunks embedded with their run's model
+func addChunkEmbeddingModelColumn(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "text_chunks", "embedding_model")
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE text_chunks ADD COLUMN embedding_model TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// createSimilarityExplanations caches LLM explanations of similar chunks by
+// the stable IDs of the pair, so they outlive recalc but not edits
+func createSimilarityExplanations(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS similarity_explanations (
+			stable_id_1 TEXT NOT NULL,
+			stable_id_2 TEXT NOT NULL,
+			explanation TEXT NOT NULL,
+			model TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (stable_id_1, stable_id_2)
+		)`,
+	})
+}
+
+// createEmbeddingProjection stores the PCA projection the embeddings of a
+// database were reduced with; it has at most one row
+func createEmbeddingProjection(tx *sql.Tx) error {
+	return execAll(tx, []string{
+		`CREATE TABLE IF NOT EXISTS embedding_projection (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			source_dimensions INTEGER NOT NULL,
+			mean TEXT NOT NULL,
+			components TEXT NOT NULL,
+			explained_variance REAL NOT NULL,
+			fitted_chunks INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+	})
+}
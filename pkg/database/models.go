@@ -1,17 +1,241 @@
 package database
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
 type TextChunk struct {
 	ID         int       `json:"id"`
 	Text       string    `json:"text"`
 	ChunkIndex int       `json:"chunk_index"`
 	Embedding  []float64 `json:"embedding"`
 	Summary    string    `json:"summary"`
+	Section    string    `json:"section,omitempty"`
+	RunID      int       `json:"run_id,omitempty"`
+	StableID   string    `json:"stable_id"`
+	IsOutlier  bool      `json:"is_outlier,omitempty"`
+	Language   string    `json:"language,omitempty"` // ISO 639-1 code, empty if undetermined
+	// Version starts at 1 and is incremented by every UpdateChunk
+	Version int `json:"version"`
+	// ParentID is set on passages, the small chunks a chunk is split into
+	// for fine-grained search, and is the ID of the chunk they came from
+	ParentID int `json:"parent_chunk_id,omitempty"`
+	// Redacted is set when personal data was masked in the text before it
+	// was embedded and stored
+	Redacted bool `json:"redacted,omitempty"`
+	// Speaker and the start and end of the chunk in seconds are set for
+	// chunks of transcripts; Speaker lists every speaker in the chunk
+	Speaker      string   `json:"speaker,omitempty"`
+	StartSeconds *float64 `json:"start_seconds,omitempty"`
+	EndSeconds   *float64 `json:"end_seconds,omitempty"`
+	// EmbeddingModel is the model that embedded the chunk: the run's,
+	// unless process --language-model or "bluffy embed" used another.
+	// Empty for chunks of runs that didn't record their model.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// TokenCount is the estimated number of tokens the embedding model
+	// read, 0 for chunks stored before counts were recorded
+	TokenCount int `json:"token_count,omitempty"`
+	// Sentiment is the emotional valence of the text, from -1 (negative)
+	// to 1 (positive); nil until the chunk is scored
+	Sentiment *float64 `json:"sentiment,omitempty"`
+	// Title is a short human-readable heading for the chunk, generated
+	// with --titles or "bluffy retitle"; empty until then
+	Title string `json:"title,omitempty"`
+	// Kind tells notebook cells apart: ChunkKindMarkdown or ChunkKindCode.
+	// It is empty for the prose of every other format.
+	Kind string `json:"kind,omitempty"`
+
+	// Longer summaries, only set for the styles requested with
+	// --summary-style. Summary always holds the short topic label.
+	SummarySentence  string `json:"summary_sentence,omitempty"`
+	SummaryParagraph string `json:"summary_paragraph,omitempty"`
+	SummaryBullets   string `json:"summary_bullets,omitempty"`
+	// SummaryLanguage is the ISO 639-1 code of the language the summaries
+	// were requested in with --summary-language, empty if the model chose
+	SummaryLanguage string `json:"summary_language,omitempty"`
+}
+
+// Chunk kinds of Jupyter notebook cells
+const (
+	ChunkKindMarkdown = "markdown"
+	ChunkKindCode     = "code"
+)
+
+// StableID returns the content hash that identifies a chunk across
+// databases and re-processing: the hex SHA-256 of its text. Unlike the
+// numeric ID it does not depend on insertion order, so chunks with
+// identical text share a stable ID.
+func StableID(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
 }
 
 type ChunkSimilarity struct {
-	ID           int     `json:"id"`
-	ChunkID1     int     `json:"chunk_id_1"`
-	ChunkID2     int     `json:"chunk_id_2"`
-	Distance     float64 `json:"distance"`
-	Similarity   float64 `json:"similarity"`
-}
\ No newline at end of file
+	ID         int     `json:"id"`
+	ChunkID1   int     `json:"chunk_id_1"`
+	ChunkID2   int     `json:"chunk_id_2"`
+	Distance   float64 `json:"distance"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Edge types. Similarity and sequence edges are derived from chunk_similarities
+// and chunk order; the others are stored in chunk_edges.
+const (
+	EdgeTypeSimilarity   = "similarity"
+	EdgeTypeSequence     = "sequence"
+	EdgeTypeWikilink     = "wikilink"
+	EdgeTypeEntityShared = "entity-shared"
+	EdgeTypeCitation     = "citation"
+)
+
+// EdgeTypes lists every known edge type
+var EdgeTypes = []string{
+	EdgeTypeSimilarity,
+	EdgeTypeSequence,
+	EdgeTypeWikilink,
+	EdgeTypeEntityShared,
+	EdgeTypeCitation,
+}
+
+// ChunkEdge is a typed relationship between two chunks that isn't a
+// similarity score, such as a wikilink or a shared citation
+type ChunkEdge struct {
+	ID       int     `json:"id"`
+	SourceID int     `json:"source_id"`
+	TargetID int     `json:"target_id"`
+	Type     string  `json:"type"`
+	Weight   float64 `json:"weight"`
+	Label    string  `json:"label,omitempty"`
+}
+
+// ChunkCitation is a normalized reference to a cited work found in a chunk
+type ChunkCitation struct {
+	ChunkID int    `json:"chunk_id"`
+	Key     string `json:"key"`
+	Kind    string `json:"kind"`
+	// RunID is the run of the citing chunk; numeric markers only refer to
+	// works within it
+	RunID int `json:"run_id,omitempty"`
+}
+
+// Run is one processing run. Re-processing an evolving corpus into the same
+// database creates a new run, so earlier runs can be compared against it.
+type Run struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+	// EmbeddingModel is empty for runs stored before models were recorded
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// EmbeddingProvider (ollama, cohere, voyage or jina) and
+	// EmbeddingDimensions are empty for runs stored before they were
+	// recorded
+	EmbeddingProvider   string `json:"embedding_provider,omitempty"`
+	EmbeddingDimensions int    `json:"embedding_dimensions,omitempty"`
+	// Normalized runs store their embeddings scaled to unit length
+	Normalized bool `json:"normalized,omitempty"`
+	// Metadata is read from the frontmatter of Markdown notes, or from the
+	// bibliography entry of a document processed with --bib; nil for other
+	// documents
+	Metadata *DocumentMetadata `json:"metadata,omitempty"`
+}
+
+// DocumentMetadata is the frontmatter of a Markdown or Obsidian note, or
+// the bibliography entry of a document
+type DocumentMetadata struct {
+	Title   string   `json:"title,omitempty"`
+	Date    string   `json:"date,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Citation is set for documents processed from a bibliography
+	Citation *Citation `json:"citation,omitempty"`
+}
+
+// Citation is the bibliography entry a document was processed from
+type Citation struct {
+	Key string `json:"key"`
+	// Type is the BibTeX entry type, e.g. article or book
+	Type    string   `json:"type,omitempty"`
+	Authors []string `json:"authors,omitempty"`
+	Year    string   `json:"year,omitempty"`
+	// Venue is the journal, book, publisher or institution
+	Venue string `json:"venue,omitempty"`
+	DOI   string `json:"doi,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// Label returns a short author-year label such as "Smith and Jones 2020"
+// or "Smith et al. 2020", or the citation key without authors
+func (c *Citation) Label() string {
+	var names []string
+	for _, author := range c.Authors {
+		// The surname comes before a suffix such as ", Jr."
+		name, _, _ := strings.Cut(author, ",")
+		if fields := strings.Fields(name); len(fields) > 0 {
+			names = append(names, fields[len(fields)-1])
+		}
+	}
+
+	var label string
+	switch len(names) {
+	case 0:
+		return c.Key
+	case 1:
+		label = names[0]
+	case 2:
+		label = names[0] + " and " + names[1]
+	default:
+		label = names[0] + " et al."
+	}
+	if c.Year != "" {
+		label += " " + c.Year
+	}
+	return label
+}
+
+// FailedChunk is a chunk that could not be embedded or summarized. Chunk
+// holds everything needed to process it again, without its embedding and
+// summaries.
+type FailedChunk struct {
+	ID         int       `json:"id"`
+	RunID      int       `json:"run_id"`
+	ChunkIndex int       `json:"chunk_index"`
+	Chunk      TextChunk `json:"chunk"`
+	Error      string    `json:"error"`
+	// Attempts counts how many times processing the chunk failed
+	Attempts  int    `json:"attempts"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ChunkKeyword is a keyword extracted from a chunk. Score is the TF-IDF
+// weight, or 0 when the keyword came from the LLM.
+type ChunkKeyword struct {
+	ChunkID int     `json:"chunk_id"`
+	Keyword string  `json:"keyword"`
+	Score   float64 `json:"score"`
+}
+
+// ChunkTag is a tag a user attached to a chunk
+type ChunkTag struct {
+	ChunkID int    `json:"chunk_id"`
+	Tag     string `json:"tag"`
+}
+
+// Entity types
+const (
+	EntityPerson       = "person"
+	EntityPlace        = "place"
+	EntityOrganization = "organization"
+)
+
+// EntityTypes lists the valid entity types
+var EntityTypes = []string{EntityPerson, EntityPlace, EntityOrganization}
+
+// ChunkEntity is a named person, place or organization mentioned in a chunk
+type ChunkEntity struct {
+	ChunkID int    `json:"chunk_id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+}
@@ -0,0 +1,195 @@
+package database
+
+import "fmt"
+
+// RebuildNeighbors replaces the chunk_neighbors table with the k most
+// similar chunks of every chunk, ranked from 1, so k-nearest-neighbor
+// queries don't have to read every similarity. It returns the number of
+// rows stored.
+func (db *DB) RebuildNeighbors(k int) (int, error) {
+	if k <= 0 {
+		return 0, fmt.Errorf("k must be positive, got %d", k)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM chunk_neighbors`); err != nil {
+		return 0, fmt.Errorf("failed to clear neighbors: %w", err)
+	}
+	result, err := tx.Exec(`INSERT INTO chunk_neighbors (chunk_id, neighbor_id, rank, similarity, distance)
+		SELECT chunk_id, neighbor_id, rank, similarity, distance FROM (
+			SELECT chunk_id, neighbor_id, similarity, distance,
+				ROW_NUMBER() OVER (PARTITION BY chunk_id ORDER BY similarity DESC, neighbor_id) AS rank
+			FROM (
+				SELECT chunk_id_1 AS chunk_id, chunk_id_2 AS neighbor_id, similarity, distance FROM chunk_similarities
+				UNION ALL
+				SELECT chunk_id_2, chunk_id_1, similarity, distance FROM chunk_similarities
+			)
+		)
+		WHERE rank <= ?`, k)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store neighbors: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit neighbors: %w", err)
+	}
+
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(stored), nil
+}
+
+// NeighborsK returns the number of neighbors stored per chunk, or 0 if
+// chunk_neighbors is empty
+func (db *DB) NeighborsK() (int, error) {
+	var k int
+	if err := db.conn.QueryRow(`SELECT COALESCE(MAX(rank), 0) FROM chunk_neighbors`).Scan(&k); err != nil {
+		return 0, fmt.Errorf("failed to read neighbors: %w", err)
+	}
+	return k, nil
+}
+
+// RefreshNeighbors rebuilds chunk_neighbors after similarities change,
+// keeping the number of neighbors it was built with. It does nothing if
+// the table was never built.
+func (db *DB) RefreshNeighbors() error {
+	k, err := db.NeighborsK()
+	if err != nil || k == 0 {
+		return err
+	}
+	_, err = db.RebuildNeighbors(k)
+	return err
+}
+
+// GetNeighborSimilarities returns the similarity rows linking every chunk
+// to its k nearest neighbors, read from chunk_neighbors, with ChunkID1 the
+// smaller ID. It returns false if fewer than k neighbors per chunk are
+// stored, in which case the caller has to read every similarity instead.
+func (db *DB) GetNeighborSimilarities(k int) ([]ChunkSimilarity, bool, error) {
+	stored, err := db.NeighborsK()
+	if err != nil || stored < k {
+		return nil, false, err
+	}
+
+	rows, err := db.conn.Query(`SELECT DISTINCT MIN(chunk_id, neighbor_id), MAX(chunk_id, neighbor_id), distance, similarity
+		FROM chunk_neighbors WHERE rank <= ? ORDER BY similarity DESC, 1, 2`, k)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query neighbors: %w", err)
+	}
+	defer rows.Close()
+
+	var similarities []ChunkSimilarity
+	for rows.Next() {
+		var sim ChunkSimilarity
+		if err := rows.Scan(&sim.ChunkID1, &sim.ChunkID2, &sim.Distance, &sim.Similarity); err != nil {
+			return nil, false, fmt.Errorf("failed to scan neighbor row: %w", err)
+		}
+		similarities = append(similarities, sim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error iterating neighbor rows: %w", err)
+	}
+	return similarities, true, nil
+}
+
+// GetChunkNeighbors returns up to limit of the nearest neighbors of a
+// chunk at or above minSimilarity from chunk_neighbors, most similar
+// first, as similarity rows with the chunk as ChunkID1. It returns false if
+// fewer than limit neighbors per chunk are stored.
+func (db *DB) GetChunkNeighbors(chunkID int, minSimilarity float64, limit int) ([]ChunkSimilarity, bool, error) {
+	stored, err := db.NeighborsK()
+	if err != nil || stored < limit {
+		return nil, false, err
+	}
+
+	rows, err := db.conn.Query(`SELECT neighbor_id, distance, similarity FROM chunk_neighbors
+		WHERE chunk_id = ? AND similarity >= ? ORDER BY rank LIMIT ?`, chunkID, minSimilarity, limit)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query neighbors of chunk %d: %w", chunkID, err)
+	}
+	defer rows.Close()
+
+	var similarities []ChunkSimilarity
+	for rows.Next() {
+		sim := ChunkSimilarity{ChunkID1: chunkID}
+		if err := rows.Scan(&sim.ChunkID2, &sim.Distance, &sim.Similarity); err != nil {
+			return nil, false, fmt.Errorf("failed to scan neighbor row: %w", err)
+		}
+		similarities = append(similarities, sim)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error iterating neighbor rows: %w", err)
+	}
+	return similarities, true, nil
+}
+
+// RefreshChunkNeighbors updates chunk_neighbors after the similarities of
+// the given chunks were added or replaced, without reading every
+// similarity: only their own neighbors are recomputed, along with those of
+// chunks that listed them or that they are now closer to than one of
+// their neighbors. It does nothing if the table was never built.
+func (db *DB) RefreshChunkNeighbors(chunkIDs []int) error {
+	k, err := db.NeighborsK()
+	if err != nil || k == 0 {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	affected := make(map[int]bool)
+	for _, id := range chunkIDs {
+		affected[id] = true
+		rows, err := tx.Query(`SELECT chunk_id FROM chunk_neighbors WHERE neighbor_id = ?
+			UNION
+			SELECT other FROM (
+				SELECT CASE WHEN chunk_id_1 = ? THEN chunk_id_2 ELSE chunk_id_1 END AS other, similarity
+				FROM chunk_similarities WHERE chunk_id_1 = ? OR chunk_id_2 = ?
+			) AS s
+			WHERE s.similarity > COALESCE((SELECT similarity FROM chunk_neighbors WHERE chunk_id = s.other AND rank = ?), -2)`,
+			id, id, id, id, k)
+		if err != nil {
+			return fmt.Errorf("failed to find chunks near chunk %d: %w", id, err)
+		}
+		for rows.Next() {
+			var other int
+			if err := rows.Scan(&other); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan neighbor row: %w", err)
+			}
+			affected[other] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating neighbor rows: %w", err)
+		}
+	}
+
+	for id := range affected {
+		if _, err := tx.Exec(`DELETE FROM chunk_neighbors WHERE chunk_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to clear neighbors of chunk %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO chunk_neighbors (chunk_id, neighbor_id, rank, similarity, distance)
+			SELECT ?, other, ROW_NUMBER() OVER (ORDER BY similarity DESC, other), similarity, distance FROM (
+				SELECT CASE WHEN chunk_id_1 = ? THEN chunk_id_2 ELSE chunk_id_1 END AS other, similarity, distance
+				FROM chunk_similarities WHERE chunk_id_1 = ? OR chunk_id_2 = ?
+			)
+			ORDER BY similarity DESC, other LIMIT ?`, id, id, id, id, k); err != nil {
+			return fmt.Errorf("failed to store neighbors of chunk %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit neighbors: %w", err)
+	}
+	return nil
+}
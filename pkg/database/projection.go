@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Projection reduces embeddings to fewer dimensions with principal
+// component analysis. A database holds at most one, recorded by
+// ApplyProjection; its stored embeddings are projected, so every
+// embedding compared with them, such as a search query, must be projected
+// with it first.
+type Projection struct {
+	// SourceDimensions is the length of the embeddings it projects
+	SourceDimensions int `json:"source_dimensions"`
+	// Mean is subtracted from an embedding before it is projected
+	Mean []float64 `json:"-"`
+	// Components are the principal components, most variance first; each
+	// is a dimension of the projected embeddings
+	Components [][]float64 `json:"-"`
+	// ExplainedVariance is the share of the variance of the fitted
+	// embeddings the components keep, from 0 to 1
+	ExplainedVariance float64 `json:"explained_variance"`
+	// FittedChunks is the number of embeddings the components were fitted on
+	FittedChunks int    `json:"fitted_chunks"`
+	CreatedAt    string `json:"created_at,omitempty"`
+}
+
+// Dimensions returns the length of projected embeddings
+func (p *Projection) Dimensions() int {
+	return len(p.Components)
+}
+
+// Project returns embedding reduced to the projection's dimensions
+func (p *Projection) Project(embedding []float64) ([]float64, error) {
+	if len(embedding) != p.SourceDimensions {
+		return nil, fmt.Errorf("embedding has %d dimensions but the database's projection expects %d; embed with the model the database was processed with", len(embedding), p.SourceDimensions)
+	}
+	projected := make([]float64, len(p.Components))
+	for i, component := range p.Components {
+		var sum float64
+		for j, value := range embedding {
+			sum += (value - p.Mean[j]) * component[j]
+		}
+		projected[i] = sum
+	}
+	return projected, nil
+}
+
+// Projection returns the projection the database's embeddings were reduced
+// with, or nil if they weren't
+func (db *DB) Projection() (*Projection, error) {
+	var exists int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'embedding_projection'`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check for embedding projection: %w", err)
+	}
+	if exists == 0 {
+		return nil, nil
+	}
+
+	var p Projection
+	var meanJSON, componentsJSON string
+	err := db.conn.QueryRow(`SELECT source_dimensions, mean, components, explained_variance, fitted_chunks, created_at FROM embedding_projection WHERE id = 1`).
+		Scan(&p.SourceDimensions, &meanJSON, &componentsJSON, &p.ExplainedVariance, &p.FittedChunks, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding projection: %w", err)
+	}
+	if err := json.Unmarshal([]byte(meanJSON), &p.Mean); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal projection mean: %w", err)
+	}
+	if err := json.Unmarshal([]byte(componentsJSON), &p.Components); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal projection components: %w", err)
+	}
+	return &p, nil
+}
+
+// ApplyProjection replaces the embeddings of chunks, already projected with
+// p, and records p as the database's projection. The runs record the
+// projected dimensions, and the sqlite-vec index, which has the old ones,
+// is dropped to be rebuilt by the next search.
+func (db *DB) ApplyProjection(p *Projection, chunks []TextChunk) error {
+	meanJSON, err := json.Marshal(p.Mean)
+	if err != nil {
+		return fmt.Errorf("failed to marshal projection mean: %w", err)
+	}
+	componentsJSON, err := json.Marshal(p.Components)
+	if err != nil {
+		return fmt.Errorf("failed to marshal projection components: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, chunk := range chunks {
+		embeddingJSON, err := json.Marshal(chunk.Embedding)
+		if err != nil {
+			return fmt.Errorf("failed to marshal embedding: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE text_chunks SET embedding = ? WHERE id = ?`, string(embeddingJSON), chunk.ID); err != nil {
+			return fmt.Errorf("failed to store embedding of chunk %d: %w", chunk.ID, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO embedding_projection (id, source_dimensions, mean, components, explained_variance, fitted_chunks, created_at)
+		VALUES (1, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		p.SourceDimensions, string(meanJSON), string(componentsJSON), p.ExplainedVariance, p.FittedChunks)
+	if err != nil {
+		return fmt.Errorf("failed to store embedding projection: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE runs SET embedding_dimensions = ? WHERE embedding_dimensions != 0`, p.Dimensions()); err != nil {
+		return fmt.Errorf("failed to update run dimensions: %w", err)
+	}
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS vec_chunks`); err != nil {
+		return fmt.Errorf("failed to drop vector index: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveProjection forgets the database's projection before its embeddings
+// are replaced with unprojected ones, dropping the sqlite-vec index of the
+// projected ones
+func (db *DB) RemoveProjection() error {
+	if _, err := db.conn.Exec(`DELETE FROM embedding_projection`); err != nil {
+		return fmt.Errorf("failed to remove embedding projection: %w", err)
+	}
+	return db.DropVectorIndex()
+}
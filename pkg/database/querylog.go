@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryLogger receives a line for every statement run against databases
+// opened while it is set, or is nil when query logging is off
+var queryLogger *log.Logger
+
+// maxLoggedSQL is how much of a statement is logged
+const maxLoggedSQL = 300
+
+// SetQueryLogger makes every database opened afterwards log each statement
+// it runs to logger, with its duration and row count, and a summary with
+// the slowest statement when it is closed. A nil logger turns it off.
+func SetQueryLogger(logger *log.Logger) {
+	queryLogger = logger
+}
+
+// QueryStats summarizes the statements run against a database since it
+// was opened. It is only recorded while a query logger is set.
+type QueryStats struct {
+	Statements int
+	Rows       int64
+	Duration   time.Duration
+	Slowest    time.Duration
+	SlowestSQL string
+}
+
+// queryLog records the statements of one DB
+type queryLog struct {
+	logger *log.Logger
+	name   string
+
+	mu    sync.Mutex
+	stats QueryStats
+}
+
+func (l *queryLog) record(query string, rows int64, elapsed time.Duration, err error) {
+	query = strings.Join(strings.Fields(query), " ")
+
+	l.mu.Lock()
+	l.stats.Statements++
+	l.stats.Rows += rows
+	l.stats.Duration += elapsed
+	if elapsed > l.stats.Slowest {
+		l.stats.Slowest = elapsed
+		l.stats.SlowestSQL = query
+	}
+	l.mu.Unlock()
+
+	if len(query) > maxLoggedSQL {
+		query = query[:maxLoggedSQL] + "..."
+	}
+	if err != nil {
+		l.logger.Printf("sql %s: %s, failed: %v: %s", l.name, roundDuration(elapsed), err, query)
+		return
+	}
+	l.logger.Printf("sql %s: %s, %d rows: %s", l.name, roundDuration(elapsed), rows, query)
+}
+
+// summarize logs the totals of every statement recorded
+func (l *queryLog) summarize() {
+	stats := l.snapshot()
+	if stats.Statements == 0 {
+		return
+	}
+	slowest := stats.SlowestSQL
+	if len(slowest) > maxLoggedSQL {
+		slowest = slowest[:maxLoggedSQL] + "..."
+	}
+	l.logger.Printf("sql %s: %d statements in %s, %d rows; slowest %s: %s",
+		l.name, stats.Statements, roundDuration(stats.Duration), stats.Rows, roundDuration(stats.Slowest), slowest)
+}
+
+func (l *queryLog) snapshot() QueryStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// QueryStats returns the statements run so far, and false if the database
+// was opened without a query logger
+func (db *DB) QueryStats() (QueryStats, bool) {
+	if db.queries == nil {
+		return QueryStats{}, false
+	}
+	return db.queries.snapshot(), true
+}
+
+// openConn opens the connection pool of a DB, routing it through the
+// query log if a logger is set
+func openConn(db *DB) (*sql.DB, error) {
+	conn, err := sql.Open(driverName, dsn(db))
+	if err != nil || queryLogger == nil {
+		return conn, err
+	}
+
+	// sql.Open doesn't connect, it only looks up the driver
+	d := conn.Driver()
+	conn.Close()
+
+	db.queries = &queryLog{logger: queryLogger, name: filepath.Base(db.path)}
+	return sql.OpenDB(&loggingConnector{driver: d, dsn: dsn(db), log: db.queries}), nil
+}
+
+// loggingConnector opens connections whose statements are recorded in log
+type loggingConnector struct {
+	driver driver.Driver
+	dsn    string
+	log    *queryLog
+}
+
+func (c *loggingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &loggingConn{Conn: conn, log: c.log}, nil
+}
+
+func (c *loggingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// loggingConn wraps a SQLite connection, which implements every optional
+// interface forwarded here
+type loggingConn struct {
+	driver.Conn
+	log *queryLog
+}
+
+func (c *loggingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *loggingConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *loggingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &loggingStmt{Stmt: stmt, query: query, log: c.log}, nil
+}
+
+func (c *loggingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	c.log.record(query, rowsAffected(result, err), time.Since(start), err)
+	return result, err
+}
+
+func (c *loggingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != nil {
+		c.log.record(query, 0, time.Since(start), err)
+		return nil, err
+	}
+	return &loggingRows{Rows: rows, query: query, start: start, log: c.log}, nil
+}
+
+type loggingStmt struct {
+	driver.Stmt
+	query string
+	log   *queryLog
+}
+
+func (s *loggingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	s.log.record(s.query, rowsAffected(result, err), time.Since(start), err)
+	return result, err
+}
+
+func (s *loggingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		s.log.record(s.query, 0, time.Since(start), err)
+		return nil, err
+	}
+	return &loggingRows{Rows: rows, query: s.query, start: start, log: s.log}, nil
+}
+
+// loggingRows counts the rows read and records the query when closed, so
+// its duration includes reading the results
+type loggingRows struct {
+	driver.Rows
+	query string
+	start time.Time
+	log   *queryLog
+	count int64
+	err   error
+}
+
+func (r *loggingRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.count++
+	case err != io.EOF:
+		r.err = err
+	}
+	return err
+}
+
+func (r *loggingRows) Close() error {
+	err := r.Rows.Close()
+	r.log.record(r.query, r.count, time.Since(r.start), r.err)
+	return err
+}
+
+func rowsAffected(result driver.Result, err error) int64 {
+	if err != nil {
+		return 0
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
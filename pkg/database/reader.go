@@ -2,27 +2,103 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Errors returned when a lookup matches nothing
+var (
+	ErrChunkNotFound = errors.New("chunk not found")
+	ErrRunNotFound   = errors.New("run not found")
+	// ErrVersionConflict is returned when a chunk was changed after the
+	// version being updated was read
+	ErrVersionConflict = errors.New("chunk was modified by another update")
+)
+
+// OpenExistingDB opens a database and upgrades its schema to the latest
+// version if it was created by an older release. It fails with
+// ErrNotBluffyDB for files bluffy didn't write and ErrIncompleteDB for
+// databases missing part of their schema.
 func OpenExistingDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.CheckBluffy(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := db.checkSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// OpenReadOnlyDB opens a database that nothing done through it can change,
+// e.g. an archived corpus being served. Pending migrations can't be
+// applied, so a database created by an older release fails until it is
+// migrated, e.g. with OpenExistingDB.
+func OpenReadOnlyDB(dbPath string) (*DB, error) {
+	db := &DB{path: dbPath, readOnly: true}
+	conn, err := openConn(db)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.conn = conn
 
-	db := &DB{
-		conn: conn,
-		path: dbPath,
+	if err := db.CheckBluffy(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if len(pending) > 0 {
+		db.Close()
+		return nil, fmt.Errorf("%s has an older schema, which can't be migrated read-only; run \"bluffy migrate %s\" first", dbPath, dbPath)
 	}
+	if err := db.checkSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ReadOnly reports whether the database was opened with OpenReadOnlyDB
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
+// OpenDB opens a database as-is, without applying pending migrations
+func OpenDB(dbPath string) (*DB, error) {
+	db := &DB{path: dbPath}
+	conn, err := openConn(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.conn = conn
 
 	return db, nil
 }
 
+// GetAllSimilarities returns every similarity row, most similar first with
+// ties broken by ID
 func (db *DB) GetAllSimilarities() ([]ChunkSimilarity, error) {
-	query := `SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities ORDER BY similarity DESC`
+	query := `SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities ORDER BY similarity DESC, id`
 	rows, err := db.conn.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query similarities: %w", err)
@@ -43,4 +119,437 @@ func (db *DB) GetAllSimilarities() ([]ChunkSimilarity, error) {
 	}
 
 	return similarities, nil
-}
\ No newline at end of file
+}
+
+// EachSimilarity calls fn for every similarity row at or above
+// minSimilarity, most similar first, without loading them all into memory.
+// Iteration stops at the first error fn returns.
+func (db *DB) EachSimilarity(minSimilarity float64, fn func(ChunkSimilarity) error) error {
+	rows, err := db.conn.Query(`SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities
+		WHERE similarity >= ? ORDER BY similarity DESC, id`, minSimilarity)
+	if err != nil {
+		return fmt.Errorf("failed to query similarities: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sim ChunkSimilarity
+		if err := rows.Scan(&sim.ID, &sim.ChunkID1, &sim.ChunkID2, &sim.Distance, &sim.Similarity); err != nil {
+			return fmt.Errorf("failed to scan similarity row: %w", err)
+		}
+		if err := fn(sim); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating similarity rows: %w", err)
+	}
+	return nil
+}
+
+// GetChunkSimilarities returns the similarity rows linking a chunk to other
+// chunks at or above minSimilarity, most similar first. A limit of 0 or
+// less returns every row.
+func (db *DB) GetChunkSimilarities(chunkID int, minSimilarity float64, limit int) ([]ChunkSimilarity, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	query := `SELECT id, chunk_id_1, chunk_id_2, distance, similarity FROM chunk_similarities
+		WHERE (chunk_id_1 = ? OR chunk_id_2 = ?) AND similarity >= ?
+		ORDER BY similarity DESC, id LIMIT ?`
+	rows, err := db.conn.Query(query, chunkID, chunkID, minSimilarity, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similarities of chunk %d: %w", chunkID, err)
+	}
+	defer rows.Close()
+
+	var similarities []ChunkSimilarity
+	for rows.Next() {
+		var sim ChunkSimilarity
+		if err := rows.Scan(&sim.ID, &sim.ChunkID1, &sim.ChunkID2, &sim.Distance, &sim.Similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan similarity row: %w", err)
+		}
+		similarities = append(similarities, sim)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating similarity rows: %w", err)
+	}
+
+	return similarities, nil
+}
+
+// GetEdges returns stored typed edges. If types is empty, edges of every type
+// are returned.
+func (db *DB) GetEdges(types ...string) ([]ChunkEdge, error) {
+	query := `SELECT id, source_chunk_id, target_chunk_id, edge_type, weight, label FROM chunk_edges`
+	args := make([]interface{}, len(types))
+	if len(types) > 0 {
+		query += ` WHERE edge_type IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+		for i, t := range types {
+			args[i] = t
+		}
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query edges: %w", err)
+	}
+	defer rows.Close()
+
+	var edges []ChunkEdge
+	for rows.Next() {
+		var edge ChunkEdge
+		if err := rows.Scan(&edge.ID, &edge.SourceID, &edge.TargetID, &edge.Type, &edge.Weight, &edge.Label); err != nil {
+			return nil, fmt.Errorf("failed to scan edge row: %w", err)
+		}
+		edges = append(edges, edge)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating edge rows: %w", err)
+	}
+
+	return edges, nil
+}
+
+// GetAllCitations returns every stored chunk citation with the run of its
+// chunk
+func (db *DB) GetAllCitations() ([]ChunkCitation, error) {
+	rows, err := db.conn.Query(`SELECT cc.chunk_id, cc.citation_key, cc.kind, COALESCE(tc.run_id, 0)
+		FROM chunk_citations cc
+		JOIN text_chunks tc ON tc.id = cc.chunk_id
+		ORDER BY cc.citation_key, cc.chunk_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query citations: %w", err)
+	}
+	defer rows.Close()
+
+	var citations []ChunkCitation
+	for rows.Next() {
+		var citation ChunkCitation
+		if err := rows.Scan(&citation.ChunkID, &citation.Key, &citation.Kind, &citation.RunID); err != nil {
+			return nil, fmt.Errorf("failed to scan citation row: %w", err)
+		}
+		citations = append(citations, citation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating citation rows: %w", err)
+	}
+
+	return citations, nil
+}
+
+// GetAllEntities returns every entity mention, ordered by chunk and then
+// by type and name
+func (db *DB) GetAllEntities() ([]ChunkEntity, error) {
+	rows, err := db.conn.Query(`SELECT ce.chunk_id, e.name, e.type
+		FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id
+		ORDER BY ce.chunk_id, e.type, e.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entities: %w", err)
+	}
+	defer rows.Close()
+
+	var entities []ChunkEntity
+	for rows.Next() {
+		var entity ChunkEntity
+		if err := rows.Scan(&entity.ChunkID, &entity.Name, &entity.Type); err != nil {
+			return nil, fmt.Errorf("failed to scan entity row: %w", err)
+		}
+		entities = append(entities, entity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating entity rows: %w", err)
+	}
+
+	return entities, nil
+}
+
+// GetAllTags returns every chunk tag, ordered by chunk and tag
+func (db *DB) GetAllTags() ([]ChunkTag, error) {
+	return db.queryTags(`SELECT chunk_id, tag FROM chunk_tags ORDER BY chunk_id, tag`)
+}
+
+// GetChunkTags returns the tags of one chunk in alphabetical order
+func (db *DB) GetChunkTags(chunkID int) ([]string, error) {
+	tags, err := db.queryTags(`SELECT chunk_id, tag FROM chunk_tags WHERE chunk_id = ? ORDER BY tag`, chunkID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Tag
+	}
+	return names, nil
+}
+
+func (db *DB) queryTags(query string, args ...interface{}) ([]ChunkTag, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []ChunkTag
+	for rows.Next() {
+		var tag ChunkTag
+		if err := rows.Scan(&tag.ChunkID, &tag.Tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag row: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tag rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// GetRuns returns all processing runs, oldest first
+func (db *DB) GetRuns() ([]Run, error) {
+	rows, err := db.conn.Query(`SELECT id, name, source, created_at, embedding_model, embedding_provider, embedding_dimensions, normalized, metadata FROM runs ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var run Run
+		var metadata string
+		if err := rows.Scan(&run.ID, &run.Name, &run.Source, &run.CreatedAt, &run.EmbeddingModel, &run.EmbeddingProvider, &run.EmbeddingDimensions, &run.Normalized, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to scan run row: %w", err)
+		}
+		if err := run.decodeMetadata(metadata); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating run rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetFailedChunks returns the chunks that could not be processed, by run
+// and position
+func (db *DB) GetFailedChunks() ([]FailedChunk, error) {
+	rows, err := db.conn.Query(`SELECT id, run_id, chunk_index, chunk, error, attempts, created_at FROM failed_chunks ORDER BY run_id, chunk_index`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []FailedChunk
+	for rows.Next() {
+		var failure FailedChunk
+		var chunkJSON string
+		if err := rows.Scan(&failure.ID, &failure.RunID, &failure.ChunkIndex, &chunkJSON, &failure.Error, &failure.Attempts, &failure.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan failed chunk row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(chunkJSON), &failure.Chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal failed chunk %d: %w", failure.ChunkIndex, err)
+		}
+		failures = append(failures, failure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating failed chunk rows: %w", err)
+	}
+
+	return failures, nil
+}
+
+// GetChunk returns a single chunk by ID
+func (db *DB) GetChunk(id int) (*TextChunk, error) {
+	chunks, err := db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("chunk %d: %w", id, ErrChunkNotFound)
+	}
+	return &chunks[0], nil
+}
+
+// GetAdjacentChunks returns up to before chunks preceding chunk and up to
+// after chunks following it in its document, both in document order.
+// Chunks are ordered by index within their run; passages by position
+// within their chunk.
+func (db *DB) GetAdjacentChunks(chunk TextChunk, before, after int) ([]TextChunk, []TextChunk, error) {
+	var preceding, following []TextChunk
+	var err error
+	if chunk.ParentID != 0 {
+		preceding, err = db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE parent_chunk_id = ? AND id < ? ORDER BY id DESC LIMIT ?`, chunk.ParentID, chunk.ID, before)
+		if err == nil {
+			following, err = db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE parent_chunk_id = ? AND id > ? ORDER BY id LIMIT ?`, chunk.ParentID, chunk.ID, after)
+		}
+	} else {
+		preceding, err = db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE run_id = ? AND parent_chunk_id IS NULL AND (chunk_index, id) < (?, ?) ORDER BY chunk_index DESC, id DESC LIMIT ?`, chunk.RunID, chunk.ChunkIndex, chunk.ID, before)
+		if err == nil {
+			following, err = db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE run_id = ? AND parent_chunk_id IS NULL AND (chunk_index, id) > (?, ?) ORDER BY chunk_index, id LIMIT ?`, chunk.RunID, chunk.ChunkIndex, chunk.ID, after)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, j := 0, len(preceding)-1; i < j; i, j = i+1, j-1 {
+		preceding[i], preceding[j] = preceding[j], preceding[i]
+	}
+	return preceding, following, nil
+}
+
+// GetChunksByID returns the chunks with the given IDs in the order the IDs
+// are listed. IDs that don't exist are skipped.
+func (db *DB) GetChunksByID(ids []int) ([]TextChunk, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	chunks, err := db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+	ordered := make([]TextChunk, 0, len(chunks))
+	for _, id := range ids {
+		if chunk, ok := byID[id]; ok {
+			ordered = append(ordered, chunk)
+		}
+	}
+	return ordered, nil
+}
+
+// GetRunByName looks up a run by its name
+func (db *DB) GetRunByName(name string) (*Run, error) {
+	var run Run
+	var metadata string
+	err := db.conn.QueryRow(`SELECT id, name, source, created_at, embedding_model, embedding_provider, embedding_dimensions, normalized, metadata FROM runs WHERE name = ?`, name).Scan(&run.ID, &run.Name, &run.Source, &run.CreatedAt, &run.EmbeddingModel, &run.EmbeddingProvider, &run.EmbeddingDimensions, &run.Normalized, &metadata)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("run %q: %w", name, ErrRunNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query run %q: %w", name, err)
+	}
+	if err := run.decodeMetadata(metadata); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ChunksEmbeddedWith returns the IDs of the chunks and passages whose
+// embedding was computed by model, either by "bluffy embed" or by the
+// run that stored them
+func (db *DB) ChunksEmbeddedWith(model string) (map[int]bool, error) {
+	rows, err := db.conn.Query(`SELECT c.id FROM text_chunks c LEFT JOIN runs r ON r.id = c.run_id
+		WHERE c.embedding_model = ? OR (c.embedding_model = '' AND r.embedding_model = ?)`, model, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding models: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk ID: %w", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chunk IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// EmbeddingModels returns the distinct models that embedded the stored
+// chunks and passages, sorted. Chunks of runs that didn't record their model
+// are reported as "".
+func (db *DB) EmbeddingModels() ([]string, error) {
+	rows, err := db.conn.Query(`SELECT DISTINCT ` + chunkEmbeddingModel + ` AS model FROM text_chunks ORDER BY model`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding models: %w", err)
+	}
+	defer rows.Close()
+
+	var models []string
+	for rows.Next() {
+		var model string
+		if err := rows.Scan(&model); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding model: %w", err)
+		}
+		models = append(models, model)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating embedding models: %w", err)
+	}
+	return models, nil
+}
+
+// RunNormalized reports whether a run stores unit-length embeddings
+func (db *DB) RunNormalized(runID int) (bool, error) {
+	var normalized bool
+	err := db.conn.QueryRow(`SELECT normalized FROM runs WHERE id = ?`, runID).Scan(&normalized)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("run %d: %w", runID, ErrRunNotFound)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query run %d: %w", runID, err)
+	}
+	return normalized, nil
+}
+
+// decodeMetadata reads the metadata column of a run, which is empty when
+// the document had no frontmatter
+func (run *Run) decodeMetadata(metadata string) error {
+	if metadata == "" {
+		return nil
+	}
+	run.Metadata = &DocumentMetadata{}
+	if err := json.Unmarshal([]byte(metadata), run.Metadata); err != nil {
+		return fmt.Errorf("failed to decode metadata of run %q: %w", run.Name, err)
+	}
+	return nil
+}
+
+// GetAllKeywords returns every stored chunk keyword, highest scoring first
+// within each chunk
+func (db *DB) GetAllKeywords() ([]ChunkKeyword, error) {
+	rows, err := db.conn.Query(`SELECT chunk_id, keyword, score FROM chunk_keywords ORDER BY chunk_id, score DESC, keyword`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keywords: %w", err)
+	}
+	defer rows.Close()
+
+	var keywords []ChunkKeyword
+	for rows.Next() {
+		var keyword ChunkKeyword
+		if err := rows.Scan(&keyword.ChunkID, &keyword.Keyword, &keyword.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan keyword row: %w", err)
+		}
+		keywords = append(keywords, keyword)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating keyword rows: %w", err)
+	}
+
+	return keywords, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// settingSimilarityMetric is the database_settings key of the metric the
+// stored similarities were scored with
+const settingSimilarityMetric = "similarity_metric"
+
+// SimilarityMetric returns the metric the stored similarities were scored
+// with, as recorded by ReplaceSimilarities or SetSimilarityMetric; empty
+// for cosine, the default
+func (db *DB) SimilarityMetric() (string, error) {
+	var metric string
+	err := db.conn.QueryRow(`SELECT value FROM database_settings WHERE key = ?`, settingSimilarityMetric).Scan(&metric)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read similarity metric: %w", err)
+	}
+	return metric, nil
+}
+
+// SetSimilarityMetric records the metric the stored similarities are
+// scored with
+func (db *DB) SetSimilarityMetric(metric string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setSetting(tx, settingSimilarityMetric, metric); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// setSetting stores a database-wide setting, removing it when value is
+// empty
+func setSetting(tx *sql.Tx, key, value string) error {
+	var err error
+	if value == "" {
+		_, err = tx.Exec(`DELETE FROM database_settings WHERE key = ?`, key)
+	} else {
+		_, err = tx.Exec(`INSERT INTO database_settings (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`, key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store setting %s: %w", key, err)
+	}
+	return nil
+}
@@ -14,8 +14,45 @@ import (
 type DB struct {
 	conn *sql.DB
 	path string
+	// readOnly is set by OpenReadOnlyDB
+	readOnly bool
+	// queries is set when the database was opened with a query logger
+	queries *queryLog
 }
 
+// busyTimeoutMillis is how long a connection waits for another
+// connection's write lock before failing with "database is locked"
+const busyTimeoutMillis = 5000
+
+// dsn returns the connection string for a database file. Foreign keys are
+// enforced on every connection so deleting a chunk cascades to the rows
+// that reference it.
+//
+// The write-ahead log lets the API server read while process, merge or
+// another server writes to the same file. Writers wait for each other for
+// up to busyTimeoutMillis, and transactions take the write lock when they
+// begin rather than on their first write, since a read lock cannot be
+// upgraded while another connection is writing. Encrypted databases enable
+// the log once they are unlocked.
+//
+// Read-only databases are opened as a URI with mode=ro, which SQLite
+// enforces for every statement. They leave the journal mode as it is and
+// don't take the write lock when a transaction begins.
+func dsn(db *DB) string {
+	if db.readOnly {
+		return fmt.Sprintf("file:%s?mode=ro&_foreign_keys=on&_busy_timeout=%d", uriPathEscaper.Replace(db.path), busyTimeoutMillis)
+	}
+	journal := "&_journal_mode=WAL"
+	if Encrypted() {
+		journal = ""
+	}
+	return fmt.Sprintf("%s?_foreign_keys=on%s&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate", db.path, journal, busyTimeoutMillis)
+}
+
+// uriPathEscaper escapes the characters of a file path that SQLite reads
+// as part of a URI rather than of the path
+var uriPathEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
 func NewDB(inputFile, outputDir string) (*DB, error) {
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
@@ -24,18 +61,30 @@ func NewDB(inputFile, outputDir string) (*DB, error) {
 	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
 	dbPath := filepath.Join(outputDir, fmt.Sprintf("%s_embeddings.db", baseName))
 
-	conn, err := sql.Open("sqlite3", dbPath)
+	db := &DB{path: dbPath}
+	conn, err := openConn(db)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.conn = conn
 
-	db := &DB{
-		conn: conn,
-		path: dbPath,
+	if _, err := db.Migrate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to setup database tables: %w", err)
 	}
 
-	if err := db.setupTables(); err != nil {
-		conn.Close()
+	return db, nil
+}
+
+// CreateDB creates a database at dbPath with the latest schema
+func CreateDB(dbPath string) (*DB, error) {
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to setup database tables: %w", err)
 	}
 
@@ -43,6 +92,9 @@ func NewDB(inputFile, outputDir string) (*DB, error) {
 }
 
 func (db *DB) Close() error {
+	if db.queries != nil {
+		db.queries.summarize()
+	}
 	return db.conn.Close()
 }
 
@@ -50,59 +102,129 @@ func (db *DB) Path() string {
 	return db.path
 }
 
-func (db *DB) setupTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS text_chunks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			text TEXT NOT NULL,
-			chunk_index INTEGER NOT NULL,
-			embedding TEXT NOT NULL,
-			summary TEXT DEFAULT '',
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS chunk_similarities (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			chunk_id_1 INTEGER NOT NULL,
-			chunk_id_2 INTEGER NOT NULL,
-			distance REAL NOT NULL,
-			similarity REAL NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (chunk_id_1) REFERENCES text_chunks (id),
-			FOREIGN KEY (chunk_id_2) REFERENCES text_chunks (id),
-			UNIQUE(chunk_id_1, chunk_id_2)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_similarities_chunk1 ON chunk_similarities(chunk_id_1)`,
-		`CREATE INDEX IF NOT EXISTS idx_similarities_chunk2 ON chunk_similarities(chunk_id_2)`,
-		`CREATE INDEX IF NOT EXISTS idx_similarities_distance ON chunk_similarities(distance)`,
+func (db *DB) InsertChunk(chunk *TextChunk) error {
+	embeddingJSON, err := json.Marshal(chunk.Embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
 	}
 
-	for _, query := range queries {
-		if _, err := db.conn.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %s, error: %w", query, err)
-		}
+	var runID, parentID interface{}
+	if chunk.RunID != 0 {
+		runID = chunk.RunID
+	}
+	if chunk.ParentID != 0 {
+		parentID = chunk.ParentID
+	}
+
+	chunk.StableID = StableID(chunk.Text)
+
+	query := `INSERT INTO text_chunks (text, chunk_index, embedding, summary, summary_sentence, summary_paragraph, summary_bullets, section, run_id, stable_id, language, parent_chunk_id, redacted, speaker, start_seconds, end_seconds, token_count, sentiment, title, kind, summary_language, embedding_model) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err = db.conn.QueryRow(query, chunk.Text, chunk.ChunkIndex, string(embeddingJSON), chunk.Summary, chunk.SummarySentence, chunk.SummaryParagraph, chunk.SummaryBullets, chunk.Section, runID, chunk.StableID, chunk.Language, parentID, chunk.Redacted, chunk.Speaker, chunk.StartSeconds, chunk.EndSeconds, chunk.TokenCount, chunk.Sentiment, chunk.Title, chunk.Kind, chunk.SummaryLanguage, chunk.EmbeddingModel).Scan(&chunk.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert chunk: %w", err)
 	}
+	chunk.Version = 1
 
 	return nil
 }
 
-func (db *DB) InsertChunk(chunk *TextChunk) error {
+// UpdateChunk replaces a chunk's text, embedding, embedding model and
+// summary and swaps its similarity rows for the given ones in a single
+// transaction. The update only applies if the stored version still equals
+// chunk.Version, otherwise it fails with ErrVersionConflict; on success
+// chunk.Version is incremented.
+// The chunk's passages are removed, as they no longer match its text.
+func (db *DB) UpdateChunk(chunk *TextChunk, similarities []ChunkSimilarity) error {
 	embeddingJSON, err := json.Marshal(chunk.Embedding)
 	if err != nil {
 		return fmt.Errorf("failed to marshal embedding: %w", err)
 	}
 
-	query := `INSERT INTO text_chunks (text, chunk_index, embedding, summary) VALUES (?, ?, ?, ?) RETURNING id`
-	err = db.conn.QueryRow(query, chunk.Text, chunk.ChunkIndex, string(embeddingJSON), chunk.Summary).Scan(&chunk.ID)
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to insert chunk: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	chunk.StableID = StableID(chunk.Text)
+
+	result, err := tx.Exec(`UPDATE text_chunks SET text = ?, embedding = ?, summary = ?, summary_sentence = ?, summary_paragraph = ?, summary_bullets = ?, stable_id = ?, language = ?, token_count = ?, sentiment = ?, title = ?, summary_language = ?, embedding_model = ?, version = version + 1 WHERE id = ? AND version = ?`,
+		chunk.Text, string(embeddingJSON), chunk.Summary, chunk.SummarySentence, chunk.SummaryParagraph, chunk.SummaryBullets, chunk.StableID, chunk.Language, chunk.TokenCount, chunk.Sentiment, chunk.Title, chunk.SummaryLanguage, chunk.EmbeddingModel, chunk.ID, chunk.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk %d: %w", chunk.ID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM text_chunks WHERE id = ?)`, chunk.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check chunk %d: %w", chunk.ID, err)
+		}
+		if exists {
+			return fmt.Errorf("chunk %d version %d: %w", chunk.ID, chunk.Version, ErrVersionConflict)
+		}
+		return fmt.Errorf("chunk %d: %w", chunk.ID, ErrChunkNotFound)
 	}
 
+	if _, err := tx.Exec(`DELETE FROM chunk_similarities WHERE chunk_id_1 = ? OR chunk_id_2 = ?`, chunk.ID, chunk.ID); err != nil {
+		return fmt.Errorf("failed to clear similarities for chunk %d: %w", chunk.ID, err)
+	}
+	// Passages were split from the old text
+	if _, err := tx.Exec(`DELETE FROM text_chunks WHERE parent_chunk_id = ?`, chunk.ID); err != nil {
+		return fmt.Errorf("failed to remove passages of chunk %d: %w", chunk.ID, err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO chunk_similarities (chunk_id_1, chunk_id_2, distance, similarity) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, similarity := range similarities {
+		if _, err := stmt.Exec(similarity.ChunkID1, similarity.ChunkID2, similarity.Distance, similarity.Similarity); err != nil {
+			return fmt.Errorf("failed to insert similarity %d-%d: %w", similarity.ChunkID1, similarity.ChunkID2, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	chunk.Version++
+
 	return nil
 }
 
+// chunkColumns is the column list scanned by queryChunks. A chunk's
+// embedding model falls back to its run's.
+const chunkColumns = `id, text, chunk_index, embedding, summary, summary_sentence, summary_paragraph, summary_bullets, section, COALESCE(run_id, 0), stable_id, is_outlier, language, version, COALESCE(parent_chunk_id, 0), redacted, speaker, start_seconds, end_seconds, token_count, sentiment, title, kind, summary_language, ` + chunkEmbeddingModel
+
+// chunkEmbeddingModel selects the model that embedded a row of text_chunks
+const chunkEmbeddingModel = `COALESCE(NULLIF(text_chunks.embedding_model, ''), (SELECT r.embedding_model FROM runs r WHERE r.id = text_chunks.run_id), '')`
+
+// GetAllChunks returns every chunk ordered by run, then chunk index, then
+// ID, so the order is stable across calls and after deletions. Passages are
+// not included; see GetPassages.
 func (db *DB) GetAllChunks() ([]TextChunk, error) {
-	query := `SELECT id, text, chunk_index, embedding, summary FROM text_chunks ORDER BY chunk_index`
-	rows, err := db.conn.Query(query)
+	return db.queryChunks(`SELECT ` + chunkColumns + ` FROM text_chunks WHERE parent_chunk_id IS NULL ORDER BY COALESCE(run_id, 0), chunk_index, id`)
+}
+
+// GetChunksByRun returns the chunks stored by one processing run, without
+// their passages
+func (db *DB) GetChunksByRun(runID int) ([]TextChunk, error) {
+	return db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE run_id = ? AND parent_chunk_id IS NULL ORDER BY chunk_index, id`, runID)
+}
+
+// GetPassages returns every passage, grouped by parent chunk in the order
+// they were split
+func (db *DB) GetPassages() ([]TextChunk, error) {
+	return db.queryChunks(`SELECT ` + chunkColumns + ` FROM text_chunks WHERE parent_chunk_id IS NOT NULL ORDER BY parent_chunk_id, id`)
+}
+
+// GetPassagesByRun returns the passages of one processing run's chunks
+func (db *DB) GetPassagesByRun(runID int) ([]TextChunk, error) {
+	return db.queryChunks(`SELECT `+chunkColumns+` FROM text_chunks WHERE run_id = ? AND parent_chunk_id IS NOT NULL ORDER BY parent_chunk_id, id`, runID)
+}
+
+func (db *DB) queryChunks(query string, args ...interface{}) ([]TextChunk, error) {
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query chunks: %w", err)
 	}
@@ -113,7 +235,7 @@ func (db *DB) GetAllChunks() ([]TextChunk, error) {
 		var chunk TextChunk
 		var embeddingJSON string
 
-		if err := rows.Scan(&chunk.ID, &chunk.Text, &chunk.ChunkIndex, &embeddingJSON, &chunk.Summary); err != nil {
+		if err := rows.Scan(&chunk.ID, &chunk.Text, &chunk.ChunkIndex, &embeddingJSON, &chunk.Summary, &chunk.SummarySentence, &chunk.SummaryParagraph, &chunk.SummaryBullets, &chunk.Section, &chunk.RunID, &chunk.StableID, &chunk.IsOutlier, &chunk.Language, &chunk.Version, &chunk.ParentID, &chunk.Redacted, &chunk.Speaker, &chunk.StartSeconds, &chunk.EndSeconds, &chunk.TokenCount, &chunk.Sentiment, &chunk.Title, &chunk.Kind, &chunk.SummaryLanguage, &chunk.EmbeddingModel); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -140,6 +262,8 @@ func (db *DB) InsertSimilarity(similarity *ChunkSimilarity) error {
 	return nil
 }
 
+// BatchInsertSimilarities stores similarity rows, ignoring pairs that are
+// already stored so a resumed run can recompute its similarities
 func (db *DB) BatchInsertSimilarities(similarities []ChunkSimilarity) error {
 	tx, err := db.conn.Begin()
 	if err != nil {
@@ -147,7 +271,7 @@ func (db *DB) BatchInsertSimilarities(similarities []ChunkSimilarity) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO chunk_similarities (chunk_id_1, chunk_id_2, distance, similarity) VALUES (?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO chunk_similarities (chunk_id_1, chunk_id_2, distance, similarity) VALUES (?, ?, ?, ?)`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
@@ -164,4 +288,389 @@ func (db *DB) BatchInsertSimilarities(similarities []ChunkSimilarity) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// BatchInsertEdges stores typed edges, ignoring edges that already exist
+func (db *DB) BatchInsertEdges(edges []ChunkEdge) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO chunk_edges (source_chunk_id, target_chunk_id, edge_type, weight, label) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, edge := range edges {
+		if _, err := stmt.Exec(edge.SourceID, edge.TargetID, edge.Type, edge.Weight, edge.Label); err != nil {
+			return fmt.Errorf("failed to insert %s edge %d-%d: %w", edge.Type, edge.SourceID, edge.TargetID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// BatchInsertCitations stores the citations found in chunks
+func (db *DB) BatchInsertCitations(citations []ChunkCitation) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO chunk_citations (chunk_id, citation_key, kind) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, citation := range citations {
+		if _, err := stmt.Exec(citation.ChunkID, citation.Key, citation.Kind); err != nil {
+			return fmt.Errorf("failed to insert citation %s for chunk %d: %w", citation.Key, citation.ChunkID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CreateRun records the start of a processing run
+func (db *DB) CreateRun(name, source string) (*Run, error) {
+	run := &Run{Name: name, Source: source}
+	err := db.conn.QueryRow(`INSERT INTO runs (name, source) VALUES (?, ?) RETURNING id, created_at`, name, source).Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run %q: %w", name, err)
+	}
+	return run, nil
+}
+
+// SetRunEmbeddingModel records the embedding model a run's chunks were
+// embedded with
+func (db *DB) SetRunEmbeddingModel(runID int, model string) error {
+	if _, err := db.conn.Exec(`UPDATE runs SET embedding_model = ? WHERE id = ?`, model, runID); err != nil {
+		return fmt.Errorf("failed to set embedding model for run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// SetRunEmbeddingInfo records the provider that embedded a run's chunks and
+// the length of its vectors
+func (db *DB) SetRunEmbeddingInfo(runID int, provider string, dimensions int) error {
+	if _, err := db.conn.Exec(`UPDATE runs SET embedding_provider = ?, embedding_dimensions = ? WHERE id = ?`, provider, dimensions, runID); err != nil {
+		return fmt.Errorf("failed to set embedding provider for run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// SetRunNormalized records that a run's embeddings were scaled to unit
+// length before they were stored
+func (db *DB) SetRunNormalized(runID int, normalized bool) error {
+	if _, err := db.conn.Exec(`UPDATE runs SET normalized = ? WHERE id = ?`, normalized, runID); err != nil {
+		return fmt.Errorf("failed to set normalized for run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// SetRunMetadata records the frontmatter of the document a run was
+// processed from
+func (db *DB) SetRunMetadata(runID int, metadata DocumentMetadata) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if _, err := db.conn.Exec(`UPDATE runs SET metadata = ? WHERE id = ?`, string(encoded), runID); err != nil {
+		return fmt.Errorf("failed to set metadata for run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// ReplaceKeywords stores keywords for the given chunks, replacing any
+// keywords previously stored for them
+func (db *DB) ReplaceKeywords(chunkIDs []int, keywords []ChunkKeyword) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range chunkIDs {
+		if _, err := tx.Exec(`DELETE FROM chunk_keywords WHERE chunk_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to clear keywords for chunk %d: %w", id, err)
+		}
+	}
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO chunk_keywords (chunk_id, keyword, score) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, keyword := range keywords {
+		if _, err := stmt.Exec(keyword.ChunkID, keyword.Keyword, keyword.Score); err != nil {
+			return fmt.Errorf("failed to insert keyword %q for chunk %d: %w", keyword.Keyword, keyword.ChunkID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceEntities stores entities for the given chunks, replacing any
+// entities previously linked to them. Entities no chunk mentions any more
+// are removed.
+func (db *DB) ReplaceEntities(chunkIDs []int, entities []ChunkEntity) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range chunkIDs {
+		if _, err := tx.Exec(`DELETE FROM chunk_entities WHERE chunk_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to clear entities for chunk %d: %w", id, err)
+		}
+	}
+
+	for _, entity := range entities {
+		var entityID int
+		err := tx.QueryRow(`INSERT INTO entities (name, type) VALUES (?, ?)
+			ON CONFLICT(name, type) DO UPDATE SET name = excluded.name
+			RETURNING id`, entity.Name, entity.Type).Scan(&entityID)
+		if err != nil {
+			return fmt.Errorf("failed to insert entity %q: %w", entity.Name, err)
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, entity.ChunkID, entityID); err != nil {
+			return fmt.Errorf("failed to link entity %q to chunk %d: %w", entity.Name, entity.ChunkID, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM entities WHERE id NOT IN (SELECT entity_id FROM chunk_entities)`); err != nil {
+		return fmt.Errorf("failed to remove unused entities: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AddChunkTags attaches tags to chunks; tags a chunk already has are
+// left alone
+func (db *DB) AddChunkTags(tags []ChunkTag) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO chunk_tags (chunk_id, tag) VALUES (?, ?)`, tag.ChunkID, tag.Tag); err != nil {
+			return fmt.Errorf("failed to tag chunk %d with %q: %w", tag.ChunkID, tag.Tag, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveChunkTags detaches tags from a chunk
+func (db *DB) RemoveChunkTags(chunkID int, tags []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, tag := range tags {
+		if _, err := tx.Exec(`DELETE FROM chunk_tags WHERE chunk_id = ? AND tag = ?`, chunkID, tag); err != nil {
+			return fmt.Errorf("failed to remove tag %q from chunk %d: %w", tag, chunkID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordFailedChunk stores a chunk that could not be processed. A chunk that
+// failed before keeps one row, with the latest error and its attempts
+// counted.
+func (db *DB) RecordFailedChunk(runID int, chunk TextChunk, cause error) error {
+	chunk.Embedding = nil
+	chunkJSON, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk: %w", err)
+	}
+
+	_, err = db.conn.Exec(`INSERT INTO failed_chunks (run_id, chunk_index, chunk, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT(run_id, chunk_index) DO UPDATE SET chunk = excluded.chunk, error = excluded.error, attempts = attempts + 1`,
+		runID, chunk.ChunkIndex, string(chunkJSON), cause.Error())
+	if err != nil {
+		return fmt.Errorf("failed to record failed chunk %d: %w", chunk.ChunkIndex, err)
+	}
+	return nil
+}
+
+// ClearFailedChunks removes the failures of a run whose chunks have since
+// been stored, and returns how many were removed
+func (db *DB) ClearFailedChunks(runID int) (int, error) {
+	result, err := db.conn.Exec(`DELETE FROM failed_chunks WHERE run_id = ? AND chunk_index IN
+		(SELECT chunk_index FROM text_chunks WHERE run_id = ? AND parent_chunk_id IS NULL)`, runID, runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear failed chunks of run %d: %w", runID, err)
+	}
+	cleared, err := result.RowsAffected()
+	return int(cleared), err
+}
+
+// GetOrCreateRun returns the run with the given name, creating it if needed
+func (db *DB) GetOrCreateRun(name, source string) (*Run, error) {
+	run, err := db.GetRunByName(name)
+	if err == nil {
+		return run, nil
+	}
+	return db.CreateRun(name, source)
+}
+
+// NextChunkIndex returns the chunk index that follows the last chunk of a run
+func (db *DB) NextChunkIndex(runID int) (int, error) {
+	var next int
+	if err := db.conn.QueryRow(`SELECT COALESCE(MAX(chunk_index) + 1, 0) FROM text_chunks WHERE run_id = ?`, runID).Scan(&next); err != nil {
+		return 0, fmt.Errorf("failed to get next chunk index: %w", err)
+	}
+	return next, nil
+}
+
+// SetSentiments stores the sentiment scores of chunks, keyed by chunk ID
+func (db *DB) SetSentiments(scores map[int]float64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for id, score := range scores {
+		if _, err := tx.Exec(`UPDATE text_chunks SET sentiment = ? WHERE id = ?`, score, id); err != nil {
+			return fmt.Errorf("failed to store sentiment of chunk %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetTitles stores the titles of chunks, keyed by chunk ID
+func (db *DB) SetTitles(titles map[int]string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for id, title := range titles {
+		if _, err := tx.Exec(`UPDATE text_chunks SET title = ? WHERE id = ?`, title, id); err != nil {
+			return fmt.Errorf("failed to store title of chunk %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetSummaries stores the summaries of chunks: the topic, the longer
+// styles and the language they were written in
+func (db *DB) SetSummaries(chunks []TextChunk) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, chunk := range chunks {
+		_, err := tx.Exec(`UPDATE text_chunks SET summary = ?, summary_sentence = ?, summary_paragraph = ?, summary_bullets = ?, summary_language = ? WHERE id = ?`,
+			chunk.Summary, chunk.SummarySentence, chunk.SummaryParagraph, chunk.SummaryBullets, chunk.SummaryLanguage, chunk.ID)
+		if err != nil {
+			return fmt.Errorf("failed to store summaries of chunk %d: %w", chunk.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetEmbeddings replaces the embeddings and token counts of chunks with
+// ones computed by model, which is recorded on each chunk
+func (db *DB) SetEmbeddings(chunks []TextChunk, model string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, chunk := range chunks {
+		embeddingJSON, err := json.Marshal(chunk.Embedding)
+		if err != nil {
+			return fmt.Errorf("failed to marshal embedding: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE text_chunks SET embedding = ?, token_count = ?, embedding_model = ? WHERE id = ?`, string(embeddingJSON), chunk.TokenCount, model, chunk.ID); err != nil {
+			return fmt.Errorf("failed to store embedding of chunk %d: %w", chunk.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SetOutliers flags the given chunks as outliers and clears the flag on
+// every other chunk
+func (db *DB) SetOutliers(chunkIDs []int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE text_chunks SET is_outlier = 0 WHERE is_outlier != 0`); err != nil {
+		return fmt.Errorf("failed to clear outlier flags: %w", err)
+	}
+	for _, id := range chunkIDs {
+		if _, err := tx.Exec(`UPDATE text_chunks SET is_outlier = 1 WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to flag chunk %d as an outlier: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
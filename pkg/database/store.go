@@ -0,0 +1,34 @@
+package database
+
+// Store is what processing a document needs from a database: runs, chunks,
+// similarities and failed chunks. *DB stores them in a SQLite file and
+// *PostgresDB in a shared Postgres server.
+type Store interface {
+	// Path describes where the store keeps its data, for messages
+	Path() string
+	Close() error
+
+	CreateRun(name, source string) (*Run, error)
+	GetRunByName(name string) (*Run, error)
+	GetRuns() ([]Run, error)
+	SetRunEmbeddingModel(runID int, model string) error
+	SetRunEmbeddingInfo(runID int, provider string, dimensions int) error
+	SetRunNormalized(runID int, normalized bool) error
+	SetRunMetadata(runID int, metadata DocumentMetadata) error
+
+	InsertChunk(chunk *TextChunk) error
+	GetAllChunks() ([]TextChunk, error)
+	GetChunksByRun(runID int) ([]TextChunk, error)
+
+	BatchInsertSimilarities(similarities []ChunkSimilarity) error
+	GetAllSimilarities() ([]ChunkSimilarity, error)
+	SimilarityMetric() (string, error)
+
+	RecordFailedChunk(runID int, chunk TextChunk, cause error) error
+	ClearFailedChunks(runID int) (int, error)
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*PostgresDB)(nil)
+)
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// driverName is the database/sql driver used to open databases. It changes
+// when the sqlite-vec extension or a passphrase is configured.
+var driverName = "sqlite3"
+
+// vectorExtension is the sqlite-vec library loaded into every connection,
+// or empty
+var vectorExtension string
+
+// ChunkMatch is a chunk ID found by a vector search, with its cosine
+// similarity to the query
+type ChunkMatch struct {
+	ChunkID    int
+	Similarity float64
+}
+
+// LoadVectorExtension makes every database opened afterwards load the
+// sqlite-vec extension from path (for example ./vec0.so), enabling the
+// vector index methods. It must be called before opening any database.
+func LoadVectorExtension(path string) {
+	vectorExtension = path
+	configureDriver()
+}
+
+// VectorSearchEnabled reports whether LoadVectorExtension has been called
+func VectorSearchEnabled() bool {
+	return vectorExtension != ""
+}
+
+// SyncVectorIndex brings the vec_chunks virtual table up to date with
+// text_chunks, creating it on first use. Rows of deleted or edited chunks
+// are replaced; the stable_id auxiliary column detects edits. It returns
+// the number of chunks added to the index.
+func (db *DB) SyncVectorIndex() (int64, error) {
+	var exists int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'vec_chunks'`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to check for vector index: %w", err)
+	}
+
+	if exists == 0 {
+		var embeddingJSON string
+		err := db.conn.QueryRow(`SELECT embedding FROM text_chunks LIMIT 1`).Scan(&embeddingJSON)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read embedding dimensions: %w", err)
+		}
+		var embedding []float64
+		if err := json.Unmarshal([]byte(embeddingJSON), &embedding); err != nil {
+			return 0, fmt.Errorf("failed to unmarshal embedding: %w", err)
+		}
+
+		query := fmt.Sprintf(`CREATE VIRTUAL TABLE vec_chunks USING vec0(embedding float[%d] distance_metric=cosine, +stable_id text)`, len(embedding))
+		if _, err := db.conn.Exec(query); err != nil {
+			return 0, fmt.Errorf("failed to create vector index (is the sqlite-vec extension loaded?): %w", err)
+		}
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM vec_chunks WHERE rowid IN (
+		SELECT v.rowid FROM vec_chunks v
+		LEFT JOIN text_chunks c ON c.id = v.rowid
+		WHERE c.id IS NULL OR c.stable_id != v.stable_id
+	)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove stale vectors: %w", err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO vec_chunks (rowid, embedding, stable_id)
+		SELECT id, embedding, stable_id FROM text_chunks
+		WHERE id NOT IN (SELECT rowid FROM vec_chunks)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to index vectors: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// VectorIndexCurrent reports whether the vec_chunks table exists and
+// holds exactly the current embeddings of text_chunks, so it can be
+// searched without SyncVectorIndex, which a read-only database can't run
+func (db *DB) VectorIndexCurrent() (bool, error) {
+	var exists int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'vec_chunks'`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for vector index: %w", err)
+	}
+	if exists == 0 {
+		return false, nil
+	}
+
+	var outdated int
+	err := db.conn.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM text_chunks c LEFT JOIN vec_chunks v ON v.rowid = c.id WHERE v.rowid IS NULL OR v.stable_id != c.stable_id) +
+		(SELECT COUNT(*) FROM vec_chunks v LEFT JOIN text_chunks c ON c.id = v.rowid WHERE c.id IS NULL)`).Scan(&outdated)
+	if err != nil {
+		return false, fmt.Errorf("failed to check vector index: %w", err)
+	}
+	return outdated == 0, nil
+}
+
+// DropVectorIndex removes the vec_chunks table, e.g. after switching
+// embedding models. The next SyncVectorIndex rebuilds it.
+func (db *DB) DropVectorIndex() error {
+	if _, err := db.conn.Exec(`DROP TABLE IF EXISTS vec_chunks`); err != nil {
+		return fmt.Errorf("failed to drop vector index: %w", err)
+	}
+	return nil
+}
+
+// SearchVectorIndex returns the k chunks nearest to query, most similar
+// first, using the sqlite-vec index built by SyncVectorIndex
+func (db *DB) SearchVectorIndex(query []float64, k int) ([]ChunkMatch, error) {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query embedding: %w", err)
+	}
+
+	rows, err := db.conn.Query(`SELECT rowid, distance FROM vec_chunks WHERE embedding MATCH ? AND k = ? ORDER BY distance`, string(queryJSON), k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vector index: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []ChunkMatch
+	for rows.Next() {
+		var match ChunkMatch
+		var distance float64
+		if err := rows.Scan(&match.ChunkID, &distance); err != nil {
+			return nil, fmt.Errorf("failed to scan match row: %w", err)
+		}
+		// Cosine distance is 1 - cosine similarity
+		match.Similarity = 1 - distance
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating match rows: %w", err)
+	}
+
+	return matches, nil
+}
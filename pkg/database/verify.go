@@ -0,0 +1,187 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotBluffyDB is returned when opening a file that isn't a bluffy
+	// database, so migrating it would add bluffy's tables to someone
+	// else's data
+	ErrNotBluffyDB = errors.New("not a bluffy database")
+	// ErrIncompleteDB is returned when opening a bluffy database that lacks
+	// tables or columns of its schema, e.g. one copied while it was being
+	// written
+	ErrIncompleteDB = errors.New("incomplete bluffy database")
+)
+
+// coreTables are the tables every bluffy database has had, from before
+// schema versioning
+var coreTables = []string{"text_chunks", "chunk_similarities"}
+
+// CheckBluffy fails unless the database was written by bluffy. Run it
+// before migrating, which would otherwise turn any SQLite file into a
+// bluffy database.
+func (db *DB) CheckBluffy() error {
+	tables, err := schemaOf(db.conn)
+	if err != nil {
+		return fmt.Errorf("%s is not a readable SQLite database: %w", db.path, err)
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("%s has no tables: %w", db.path, ErrNotBluffyDB)
+	}
+
+	var missing []string
+	for _, table := range coreTables {
+		if _, ok := tables[table]; !ok {
+			missing = append(missing, table)
+		}
+	}
+	switch {
+	case len(missing) == len(coreTables):
+		return fmt.Errorf("%s has none of the %s tables, only %s: %w", db.path, strings.Join(coreTables, " and "), strings.Join(sortedKeys(tables), ", "), ErrNotBluffyDB)
+	case len(missing) > 0:
+		return fmt.Errorf("%s is missing the %s table: %w", db.path, strings.Join(missing, ", "), ErrIncompleteDB)
+	}
+	return nil
+}
+
+// checkSchema fails if the database lacks any table or column of the
+// latest schema. Migrations create them, so a migrated database missing
+// one was damaged after it was written.
+func (db *DB) checkSchema() error {
+	want, err := latestSchema()
+	if err != nil {
+		return err
+	}
+	have, err := schemaOf(db.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema of %s: %w", db.path, err)
+	}
+
+	var missingTables, missingColumns []string
+	for _, table := range sortedKeys(want) {
+		columns, ok := have[table]
+		if !ok {
+			missingTables = append(missingTables, table)
+			continue
+		}
+		for _, column := range want[table] {
+			if !columns[column] {
+				missingColumns = append(missingColumns, table+"."+column)
+			}
+		}
+	}
+	sort.Strings(missingColumns)
+
+	var problems []string
+	if len(missingTables) > 0 {
+		problems = append(problems, "tables "+strings.Join(missingTables, ", "))
+	}
+	if len(missingColumns) > 0 {
+		problems = append(problems, "columns "+strings.Join(missingColumns, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is at schema version %d but is missing %s: %w", db.path, LatestSchemaVersion(), strings.Join(problems, " and "), ErrIncompleteDB)
+	}
+	return nil
+}
+
+// CheckIntegrity runs SQLite's quick_check over the whole file and returns
+// the problems it finds, none for a sound database. It reads every page,
+// so it is meant for startup rather than every open.
+func (db *DB) CheckIntegrity() ([]string, error) {
+	rows, err := db.conn.Query(`PRAGMA quick_check`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check integrity of %s: %w", db.path, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check integrity of %s: %w", db.path, err)
+	}
+	return problems, nil
+}
+
+var (
+	latestSchemaOnce   sync.Once
+	latestSchemaTables map[string][]string
+	latestSchemaErr    error
+)
+
+// latestSchema returns the columns of every table of a new database, by
+// migrating an in-memory one the first time it is called
+func latestSchema() (map[string][]string, error) {
+	latestSchemaOnce.Do(func() {
+		conn, err := sql.Open(driverName, ":memory:")
+		if err != nil {
+			latestSchemaErr = err
+			return
+		}
+		defer conn.Close()
+		// Every connection to :memory: is a database of its own
+		conn.SetMaxOpenConns(1)
+
+		memory := &DB{conn: conn, path: ":memory:"}
+		if _, err := memory.Migrate(); err != nil {
+			latestSchemaErr = fmt.Errorf("failed to build the latest schema: %w", err)
+			return
+		}
+		tables, err := schemaOf(conn)
+		if err != nil {
+			latestSchemaErr = err
+			return
+		}
+		latestSchemaTables = make(map[string][]string, len(tables))
+		for table, columns := range tables {
+			latestSchemaTables[table] = sortedKeys(columns)
+		}
+	})
+	return latestSchemaTables, latestSchemaErr
+}
+
+// schemaOf returns the columns of each table of a database, by table name
+func schemaOf(conn *sql.DB) (map[string]map[string]bool, error) {
+	rows, err := conn.Query(`SELECT m.name, p.name FROM sqlite_master m JOIN pragma_table_info(m.name) p WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make(map[string]map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		if tables[table] == nil {
+			tables[table] = make(map[string]bool)
+		}
+		tables[table][column] = true
+	}
+	return tables, rows.Err()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
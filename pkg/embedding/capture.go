@@ -0,0 +1,128 @@
+package embedding
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCaptureMaxBytes is how much a capture directory may hold before
+// further failures are no longer saved
+const DefaultCaptureMaxBytes = 50 << 20
+
+// maxCapturedPayload is how much of a request or response body a capture
+// keeps; longer bodies are cut with a note of their full length
+const maxCapturedPayload = 1 << 20
+
+// FailureCapture saves the raw request and response of Ollama calls that
+// failed or returned malformed data, one JSON file per failure, so model
+// misbehavior can be reported and replayed. The directory is capped in
+// size; once full, failures are only reported.
+type FailureCapture struct {
+	dir      string
+	maxBytes int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+// CapturedFailure is the content of a capture file
+type CapturedFailure struct {
+	Time  time.Time `json:"time"`
+	URL   string    `json:"url"`
+	Error string    `json:"error"`
+	// Status is the HTTP status, 0 if no response arrived
+	Status int `json:"status,omitempty"`
+	// Request is the JSON sent, replayable with curl -d, or a string if
+	// it had to be cut
+	Request json.RawMessage `json:"request"`
+	// Response is the body received, which need not be valid JSON
+	Response string `json:"response"`
+}
+
+// NewFailureCapture creates dir if needed and counts the captures already
+// in it toward maxBytes
+func NewFailureCapture(dir string, maxBytes int64) (*FailureCapture, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture directory: %w", err)
+	}
+
+	capture := &FailureCapture{dir: dir, maxBytes: maxBytes}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			capture.used += info.Size()
+		}
+	}
+	return capture, nil
+}
+
+// Dir returns the directory captures are written to
+func (f *FailureCapture) Dir() string {
+	return f.dir
+}
+
+// Save writes a capture of a failed call and returns its path
+func (f *FailureCapture) Save(url string, request []byte, status int, response []byte, failure error) (string, error) {
+	captured := CapturedFailure{
+		Time:     time.Now().UTC(),
+		URL:      url,
+		Error:    failure.Error(),
+		Status:   status,
+		Request:  request,
+		Response: capPayload(response),
+	}
+	if len(request) > maxCapturedPayload || !json.Valid(request) {
+		quoted, _ := json.Marshal(capPayload(request))
+		captured.Request = quoted
+	}
+	data, err := json.MarshalIndent(captured, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode capture: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.used+int64(len(data)) > f.maxBytes {
+		return "", fmt.Errorf("capture directory %s is full (%d bytes); clear it to capture more", f.dir, f.maxBytes)
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	path := filepath.Join(f.dir, fmt.Sprintf("%s-%s.json", captured.Time.Format("20060102-150405"), hex.EncodeToString(suffix)))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write capture: %w", err)
+	}
+	f.used += int64(len(data))
+	return path, nil
+}
+
+// capPayload returns body as a string of at most maxCapturedPayload bytes
+func capPayload(body []byte) string {
+	if len(body) <= maxCapturedPayload {
+		return string(body)
+	}
+	return strings.ToValidUTF8(string(body[:maxCapturedPayload]), "") + fmt.Sprintf("... (%d bytes in total)", len(body))
+}
+
+// captured saves a failed call if failures are captured, and adds where it
+// was saved to err
+func (c *OllamaClient) captured(err error, url string, request []byte, status int, response []byte) error {
+	if c.options.Capture == nil {
+		return err
+	}
+	path, captureErr := c.options.Capture.Save(url, request, status, response, err)
+	if captureErr != nil {
+		return fmt.Errorf("%w (not captured: %v)", err, captureErr)
+	}
+	return fmt.Errorf("%w (request and response saved to %s)", err, path)
+}
@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// entityTypeAliases maps the labels models commonly use to entity types
+var entityTypeAliases = map[string]string{
+	"person":        database.EntityPerson,
+	"people":        database.EntityPerson,
+	"place":         database.EntityPlace,
+	"places":        database.EntityPlace,
+	"location":      database.EntityPlace,
+	"organization":  database.EntityOrganization,
+	"organizations": database.EntityOrganization,
+	"organisation":  database.EntityOrganization,
+	"org":           database.EntityOrganization,
+}
+
+// maxEntityWords drops lines that are sentences rather than names
+const maxEntityWords = 6
+
+// GetEntities asks the generation model for the people, places and
+// organizations named in text. The returned entities have no ChunkID.
+func (c *OllamaClient) GetEntities(text string) ([]database.ChunkEntity, error) {
+	prompt := fmt.Sprintf("List the people, places and organizations named in this text, one per line, in the form \"person: Name\", \"place: Name\" or \"organization: Name\". Only list names that appear in the text. If there are none, respond with \"none\". Do not include any reasoning or explanations:\n\n%s \n\n /no_think", text)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEntityList(response), nil
+}
+
+func parseEntityList(response string) []database.ChunkEntity {
+	cleaned := thinkTagRegex.ReplaceAllString(response, "")
+
+	seen := make(map[string]bool)
+	var entities []database.ChunkEntity
+	for _, line := range strings.Split(cleaned, "\n") {
+		line = listMarkerRegex.ReplaceAllString(strings.TrimSpace(line), "")
+		label, name, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		entityType, ok := entityTypeAliases[strings.ToLower(strings.Trim(strings.TrimSpace(label), "*"))]
+		if !ok {
+			continue
+		}
+		name = strings.Trim(strings.TrimSpace(name), ".\"'*")
+		if name == "" || strings.EqualFold(name, "none") || len(strings.Fields(name)) > maxEntityWords {
+			continue
+		}
+
+		key := entityType + "\x00" + strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entities = append(entities, database.ChunkEntity{Name: name, Type: entityType})
+	}
+	return entities
+}
+
+// GetEntitiesConcurrent extracts entities for each text, returning them in
+// the same order as texts
+func (c *OllamaClient) GetEntitiesConcurrent(texts []string, maxWorkers int, progressCallback func(completed, total int)) ([][]database.ChunkEntity, error) {
+	entities := make([][]database.ChunkEntity, len(texts))
+	errs := runConcurrent(len(texts), maxWorkers, func(i int) error {
+		result, err := c.GetEntities(texts[i])
+		entities[i] = result
+		return err
+	}, progressCallback)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("entity extraction errors occurred: %v", errs)
+	}
+	return entities, nil
+}
@@ -0,0 +1,23 @@
+package embedding
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExplainSimilarity asks the generation model for one sentence on why two
+// passages an embedding model found similar are related
+func (c *OllamaClient) ExplainSimilarity(a, b string) (string, error) {
+	prompt := fmt.Sprintf("An embedding model found these two passages similar. In one sentence, explain what they have in common and why they are related. Do not include any reasoning or preamble.%s Just respond with the sentence:\n\nPassage 1:\n%s\n\nPassage 2:\n%s \n\n /no_think", c.languageInstruction(), a, b)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	explanation := cleanSummaryResponse(response)
+	if line, _, ok := strings.Cut(explanation, "\n"); ok {
+		explanation = line
+	}
+	return strings.Trim(explanation, " \t*\"“”"), nil
+}
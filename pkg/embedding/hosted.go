@@ -0,0 +1,348 @@
+package embedding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Embedding providers. ProviderOllama is the local default; the others are
+// hosted APIs that need an API key.
+const (
+	ProviderOllama = "ollama"
+	ProviderCohere = "cohere"
+	ProviderVoyage = "voyage"
+	ProviderJina   = "jina"
+)
+
+// Providers lists the valid embedding providers
+var Providers = []string{ProviderOllama, ProviderCohere, ProviderVoyage, ProviderJina}
+
+// Input types of hosted embedding requests. Hosted models embed the texts
+// being searched and the queries searching them differently, so documents
+// and queries must be embedded with their own input type.
+const (
+	InputDocument = "document"
+	InputQuery    = "query"
+)
+
+// hostedProvider describes a hosted embedding API
+type hostedProvider struct {
+	url          string
+	apiKeyEnv    string
+	defaultModel string
+	// inputTypes maps InputDocument and InputQuery to the provider's names
+	inputTypes map[string]string
+}
+
+var hostedProviders = map[string]hostedProvider{
+	ProviderCohere: {
+		url:          "https://api.cohere.com/v2/embed",
+		apiKeyEnv:    "COHERE_API_KEY",
+		defaultModel: "embed-english-v3.0",
+		inputTypes:   map[string]string{InputDocument: "search_document", InputQuery: "search_query"},
+	},
+	ProviderVoyage: {
+		url:          "https://api.voyageai.com/v1/embeddings",
+		apiKeyEnv:    "VOYAGE_API_KEY",
+		defaultModel: "voyage-3.5",
+		inputTypes:   map[string]string{InputDocument: "document", InputQuery: "query"},
+	},
+	ProviderJina: {
+		url:          "https://api.jina.ai/v1/embeddings",
+		apiKeyEnv:    "JINA_API_KEY",
+		defaultModel: "jina-embeddings-v3",
+		inputTypes:   map[string]string{InputDocument: "retrieval.passage", InputQuery: "retrieval.query"},
+	},
+}
+
+// hostedRequestTimeout bounds a single request to a hosted API
+const hostedRequestTimeout = 2 * time.Minute
+
+// HostedOptions configure a HostedClient
+type HostedOptions struct {
+	// Model defaults to the provider's general-purpose model
+	Model string
+	// APIKey defaults to the provider's environment variable
+	// (COHERE_API_KEY, VOYAGE_API_KEY or JINA_API_KEY)
+	APIKey string
+	// URL overrides the provider's endpoint, e.g. for a proxy
+	URL string
+	// Dimensions asks models that support shortened embeddings for
+	// vectors of this length; 0 uses the model's default
+	Dimensions int
+	// Truncate cuts texts longer than the model's context instead of
+	// failing
+	Truncate bool
+}
+
+// HostedClient embeds text with a hosted embedding API
+type HostedClient struct {
+	provider string
+	api      hostedProvider
+	options  HostedOptions
+	client   *http.Client
+	limiter  *RateLimiter
+	cache    *database.EmbeddingCache
+}
+
+// NewHostedClient creates a client for a hosted provider (cohere, voyage
+// or jina)
+func NewHostedClient(provider string, options HostedOptions) (*HostedClient, error) {
+	api, ok := hostedProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown embedding provider %q (valid providers: %s)", provider, strings.Join(Providers, ", "))
+	}
+	if options.Model == "" {
+		options.Model = api.defaultModel
+	}
+	if options.APIKey == "" {
+		options.APIKey = os.Getenv(api.apiKeyEnv)
+	}
+	if options.APIKey == "" {
+		return nil, fmt.Errorf("%s needs an API key; set %s", provider, api.apiKeyEnv)
+	}
+	if options.URL == "" {
+		options.URL = api.url
+	}
+	if options.Dimensions < 0 {
+		return nil, fmt.Errorf("dimensions must not be negative, got %d", options.Dimensions)
+	}
+
+	return &HostedClient{
+		provider: provider,
+		api:      api,
+		options:  options,
+		client:   &http.Client{Timeout: hostedRequestTimeout},
+	}, nil
+}
+
+// DefaultHostedModel returns the model a provider uses when none is given
+func DefaultHostedModel(provider string) string {
+	return hostedProviders[provider].defaultModel
+}
+
+// Provider returns the provider name
+func (c *HostedClient) Provider() string {
+	return c.provider
+}
+
+// Model returns the embedding model
+func (c *HostedClient) Model() string {
+	return c.options.Model
+}
+
+// SetRateLimiter makes every request wait for limiter first
+func (c *HostedClient) SetRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
+// SetEmbeddingCache stores embeddings in cache and reuses them
+func (c *HostedClient) SetEmbeddingCache(cache *database.EmbeddingCache) {
+	c.cache = cache
+}
+
+// cacheModel is the name embeddings are cached under: the provider, model,
+// input type and dimensions all change the vector
+func (c *HostedClient) cacheModel(inputType string) string {
+	name := fmt.Sprintf("%s/%s (%s", c.provider, c.options.Model, inputType)
+	if c.options.Dimensions > 0 {
+		name += fmt.Sprintf(", %d dimensions", c.options.Dimensions)
+	}
+	return name + ")"
+}
+
+// GetEmbedding embeds text as a document to be searched
+func (c *HostedClient) GetEmbedding(text string) ([]float64, error) {
+	return c.Embed(text, InputDocument)
+}
+
+// GetQueryEmbedding embeds text as a search query
+func (c *HostedClient) GetQueryEmbedding(text string) ([]float64, error) {
+	return c.Embed(text, InputQuery)
+}
+
+// Embed embeds text with the given input type, InputDocument or InputQuery
+func (c *HostedClient) Embed(text, inputType string) ([]float64, error) {
+	if c.cache != nil {
+		if embedding, ok, err := c.cache.Get(c.cacheModel(inputType), text); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if ok {
+			return embedding, nil
+		}
+	}
+
+	embedding, err := c.request(text, inputType)
+	if err != nil {
+		return nil, err
+	}
+	if c.options.Dimensions > 0 && len(embedding) != c.options.Dimensions {
+		return nil, fmt.Errorf("%s returned %d dimensions instead of %d; check that %s supports shortened embeddings", c.provider, len(embedding), c.options.Dimensions, c.options.Model)
+	}
+
+	if c.cache != nil {
+		if err := c.cache.Put(c.cacheModel(inputType), text, embedding); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return embedding, nil
+}
+
+type cohereEmbedRequest struct {
+	Model           string   `json:"model"`
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	EmbeddingTypes  []string `json:"embedding_types"`
+	Truncate        string   `json:"truncate"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+}
+
+type cohereEmbedResponse struct {
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+}
+
+type voyageEmbedRequest struct {
+	Model           string   `json:"model"`
+	Input           []string `json:"input"`
+	InputType       string   `json:"input_type"`
+	Truncation      bool     `json:"truncation"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+}
+
+type jinaEmbedRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Task       string   `json:"task"`
+	Truncate   bool     `json:"truncate"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+// dataEmbedResponse is the OpenAI-style response of Voyage and Jina
+type dataEmbedResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (c *HostedClient) request(text, inputType string) ([]float64, error) {
+	providerInputType, ok := c.api.inputTypes[inputType]
+	if !ok {
+		return nil, fmt.Errorf("unknown input type %q (expected %s or %s)", inputType, InputDocument, InputQuery)
+	}
+
+	var reqBody interface{}
+	switch c.provider {
+	case ProviderCohere:
+		truncate := "NONE"
+		if c.options.Truncate {
+			truncate = "END"
+		}
+		reqBody = cohereEmbedRequest{
+			Model:           c.options.Model,
+			Texts:           []string{text},
+			InputType:       providerInputType,
+			EmbeddingTypes:  []string{"float"},
+			Truncate:        truncate,
+			OutputDimension: c.options.Dimensions,
+		}
+	case ProviderVoyage:
+		reqBody = voyageEmbedRequest{
+			Model:           c.options.Model,
+			Input:           []string{text},
+			InputType:       providerInputType,
+			Truncation:      c.options.Truncate,
+			OutputDimension: c.options.Dimensions,
+		}
+	case ProviderJina:
+		reqBody = jinaEmbedRequest{
+			Model:      c.options.Model,
+			Input:      []string{text},
+			Task:       providerInputType,
+			Truncate:   c.options.Truncate,
+			Dimensions: c.options.Dimensions,
+		}
+	}
+
+	var embeddings [][]float64
+	if c.provider == ProviderCohere {
+		var result cohereEmbedResponse
+		if err := c.postJSON(reqBody, &result); err != nil {
+			return nil, err
+		}
+		embeddings = result.Embeddings.Float
+	} else {
+		var result dataEmbedResponse
+		if err := c.postJSON(reqBody, &result); err != nil {
+			return nil, err
+		}
+		for _, data := range result.Data {
+			embeddings = append(embeddings, data.Embedding)
+		}
+	}
+	if len(embeddings) != 1 || len(embeddings[0]) == 0 {
+		return nil, fmt.Errorf("%s returned %d embeddings for 1 input", c.provider, len(embeddings))
+	}
+	return embeddings[0], nil
+}
+
+// postJSON sends an authenticated request, waiting for the rate limiter
+// first. Requests rejected with 429 are retried with exponential backoff
+// (or the server's Retry-After), and the limiter is slowed down.
+func (c *HostedClient) postJSON(reqBody, result interface{}) error {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			c.limiter.Wait()
+		}
+
+		req, err := http.NewRequest(http.MethodPost, c.options.URL, bytes.NewReader(jsonData))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.options.APIKey)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to call %s API: %w", c.provider, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			resp.Body.Close()
+			if c.limiter != nil {
+				c.limiter.Backoff()
+			}
+			time.Sleep(retryAfter(resp, backoff))
+			backoff *= 2
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("%s API returned status %d: %s", c.provider, resp.StatusCode, string(body))
+		}
+		if c.limiter != nil {
+			c.limiter.Success()
+		}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+}
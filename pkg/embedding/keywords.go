@@ -0,0 +1,105 @@
+package embedding
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var listMarkerRegex = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s*`)
+
+// GetKeywords asks the generation model for the n most important keywords
+// or short key phrases in text
+func (c *OllamaClient) GetKeywords(text string, n int) ([]string, error) {
+	prompt := fmt.Sprintf("List the %d most important keywords or short key phrases in this text as a comma-separated list. Do not include any reasoning, explanations, or numbering. Just respond with the list:\n\n%s \n\n /no_think", n, text)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKeywordList(response, n), nil
+}
+
+func parseKeywordList(response string, n int) []string {
+	cleaned := cleanSummaryResponse(response)
+	parts := strings.FieldsFunc(cleaned, func(r rune) bool { return r == ',' || r == '\n' || r == ';' })
+
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, part := range parts {
+		keyword := strings.ToLower(strings.TrimSpace(listMarkerRegex.ReplaceAllString(strings.TrimSpace(part), "")))
+		keyword = strings.Trim(keyword, ".\"'")
+		if keyword == "" || seen[keyword] || len(strings.Fields(keyword)) > 4 {
+			continue
+		}
+		seen[keyword] = true
+		keywords = append(keywords, keyword)
+		if len(keywords) == n {
+			break
+		}
+	}
+	return keywords
+}
+
+// GetKeywordsConcurrent extracts keywords for each text, returning them in
+// the same order as texts
+func (c *OllamaClient) GetKeywordsConcurrent(texts []string, n, maxWorkers int, progressCallback func(completed, total int)) ([][]string, error) {
+	keywords := make([][]string, len(texts))
+	errs := runConcurrent(len(texts), maxWorkers, func(i int) error {
+		result, err := c.GetKeywords(texts[i], n)
+		keywords[i] = result
+		return err
+	}, progressCallback)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("keyword extraction errors occurred: %v", errs)
+	}
+	return keywords, nil
+}
+
+// runConcurrent calls fn for every index in [0, total) using up to
+// maxWorkers goroutines and returns the errors that occurred
+func runConcurrent(total, maxWorkers int, fn func(i int) error, progressCallback func(completed, total int)) []error {
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+
+	jobs := make(chan int, total)
+	for i := 0; i < total; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	var (
+		mu        sync.Mutex
+		errs      []error
+		completed int
+		wg        sync.WaitGroup
+	)
+
+	for w := 0; w < maxWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := fn(i)
+
+				mu.Lock()
+				completed++
+				if err != nil {
+					errs = append(errs, fmt.Errorf("item %d: %w", i, err))
+				}
+				if progressCallback != nil {
+					progressCallback(completed, total)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return errs
+}
@@ -5,33 +5,146 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/progress"
 )
 
 type OllamaClient struct {
 	baseURL string
-	model   string
+	// generationURL serves summaries and other prompts; empty means
+	// baseURL
+	generationURL   string
+	model           string
+	generationModel string
+	limiter         *RateLimiter
+	cache           *database.EmbeddingCache
+	options         ClientOptions
+	pullProgress    progress.Reporter
+	// summaryLanguage is the ISO 639-1 code summaries are written in, or
+	// empty for the model's choice
+	summaryLanguage string
 }
 
+// Embedding endpoints of the Ollama API
+const (
+	// EmbeddingsAPI is the original /api/embeddings endpoint
+	EmbeddingsAPI = "embeddings"
+	// EmbedAPI is the /api/embed endpoint of Ollama 0.3.4 and later, which
+	// returns unit-length embeddings and can truncate long inputs
+	EmbedAPI = "embed"
+)
+
+// ClientOptions tune the requests a client sends to Ollama
+type ClientOptions struct {
+	// EmbedAPI selects the embedding endpoint, EmbeddingsAPI (default) or
+	// EmbedAPI. Embeddings from the two differ in length, so a database
+	// should be built with one of them.
+	EmbedAPI string
+
+	// KeepAlive is how long Ollama keeps a model loaded after a request,
+	// e.g. "30m" or "-1m" for indefinitely. Empty uses the server default.
+	KeepAlive string
+
+	// Truncate, if set, controls whether /api/embed cuts inputs longer
+	// than the model's context instead of failing
+	Truncate *bool
+
+	// ModelOptions are sent as the options of every request, e.g.
+	// {"num_ctx": 8192}
+	ModelOptions map[string]interface{}
+
+	// AutoPull makes CheckModelsAvailable pull missing models instead of
+	// failing
+	AutoPull bool
+
+	// EmbeddingHost and GenerationHost, if set, send embedding and
+	// generation requests to different Ollama servers than the client's
+	// host, e.g. embeddings to a GPU box and summaries to localhost
+	EmbeddingHost  string
+	GenerationHost string
+
+	// GenerationOnly leaves the embedding model out of
+	// CheckModelsAvailable, for clients that only summarize while a hosted
+	// provider embeds
+	GenerationOnly bool
+
+	// EmbeddingOnly leaves the generation model out of
+	// CheckModelsAvailable, for clients that only embed while chunks are
+	// summarized without an LLM
+	EmbeddingOnly bool
+
+	// Capture, if set, saves the raw request and response of calls that
+	// fail with an error status or return malformed data
+	Capture *FailureCapture
+}
+
+// Default Ollama models for embeddings and for summaries and other prompts
+const (
+	DefaultEmbeddingModel  = "nomic-embed-text"
+	DefaultGenerationModel = "qwen3:0.6b"
+)
+
+// maxRateLimitRetries is how many times a request is retried after the
+// backend answers 429 Too Many Requests
+const maxRateLimitRetries = 5
+
 type embeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
 }
 
 type embeddingResponse struct {
 	Embedding []float64 `json:"embedding"`
 }
 
+func (r embeddingResponse) validate() error {
+	if len(r.Embedding) == 0 {
+		return fmt.Errorf("Ollama returned an empty embedding")
+	}
+	return nil
+}
+
+type embedRequest struct {
+	Model     string                 `json:"model"`
+	Input     string                 `json:"input"`
+	Truncate  *bool                  `json:"truncate,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+}
+
+type embedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func (r embedResponse) validate() error {
+	if len(r.Embeddings) != 1 {
+		return fmt.Errorf("Ollama returned %d embeddings for one input", len(r.Embeddings))
+	}
+	if len(r.Embeddings[0]) == 0 {
+		return fmt.Errorf("Ollama returned an empty embedding")
+	}
+	return nil
+}
+
 type generateRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	Stream bool   `json:"stream"`
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	Stream    bool                   `json:"stream"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	// Format "json" constrains the response to a JSON value
+	Format string `json:"format,omitempty"`
 }
 
 type generateResponse struct {
@@ -74,26 +187,184 @@ func NewOllamaClient(baseURL, model string) *OllamaClient {
 		baseURL = "http://localhost:11434"
 	}
 	if model == "" {
-		model = "nomic-embed-text"
+		model = DefaultEmbeddingModel
 	}
 
 	return &OllamaClient{
-		baseURL: baseURL,
-		model:   model,
+		baseURL:         baseURL,
+		model:           model,
+		generationModel: DefaultGenerationModel,
 	}
 }
 
+// Model returns the name of the embedding model
+func (c *OllamaClient) Model() string {
+	return c.model
+}
+
+// WithEmbeddingModel returns a copy of the client that embeds with model,
+// sharing its rate limiter and embedding cache
+func (c *OllamaClient) WithEmbeddingModel(model string) *OllamaClient {
+	copied := *c
+	copied.model = model
+	return &copied
+}
+
+// GenerationModel returns the name of the model used for summaries and
+// other prompts
+func (c *OllamaClient) GenerationModel() string {
+	return c.generationModel
+}
+
+// Host returns the URL of the Ollama server used for embeddings
+func (c *OllamaClient) Host() string {
+	return c.baseURL
+}
+
+// GenerationHost returns the URL of the Ollama server used for summaries
+// and other prompts
+func (c *OllamaClient) GenerationHost() string {
+	if c.generationURL != "" {
+		return c.generationURL
+	}
+	return c.baseURL
+}
+
+// hosts returns the distinct servers the client sends requests to
+func (c *OllamaClient) hosts() []string {
+	if c.GenerationHost() == c.baseURL {
+		return []string{c.baseURL}
+	}
+	return []string{c.baseURL, c.GenerationHost()}
+}
+
+// hostFor returns the server that runs model
+func (c *OllamaClient) hostFor(model string) string {
+	if model == c.generationModel && model != c.model {
+		return c.GenerationHost()
+	}
+	return c.baseURL
+}
+
+// SetGenerationModel changes the model used for summaries and other
+// prompts. An empty name keeps the current model.
+func (c *OllamaClient) SetGenerationModel(model string) {
+	if model != "" {
+		c.generationModel = model
+	}
+}
+
+// SetRateLimiter limits the request rate of all workers using this client
+func (c *OllamaClient) SetRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
+// SetEmbeddingCache makes GetEmbedding look embeddings up in cache before
+// asking Ollama, and store the ones it had to ask for
+func (c *OllamaClient) SetEmbeddingCache(cache *database.EmbeddingCache) {
+	c.cache = cache
+}
+
+// Validate checks that the options name a known embedding API
+func (o ClientOptions) Validate() error {
+	switch o.EmbedAPI {
+	case "", EmbeddingsAPI, EmbedAPI:
+	default:
+		return fmt.Errorf("unknown embedding API %q (valid: %s, %s)", o.EmbedAPI, EmbeddingsAPI, EmbedAPI)
+	}
+	// Ollama parses keep_alive strings as Go durations
+	if o.KeepAlive != "" {
+		if _, err := time.ParseDuration(o.KeepAlive); err != nil {
+			return fmt.Errorf("invalid keep-alive %q: use a duration such as 30m, or -1m to keep models loaded", o.KeepAlive)
+		}
+	}
+	return nil
+}
+
+// SetOptions changes the hosts, endpoint, keep-alive and model options used
+// for every request. Options should be validated first; an unknown embedding
+// API falls back to EmbeddingsAPI.
+func (c *OllamaClient) SetOptions(options ClientOptions) {
+	c.options = options
+	if options.EmbeddingHost != "" {
+		// Prompts stay on the client's own host
+		if c.generationURL == "" {
+			c.generationURL = c.baseURL
+		}
+		c.baseURL = options.EmbeddingHost
+	}
+	if options.GenerationHost != "" {
+		c.generationURL = options.GenerationHost
+	}
+}
+
+// cacheModel is the model name embeddings are cached under. /api/embed
+// returns differently scaled vectors, so they are cached separately.
+func (c *OllamaClient) cacheModel() string {
+	if c.options.EmbedAPI == EmbedAPI {
+		return c.model + " (" + EmbedAPI + ")"
+	}
+	return c.model
+}
+
+// post sends a JSON request, waiting for the rate limiter first. Requests
+// rejected with 429 are retried with exponential backoff (or the server's
+// Retry-After), and the limiter is slowed down for everyone.
+func (c *OllamaClient) post(url string, jsonData []byte) (*http.Response, error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			c.limiter.Wait()
+		}
+
+		resp, err := http.Post(url, "application/json", bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			if resp.StatusCode == http.StatusOK && c.limiter != nil {
+				c.limiter.Success()
+			}
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if c.limiter != nil {
+			c.limiter.Backoff()
+		}
+		time.Sleep(retryAfter(resp, backoff))
+		backoff *= 2
+	}
+}
+
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
 // CheckConnection verifies that Ollama is running and accessible
 func (c *OllamaClient) CheckConnection() error {
-	url := fmt.Sprintf("%s/api/tags", c.baseURL)
+	for _, host := range c.hosts() {
+		if err := checkHost(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkHost(host string) error {
+	url := fmt.Sprintf("%s/api/tags", host)
 	resp, err := http.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Ollama at %s: %w\n\nPlease ensure:\n1. Ollama is installed (visit https://ollama.ai)\n2. Ollama is running (try 'ollama serve')\n3. The correct host is specified (default: http://localhost:11434)", c.baseURL, err)
+		return fmt.Errorf("failed to connect to Ollama at %s: %w\n\nPlease ensure:\n1. Ollama is installed (visit https://ollama.ai)\n2. Ollama is running (try 'ollama serve')\n3. The correct host is specified (default: http://localhost:11434)", host, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Ollama server responded with status %d\n\nPlease check that Ollama is running properly", resp.StatusCode)
+		return fmt.Errorf("Ollama server at %s responded with status %d\n\nPlease check that Ollama is running properly", host, resp.StatusCode)
 	}
 
 	return nil
@@ -101,16 +372,70 @@ func (c *OllamaClient) CheckConnection() error {
 
 // CheckModelsAvailable verifies that required models are installed
 func (c *OllamaClient) CheckModelsAvailable() error {
-	url := fmt.Sprintf("%s/api/tags", c.baseURL)
+	missingModels, err := c.MissingModels()
+	if err != nil {
+		return err
+	}
+
+	if c.options.AutoPull {
+		for _, model := range missingModels {
+			if err := c.PullModel(model, c.pullProgress); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(missingModels) > 0 {
+		return fmt.Errorf("missing required models: %v\n\nPlease install them with:\n%s",
+			missingModels,
+			c.generateInstallCommands(missingModels))
+	}
+
+	return nil
+}
+
+// MissingModels returns the required models that are not installed on the
+// server that runs them
+func (c *OllamaClient) MissingModels() ([]string, error) {
+	installed := make(map[string]map[string]bool)
+	var missingModels []string
+	models := []string{c.model, c.generationModel}
+	if c.options.GenerationOnly {
+		models = models[1:]
+	}
+	if c.options.EmbeddingOnly {
+		models = models[:len(models)-1]
+	}
+	for _, required := range models {
+		host := c.hostFor(required)
+		if installed[host] == nil {
+			models, err := listModels(host)
+			if err != nil {
+				return nil, err
+			}
+			installed[host] = models
+		}
+		if !installed[host][required] {
+			missingModels = append(missingModels, required)
+		}
+	}
+
+	return missingModels, nil
+}
+
+// listModels returns the models installed on host
+func listModels(host string) (map[string]bool, error) {
+	url := fmt.Sprintf("%s/api/tags", host)
 	resp, err := http.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to check available models: %w", err)
+		return nil, fmt.Errorf("failed to check available models: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var listResp listModelsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
-		return fmt.Errorf("failed to parse models list: %w", err)
+		return nil, fmt.Errorf("failed to parse models list: %w", err)
 	}
 
 	modelMap := make(map[string]bool)
@@ -122,103 +447,257 @@ func (c *OllamaClient) CheckModelsAvailable() error {
 			modelMap[baseName] = true
 		}
 	}
+	return modelMap, nil
+}
 
-	requiredModels := []string{c.model, "qwen3:0.6b"}
-	var missingModels []string
+type pullRequest struct {
+	Name   string `json:"name"`
+	Stream bool   `json:"stream"`
+}
 
-	for _, required := range requiredModels {
-		if !modelMap[required] {
-			missingModels = append(missingModels, required)
-		}
+// pullStatus is one line of the streamed /api/pull response. Each layer of
+// the model is downloaded separately and reports its own digest and size.
+type pullStatus struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// bytesPerMB scales pull progress, which Reporter counts in ints
+const bytesPerMB = 1000 * 1000
+
+// SetPullProgress sets where PullModel reports download progress when it is
+// called by CheckModelsAvailable with AutoPull set
+func (c *OllamaClient) SetPullProgress(reporter progress.Reporter) {
+	c.pullProgress = reporter
+}
+
+// PullModel downloads a model to the Ollama server that runs it, blocking
+// until the download finishes. If reporter is non-nil it receives the megabytes
+// downloaded across all of the model's layers.
+func (c *OllamaClient) PullModel(model string, reporter progress.Reporter) error {
+	jsonData, err := json.Marshal(pullRequest{Name: model, Stream: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if len(missingModels) > 0 {
-		return fmt.Errorf("missing required models: %v\n\nPlease install them with:\n%s", 
-			missingModels, 
-			generateInstallCommands(missingModels))
+	resp, err := http.Post(fmt.Sprintf("%s/api/pull", c.hostFor(model)), "application/json", bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to pull model %s: %w", model, err)
 	}
+	defer resp.Body.Close()
 
-	return nil
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Ollama API returned status %d pulling %s: %s", resp.StatusCode, model, string(body))
+	}
+
+	stage := fmt.Sprintf("Pulling %s (MB)", model)
+	totals := make(map[string]int64)
+	completed := make(map[string]int64)
+	report := func(done bool) {
+		if reporter == nil || len(totals) == 0 {
+			return
+		}
+		var sumTotal, sumCompleted int64
+		for digest, total := range totals {
+			sumTotal += total
+			sumCompleted += completed[digest]
+		}
+		mbTotal := int((sumTotal + bytesPerMB - 1) / bytesPerMB)
+		mbCompleted := int(sumCompleted / bytesPerMB)
+		if done {
+			mbCompleted = mbTotal
+		} else if mbCompleted >= mbTotal {
+			// Reaching the total ends the stage, but more layers may follow
+			mbCompleted = mbTotal - 1
+		}
+		reporter.Report(stage, mbCompleted, mbTotal)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var status pullStatus
+		if err := decoder.Decode(&status); err == io.EOF {
+			return fmt.Errorf("pull of %s ended before it finished", model)
+		} else if err != nil {
+			return fmt.Errorf("failed to read pull progress for %s: %w", model, err)
+		}
+		if status.Error != "" {
+			return fmt.Errorf("failed to pull model %s: %s", model, status.Error)
+		}
+		if status.Status == "success" {
+			report(true)
+			return nil
+		}
+		if status.Digest != "" && status.Total > 0 {
+			totals[status.Digest] = status.Total
+			completed[status.Digest] = status.Completed
+			report(false)
+		}
+	}
 }
 
-func generateInstallCommands(models []string) string {
+func (c *OllamaClient) generateInstallCommands(models []string) string {
 	var commands []string
 	for _, model := range models {
-		commands = append(commands, fmt.Sprintf("ollama pull %s", model))
+		command := fmt.Sprintf("ollama pull %s", model)
+		if len(c.hosts()) > 1 {
+			command += "  # on " + c.hostFor(model)
+		}
+		commands = append(commands, command)
 	}
 	return strings.Join(commands, "\n")
 }
 
 func (c *OllamaClient) GetEmbedding(text string) ([]float64, error) {
-	reqBody := embeddingRequest{
-		Model:  c.model,
-		Prompt: text,
+	if c.cache != nil {
+		// A cache that cannot be read or written only costs an Ollama call
+		if embedding, ok, err := c.cache.Get(c.cacheModel(), text); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if ok {
+			return embedding, nil
+		}
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	var embedding []float64
+	var err error
+	if c.options.EmbedAPI == EmbedAPI {
+		embedding, err = c.embed(text)
+	} else {
+		embedding, err = c.embeddings(text)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/api/embeddings", c.baseURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to call Ollama API: %w", err)
+	if c.cache != nil && len(embedding) > 0 {
+		if err := c.cache.Put(c.cacheModel(), text, embedding); err != nil {
+			log.Printf("Warning: %v", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Ollama API returned status %d: %s", resp.StatusCode, string(body))
+	return embedding, nil
+}
+
+// embeddings calls the original /api/embeddings endpoint
+func (c *OllamaClient) embeddings(text string) ([]float64, error) {
+	reqBody := embeddingRequest{
+		Model:     c.model,
+		Prompt:    text,
+		KeepAlive: c.options.KeepAlive,
+		Options:   c.options.ModelOptions,
 	}
 
 	var result embeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.postJSON(c.baseURL, "/api/embeddings", reqBody, &result); err != nil {
+		return nil, err
 	}
-
 	return result.Embedding, nil
 }
 
-func (c *OllamaClient) GetSummary(text string) (string, error) {
-	prompt := fmt.Sprintf("Please provide only a 1-5 word summary of this text. Do not include any reasoning, explanations, or thinking process. Limit your response to a maximum of 5 words. Just respond with the key topic:\n\n%s \n\n /no_think", text)
+// embed calls the /api/embed endpoint
+func (c *OllamaClient) embed(text string) ([]float64, error) {
+	reqBody := embedRequest{
+		Model:     c.model,
+		Input:     text,
+		Truncate:  c.options.Truncate,
+		KeepAlive: c.options.KeepAlive,
+		Options:   c.options.ModelOptions,
+	}
 
-	reqBody := generateRequest{
-		Model:  "qwen3:0.6b",
-		Prompt: prompt,
-		Stream: false,
+	var result embedResponse
+	if err := c.postJSON(c.baseURL, "/api/embed", reqBody, &result); err != nil {
+		return nil, err
 	}
+	return result.Embeddings[0], nil
+}
 
+// postJSON posts reqBody to an API path of the Ollama server at host and
+// decodes the response into result, checking it if result has a validate
+// method. Error statuses, undecodable bodies and invalid results are
+// captured if the client captures failures.
+func (c *OllamaClient) postJSON(host, path string, reqBody, result interface{}) error {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/api/generate", c.baseURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	url := host + path
+	resp, err := c.post(url, jsonData)
 	if err != nil {
-		return "", fmt.Errorf("failed to call Ollama API: %w", err)
+		return fmt.Errorf("failed to call Ollama API: %w", err)
 	}
 	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return c.captured(fmt.Errorf("failed to read response: %w", err), url, jsonData, resp.StatusCode, body)
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ollama API returned status %d: %s", resp.StatusCode, string(body))
+		return c.captured(fmt.Errorf("Ollama API returned status %d: %s", resp.StatusCode, string(body)), url, jsonData, resp.StatusCode, body)
 	}
 
-	var result generateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	if err := json.Unmarshal(body, result); err != nil {
+		return c.captured(fmt.Errorf("failed to decode response: %w", err), url, jsonData, resp.StatusCode, body)
+	}
+	if v, ok := result.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return c.captured(err, url, jsonData, resp.StatusCode, body)
+		}
+	}
+	return nil
+}
+
+func (c *OllamaClient) GetSummary(text string) (string, error) {
+	prompt := fmt.Sprintf("Please provide only a 1-5 word summary of this text. Do not include any reasoning, explanations, or thinking process. Limit your response to a maximum of 5 words.%s Just respond with the key topic:\n\n%s \n\n /no_think", c.languageInstruction(), text)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return "", err
 	}
 
 	// Clean up the response - remove thinking tags and clean text
-	summary := cleanSummaryResponse(result.Response)
+	return limitSummaryWords(cleanSummaryResponse(response)), nil
+}
+
+// limitSummaryWords cuts a topic label that ran on to its first 10 words
+func limitSummaryWords(summary string) string {
 	words := strings.Fields(summary)
 	if len(words) > 10 {
 		words = words[:10]
 	}
+	return strings.Join(words, " ")
+}
+
+// Generate sends a prompt to the generation model and returns the raw,
+// non-streamed response
+func (c *OllamaClient) Generate(prompt string) (string, error) {
+	return c.generate(prompt, "")
+}
+
+// GenerateJSON is Generate with the response constrained to JSON
+func (c *OllamaClient) GenerateJSON(prompt string) (string, error) {
+	return c.generate(prompt, "json")
+}
 
-	return strings.Join(words, " "), nil
+func (c *OllamaClient) generate(prompt, format string) (string, error) {
+	reqBody := generateRequest{
+		Model:     c.generationModel,
+		Prompt:    prompt,
+		Stream:    false,
+		KeepAlive: c.options.KeepAlive,
+		Options:   c.options.ModelOptions,
+		Format:    format,
+	}
+
+	var result generateResponse
+	if err := c.postJSON(c.GenerationHost(), "/api/generate", reqBody, &result); err != nil {
+		return "", err
+	}
+	return result.Response, nil
 }
 
 func cleanSummaryResponse(response string) string {
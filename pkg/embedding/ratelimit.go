@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by all workers of a client. When the
+// backend answers 429 the rate is halved, and it then creeps back up towards
+// the configured rate with every successful request.
+type RateLimiter struct {
+	mu      sync.Mutex
+	maxRate float64
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+// minRateFraction is the floor Backoff will slow down to, relative to the
+// configured rate
+const minRateFraction = 0.05
+
+// NewRateLimiter creates a limiter allowing rps requests per second with
+// bursts of up to burst requests
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		maxRate: rps,
+		rate:    rps,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made
+func (l *RateLimiter) Wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// Backoff halves the current rate after the backend reported rate limiting
+func (l *RateLimiter) Backoff() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate /= 2
+	if floor := l.maxRate * minRateFraction; l.rate < floor {
+		l.rate = floor
+	}
+	l.tokens = 0
+}
+
+// Success nudges the rate back up towards the configured maximum
+func (l *RateLimiter) Success() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate < l.maxRate {
+		l.rate += l.maxRate * minRateFraction
+		if l.rate > l.maxRate {
+			l.rate = l.maxRate
+		}
+	}
+}
+
+// Rate returns the current requests per second
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
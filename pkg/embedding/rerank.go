@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// RerankCandidate is a search hit to be re-scored. Similarity is the
+// embedding similarity that selected it; Score is set by the reranker.
+type RerankCandidate struct {
+	ID         int
+	Text       string
+	Similarity float64
+	Score      float64
+}
+
+// Reranker re-scores search candidates against a query and returns them
+// best first. Implementations can use any backend that compares the query
+// with each candidate directly, which is more precise than comparing
+// independently computed embeddings.
+type Reranker interface {
+	Rerank(query string, candidates []RerankCandidate) ([]RerankCandidate, error)
+}
+
+// LLMReranker asks the client's generation model to rate how relevant each
+// candidate is to the query, on a scale from 0 to 10
+type LLMReranker struct {
+	client     *OllamaClient
+	maxWorkers int
+}
+
+// NewLLMReranker creates a reranker that scores candidates with up to
+// maxWorkers concurrent prompts (0 = number of CPUs). Give the client a
+// dedicated rerank model with SetGenerationModel if one is installed.
+func NewLLMReranker(client *OllamaClient, maxWorkers int) *LLMReranker {
+	return &LLMReranker{client: client, maxWorkers: maxWorkers}
+}
+
+var scoreRegex = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// Rerank implements Reranker. Candidates with equal scores keep their
+// embedding similarity order.
+func (r *LLMReranker) Rerank(query string, candidates []RerankCandidate) ([]RerankCandidate, error) {
+	scored := make([]RerankCandidate, len(candidates))
+	copy(scored, candidates)
+
+	errs := runConcurrent(len(scored), r.maxWorkers, func(i int) error {
+		prompt := fmt.Sprintf("Rate how relevant the passage is to the query on a scale from 0 (unrelated) to 10 (directly answers it). Respond with only the number.\n\nQuery: %s\n\nPassage:\n%s \n\n /no_think", query, scored[i].Text)
+		response, err := r.client.Generate(prompt)
+		if err != nil {
+			return err
+		}
+		scored[i].Score = parseRelevanceScore(response)
+		return nil
+	}, nil)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("reranking errors occurred: %v", errs)
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].Similarity > scored[j].Similarity
+	})
+	return scored, nil
+}
+
+// parseRelevanceScore extracts the first number in a response, clamped to
+// 0-10 and normalized to 0-1. Responses without a number score 0.
+func parseRelevanceScore(response string) float64 {
+	match := scoreRegex.FindString(cleanSummaryResponse(response))
+	if match == "" {
+		return 0
+	}
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0
+	}
+	return min(max(score, 0), 10) / 10
+}
@@ -0,0 +1,56 @@
+package embedding
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sentimentRegex = regexp.MustCompile(`[-+]?\d+(?:\.\d+)?`)
+
+// GetSentiment asks the generation model for the emotional valence of
+// text, from -1 (very negative) through 0 (neutral) to 1 (very positive)
+func (c *OllamaClient) GetSentiment(text string) (float64, error) {
+	prompt := fmt.Sprintf("Rate the emotional tone of this text on a scale from -1 (very negative: grief, anger, fear) through 0 (neutral) to 1 (very positive: joy, love, hope). Do not include any reasoning or explanations. Just respond with the number:\n\n%s \n\n /no_think", text)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseSentiment(response)
+}
+
+// parseSentiment reads the first number of a response and clamps it to
+// [-1, 1]
+func parseSentiment(response string) (float64, error) {
+	// Models sometimes answer with a Unicode minus sign
+	cleaned := strings.ReplaceAll(cleanSummaryResponse(response), "−", "-")
+	match := sentimentRegex.FindString(cleaned)
+	if match == "" {
+		return 0, fmt.Errorf("no sentiment score in response %q", cleaned)
+	}
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sentiment score %q: %w", match, err)
+	}
+	return math.Max(-1, math.Min(1, score)), nil
+}
+
+// GetSentimentConcurrent scores each text, returning the scores in the same
+// order as texts
+func (c *OllamaClient) GetSentimentConcurrent(texts []string, maxWorkers int, progressCallback func(completed, total int)) ([]float64, error) {
+	scores := make([]float64, len(texts))
+	errs := runConcurrent(len(texts), maxWorkers, func(i int) error {
+		score, err := c.GetSentiment(texts[i])
+		scores[i] = score
+		return err
+	}, progressCallback)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("sentiment scoring errors occurred: %v", errs)
+	}
+	return scores, nil
+}
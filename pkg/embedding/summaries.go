@@ -0,0 +1,200 @@
+package embedding
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Summary styles. The topic is the short node label stored in the summary
+// column; the longer styles are stored in columns of their own.
+const (
+	SummaryTopic     = "topic"
+	SummarySentence  = "sentence"
+	SummaryParagraph = "paragraph"
+	SummaryBullets   = "bullets"
+)
+
+// SummaryStyles lists the valid summary styles, shortest first
+var SummaryStyles = []string{SummaryTopic, SummarySentence, SummaryParagraph, SummaryBullets}
+
+var summaryPrompts = map[string]string{
+	SummarySentence:  "Summarize the following text in one sentence of at most 30 words. Respond with the sentence only.",
+	SummaryParagraph: "Write a single paragraph of 3-5 sentences summarizing the following text for someone who has not read it. Respond with the paragraph only.",
+	SummaryBullets:   "List the 3-5 key points of the following text as a markdown bullet list, one short line per point starting with \"- \". Respond with the list only.",
+}
+
+var thinkTagRegex = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// SummaryLanguages names the languages summaries can be requested in, by
+// ISO 639-1 code
+var SummaryLanguages = map[string]string{
+	"ar": "Arabic",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fi": "Finnish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"no": "Norwegian",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// ValidateSummaryLanguage returns an error if language is neither empty
+// nor a code of SummaryLanguages
+func ValidateSummaryLanguage(language string) error {
+	if _, ok := SummaryLanguages[language]; ok || language == "" {
+		return nil
+	}
+	codes := make([]string, 0, len(SummaryLanguages))
+	for code := range SummaryLanguages {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return fmt.Errorf("unknown summary language %q (valid languages: %s)", language, strings.Join(codes, ", "))
+}
+
+// SetSummaryLanguage makes summaries and titles answer in the language
+// with the given ISO 639-1 code whatever the language of the text, so a
+// German corpus can get German node labels from a model that otherwise
+// replies in English. An empty code leaves the language to the model.
+func (c *OllamaClient) SetSummaryLanguage(language string) {
+	c.summaryLanguage = language
+}
+
+// WithSummaryLanguage returns a copy of the client that summarizes in
+// language, sharing its rate limiter and embedding cache
+func (c *OllamaClient) WithSummaryLanguage(language string) *OllamaClient {
+	copied := *c
+	copied.summaryLanguage = language
+	return &copied
+}
+
+// SummaryLanguage returns the code set with SetSummaryLanguage
+func (c *OllamaClient) SummaryLanguage() string {
+	return c.summaryLanguage
+}
+
+// languageInstruction is added to summary and title prompts to ask for the
+// summary language, or empty if none is set
+func (c *OllamaClient) languageInstruction() string {
+	name, ok := SummaryLanguages[c.summaryLanguage]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" Respond in %s, whatever the language of the text.", name)
+}
+
+// ValidateSummaryStyles returns an error naming the first unknown style
+func ValidateSummaryStyles(styles []string) error {
+	for _, style := range styles {
+		known := false
+		for _, valid := range SummaryStyles {
+			known = known || style == valid
+		}
+		if !known {
+			return fmt.Errorf("unknown summary style %q (valid styles: %s)", style, strings.Join(SummaryStyles, ", "))
+		}
+	}
+	return nil
+}
+
+// GetSummaries generates a summary of text in each of the given styles.
+// The prompts are chained: when a paragraph is requested, the sentence is
+// condensed from the paragraph rather than from the full text, which keeps
+// the two consistent and the second prompt short. The topic style uses
+// GetSummary.
+func (c *OllamaClient) GetSummaries(text string, styles []string) (map[string]string, error) {
+	if err := ValidateSummaryStyles(styles); err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(styles))
+	for _, style := range styles {
+		wanted[style] = true
+	}
+
+	summaries := make(map[string]string, len(styles))
+	if wanted[SummaryTopic] {
+		topic, err := c.GetSummary(text)
+		if err != nil {
+			return nil, err
+		}
+		summaries[SummaryTopic] = topic
+	}
+
+	for _, style := range []string{SummaryParagraph, SummaryBullets, SummarySentence} {
+		if !wanted[style] {
+			continue
+		}
+		source := text
+		if style == SummarySentence && summaries[SummaryParagraph] != "" {
+			source = summaries[SummaryParagraph]
+		}
+
+		response, err := c.Generate(fmt.Sprintf("%s%s\n\n%s\n\n /no_think", summaryPrompts[style], c.languageInstruction(), source))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s summary: %w", style, err)
+		}
+		summaries[style] = strings.TrimSpace(thinkTagRegex.ReplaceAllString(response, ""))
+	}
+
+	return summaries, nil
+}
+
+// GetSummaryBatch generates the topic labels of several texts with one
+// prompt, returning them in the same order as texts. The model answers in
+// JSON; a reply that doesn't parse or has the wrong number of labels is an
+// error, so callers can fall back to GetSummary.
+func (c *OllamaClient) GetSummaryBatch(texts []string) ([]string, error) {
+	var passages strings.Builder
+	for i, text := range texts {
+		fmt.Fprintf(&passages, "Passage %d:\n%s\n\n", i+1, text)
+	}
+	prompt := fmt.Sprintf("Below are %d numbered passages. For each passage, give only a 1-5 word summary of its key topic. Do not include any reasoning, explanations, or thinking process.%s Respond with a JSON object of the form {\"summaries\": [\"topic of passage 1\", \"topic of passage 2\", ...]} holding exactly %d summaries, in the order of the passages:\n\n%s /no_think", len(texts), c.languageInstruction(), len(texts), passages.String())
+
+	response, err := c.GenerateJSON(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Summaries []string `json:"summaries"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(thinkTagRegex.ReplaceAllString(response, ""))), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse batched summaries: %w", err)
+	}
+	if len(result.Summaries) != len(texts) {
+		return nil, fmt.Errorf("asked for %d batched summaries, got %d", len(texts), len(result.Summaries))
+	}
+
+	summaries := make([]string, len(texts))
+	for i, summary := range result.Summaries {
+		summaries[i] = limitSummaryWords(cleanSummaryResponse(summary))
+		if summaries[i] == "" {
+			return nil, fmt.Errorf("batched summary %d of %d is empty", i+1, len(texts))
+		}
+	}
+	return summaries, nil
+}
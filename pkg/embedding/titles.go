@@ -0,0 +1,63 @@
+package embedding
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTitleWords caps a generated title, in case the model ignores the
+// prompt and writes a sentence
+const maxTitleWords = 12
+
+// titleTrim is the Markdown and quoting models wrap titles in
+const titleTrim = " \t*#\"'“”‘’"
+
+// GetTitle asks the generation model for a short headline for text. Unlike
+// the topic summary, which names the subject in a few keywords, a title
+// reads like a heading a person would give the passage.
+func (c *OllamaClient) GetTitle(text string) (string, error) {
+	prompt := fmt.Sprintf("Write a short, descriptive title of 3 to 8 words for this passage, like a heading in a book or an article. Use title case and no quotation marks or trailing punctuation. Do not include any reasoning or explanations.%s Just respond with the title:\n\n%s \n\n /no_think", c.languageInstruction(), text)
+
+	response, err := c.Generate(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	return cleanTitle(response), nil
+}
+
+// cleanTitle keeps the first line of a response, without quotes, a
+// "Title:" prefix or trailing punctuation
+func cleanTitle(response string) string {
+	title := cleanSummaryResponse(response)
+	if line, _, ok := strings.Cut(title, "\n"); ok {
+		title = line
+	}
+	title = strings.Trim(title, titleTrim)
+	if len(title) >= len("title:") && strings.EqualFold(title[:len("title:")], "title:") {
+		title = strings.Trim(title[len("title:"):], titleTrim)
+	}
+	title = strings.TrimRight(title, ".:;,")
+
+	words := strings.Fields(title)
+	if len(words) > maxTitleWords {
+		words = words[:maxTitleWords]
+	}
+	return strings.Join(words, " ")
+}
+
+// GetTitlesConcurrent titles each text, returning the titles in the same
+// order as texts
+func (c *OllamaClient) GetTitlesConcurrent(texts []string, maxWorkers int, progressCallback func(completed, total int)) ([]string, error) {
+	titles := make([]string, len(texts))
+	errs := runConcurrent(len(texts), maxWorkers, func(i int) error {
+		title, err := c.GetTitle(texts[i])
+		titles[i] = title
+		return err
+	}, progressCallback)
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("title generation errors occurred: %v", errs)
+	}
+	return titles, nil
+}
@@ -0,0 +1,118 @@
+package embedding
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenizer families of embedding models. Token counts are estimated from
+// how each family splits text, without loading the model's vocabulary.
+const (
+	// TokenizerWordPiece is used by BERT-based models (nomic-embed-text,
+	// mxbai-embed-large, all-minilm, bge, snowflake-arctic-embed): whole
+	// words for common vocabulary, 4-5 character pieces for rare words
+	TokenizerWordPiece = "wordpiece"
+	// TokenizerBPE covers byte-pair and SentencePiece tokenizers (bge-m3,
+	// Cohere, Voyage, Jina v3 and most LLM-based embedders), which split
+	// words into shorter pieces
+	TokenizerBPE = "bpe"
+)
+
+// ModelLimits describes how a model tokenizes text and how many tokens of
+// a text it embeds; the rest is cut off
+type ModelLimits struct {
+	Tokenizer     string
+	ContextTokens int
+}
+
+// defaultContextTokens is Ollama's default num_ctx, which applies to models
+// whose Modelfile doesn't set one
+const defaultContextTokens = 2048
+
+// modelLimits lists known embedding models by name prefix. Ollama limits
+// are those of the published Modelfiles; nomic-embed-text supports 8192
+// tokens but Ollama runs it with a 2048-token context unless num_ctx is
+// raised.
+var modelLimits = []struct {
+	prefix string
+	limits ModelLimits
+}{
+	{"nomic-embed-text", ModelLimits{TokenizerWordPiece, 2048}},
+	{"mxbai-embed-large", ModelLimits{TokenizerWordPiece, 512}},
+	{"all-minilm", ModelLimits{TokenizerWordPiece, 512}},
+	{"snowflake-arctic-embed2", ModelLimits{TokenizerBPE, 8192}},
+	{"snowflake-arctic-embed", ModelLimits{TokenizerWordPiece, 512}},
+	{"bge-m3", ModelLimits{TokenizerBPE, 8192}},
+	{"bge-large", ModelLimits{TokenizerWordPiece, 512}},
+	{"granite-embedding", ModelLimits{TokenizerBPE, 512}},
+	{"paraphrase-multilingual", ModelLimits{TokenizerBPE, 128}},
+	{"jina/jina-embeddings-v2", ModelLimits{TokenizerWordPiece, 8192}},
+	{"embed-english-v3", ModelLimits{TokenizerBPE, 512}},
+	{"embed-multilingual-v3", ModelLimits{TokenizerBPE, 512}},
+	{"embed-v4", ModelLimits{TokenizerBPE, 128000}},
+	{"voyage-3", ModelLimits{TokenizerBPE, 32000}},
+	{"voyage-", ModelLimits{TokenizerBPE, 16000}},
+	{"jina-embeddings-v3", ModelLimits{TokenizerBPE, 8192}},
+	{"jina-embeddings-v2", ModelLimits{TokenizerWordPiece, 8192}},
+}
+
+// LimitsFor returns the tokenizer and context length of an embedding model.
+// Tags such as ":latest" are ignored; unknown models are assumed to use a
+// BPE tokenizer and Ollama's default context.
+func LimitsFor(model string) ModelLimits {
+	name, _, _ := strings.Cut(model, ":")
+	for _, known := range modelLimits {
+		if strings.HasPrefix(name, known.prefix) {
+			return known.limits
+		}
+	}
+	return ModelLimits{TokenizerBPE, defaultContextTokens}
+}
+
+// CountTokens estimates how many tokens a model's tokenizer splits text
+// into, including the start and end markers. Estimates are close for
+// English prose and rougher for code and other languages; CJK characters
+// count as one token each.
+func CountTokens(model, text string) int {
+	tokenizer := LimitsFor(model).Tokenizer
+	tokens := 2
+
+	word := 0
+	flush := func() {
+		if word > 0 {
+			tokens += wordTokens(word, tokenizer)
+			word = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			// Punctuation and symbols are tokens of their own
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// wordTokens estimates the pieces a word of n characters is split into.
+// Common words are single tokens in both families; longer words are split
+// into pieces of about 5 characters by WordPiece and 4 by BPE.
+func wordTokens(n int, tokenizer string) int {
+	whole, piece := 7, 5
+	if tokenizer == TokenizerBPE {
+		whole, piece = 6, 4
+	}
+	if n <= whole {
+		return 1
+	}
+	return (n + piece - 1) / piece
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// stageLimit bounds how many requests of one stage run at once
+type stageLimit interface {
+	acquire(ctx context.Context) error
+	// release frees the slot of a request that took latency and failed
+	// with err, nil on success
+	release(latency time.Duration, err error)
+	// workers is the most requests that may run at once
+	workers() int
+}
+
+// fixedLimit allows a constant number of requests at once
+type fixedLimit chan struct{}
+
+func (l fixedLimit) acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l fixedLimit) release(time.Duration, error) { <-l }
+
+func (l fixedLimit) workers() int { return cap(l) }
+
+// Tuning of adaptiveLimit
+const (
+	// adaptiveWindow is the fewest requests a limit is judged by
+	adaptiveWindow = 4
+	// adaptiveSlowdown is how much slower than the fastest window a window
+	// may be before the backend counts as saturated, as long as it is also
+	// adaptiveMinSlowdown slower, so jitter of fast requests doesn't count
+	adaptiveSlowdown    = 2.0
+	adaptiveMinSlowdown = 100 * time.Millisecond
+)
+
+// adaptiveLimit starts with one request at a time and adjusts the limit
+// after every window of requests: a failure halves it, a window much
+// slower than the fastest one seen lowers it by one, since the backend is
+// queueing requests rather than serving them, and any other window raises
+// it by one, up to max.
+type adaptiveLimit struct {
+	name string
+	max  int
+	logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	limit int
+	inUse int
+	// freed is closed when a slot frees up or the limit grows
+	freed chan struct{}
+
+	// The window being measured, and the lowest average latency of any
+	// window so far
+	requests int
+	failures int
+	latency  time.Duration
+	fastest  time.Duration
+}
+
+func newAdaptiveLimit(name string, max int, logf func(format string, args ...interface{})) *adaptiveLimit {
+	return &adaptiveLimit{name: name, max: max, limit: 1, logf: logf, freed: make(chan struct{})}
+}
+
+func (l *adaptiveLimit) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *adaptiveLimit) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inUse--
+	l.requests++
+	l.latency += latency
+	if err != nil {
+		l.failures++
+	}
+	if l.requests >= max(l.limit, adaptiveWindow) {
+		l.adjust()
+	}
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// adjust sets the limit from the finished window and starts the next one
+func (l *adaptiveLimit) adjust() {
+	average := l.latency / time.Duration(l.requests)
+	previous := l.limit
+	switch {
+	case l.failures > 0:
+		l.limit = max(l.limit/2, 1)
+		if l.limit != previous {
+			l.logf("%d of %d %s requests failed; lowering %s workers to %d", l.failures, l.requests, l.name, l.name, l.limit)
+		}
+	case l.fastest > 0 && float64(average) > float64(l.fastest)*adaptiveSlowdown && average-l.fastest > adaptiveMinSlowdown:
+		l.limit = max(l.limit-1, 1)
+		if l.limit != previous {
+			l.logf("%s requests slowed to %s from %s; lowering %s workers to %d", l.name, average.Round(time.Millisecond), l.fastest.Round(time.Millisecond), l.name, l.limit)
+		}
+	default:
+		l.limit = min(l.limit+1, l.max)
+	}
+	if l.failures == 0 && (l.fastest == 0 || average < l.fastest) {
+		l.fastest = average
+	}
+	l.requests, l.failures, l.latency = 0, 0, 0
+}
+
+func (l *adaptiveLimit) workers() int { return l.max }
+
+// current returns the limit in effect
+func (l *adaptiveLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
@@ -0,0 +1,654 @@
+// Package pipeline runs bluffy's document processing steps: chunking,
+// embedding, summarizing, storing, and linking chunks by similarity. Each
+// step is an interface so programs can swap in their own implementations.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+	"github.com/jcpsimmons/bluffy/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Progress stages reported by Run
+const (
+	// StageChunks counts chunks embedded, summarized and stored
+	StageChunks = "Chunks"
+	// StageSimilarities counts chunks compared against the chunks before
+	// them when the default similarity strategy is used
+	StageSimilarities = "Similarities"
+	// StageStoring counts similarities written to the Store
+	StageStoring = "Storing"
+)
+
+// similarityBatchSize is how many similarities are written per transaction.
+// Inserts ignore existing rows, so a run stopped between batches resumes
+// cleanly.
+const similarityBatchSize = 10000
+
+// Chunker produces the chunks to process
+type Chunker interface {
+	Chunk(ctx context.Context) ([]database.TextChunk, error)
+}
+
+// Embedder returns the embedding of a text
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Summarizer returns a short summary of a text
+type Summarizer interface {
+	Summarize(ctx context.Context, text string) (string, error)
+}
+
+// DetailSummarizer is implemented by summarizers that also write longer
+// summaries (sentence, paragraph, bullets) onto each chunk
+type DetailSummarizer interface {
+	SummarizeDetails(ctx context.Context, chunk *database.TextChunk) error
+}
+
+// LanguageSummarizer is implemented by summarizers that can be asked to
+// write in a fixed language, recorded on each chunk they summarize
+type LanguageSummarizer interface {
+	// SummaryLanguage returns the ISO 639-1 code of that language, or
+	// empty if the model chooses
+	SummaryLanguage() string
+}
+
+// ModelRouter is implemented by embedders that embed some texts with a
+// model other than the run's, recorded on each chunk they embed
+type ModelRouter interface {
+	// ModelFor returns the model that embeds text, or empty for the
+	// run's model
+	ModelFor(text string) string
+}
+
+// Checker is implemented by steps that can verify their backend is
+// reachable before any work starts
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Store persists runs, chunks, and similarities. *database.DB and
+// *database.PostgresDB implement it.
+type Store interface {
+	CreateRun(name, source string) (*database.Run, error)
+	GetRunByName(name string) (*database.Run, error)
+	GetChunksByRun(runID int) ([]database.TextChunk, error)
+	InsertChunk(chunk *database.TextChunk) error
+	BatchInsertSimilarities(similarities []database.ChunkSimilarity) error
+}
+
+// FailureStore is implemented by stores that can record the chunks a run
+// with ContinueOnError could not process, so they can be retried later.
+// *database.DB implements it.
+type FailureStore interface {
+	RecordFailedChunk(runID int, chunk database.TextChunk, cause error) error
+	// ClearFailedChunks removes the failures of chunks that have since
+	// been stored
+	ClearFailedChunks(runID int) (int, error)
+}
+
+// SimilarityStrategy computes the similarity rows stored for a run's chunks
+type SimilarityStrategy func(chunks []database.TextChunk) ([]database.ChunkSimilarity, error)
+
+// Hook runs after all of a run's chunks are stored, before similarities
+// are calculated. It receives every chunk of the run, including chunks
+// stored by an earlier, interrupted attempt.
+type Hook func(ctx context.Context, chunks []database.TextChunk) error
+
+// Pipeline processes one source into a run of a Store. Chunker, Embedder,
+// Summarizer, and Store are required.
+//
+// Each chunk is written to the Store as soon as it has been embedded and
+// summarized, so only chunks in flight are held in memory and an
+// interrupted run can be resumed.
+type Pipeline struct {
+	Chunker    Chunker
+	Embedder   Embedder
+	Summarizer Summarizer
+	Store      Store
+
+	// Workers is the number of chunks processed concurrently (default 1)
+	Workers int
+
+	// EmbedWorkers and SummaryWorkers limit how many chunks are embedded
+	// and summarized at once, each defaulting to Workers, so a generation
+	// model that saturates the GPU with a few requests doesn't hold back
+	// embeddings. Chunks in flight are bounded by the larger of the two.
+	EmbedWorkers   int
+	SummaryWorkers int
+
+	// Budget, if set, replaces EmbedWorkers and SummaryWorkers with limits
+	// shared by every pipeline using the same Budget
+	Budget *Budget
+
+	// AdaptiveWorkers starts each stage with one request at a time and
+	// scales it up to its worker limit while the backend keeps up, backing
+	// off when requests fail or slow down
+	AdaptiveWorkers bool
+
+	// Similarity defaults to comparing every pair of the run's chunks
+	Similarity SimilarityStrategy
+
+	// Normalize scales embeddings to unit length before they are stored,
+	// so the default similarity pass compares them by dot product alone
+	Normalize bool
+
+	// Projection, if set, reduces embeddings before they are normalized
+	// and stored, for databases whose embeddings were projected
+	Projection *database.Projection
+
+	// Metric is the similarity metric, such as similarity.MetricDot, the
+	// default similarity pass scores pairs with (default cosine)
+	Metric string
+
+	// Hooks run in order after chunks are stored
+	Hooks []Hook
+
+	// Source is recorded on the run, typically the input file path
+	Source string
+
+	// RunName defaults to the current timestamp
+	RunName string
+
+	// Resume continues the run named RunName if it exists, skipping chunks
+	// it already stored, instead of failing on the duplicate name
+	Resume bool
+
+	// ContinueOnError keeps going when a chunk fails to embed or
+	// summarize: the other chunks are stored and linked as usual, and the
+	// failures are returned in Result.Failed and recorded if the Store is a
+	// FailureStore. By default the first failure stops the run.
+	ContinueOnError bool
+
+	// Progress, if set, receives per-chunk progress for each stage
+	Progress progress.Reporter
+
+	// Logf, if set, receives a line for each step
+	Logf func(format string, args ...interface{})
+}
+
+// Result describes a completed run
+type Result struct {
+	Run          *database.Run
+	Chunks       []database.TextChunk
+	Resumed      int
+	Similarities int
+	// Failed lists the chunks that could not be processed, with
+	// ContinueOnError
+	Failed []database.FailedChunk
+}
+
+// Run chunks the source, checks the embedding and summary backends,
+// embeds, summarizes and stores every chunk, runs the hooks, and stores
+// the similarities between the run's chunks. It stops early if ctx is
+// cancelled; chunks stored up to that point are kept. Each stage is traced
+// as a span of the run's span.
+func (p *Pipeline) Run(ctx context.Context) (result *Result, err error) {
+	if p.Chunker == nil || p.Embedder == nil || p.Summarizer == nil || p.Store == nil {
+		return nil, fmt.Errorf("pipeline requires a chunker, embedder, summarizer, and store")
+	}
+	ctx, span := tracing.Start(ctx, "pipeline.Run", attribute.String("bluffy.source", p.Source))
+	defer func() { tracing.End(span, err) }()
+
+	chunkCtx, chunkSpan := tracing.Start(ctx, "pipeline.Chunk")
+	chunks, err := p.Chunker.Chunk(chunkCtx)
+	chunkSpan.SetAttributes(attribute.Int("bluffy.chunks", len(chunks)))
+	tracing.End(chunkSpan, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk input: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("input produced no chunks")
+	}
+	p.logf("Processed %d text chunks", len(chunks))
+
+	for i := range chunks {
+		if chunks[i].Language == "" {
+			chunks[i].Language = textproc.DetectLanguage(chunks[i].Text)
+		}
+	}
+
+	run, pending, err := p.startRun(ctx, chunks)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("bluffy.run.id", run.ID), attribute.String("bluffy.run.name", run.Name))
+	resumed := len(chunks) - len(pending)
+	if resumed > 0 {
+		p.logf("Resuming run %q: %d of %d chunks already stored", run.Name, resumed, len(chunks))
+	}
+
+	var failed []database.FailedChunk
+	if len(pending) > 0 {
+		if err := p.check(ctx); err != nil {
+			return nil, err
+		}
+
+		p.logf("Embedding, summarizing and storing chunks...")
+		if failed, err = p.processChunks(ctx, pending); err != nil {
+			return nil, err
+		}
+	}
+	if failures, ok := p.Store.(FailureStore); ok {
+		if _, err := failures.ClearFailedChunks(run.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, storeSpan := tracing.Start(ctx, "Store.GetChunksByRun")
+	stored, err := p.Store.GetChunksByRun(run.ID)
+	tracing.End(storeSpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, hook := range p.Hooks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hookCtx, hookSpan := tracing.Start(ctx, "pipeline.Hook", attribute.Int("bluffy.hook", i))
+		err := hook(hookCtx, stored)
+		tracing.End(hookSpan, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.logf("Calculating similarities between all chunks...")
+	strategy := p.Similarity
+	if strategy == nil {
+		strategy = p.allSimilarities
+	}
+	_, similaritySpan := tracing.Start(ctx, "pipeline.Similarities", attribute.Int("bluffy.chunks", len(stored)))
+	similarities, err := strategy(stored)
+	similaritySpan.SetAttributes(attribute.Int("bluffy.similarities", len(similarities)))
+	tracing.End(similaritySpan, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate similarities: %w", err)
+	}
+
+	p.logf("Storing %d similarity calculations...", len(similarities))
+	if err := p.storeSimilarities(ctx, similarities); err != nil {
+		return nil, fmt.Errorf("failed to store similarities: %w", err)
+	}
+
+	return &Result{
+		Run:          run,
+		Chunks:       stored,
+		Resumed:      resumed,
+		Similarities: len(similarities),
+		Failed:       failed,
+	}, nil
+}
+
+// startRun creates the run, or finds it when resuming, and returns the
+// chunks that still need processing with their RunID set
+func (p *Pipeline) startRun(ctx context.Context, chunks []database.TextChunk) (_ *database.Run, _ []database.TextChunk, err error) {
+	_, span := tracing.Start(ctx, "pipeline.StartRun", attribute.Bool("bluffy.resume", p.Resume))
+	defer func() { tracing.End(span, err) }()
+
+	runName := p.RunName
+	if runName == "" {
+		runName = time.Now().Format("2006-01-02T15:04:05")
+	}
+
+	var run *database.Run
+	done := make(map[int]bool)
+	if p.Resume {
+		existing, err := p.Store.GetRunByName(runName)
+		switch {
+		case err == nil:
+			run = existing
+			stored, err := p.Store.GetChunksByRun(run.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, chunk := range stored {
+				done[chunk.ChunkIndex] = true
+			}
+		case !errors.Is(err, database.ErrRunNotFound):
+			return nil, nil, err
+		}
+	}
+	if run == nil {
+		created, err := p.Store.CreateRun(runName, p.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		run = created
+	}
+
+	pending := make([]database.TextChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if done[chunk.ChunkIndex] {
+			continue
+		}
+		chunk.RunID = run.ID
+		pending = append(pending, chunk)
+	}
+	return run, pending, nil
+}
+
+// processed is a chunk ready to store, or the error that stopped it
+type processed struct {
+	chunk database.TextChunk
+	err   error
+}
+
+// processChunks embeds and summarizes chunks with a pool of workers and
+// stores each one as soon as it is ready. Inserts go through a single
+// goroutine since SQLite allows one writer at a time. With ContinueOnError
+// the chunks that failed are returned instead of stopping the run.
+func (p *Pipeline) processChunks(ctx context.Context, chunks []database.TextChunk) ([]database.FailedChunk, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	embedWorkers, summaryWorkers := p.StageWorkers()
+	workers := max(embedWorkers, summaryWorkers)
+	var embedSlots, summarySlots stageLimit = make(fixedLimit, embedWorkers), make(fixedLimit, summaryWorkers)
+	switch {
+	case p.Budget != nil:
+		embedSlots, summarySlots = p.Budget.embed, p.Budget.summary
+	case p.AdaptiveWorkers:
+		embedSlots, summarySlots = newAdaptiveLimit("embedding", embedWorkers, p.logf), newAdaptiveLimit("summary", summaryWorkers, p.logf)
+	}
+
+	jobs := make(chan database.TextChunk)
+	ready := make(chan processed)
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, chunk := range chunks {
+			select {
+			case jobs <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				err := p.processChunk(ctx, &chunk, embedSlots, summarySlots)
+				if err != nil && (!p.ContinueOnError || ctx.Err() != nil) {
+					fail(err)
+					return
+				}
+
+				select {
+				case ready <- processed{chunk: chunk, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(ready)
+	}()
+
+	// Chunks that finish after another chunk failed are still stored so
+	// that a resumed run doesn't repeat their work
+	var failed []database.FailedChunk
+	completed := 0
+	storeFailed := false
+	for result := range ready {
+		if storeFailed {
+			continue
+		}
+		chunk := result.chunk
+		if result.err != nil {
+			p.logf("Skipping chunk %d: %v", chunk.ChunkIndex, result.err)
+			failed = append(failed, database.FailedChunk{RunID: chunk.RunID, ChunkIndex: chunk.ChunkIndex, Chunk: chunk, Error: result.err.Error(), Attempts: 1})
+			if failures, ok := p.Store.(FailureStore); ok {
+				if err := failures.RecordFailedChunk(chunk.RunID, chunk, result.err); err != nil {
+					fail(err)
+					storeFailed = true
+					continue
+				}
+			}
+		} else if err := p.insertChunk(ctx, &chunk); err != nil {
+			fail(fmt.Errorf("failed to insert chunk %d: %w", chunk.ChunkIndex, err))
+			storeFailed = true
+			continue
+		}
+		completed++
+		if p.Progress != nil {
+			p.Progress.Report(StageChunks, completed, len(chunks))
+		}
+	}
+
+	if p.Budget == nil && p.AdaptiveWorkers {
+		p.logf("Adaptive workers ended at %d embedding and %d summary workers", embedSlots.(*adaptiveLimit).current(), summarySlots.(*adaptiveLimit).current())
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return failed, ctx.Err()
+}
+
+// Budget limits how many chunks are embedded and summarized at once across
+// several pipelines, such as the files of a directory processed together
+type Budget struct {
+	embed   stageLimit
+	summary stageLimit
+}
+
+// NewBudget returns a Budget allowing embed embeddings and summary
+// summaries at once; values below 1 are raised to 1
+func NewBudget(embed, summary int) *Budget {
+	return &Budget{
+		embed:   make(fixedLimit, max(embed, 1)),
+		summary: make(fixedLimit, max(summary, 1)),
+	}
+}
+
+// NewAdaptiveBudget returns a Budget whose limits scale like those of
+// Pipeline.AdaptiveWorkers, up to embed embeddings and summary summaries
+// at once. logf, if set, receives a line whenever a limit is lowered.
+func NewAdaptiveBudget(embed, summary int, logf func(format string, args ...interface{})) *Budget {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	return &Budget{
+		embed:   newAdaptiveLimit("embedding", max(embed, 1), logf),
+		summary: newAdaptiveLimit("summary", max(summary, 1), logf),
+	}
+}
+
+// StageWorkers returns how many chunks are embedded and how many are
+// summarized at once
+func (p *Pipeline) StageWorkers() (embed, summary int) {
+	if p.Budget != nil {
+		return p.Budget.embed.workers(), p.Budget.summary.workers()
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	embed, summary = workers, workers
+	if p.EmbedWorkers > 0 {
+		embed = p.EmbedWorkers
+	}
+	if p.SummaryWorkers > 0 {
+		summary = p.SummaryWorkers
+	}
+	return embed, summary
+}
+
+// insertChunk stores a processed chunk
+func (p *Pipeline) insertChunk(ctx context.Context, chunk *database.TextChunk) (err error) {
+	_, span := tracing.Start(ctx, "Store.InsertChunk", attribute.Int("bluffy.chunk.index", chunk.ChunkIndex))
+	defer func() { tracing.End(span, err) }()
+	return p.Store.InsertChunk(chunk)
+}
+
+// processChunk embeds and summarizes a chunk, holding a slot of each stage
+// while its requests run. Waiting for a slot is part of the chunk's span
+// but not of its embed and summarize spans.
+func (p *Pipeline) processChunk(ctx context.Context, chunk *database.TextChunk, embedSlots, summarySlots stageLimit) (err error) {
+	ctx, span := tracing.Start(ctx, "pipeline.ProcessChunk",
+		attribute.Int("bluffy.chunk.index", chunk.ChunkIndex),
+		attribute.Int("bluffy.chunk.length", len(chunk.Text)))
+	defer func() { tracing.End(span, err) }()
+
+	if err := embedSlots.acquire(ctx); err != nil {
+		return err
+	}
+	embedCtx, embedSpan := tracing.Start(ctx, "pipeline.Embed")
+	started := time.Now()
+	embedding, err := p.Embedder.Embed(embedCtx, chunk.Text)
+	tracing.End(embedSpan, err)
+	embedSlots.release(time.Since(started), backendError(ctx, err))
+	if err != nil {
+		return fmt.Errorf("failed to embed chunk %d: %w", chunk.ChunkIndex, err)
+	}
+	if router, ok := p.Embedder.(ModelRouter); ok {
+		chunk.EmbeddingModel = router.ModelFor(chunk.Text)
+	}
+
+	if err := summarySlots.acquire(ctx); err != nil {
+		return err
+	}
+	started = time.Now()
+	defer func() { summarySlots.release(time.Since(started), backendError(ctx, err)) }()
+	summaryCtx, summarySpan := tracing.Start(ctx, "pipeline.Summarize")
+	defer func() { tracing.End(summarySpan, err) }()
+	summary, err := p.Summarizer.Summarize(summaryCtx, chunk.Text)
+	if err != nil {
+		return fmt.Errorf("failed to summarize chunk %d: %w", chunk.ChunkIndex, err)
+	}
+	if p.Projection != nil {
+		if embedding, err = p.Projection.Project(embedding); err != nil {
+			return fmt.Errorf("failed to project chunk %d: %w", chunk.ChunkIndex, err)
+		}
+	}
+	if p.Normalize {
+		embedding = similarity.Normalize(embedding)
+	}
+	chunk.Embedding = embedding
+	chunk.Summary = summary
+	if language, ok := p.Summarizer.(LanguageSummarizer); ok {
+		chunk.SummaryLanguage = language.SummaryLanguage()
+	}
+	if details, ok := p.Summarizer.(DetailSummarizer); ok {
+		if err := details.SummarizeDetails(summaryCtx, chunk); err != nil {
+			return fmt.Errorf("failed to summarize chunk %d: %w", chunk.ChunkIndex, err)
+		}
+	}
+	return nil
+}
+
+// backendError returns err unless the request failed because ctx was
+// cancelled, which says nothing about the backend
+func backendError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// check runs Check on every step that implements Checker, once per distinct
+// step
+func (p *Pipeline) check(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "pipeline.Check")
+	defer func() { tracing.End(span, err) }()
+
+	seen := make(map[Checker]bool)
+	for _, step := range []interface{}{p.Chunker, p.Embedder, p.Summarizer} {
+		checker, ok := step.(Checker)
+		if !ok || seen[checker] {
+			continue
+		}
+		seen[checker] = true
+		p.logf("Checking backends...")
+		if err := checker.Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allSimilarities compares every pair of chunks like
+// similarity.CalculateAllSimilarities, reporting progress per chunk. With
+// Normalize the embeddings are unit length, so a dot product suffices for
+// cosine and dot.
+func (p *Pipeline) allSimilarities(chunks []database.TextChunk) ([]database.ChunkSimilarity, error) {
+	compare := func(chunk database.TextChunk, others []database.TextChunk) ([]database.ChunkSimilarity, error) {
+		return similarity.SimilaritiesTo(chunk, others, p.Metric)
+	}
+	if p.Normalize && p.Metric != similarity.MetricEuclidean {
+		compare = similarity.UnitSimilaritiesTo
+	}
+
+	var similarities []database.ChunkSimilarity
+	for i, chunk := range chunks {
+		// Compared against earlier chunks, each pair keeps the earlier
+		// chunk as ChunkID1
+		chunkSimilarities, err := compare(chunk, chunks[:i])
+		if err != nil {
+			return nil, err
+		}
+		similarities = append(similarities, chunkSimilarities...)
+		if p.Progress != nil {
+			p.Progress.Report(StageSimilarities, i+1, len(chunks))
+		}
+	}
+	return similarities, nil
+}
+
+// storeSimilarities writes similarities in batches, reporting progress
+// after each
+func (p *Pipeline) storeSimilarities(ctx context.Context, similarities []database.ChunkSimilarity) error {
+	for start := 0; start < len(similarities); start += similarityBatchSize {
+		end := min(start+similarityBatchSize, len(similarities))
+		_, span := tracing.Start(ctx, "Store.BatchInsertSimilarities", attribute.Int("bluffy.similarities", end-start))
+		err := p.Store.BatchInsertSimilarities(similarities[start:end])
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+		if p.Progress != nil {
+			p.Progress.Report(StageStoring, end, len(similarities))
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) logf(format string, args ...interface{}) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
@@ -0,0 +1,346 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// FileChunker validates and chunks a .txt, .md, .docx, or .epub file
+type FileChunker struct {
+	Path string
+
+	// Transcode converts UTF-16 and Latin-1 input instead of rejecting it
+	Transcode bool
+
+	// Options defaults to textproc.DefaultChunkOptions
+	Options textproc.ChunkOptions
+}
+
+// Chunk implements Chunker
+func (c *FileChunker) Chunk(ctx context.Context) ([]database.TextChunk, error) {
+	opts := c.Options
+	if opts == (textproc.ChunkOptions{}) {
+		opts = textproc.DefaultChunkOptions
+	}
+
+	report, err := textproc.ValidateFile(c.Path, c.Transcode, opts)
+	if err != nil {
+		return nil, err
+	}
+	return report.Chunks, nil
+}
+
+// Chunks is a Chunker for chunks that have already been produced
+type Chunks []database.TextChunk
+
+// Chunk implements Chunker
+func (c Chunks) Chunk(ctx context.Context) ([]database.TextChunk, error) {
+	return c, nil
+}
+
+// Ollama embeds and summarizes text with an Ollama server
+type Ollama struct {
+	Client *embedding.OllamaClient
+
+	// Styles lists longer summary styles (embedding.SummarySentence,
+	// SummaryParagraph, SummaryBullets) to generate in addition to the
+	// topic. The topic style is always generated and may be omitted.
+	Styles []string
+}
+
+// Check implements Checker by verifying the server is reachable and has
+// the required models
+func (o *Ollama) Check(ctx context.Context) error {
+	if err := o.Client.CheckConnection(); err != nil {
+		return err
+	}
+	return o.Client.CheckModelsAvailable()
+}
+
+// Normalized scales the embeddings of Embedder to unit length
+type Normalized struct {
+	Embedder Embedder
+}
+
+// Embed implements Embedder
+func (n Normalized) Embed(ctx context.Context, text string) ([]float64, error) {
+	embedding, err := n.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return similarity.Normalize(embedding), nil
+}
+
+// ModelFor implements ModelRouter for the wrapped embedder
+func (n Normalized) ModelFor(text string) string {
+	return modelFor(n.Embedder, text)
+}
+
+// Projected reduces the embeddings of Embedder with the projection of the
+// database they are stored in
+type Projected struct {
+	Embedder   Embedder
+	Projection *database.Projection
+}
+
+// Embed implements Embedder
+func (p Projected) Embed(ctx context.Context, text string) ([]float64, error) {
+	embedding, err := p.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return p.Projection.Project(embedding)
+}
+
+// ModelFor implements ModelRouter for the wrapped embedder
+func (p Projected) ModelFor(text string) string {
+	return modelFor(p.Embedder, text)
+}
+
+// modelFor returns the model embedder embeds text with, or empty for the
+// run's model
+func modelFor(embedder Embedder, text string) string {
+	if router, ok := embedder.(ModelRouter); ok {
+		return router.ModelFor(text)
+	}
+	return ""
+}
+
+// Embed implements Embedder
+func (o *Ollama) Embed(ctx context.Context, text string) ([]float64, error) {
+	return o.Client.GetEmbedding(text)
+}
+
+// Summarize implements Summarizer
+func (o *Ollama) Summarize(ctx context.Context, text string) (string, error) {
+	return o.Client.GetSummary(text)
+}
+
+// SummaryLanguage implements LanguageSummarizer
+func (o *Ollama) SummaryLanguage() string {
+	return o.Client.SummaryLanguage()
+}
+
+// SummarizeDetails implements DetailSummarizer
+func (o *Ollama) SummarizeDetails(ctx context.Context, chunk *database.TextChunk) error {
+	var styles []string
+	for _, style := range o.Styles {
+		if style != embedding.SummaryTopic {
+			styles = append(styles, style)
+		}
+	}
+	if len(styles) == 0 {
+		return nil
+	}
+
+	summaries, err := o.Client.GetSummaries(chunk.Text, styles)
+	if err != nil {
+		return err
+	}
+	chunk.SummarySentence = summaries[embedding.SummarySentence]
+	chunk.SummaryParagraph = summaries[embedding.SummaryParagraph]
+	chunk.SummaryBullets = summaries[embedding.SummaryBullets]
+	return nil
+}
+
+// Statistical summarizes text as its most characteristic keywords by
+// TF-IDF over a corpus, without an LLM
+type Statistical struct {
+	// Model scores terms against the corpus; nil scores them against the
+	// text alone
+	Model *textproc.TFIDF
+	// Words is how many keywords a summary has (default 3)
+	Words int
+}
+
+// Summarize implements Summarizer
+func (s *Statistical) Summarize(ctx context.Context, text string) (string, error) {
+	model := s.Model
+	if model == nil {
+		model = textproc.NewTFIDF([]string{text})
+	}
+	words := s.Words
+	if words <= 0 {
+		words = 3
+	}
+
+	keywords := model.Keywords(text, words)
+	terms := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		terms[i] = keyword.Term
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+// maxBatchChars closes a summary batch early when its texts get this long,
+// so a batch stays well inside the generation model's context
+const maxBatchChars = 12000
+
+// Batched summarizes with Ollama, writing the topic labels of Size texts
+// at a time with one prompt. For corpora of many short chunks, where each
+// prompt costs more in overhead than in text, this cuts the summary stage
+// several-fold. Texts lists the texts to be summarized in processing order,
+// which sets the batches: the first Summarize of a batch summarizes all of
+// it, and the others wait for it. A batch whose reply can't be parsed, and
+// text outside Texts, are summarized one at a time. Longer summary styles
+// are still generated per chunk.
+type Batched struct {
+	*Ollama
+
+	Texts []string
+	// Size is how many texts share a prompt (default 10)
+	Size int
+
+	once    sync.Once
+	batches map[string]*summaryBatch
+}
+
+// summaryBatch is a group of texts summarized together
+type summaryBatch struct {
+	texts     []string
+	once      sync.Once
+	summaries map[string]string
+}
+
+// Summarize implements Summarizer
+func (b *Batched) Summarize(ctx context.Context, text string) (string, error) {
+	b.once.Do(b.group)
+	batch, ok := b.batches[text]
+	if !ok {
+		return b.Ollama.Summarize(ctx, text)
+	}
+
+	batch.once.Do(func() {
+		summaries, err := b.Client.GetSummaryBatch(batch.texts)
+		if err != nil {
+			return
+		}
+		batch.summaries = make(map[string]string, len(summaries))
+		for i, summary := range summaries {
+			batch.summaries[batch.texts[i]] = summary
+		}
+	})
+	if summary, ok := batch.summaries[text]; ok {
+		return summary, nil
+	}
+	return b.Ollama.Summarize(ctx, text)
+}
+
+// group splits Texts into batches, each text in only one of them
+func (b *Batched) group() {
+	size := b.Size
+	if size <= 0 {
+		size = 10
+	}
+
+	b.batches = make(map[string]*summaryBatch, len(b.Texts))
+	batch, chars := &summaryBatch{}, 0
+	for _, text := range b.Texts {
+		if _, ok := b.batches[text]; ok {
+			continue
+		}
+		if len(batch.texts) == size || (len(batch.texts) > 0 && chars+len(text) > maxBatchChars) {
+			batch, chars = &summaryBatch{}, 0
+		}
+		batch.texts = append(batch.texts, text)
+		chars += len(text)
+		b.batches[text] = batch
+	}
+}
+
+// Hosted embeds text with a hosted embedding API (Cohere, Voyage or Jina)
+// as documents to be searched
+type Hosted struct {
+	Client *embedding.HostedClient
+}
+
+// Check implements Checker by embedding a short text, which fails early on
+// a bad API key, model or dimension setting
+func (h *Hosted) Check(ctx context.Context) error {
+	if _, err := h.Client.GetEmbedding("bluffy"); err != nil {
+		return fmt.Errorf("%s embedding check failed: %w", h.Client.Provider(), err)
+	}
+	return nil
+}
+
+// Embed implements Embedder
+func (h *Hosted) Embed(ctx context.Context, text string) ([]float64, error) {
+	return h.Client.GetEmbedding(text)
+}
+
+// LanguageRouter embeds each text with the embedder registered for its
+// detected language, and with Default for every other language
+type LanguageRouter struct {
+	Default   Embedder
+	Languages map[string]Embedder
+	// Models names the model of each language's embedder, recorded on
+	// the chunks it embeds
+	Models map[string]string
+	// Metric is the similarity metric Similarities scores pairs with
+	// (default cosine)
+	Metric string
+}
+
+// Embed implements Embedder
+func (r *LanguageRouter) Embed(ctx context.Context, text string) ([]float64, error) {
+	if embedder, ok := r.Languages[textproc.DetectLanguage(text)]; ok {
+		return embedder.Embed(ctx, text)
+	}
+	return r.Default.Embed(ctx, text)
+}
+
+// ModelFor implements ModelRouter
+func (r *LanguageRouter) ModelFor(text string) string {
+	return r.Models[textproc.DetectLanguage(text)]
+}
+
+// Check implements Checker by checking every embedder that can be checked
+func (r *LanguageRouter) Check(ctx context.Context) error {
+	embedders := []Embedder{r.Default}
+	for _, embedder := range r.Languages {
+		embedders = append(embedders, embedder)
+	}
+	for _, embedder := range embedders {
+		if checker, ok := embedder.(Checker); ok {
+			if err := checker.Check(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Similarities is a SimilarityStrategy that only compares chunks embedded
+// by the same embedder, since embeddings from different models can't be
+// compared
+func (r *LanguageRouter) Similarities(chunks []database.TextChunk) ([]database.ChunkSimilarity, error) {
+	groups := make(map[string][]database.TextChunk)
+	var order []string
+	for _, chunk := range chunks {
+		group := ""
+		if _, ok := r.Languages[chunk.Language]; ok {
+			group = chunk.Language
+		}
+		if _, ok := groups[group]; !ok {
+			order = append(order, group)
+		}
+		groups[group] = append(groups[group], chunk)
+	}
+
+	var similarities []database.ChunkSimilarity
+	for _, group := range order {
+		groupSimilarities, err := similarity.AllSimilarities(groups[group], r.Metric)
+		if err != nil {
+			return nil, err
+		}
+		similarities = append(similarities, groupSimilarities...)
+	}
+	return similarities, nil
+}
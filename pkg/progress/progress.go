@@ -0,0 +1,195 @@
+// Package progress reports the progress of long-running stages with
+// throughput and estimated time remaining, to a terminal, as plain lines
+// for logs, as JSON lines, or to any function (for example one that emits
+// desktop app events).
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reporter receives progress for a named stage. A stage is finished when
+// completed reaches total. Implementations are safe for concurrent use.
+type Reporter interface {
+	Report(stage string, completed, total int)
+}
+
+// Update is a progress report with the throughput and estimated time
+// remaining derived from when the stage started
+type Update struct {
+	Stage     string
+	Completed int
+	Total     int
+	// Rate is the number of items completed per second
+	Rate    float64
+	Elapsed time.Duration
+	// ETA is zero until a rate is known
+	ETA time.Duration
+}
+
+// Done reports whether the stage is finished
+func (u Update) Done() bool {
+	return u.Completed >= u.Total
+}
+
+// Noop discards all progress
+var Noop Reporter = noop{}
+
+type noop struct{}
+
+func (noop) Report(string, int, int) {}
+
+// Func returns a Reporter that passes each report, with its rate and ETA,
+// to fn
+func Func(fn func(Update)) Reporter {
+	return &tracker{
+		emit:    fn,
+		started: make(map[string]time.Time),
+	}
+}
+
+type tracker struct {
+	mu      sync.Mutex
+	emit    func(Update)
+	started map[string]time.Time
+}
+
+func (t *tracker) Report(stage string, completed, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	start, ok := t.started[stage]
+	if !ok {
+		start = now
+		t.started[stage] = now
+	}
+
+	update := Update{
+		Stage:     stage,
+		Completed: completed,
+		Total:     total,
+		Elapsed:   now.Sub(start),
+	}
+	if seconds := update.Elapsed.Seconds(); seconds > 0 && completed > 0 {
+		update.Rate = float64(completed) / seconds
+		update.ETA = time.Duration(float64(total-completed) / update.Rate * float64(time.Second))
+	}
+	if update.Done() {
+		// A later stage with the same name starts its clock afresh
+		delete(t.started, stage)
+	}
+
+	t.emit(update)
+}
+
+// Terminal returns a Reporter that redraws a progress bar with rate and ETA
+// on a single line of w, moving to a new line when a stage finishes
+func Terminal(w io.Writer) Reporter {
+	return Func(func(u Update) {
+		const width = 50
+		fraction := 0.0
+		if u.Total > 0 {
+			fraction = float64(u.Completed) / float64(u.Total)
+		}
+		filled := int(fraction * width)
+		bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+
+		line := fmt.Sprintf("\r%s: [%s] %d/%d (%.1f%%)", u.Stage, bar, u.Completed, u.Total, fraction*100)
+		if u.Rate > 0 {
+			line += fmt.Sprintf(" %.1f/s", u.Rate)
+			if !u.Done() {
+				line += " ETA " + formatDuration(u.ETA)
+			}
+		}
+		if u.Done() {
+			line += " in " + formatDuration(u.Elapsed)
+		}
+		// Trailing spaces clear what is left of a longer previous line
+		line += "   "
+		if u.Done() {
+			line += "\n"
+		}
+		fmt.Fprint(w, line)
+	})
+}
+
+// Plain returns a Reporter that writes a line to w each time a stage
+// passes another tenth of its total and when it finishes, without the
+// carriage returns and block characters of Terminal, for logs and CI
+func Plain(w io.Writer) Reporter {
+	// Reports are passed on one at a time, so tenths needs no lock
+	tenths := make(map[string]int)
+	return Func(func(u Update) {
+		tenth := 0
+		if u.Total > 0 {
+			tenth = u.Completed * 10 / u.Total
+		}
+		if last, ok := tenths[u.Stage]; ok && tenth <= last && !u.Done() {
+			return
+		}
+		if u.Done() {
+			delete(tenths, u.Stage)
+		} else {
+			tenths[u.Stage] = tenth
+		}
+
+		percent := 100.0
+		if u.Total > 0 {
+			percent = float64(u.Completed) / float64(u.Total) * 100
+		}
+		line := fmt.Sprintf("%s: %d/%d (%.0f%%)", u.Stage, u.Completed, u.Total, percent)
+		if u.Rate > 0 {
+			line += fmt.Sprintf(" %.1f/s", u.Rate)
+			if !u.Done() {
+				line += " ETA " + formatDuration(u.ETA)
+			}
+		}
+		if u.Done() {
+			line += " in " + formatDuration(u.Elapsed)
+		}
+		fmt.Fprintln(w, line)
+	})
+}
+
+type jsonUpdate struct {
+	Stage          string  `json:"stage"`
+	Completed      int     `json:"completed"`
+	Total          int     `json:"total"`
+	Rate           float64 `json:"rate"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	ETASeconds     float64 `json:"eta_seconds"`
+}
+
+// JSONLines returns a Reporter that writes each report to w as a JSON
+// object on its own line
+func JSONLines(w io.Writer) Reporter {
+	encoder := json.NewEncoder(w)
+	return Func(func(u Update) {
+		encoder.Encode(jsonUpdate{
+			Stage:          u.Stage,
+			Completed:      u.Completed,
+			Total:          u.Total,
+			Rate:           u.Rate,
+			ElapsedSeconds: u.Elapsed.Seconds(),
+			ETASeconds:     u.ETA.Seconds(),
+		})
+	})
+}
+
+// formatDuration renders d rounded to the second, e.g. "1m05s"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
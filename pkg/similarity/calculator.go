@@ -3,10 +3,37 @@ package similarity
 import (
 	"fmt"
 	"math"
+	"strings"
 
 	"github.com/jcpsimmons/bluffy/pkg/database"
 )
 
+// Similarity metrics. The similarity column holds the metric's score and
+// the distance column always the Euclidean distance.
+const (
+	// MetricCosine is the cosine of the angle between two embeddings
+	MetricCosine = "cosine"
+	// MetricDot is the dot product, which equals the cosine for unit-length
+	// embeddings and also weighs their length otherwise
+	MetricDot = "dot"
+	// MetricEuclidean is 1 / (1 + distance), so closer chunks score higher
+	// and identical ones score 1
+	MetricEuclidean = "euclidean"
+)
+
+// Metrics lists the valid similarity metrics
+var Metrics = []string{MetricCosine, MetricDot, MetricEuclidean}
+
+// ValidateMetric returns an error naming the valid metrics if metric is
+// not one of them. The empty string stands for MetricCosine.
+func ValidateMetric(metric string) error {
+	switch metric {
+	case "", MetricCosine, MetricDot, MetricEuclidean:
+		return nil
+	}
+	return fmt.Errorf("unknown similarity metric %q (valid metrics: %s)", metric, strings.Join(Metrics, ", "))
+}
+
 func CosineSimilarity(a, b []float64) (float64, error) {
 	if len(a) != len(b) {
 		return 0, fmt.Errorf("vectors must have the same length: %d vs %d", len(a), len(b))
@@ -30,6 +57,78 @@ func CosineSimilarity(a, b []float64) (float64, error) {
 	return dotProduct / (normA * normB), nil
 }
 
+// Normalize returns v scaled to unit length. A zero vector is returned as
+// is.
+func Normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+
+	unit := make([]float64, len(v))
+	for i, x := range v {
+		unit[i] = x / norm
+	}
+	return unit
+}
+
+// UnitSimilarity returns the cosine similarity and Euclidean distance of
+// two unit-length vectors in one pass: the similarity is their dot product,
+// and the distance follows from it.
+func UnitSimilarity(a, b []float64) (float64, float64, error) {
+	if len(a) != len(b) {
+		return 0, 0, fmt.Errorf("vectors must have the same length: %d vs %d", len(a), len(b))
+	}
+
+	var dotProduct float64
+	for i := 0; i < len(a); i++ {
+		dotProduct += a[i] * b[i]
+	}
+
+	// Rounding can push the dot product of near-identical vectors just
+	// past 1
+	return dotProduct, math.Sqrt(math.Max(0, 2-2*dotProduct)), nil
+}
+
+// DotProduct returns the dot product of two vectors
+func DotProduct(a, b []float64) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors must have the same length: %d vs %d", len(a), len(b))
+	}
+
+	var dotProduct float64
+	for i := 0; i < len(a); i++ {
+		dotProduct += a[i] * b[i]
+	}
+	return dotProduct, nil
+}
+
+// Score returns the similarity of two vectors by metric, and their
+// Euclidean distance
+func Score(metric string, a, b []float64) (float64, float64, error) {
+	distance, err := EuclideanDistance(a, b)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var score float64
+	switch metric {
+	case "", MetricCosine:
+		score, err = CosineSimilarity(a, b)
+	case MetricDot:
+		score, err = DotProduct(a, b)
+	case MetricEuclidean:
+		score = 1 / (1 + distance)
+	default:
+		err = ValidateMetric(metric)
+	}
+	return score, distance, err
+}
+
 func EuclideanDistance(a, b []float64) (float64, error) {
 	if len(a) != len(b) {
 		return 0, fmt.Errorf("vectors must have the same length: %d vs %d", len(a), len(b))
@@ -74,4 +173,99 @@ func CalculateAllSimilarities(chunks []database.TextChunk) ([]database.ChunkSimi
 	}
 
 	return similarities, nil
-}
\ No newline at end of file
+}
+
+// CalculateSimilaritiesTo compares one chunk against every other chunk,
+// skipping itself. Each result lists the other chunk as ChunkID1.
+func CalculateSimilaritiesTo(chunk database.TextChunk, others []database.TextChunk) ([]database.ChunkSimilarity, error) {
+	var similarities []database.ChunkSimilarity
+
+	for _, other := range others {
+		if other.ID == chunk.ID {
+			continue
+		}
+
+		distance, err := EuclideanDistance(other.Embedding, chunk.Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate distance between chunks %d and %d: %w", other.ID, chunk.ID, err)
+		}
+
+		cosineSim, err := CosineSimilarity(other.Embedding, chunk.Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate similarity between chunks %d and %d: %w", other.ID, chunk.ID, err)
+		}
+
+		similarities = append(similarities, database.ChunkSimilarity{
+			ChunkID1:   other.ID,
+			ChunkID2:   chunk.ID,
+			Distance:   distance,
+			Similarity: cosineSim,
+		})
+	}
+
+	return similarities, nil
+}
+
+// UnitSimilaritiesTo is CalculateSimilaritiesTo for embeddings normalized
+// to unit length, which only need a dot product per pair
+func UnitSimilaritiesTo(chunk database.TextChunk, others []database.TextChunk) ([]database.ChunkSimilarity, error) {
+	var similarities []database.ChunkSimilarity
+
+	for _, other := range others {
+		if other.ID == chunk.ID {
+			continue
+		}
+
+		sim, distance, err := UnitSimilarity(other.Embedding, chunk.Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate similarity between chunks %d and %d: %w", other.ID, chunk.ID, err)
+		}
+
+		similarities = append(similarities, database.ChunkSimilarity{
+			ChunkID1:   other.ID,
+			ChunkID2:   chunk.ID,
+			Distance:   distance,
+			Similarity: sim,
+		})
+	}
+
+	return similarities, nil
+}
+
+// SimilaritiesTo is CalculateSimilaritiesTo scoring by metric
+func SimilaritiesTo(chunk database.TextChunk, others []database.TextChunk, metric string) ([]database.ChunkSimilarity, error) {
+	var similarities []database.ChunkSimilarity
+
+	for _, other := range others {
+		if other.ID == chunk.ID {
+			continue
+		}
+
+		score, distance, err := Score(metric, other.Embedding, chunk.Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate similarity between chunks %d and %d: %w", other.ID, chunk.ID, err)
+		}
+
+		similarities = append(similarities, database.ChunkSimilarity{
+			ChunkID1:   other.ID,
+			ChunkID2:   chunk.ID,
+			Distance:   distance,
+			Similarity: score,
+		})
+	}
+
+	return similarities, nil
+}
+
+// AllSimilarities is CalculateAllSimilarities scoring by metric
+func AllSimilarities(chunks []database.TextChunk, metric string) ([]database.ChunkSimilarity, error) {
+	var similarities []database.ChunkSimilarity
+	for i, chunk := range chunks {
+		chunkSimilarities, err := SimilaritiesTo(chunk, chunks[:i], metric)
+		if err != nil {
+			return nil, err
+		}
+		similarities = append(similarities, chunkSimilarities...)
+	}
+	return similarities, nil
+}
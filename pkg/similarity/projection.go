@@ -0,0 +1,326 @@
+package similarity
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// maxPCASample bounds the number of embeddings the principal components
+// are fitted on. The covariance of a sample this large is already close to
+// that of the whole corpus, and fitting grows with the sample size.
+const maxPCASample = 10000
+
+// pcaIterations and pcaTolerance stop the subspace iteration once the
+// variance the components capture stops growing
+const (
+	pcaIterations = 100
+	pcaTolerance  = 1e-7
+)
+
+// FitPCA fits a projection of embeddings onto their first dimensions
+// principal components: the directions of greatest variance, found by
+// subspace iteration on their covariance matrix. Corpora larger than
+// maxPCASample are fitted on an evenly spaced sample.
+func FitPCA(embeddings [][]float64, dimensions int) (*database.Projection, error) {
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings to fit a projection on")
+	}
+	source := len(embeddings[0])
+	for _, embedding := range embeddings {
+		if len(embedding) != source {
+			return nil, fmt.Errorf("embeddings have different lengths (%d and %d); embed every chunk with the same model first", source, len(embedding))
+		}
+	}
+	if dimensions <= 0 || dimensions >= source {
+		return nil, fmt.Errorf("dimensions must be between 1 and %d, the length of the embeddings, got %d", source-1, dimensions)
+	}
+
+	sample := embeddings
+	if len(sample) > maxPCASample {
+		sample = make([][]float64, maxPCASample)
+		for i := range sample {
+			sample[i] = embeddings[i*len(embeddings)/maxPCASample]
+		}
+	}
+	if dimensions >= len(sample) {
+		return nil, fmt.Errorf("fitting %d dimensions needs more than %d embeddings", dimensions, len(sample))
+	}
+
+	mean := make([]float64, source)
+	for _, embedding := range sample {
+		for j, value := range embedding {
+			mean[j] += value
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(sample))
+	}
+
+	cov := covariance(sample, mean)
+	var total float64
+	for i := range cov {
+		total += cov[i][i]
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("every embedding is the same; there is no variance to keep")
+	}
+
+	basis := subspaceIteration(cov, dimensions)
+	values, components := rayleighRitz(cov, basis)
+
+	var kept float64
+	for _, value := range values {
+		kept += math.Max(value, 0)
+	}
+	return &database.Projection{
+		SourceDimensions:  source,
+		Mean:              mean,
+		Components:        components,
+		ExplainedVariance: math.Min(kept/total, 1),
+		FittedChunks:      len(sample),
+	}, nil
+}
+
+// covariance returns the covariance matrix of vectors around mean. Rows
+// are divided among the CPUs.
+func covariance(vectors [][]float64, mean []float64) [][]float64 {
+	n := len(mean)
+	centered := make([][]float64, len(vectors))
+	for i, vector := range vectors {
+		centered[i] = make([]float64, n)
+		for j, value := range vector {
+			centered[i][j] = value - mean[j]
+		}
+	}
+
+	cov := make([][]float64, n)
+	for i := range cov {
+		cov[i] = make([]float64, n)
+	}
+	parallel(n, func(i int) {
+		row := cov[i]
+		for _, x := range centered {
+			xi := x[i]
+			for j := i; j < n; j++ {
+				row[j] += xi * x[j]
+			}
+		}
+	})
+
+	scale := 1 / float64(max(len(vectors)-1, 1))
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			cov[i][j] *= scale
+			cov[j][i] = cov[i][j]
+		}
+	}
+	return cov
+}
+
+// subspaceIteration returns an orthonormal basis of the k-dimensional
+// subspace of greatest variance of the symmetric matrix m
+func subspaceIteration(m [][]float64, k int) [][]float64 {
+	// A fixed seed makes projecting the same database twice give the
+	// same components
+	rng := rand.New(rand.NewSource(1))
+	basis := make([][]float64, k)
+	for i := range basis {
+		basis[i] = randomVector(rng, len(m))
+	}
+	orthonormalize(basis, rng)
+
+	previous := 0.0
+	for iteration := 0; iteration < pcaIterations; iteration++ {
+		next := make([][]float64, k)
+		parallel(k, func(i int) {
+			next[i] = multiply(m, basis[i])
+		})
+
+		// The variance captured by the basis, sum of q^T M q
+		var captured float64
+		for i := range basis {
+			captured += dot(basis[i], next[i])
+		}
+		basis = next
+		orthonormalize(basis, rng)
+		if iteration > 0 && math.Abs(captured-previous) <= pcaTolerance*math.Abs(captured) {
+			break
+		}
+		previous = captured
+	}
+	return basis
+}
+
+// rayleighRitz rotates the orthonormal basis into the eigenvectors of m
+// within its span, returned with their eigenvalues, largest first
+func rayleighRitz(m [][]float64, basis [][]float64) ([]float64, [][]float64) {
+	k := len(basis)
+	mb := make([][]float64, k)
+	parallel(k, func(i int) {
+		mb[i] = multiply(m, basis[i])
+	})
+	h := make([][]float64, k)
+	for i := range h {
+		h[i] = make([]float64, k)
+		for j := range h[i] {
+			h[i][j] = dot(basis[i], mb[j])
+		}
+	}
+
+	values, vectors := jacobiEigen(h)
+	order := make([]int, k)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return values[order[a]] > values[order[b]]
+	})
+
+	sortedValues := make([]float64, k)
+	components := make([][]float64, k)
+	for rank, col := range order {
+		sortedValues[rank] = values[col]
+		component := make([]float64, len(m))
+		for i := range basis {
+			weight := vectors[i][col]
+			for j, value := range basis[i] {
+				component[j] += weight * value
+			}
+		}
+		components[rank] = component
+	}
+	return sortedValues, components
+}
+
+// jacobiEigen returns the eigenvalues of the symmetric matrix a and the
+// matrix whose columns are their eigenvectors, by cyclic Jacobi rotations
+func jacobiEigen(a [][]float64) ([]float64, [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	v := make([][]float64, n)
+	for i := range m {
+		m[i] = append([]float64(nil), a[i]...)
+		v[i] = make([]float64, n)
+		v[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		var off, diagonal float64
+		for p := 0; p < n; p++ {
+			diagonal += m[p][p] * m[p][p]
+			for q := p + 1; q < n; q++ {
+				off += m[p][q] * m[p][q]
+			}
+		}
+		if off <= 1e-30*diagonal {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if m[p][q] == 0 {
+					continue
+				}
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = m[i][i]
+	}
+	return values, v
+}
+
+// orthonormalize makes vectors orthonormal in place by modified
+// Gram-Schmidt, replacing vectors that vanish (when the matrix has lower
+// rank) with random ones
+func orthonormalize(vectors [][]float64, rng *rand.Rand) {
+	for i := range vectors {
+		for attempt := 0; ; attempt++ {
+			for j := 0; j < i; j++ {
+				projection := dot(vectors[i], vectors[j])
+				for k := range vectors[i] {
+					vectors[i][k] -= projection * vectors[j][k]
+				}
+			}
+			norm := math.Sqrt(dot(vectors[i], vectors[i]))
+			if norm > 1e-12 || attempt == 3 {
+				for k := range vectors[i] {
+					vectors[i][k] /= norm
+				}
+				break
+			}
+			vectors[i] = randomVector(rng, len(vectors[i]))
+		}
+	}
+}
+
+func randomVector(rng *rand.Rand, n int) []float64 {
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = rng.NormFloat64()
+	}
+	return v
+}
+
+func multiply(m [][]float64, v []float64) []float64 {
+	result := make([]float64, len(m))
+	for i, row := range m {
+		result[i] = dot(row, v)
+	}
+	return result
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// parallel calls f for 0 through n-1 on every CPU
+func parallel(n int, f func(i int)) {
+	workers := min(runtime.NumCPU(), n)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Interleaved, since the rows of a triangle differ in length
+			for i := w; i < n; i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
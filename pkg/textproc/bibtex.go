@@ -0,0 +1,484 @@
+package textproc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BibEntry is one entry of a BibTeX or BibLaTeX bibliography, such as a
+// Zotero export
+type BibEntry struct {
+	// Type is the entry type in lower case, e.g. article or book
+	Type string
+	Key  string
+	// Fields maps lower-case field names to their values with macros and
+	// concatenations resolved but LaTeX left in; Field converts them to
+	// text
+	Fields map[string]string
+}
+
+// bibMonths are the month macros every BibTeX style defines
+var bibMonths = map[string]string{
+	"jan": "1", "feb": "2", "mar": "3", "apr": "4", "may": "5", "jun": "6",
+	"jul": "7", "aug": "8", "sep": "9", "oct": "10", "nov": "11", "dec": "12",
+}
+
+// ReadBibTeX reads the entries of a .bib file
+func ReadBibTeX(filename string) ([]BibEntry, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ParseBibTeX(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return entries, nil
+}
+
+// ParseBibTeX returns the entries of a bibliography in the order they
+// appear. @string macros are expanded; @comment and @preamble are skipped,
+// as is text outside entries, which BibTeX treats as a comment.
+func ParseBibTeX(source string) ([]BibEntry, error) {
+	p := &bibParser{source: source, macros: make(map[string]string)}
+	for name, month := range bibMonths {
+		p.macros[name] = month
+	}
+
+	var entries []BibEntry
+	seen := make(map[string]bool)
+	for {
+		at := strings.IndexByte(p.source[p.pos:], '@')
+		if at < 0 {
+			return entries, nil
+		}
+		p.pos += at + 1
+		kind := strings.ToLower(p.identifier())
+		p.skipSpace()
+		if p.pos >= len(p.source) || (p.source[p.pos] != '{' && p.source[p.pos] != '(') {
+			continue
+		}
+		close := byte('}')
+		if p.source[p.pos] == '(' {
+			close = ')'
+		}
+		start := p.pos
+		p.pos++
+
+		switch kind {
+		case "comment":
+			if close == ')' {
+				if end := strings.IndexByte(p.source[p.pos:], ')'); end >= 0 {
+					p.pos += end + 1
+				} else {
+					p.pos = len(p.source)
+				}
+				continue
+			}
+			p.pos = start
+			p.skipBalanced()
+		case "preamble":
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+			p.expect(close)
+		case "string":
+			p.skipSpace()
+			name := strings.ToLower(p.identifier())
+			p.skipSpace()
+			if !p.expect('=') {
+				return nil, p.errorf("expected = after @string name %q", name)
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			p.macros[name] = value
+			p.expect(close)
+		default:
+			entry, err := p.entry(kind, close)
+			if err != nil {
+				return nil, err
+			}
+			if seen[entry.Key] {
+				return nil, p.errorf("duplicate citation key %q", entry.Key)
+			}
+			seen[entry.Key] = true
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// bibParser reads a bibliography from pos onwards
+type bibParser struct {
+	source string
+	pos    int
+	macros map[string]string
+}
+
+func (p *bibParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.source[:min(p.pos, len(p.source))], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *bibParser) skipSpace() {
+	for p.pos < len(p.source) && strings.IndexByte(" \t\r\n", p.source[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// expect consumes c, after any space, if it comes next
+func (p *bibParser) expect(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.source) && p.source[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// identifier reads an entry type, key, field or macro name
+func (p *bibParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.source) && strings.IndexByte(" \t\r\n{}()=,#\"", p.source[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.source[start:p.pos]
+}
+
+// skipBalanced skips a brace group starting at pos
+func (p *bibParser) skipBalanced() {
+	if end := matchingBrace(p.source, p.pos); end >= 0 {
+		p.pos = end + 1
+		return
+	}
+	p.pos = len(p.source)
+}
+
+func (p *bibParser) entry(kind string, close byte) (BibEntry, error) {
+	entry := BibEntry{Type: kind, Fields: make(map[string]string)}
+	p.skipSpace()
+	entry.Key = strings.TrimSpace(p.identifier())
+	if entry.Key == "" {
+		return entry, p.errorf("@%s entry has no citation key", kind)
+	}
+
+	for {
+		p.skipSpace()
+		if p.expect(close) {
+			return entry, nil
+		}
+		if !p.expect(',') {
+			return entry, p.errorf("expected , or %c in entry %q", close, entry.Key)
+		}
+		p.skipSpace()
+		if p.expect(close) {
+			return entry, nil
+		}
+		name := strings.ToLower(p.identifier())
+		if name == "" {
+			return entry, p.errorf("expected a field name in entry %q", entry.Key)
+		}
+		if !p.expect('=') {
+			return entry, p.errorf("expected = after field %q in entry %q", name, entry.Key)
+		}
+		value, err := p.value()
+		if err != nil {
+			return entry, err
+		}
+		entry.Fields[name] = value
+	}
+}
+
+// value reads a field value: braced or quoted strings, numbers and macros,
+// joined with #
+func (p *bibParser) value() (string, error) {
+	var b strings.Builder
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.source) {
+			return "", p.errorf("unexpected end of file in a field value")
+		}
+		switch c := p.source[p.pos]; c {
+		case '{':
+			end := matchingBrace(p.source, p.pos)
+			if end < 0 {
+				return "", p.errorf("unbalanced braces in a field value")
+			}
+			b.WriteString(p.source[p.pos+1 : end])
+			p.pos = end + 1
+		case '"':
+			end := p.pos + 1
+			for depth := 0; end < len(p.source); end++ {
+				if p.source[end] == '{' {
+					depth++
+				} else if p.source[end] == '}' {
+					depth--
+				} else if p.source[end] == '"' && depth == 0 && p.source[end-1] != '\\' {
+					break
+				}
+			}
+			if end >= len(p.source) {
+				return "", p.errorf("unterminated quoted field value")
+			}
+			b.WriteString(p.source[p.pos+1 : end])
+			p.pos = end + 1
+		default:
+			name := p.identifier()
+			if name == "" {
+				return "", p.errorf("unexpected %q in a field value", c)
+			}
+			if macro, ok := p.macros[strings.ToLower(name)]; ok {
+				b.WriteString(macro)
+			} else {
+				b.WriteString(name)
+			}
+		}
+		if !p.expect('#') {
+			return b.String(), nil
+		}
+	}
+}
+
+// bibVerbatimFields hold identifiers rather than text, which only have
+// special characters escaped
+var bibVerbatimFields = map[string]bool{"doi": true, "url": true, "eprint": true, "isbn": true, "issn": true}
+
+// bibUnescaper undoes the escapes exporters add to verbatim fields
+var bibUnescaper = strings.NewReplacer(`\_`, "_", `\%`, "%", `\&`, "&", `\#`, "#", `\$`, "$", `\~`, "~", `{`, "", `}`, "")
+
+// Field returns a field as plain text, with LaTeX commands and protective
+// braces removed and accents applied
+func (e BibEntry) Field(name string) string {
+	value, ok := e.Fields[name]
+	if !ok {
+		return ""
+	}
+	if bibVerbatimFields[name] {
+		return strings.TrimSpace(bibUnescaper.Replace(value))
+	}
+	return bibText(value)
+}
+
+// bibText converts a field value to plain text
+func bibText(value string) string {
+	return strings.Join(strings.Fields(latexText(bibAccented(value))), " ")
+}
+
+// bibAccentMarks maps LaTeX accent commands to Unicode combining marks
+var bibAccentMarks = map[string]string{
+	`"`: "\u0308", "'": "\u0301", "`": "\u0300", "^": "\u0302", "~": "\u0303", "=": "\u0304", ".": "\u0307",
+	"c": "\u0327", "v": "\u030c", "u": "\u0306", "H": "\u030b", "k": "\u0328", "r": "\u030a",
+}
+
+// bibLetters maps LaTeX commands for letters to the letters
+var bibLetters = map[string]string{
+	"ss": "ß", "o": "ø", "O": "Ø", "aa": "å", "AA": "Å", "ae": "æ", "AE": "Æ",
+	"oe": "œ", "OE": "Œ", "l": "ł", "L": "Ł", "i": "i", "j": "j",
+}
+
+// bibAccentRegex matches an accented letter such as \"o, \"{o}, \c{c} or
+// \c c, and bibLetterRegex a letter command such as \ss or {\o}
+var (
+	bibAccentRegex = regexp.MustCompile(`\\(["'` + "`" + `^~=.])\s*\{?\\?([A-Za-z])\}?|\\([cvuHkr])(?:\{\\?([A-Za-z])\}|\s+([A-Za-z]))`)
+	bibLetterRegex = regexp.MustCompile(`\\(ss|aa|AA|ae|AE|oe|OE|o|O|l|L|i|j)(?:\{\}|\s+|\b)`)
+)
+
+// bibAccented replaces LaTeX accents and letter commands, which latexText
+// drops, with the Unicode letters they stand for, so names such as
+// M{\"u}ller keep their umlaut
+func bibAccented(value string) string {
+	value = bibAccentRegex.ReplaceAllStringFunc(value, func(match string) string {
+		groups := bibAccentRegex.FindStringSubmatch(match)
+		if groups[1] != "" {
+			return groups[2] + bibAccentMarks[groups[1]]
+		}
+		return groups[4] + groups[5] + bibAccentMarks[groups[3]]
+	})
+	value = bibLetterRegex.ReplaceAllStringFunc(value, func(match string) string {
+		return bibLetters[bibLetterRegex.FindStringSubmatch(match)[1]]
+	})
+	return norm.NFC.String(value)
+}
+
+// Authors returns the authors, or the editors of an entry without
+// authors, as "First Last". Corporate authors in braces are kept whole.
+func (e BibEntry) Authors() []string {
+	value, ok := e.Fields["author"]
+	if !ok {
+		value = e.Fields["editor"]
+	}
+
+	var authors []string
+	for _, name := range splitBibNames(value) {
+		if name = bibName(name); name != "" && !strings.EqualFold(name, "others") {
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+// bibAndRegex separates the names of an author list
+var bibAndRegex = regexp.MustCompile(`(?i)\s+and\s+`)
+
+// splitBibNames splits an author list at "and", except inside braces
+func splitBibNames(value string) []string {
+	var names []string
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		default:
+			if depth != 0 {
+				continue
+			}
+			if loc := bibAndRegex.FindStringIndex(value[i:]); loc != nil && loc[0] == 0 {
+				names = append(names, value[start:i])
+				i += loc[1] - 1
+				start = i + 1
+			}
+		}
+	}
+	return append(names, value[start:])
+}
+
+// bibName converts one BibTeX name, "Last, First" or "First Last", to
+// "First Last" text
+func bibName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "{") && matchingBrace(name, 0) == len(name)-1 {
+		// {World Health Organization} is one name, not first and last
+		return bibText(name[1 : len(name)-1])
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(name[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, strings.TrimSpace(name[start:]))
+
+	switch len(parts) {
+	case 2:
+		// Last, First
+		name = parts[1] + " " + parts[0]
+	case 3:
+		// Last, Jr, First
+		name = parts[2] + " " + parts[0] + ", " + parts[1]
+	}
+	return bibText(name)
+}
+
+// bibYearRegex finds the year in a BibLaTeX date such as 2020-05-01
+var bibYearRegex = regexp.MustCompile(`\b\d{4}\b`)
+
+// Year returns the year field, or the year of the BibLaTeX date field
+func (e BibEntry) Year() string {
+	if year := e.Field("year"); year != "" {
+		return year
+	}
+	return bibYearRegex.FindString(e.Field("date"))
+}
+
+// Attachments returns the file paths in the file field, as written. Zotero
+// and JabRef write "description:path:mime type" items separated by
+// semicolons, escaping colons and semicolons in paths with a backslash;
+// other tools write bare paths.
+func (e BibEntry) Attachments() []string {
+	value, ok := e.Fields["file"]
+	if !ok {
+		return nil
+	}
+
+	var items [][]string
+	var part strings.Builder
+	item := []string{}
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && i+1 < len(value) && (value[i+1] == ':' || value[i+1] == ';' || value[i+1] == '\\'):
+			part.WriteByte(value[i+1])
+			i++
+		case c == ':':
+			item = append(item, part.String())
+			part.Reset()
+		case c == ';':
+			items = append(items, append(item, part.String()))
+			item = []string{}
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	items = append(items, append(item, part.String()))
+
+	var paths []string
+	for _, item := range items {
+		var path string
+		switch {
+		case len(item) >= 3:
+			// A Windows drive letter adds a part: desc:C:\path:mime
+			path = strings.Join(item[1:len(item)-1], ":")
+		case len(item) == 2 && len(item[0]) == 1:
+			// A bare Windows path
+			path = item[0] + ":" + item[1]
+		default:
+			path = strings.Join(item, ":")
+		}
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Metadata returns the entry's title, date and keywords along with its
+// citation record, to be stored with the run of its document
+func (e BibEntry) Metadata() *database.DocumentMetadata {
+	citation := &database.Citation{
+		Key:     e.Key,
+		Type:    e.Type,
+		Authors: e.Authors(),
+		Year:    e.Year(),
+		DOI:     e.Field("doi"),
+		URL:     e.Field("url"),
+	}
+	for _, field := range []string{"journal", "journaltitle", "booktitle", "publisher", "school", "institution"} {
+		if venue := e.Field(field); venue != "" {
+			citation.Venue = venue
+			break
+		}
+	}
+
+	metadata := &database.DocumentMetadata{
+		Title:    e.Field("title"),
+		Date:     e.Field("date"),
+		Citation: citation,
+	}
+	if metadata.Date == "" {
+		metadata.Date = citation.Year
+	}
+	for _, keyword := range strings.FieldsFunc(e.Field("keywords"), func(r rune) bool { return r == ',' || r == ';' }) {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			metadata.Tags = append(metadata.Tags, keyword)
+		}
+	}
+	return metadata
+}
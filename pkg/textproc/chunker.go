@@ -1,15 +1,63 @@
 package textproc
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/jcpsimmons/bluffy/pkg/database"
 	"github.com/tmc/langchaingo/textsplitter"
 )
 
+// ChunkOptions controls how text is split into chunks. Size and Overlap are
+// measured in characters.
+type ChunkOptions struct {
+	Size    int
+	Overlap int
+	// Window chunks transcripts by fixed time windows instead of speaker
+	// turns when set
+	Window time.Duration
+	// NotebookCode chunks the code cells of Jupyter notebooks too, as
+	// chunks of kind code; otherwise only markdown cells are read
+	NotebookCode bool
+}
+
+// DefaultChunkOptions keeps chunks a bit under nomic-embed-text's 8192 token
+// context, with 10% overlap
+var DefaultChunkOptions = ChunkOptions{Size: 7500, Overlap: 750}
+
+// Validate checks that the options describe a usable splitter
+func (o ChunkOptions) Validate() error {
+	if o.Size <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", o.Size)
+	}
+	if o.Overlap < 0 || o.Overlap >= o.Size {
+		return fmt.Errorf("chunk overlap must be between 0 and the chunk size (%d), got %d", o.Size, o.Overlap)
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("transcript window must not be negative, got %s", o.Window)
+	}
+	return nil
+}
+
 func ChunkTextByParagraphs(filename string) ([]database.TextChunk, error) {
+	if IsTranscript(DocumentFormat(filename)) {
+		cues, err := ExtractCues(filename)
+		if err != nil {
+			return nil, err
+		}
+		return chunkCues(cues, DefaultChunkOptions), nil
+	}
+	if DocumentFormat(filename) != FormatText {
+		sections, err := ExtractSections(filename)
+		if err != nil {
+			return nil, err
+		}
+		return chunkSections(sections, DefaultChunkOptions)
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
@@ -23,10 +71,19 @@ func ChunkTextByParagraphs(filename string) ([]database.TextChunk, error) {
 	}
 
 	text := string(content)
-	return chunkTextWithSplitter(text)
+	return chunkTextWithSplitter(text, DefaultChunkOptions)
 }
 
-func chunkTextWithSplitter(text string) ([]database.TextChunk, error) {
+// ChunkText splits text that did not come from a file, such as text
+// submitted through the API
+func ChunkText(text string, opts ChunkOptions) ([]database.TextChunk, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return chunkTextWithSplitter(text, opts)
+}
+
+func chunkTextWithSplitter(text string, opts ChunkOptions) ([]database.TextChunk, error) {
 	// Clean up the text
 	text = strings.TrimSpace(text)
 	if len(text) == 0 {
@@ -35,18 +92,18 @@ func chunkTextWithSplitter(text string) ([]database.TextChunk, error) {
 
 	// Create a recursive character text splitter
 	splitter := textsplitter.NewRecursiveCharacter(
-		textsplitter.WithChunkSize(7500),        // A bit under 8192 for safety
-		textsplitter.WithChunkOverlap(750),      // 10% overlap (750 chars)
-		textsplitter.WithSeparators([]string{    // Custom separators for better text splitting
-			"\n\n",    // Paragraph breaks
-			"\n",      // Line breaks
-			". ",      // Sentence endings
+		textsplitter.WithChunkSize(opts.Size),
+		textsplitter.WithChunkOverlap(opts.Overlap),
+		textsplitter.WithSeparators([]string{ // Custom separators for better text splitting
+			"\n\n", // Paragraph breaks
+			"\n",   // Line breaks
+			". ",   // Sentence endings
 			"! ",
 			"? ",
-			"; ",      // Clause separators
-			", ",      // Comma separators
-			" ",       // Word boundaries
-			"",        // Character level (fallback)
+			"; ", // Clause separators
+			", ", // Comma separators
+			" ",  // Word boundaries
+			"",   // Character level (fallback)
 		}),
 	)
 
@@ -69,4 +126,23 @@ func chunkTextWithSplitter(text string) ([]database.TextChunk, error) {
 	}
 
 	return chunks, nil
-}
\ No newline at end of file
+}
+
+// chunkSections chunks each section separately so no chunk spans a section
+// boundary, and records the section title on every chunk
+func chunkSections(sections []Section, opts ChunkOptions) ([]database.TextChunk, error) {
+	var chunks []database.TextChunk
+	for _, section := range sections {
+		sectionChunks, err := chunkTextWithSplitter(section.Text, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range sectionChunks {
+			chunk.ChunkIndex = len(chunks)
+			chunk.Section = section.Title
+			chunk.Kind = section.Kind
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,172 @@
+package textproc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Citation kinds recognized by ExtractCitations
+const (
+	CitationKindDOI        = "doi"
+	CitationKindArxiv      = "arxiv"
+	CitationKindAuthorYear = "author-year"
+	CitationKindNumeric    = "numeric"
+)
+
+// maxCitingChunks caps how many chunks a single citation can link together.
+// Keys cited everywhere (a textbook everyone references) would otherwise
+// produce a quadratic number of edges that say nothing useful.
+const maxCitingChunks = 50
+
+// maxNumericRange guards against expanding things like [1-2000] that are not
+// really citation markers
+const maxNumericRange = 50
+
+var (
+	doiRegex         = regexp.MustCompile(`\b10\.\d{4,9}/[-._;()/:A-Za-z0-9]+`)
+	arxivRegex       = regexp.MustCompile(`(?i)\barxiv:\s*(\d{4}\.\d{4,5})(?:v\d+)?`)
+	parentheticRegex = regexp.MustCompile(`\(([^()]*\d{4}[a-z]?[^()]*)\)`)
+	authorYearRegex  = regexp.MustCompile(`^(?:see |e\.g\.,? |cf\. )?([A-Z][A-Za-z'\-]+)(?:\s+et al\.?|\s+(?:and|&)\s+[A-Z][A-Za-z'\-]+)?,?\s+(\d{4}[a-z]?)\b`)
+	numericRegex     = regexp.MustCompile(`\[(\d+(?:\s*[-–,]\s*\d+)*)\]`)
+)
+
+// ExtractCitations finds DOIs, arXiv identifiers, author-year references such
+// as (Smith et al., 2020), and numeric markers such as [3] or [4-6] in text.
+// Keys are normalized so the same work cited in different chunks matches.
+func ExtractCitations(text string) []database.ChunkCitation {
+	seen := make(map[string]bool)
+	var citations []database.ChunkCitation
+
+	add := func(kind, key string) {
+		if key == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		citations = append(citations, database.ChunkCitation{Key: key, Kind: kind})
+	}
+
+	for _, match := range doiRegex.FindAllString(text, -1) {
+		add(CitationKindDOI, "doi:"+strings.ToLower(strings.TrimRight(match, ".,;:)")))
+	}
+
+	for _, match := range arxivRegex.FindAllStringSubmatch(text, -1) {
+		add(CitationKindArxiv, "arxiv:"+match[1])
+	}
+
+	for _, match := range parentheticRegex.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(match[1], ";") {
+			ref := authorYearRegex.FindStringSubmatch(strings.TrimSpace(part))
+			if ref == nil {
+				continue
+			}
+			add(CitationKindAuthorYear, strings.ToLower(ref[1])+ref[2])
+		}
+	}
+
+	for _, match := range numericRegex.FindAllStringSubmatch(text, -1) {
+		for _, n := range expandNumericMarker(match[1]) {
+			add(CitationKindNumeric, fmt.Sprintf("[%d]", n))
+		}
+	}
+
+	return citations
+}
+
+func expandNumericMarker(marker string) []int {
+	var numbers []int
+	for _, part := range strings.Split(marker, ",") {
+		bounds := strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '–' })
+		if len(bounds) == 0 {
+			continue
+		}
+
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) > 1 {
+			if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				continue
+			}
+		}
+		if end < start || end-start > maxNumericRange {
+			continue
+		}
+
+		for n := start; n <= end; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// CitationEdges links every pair of chunks that cite the same work. Each
+// edge is labeled with the citation key; pairs sharing several citations get
+// one edge per key. DOI, arXiv and author-year keys are matched across the
+// corpus, but numeric markers such as [3] are numbered per document, so they
+// only link chunks of the same run.
+func CitationEdges(citations []database.ChunkCitation) []database.ChunkEdge {
+	type citationGroup struct {
+		key   string
+		runID int
+	}
+
+	byGroup := make(map[citationGroup][]int)
+	for _, citation := range citations {
+		group := citationGroup{key: citation.Key}
+		if citation.Kind == CitationKindNumeric {
+			group.runID = citation.RunID
+		}
+		byGroup[group] = append(byGroup[group], citation.ChunkID)
+	}
+
+	groups := make([]citationGroup, 0, len(byGroup))
+	for group := range byGroup {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].key != groups[j].key {
+			return groups[i].key < groups[j].key
+		}
+		return groups[i].runID < groups[j].runID
+	})
+
+	var edges []database.ChunkEdge
+	for _, group := range groups {
+		chunkIDs := uniqueSorted(byGroup[group])
+		if len(chunkIDs) < 2 || len(chunkIDs) > maxCitingChunks {
+			continue
+		}
+
+		for i := 0; i < len(chunkIDs); i++ {
+			for j := i + 1; j < len(chunkIDs); j++ {
+				edges = append(edges, database.ChunkEdge{
+					SourceID: chunkIDs[i],
+					TargetID: chunkIDs[j],
+					Type:     database.EdgeTypeCitation,
+					Weight:   1,
+					Label:    group.key,
+				})
+			}
+		}
+	}
+
+	return edges
+}
+
+func uniqueSorted(ids []int) []int {
+	sort.Ints(ids)
+	var unique []int
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,344 @@
+package textproc
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Section is a titled span of a structured document such as a chapter of
+// an ebook or a heading-delimited part of a Word document
+type Section struct {
+	Title string
+	Text  string
+	// Kind is copied to the section's chunks; see database.TextChunk
+	Kind string
+}
+
+// Document formats understood by ValidateFile besides plain text
+const (
+	FormatText        = "text"
+	FormatDOCX        = "docx"
+	FormatEPUB        = "epub"
+	FormatSRT         = "srt"
+	FormatVTT         = "vtt"
+	FormatWhisperJSON = "whisper-json"
+	FormatLaTeX       = "latex"
+	FormatNotebook    = "ipynb"
+)
+
+// DocumentFormat returns the format bluffy will read a file as, based on its
+// extension. Anything that isn't a known container format is plain text.
+func DocumentFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".docx":
+		return FormatDOCX
+	case ".epub":
+		return FormatEPUB
+	case ".srt":
+		return FormatSRT
+	case ".vtt":
+		return FormatVTT
+	case ".json":
+		return FormatWhisperJSON
+	case ".tex":
+		return FormatLaTeX
+	case ".ipynb":
+		return FormatNotebook
+	default:
+		return FormatText
+	}
+}
+
+// ExtractSections reads a DOCX or EPUB file and returns its text split into
+// sections. DOCX sections start at Title and Heading paragraphs; EPUB
+// sections follow the spine, with headings inside a chapter starting new
+// sections.
+func ExtractSections(filename string) ([]Section, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s as a zip archive: %w", filename, err)
+	}
+	defer archive.Close()
+
+	switch DocumentFormat(filename) {
+	case FormatDOCX:
+		return extractDOCX(&archive.Reader)
+	case FormatEPUB:
+		return extractEPUB(&archive.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported document format: %s", filepath.Ext(filename))
+	}
+}
+
+func openZipFile(archive *zip.Reader, name string) (io.ReadCloser, error) {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
+
+// sectionBuilder accumulates paragraphs and starts a new section whenever a
+// heading is seen
+type sectionBuilder struct {
+	sections []Section
+	title    string
+	kind     string
+	body     []string
+}
+
+func (b *sectionBuilder) heading(title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return
+	}
+	b.flush()
+	b.title = title
+}
+
+// setKind starts a new section under the current title when the kind of
+// the paragraphs that follow differs
+func (b *sectionBuilder) setKind(kind string) {
+	if kind != b.kind {
+		b.flush()
+		b.kind = kind
+	}
+}
+
+func (b *sectionBuilder) paragraph(text string) {
+	text = strings.TrimSpace(text)
+	if text != "" {
+		b.body = append(b.body, text)
+	}
+}
+
+func (b *sectionBuilder) flush() {
+	if len(b.body) > 0 {
+		b.sections = append(b.sections, Section{
+			Title: b.title,
+			Text:  strings.Join(b.body, "\n\n"),
+			Kind:  b.kind,
+		})
+	}
+	b.body = nil
+}
+
+func (b *sectionBuilder) result() []Section {
+	b.flush()
+	return b.sections
+}
+
+func extractDOCX(archive *zip.Reader) ([]Section, error) {
+	rc, err := openZipFile(archive, "word/document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("not a Word document: %w", err)
+	}
+	defer rc.Close()
+
+	var (
+		builder   sectionBuilder
+		paragraph strings.Builder
+		isHeading bool
+		inText    bool
+	)
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse word/document.xml: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				isHeading = false
+			case "pStyle":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "val" {
+						style := strings.ToLower(attr.Value)
+						isHeading = strings.HasPrefix(style, "heading") || style == "title"
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if isHeading {
+					builder.heading(paragraph.String())
+				} else {
+					builder.paragraph(paragraph.String())
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+
+	return builder.result(), nil
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []struct {
+		ID   string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+func extractEPUB(archive *zip.Reader) ([]Section, error) {
+	rc, err := openZipFile(archive, "META-INF/container.xml")
+	if err != nil {
+		return nil, fmt.Errorf("not an EPUB: %w", err)
+	}
+	var container epubContainer
+	err = xml.NewDecoder(rc).Decode(&container)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EPUB container: %w", err)
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, fmt.Errorf("EPUB container lists no package document")
+	}
+
+	opfPath := container.Rootfiles[0].FullPath
+	rc, err = openZipFile(archive, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg epubPackage
+	err = xml.NewDecoder(rc).Decode(&pkg)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse EPUB package %s: %w", opfPath, err)
+	}
+
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	for _, item := range pkg.Manifest {
+		hrefs[item.ID] = item.Href
+	}
+
+	var builder sectionBuilder
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		name := path.Join(path.Dir(opfPath), href)
+		if err := extractXHTML(archive, name, &builder); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.result(), nil
+}
+
+var (
+	xhtmlHeadings = map[string]bool{"h1": true, "h2": true, "h3": true}
+	xhtmlBlocks   = map[string]bool{
+		"p": true, "div": true, "li": true, "blockquote": true, "pre": true,
+		"h4": true, "h5": true, "h6": true, "tr": true, "dd": true, "dt": true,
+	}
+	xhtmlSkipped = map[string]bool{"head": true, "script": true, "style": true}
+)
+
+func extractXHTML(archive *zip.Reader, name string, builder *sectionBuilder) error {
+	rc, err := openZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var (
+		text      strings.Builder
+		inHeading bool
+		skipDepth int
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			tag := strings.ToLower(t.Name.Local)
+			switch {
+			case xhtmlSkipped[tag]:
+				skipDepth++
+			case xhtmlHeadings[tag]:
+				builder.paragraph(collapseSpace(text.String()))
+				text.Reset()
+				inHeading = true
+			case xhtmlBlocks[tag] && !inHeading:
+				builder.paragraph(collapseSpace(text.String()))
+				text.Reset()
+			case tag == "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			tag := strings.ToLower(t.Name.Local)
+			switch {
+			case xhtmlSkipped[tag]:
+				skipDepth--
+			case xhtmlHeadings[tag]:
+				builder.heading(text.String())
+				text.Reset()
+				inHeading = false
+			case xhtmlBlocks[tag] && !inHeading:
+				builder.paragraph(collapseSpace(text.String()))
+				text.Reset()
+			}
+		case xml.CharData:
+			if skipDepth == 0 {
+				text.Write(t)
+			}
+		}
+	}
+	builder.paragraph(collapseSpace(text.String()))
+
+	return nil
+}
+
+// collapseSpace undoes the line wrapping and indentation of XHTML source
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
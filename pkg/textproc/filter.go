@@ -0,0 +1,133 @@
+package textproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// ChunkFilter drops chunks with nothing worth embedding, such as the page
+// numbers, running headers and OCR debris of scanned books
+type ChunkFilter struct {
+	// MinLength skips chunks with fewer characters
+	MinLength int
+	// Skip skips chunks whose whole text matches one of the expressions
+	Skip []*regexp.Regexp
+	// MinLetterRatio skips chunks in which letters make up less than this
+	// share of the characters other than spaces (0 = off)
+	MinLetterRatio float64
+	// SkipStopwords skips chunks whose words are all stopwords
+	SkipStopwords bool
+}
+
+// SkippedChunks counts the chunks a ChunkFilter dropped, by the first rule
+// each one failed
+type SkippedChunks struct {
+	Short     int
+	Matched   int
+	Symbols   int
+	Stopwords int
+}
+
+// Total returns the number of chunks skipped
+func (s SkippedChunks) Total() int {
+	return s.Short + s.Matched + s.Symbols + s.Stopwords
+}
+
+// NewChunkFilter returns a ChunkFilter for the given rules. Patterns are
+// anchored, so "Page \d+" skips a chunk reading "Page 12" but not a
+// paragraph that mentions a page.
+func NewChunkFilter(minLength int, patterns []string, minLetterRatio float64, skipStopwords bool) (*ChunkFilter, error) {
+	if minLength < 0 {
+		return nil, fmt.Errorf("minimum chunk length must not be negative, got %d", minLength)
+	}
+	if minLetterRatio < 0 || minLetterRatio > 1 {
+		return nil, fmt.Errorf("minimum letter ratio must be between 0 and 1, got %g", minLetterRatio)
+	}
+
+	f := &ChunkFilter{MinLength: minLength, MinLetterRatio: minLetterRatio, SkipStopwords: skipStopwords}
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid skip pattern %q: %w", pattern, err)
+		}
+		f.Skip = append(f.Skip, regex)
+	}
+	return f, nil
+}
+
+// Empty reports whether the ChunkFilter keeps every chunk
+func (f *ChunkFilter) Empty() bool {
+	return f.MinLength == 0 && len(f.Skip) == 0 && f.MinLetterRatio == 0 && !f.SkipStopwords
+}
+
+// FilterChunks returns the chunks that pass every rule, numbered again
+// from 0 so that the chunks on either side of a skipped one stay
+// consecutive, and counts the chunks skipped
+func (f *ChunkFilter) FilterChunks(chunks []database.TextChunk) ([]database.TextChunk, SkippedChunks) {
+	var skipped SkippedChunks
+	kept := make([]database.TextChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		text := strings.TrimSpace(chunk.Text)
+		switch {
+		case len([]rune(text)) < f.MinLength:
+			skipped.Short++
+		case f.matches(text):
+			skipped.Matched++
+		case f.MinLetterRatio > 0 && letterRatio(text) < f.MinLetterRatio:
+			skipped.Symbols++
+		case f.SkipStopwords && onlyStopwords(text):
+			skipped.Stopwords++
+		default:
+			chunk.ChunkIndex = len(kept)
+			kept = append(kept, chunk)
+		}
+	}
+	return kept, skipped
+}
+
+func (f *ChunkFilter) matches(text string) bool {
+	for _, regex := range f.Skip {
+		if regex.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// letterRatio returns the share of letters among the characters of text
+// other than spaces, 0 for blank text
+func letterRatio(text string) float64 {
+	letters, total := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(letters) / float64(total)
+}
+
+// onlyStopwords reports whether every word of text is a stopword of one of
+// the languages DetectLanguage knows, which includes text without words
+func onlyStopwords(text string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if word != "" && !stopwords[word] && len(stopwordLanguages[word]) == 0 {
+			return false
+		}
+	}
+	return true
+}
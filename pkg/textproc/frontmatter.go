@@ -0,0 +1,239 @@
+package textproc
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// wikilinkRegex matches [[Note]], [[Note|shown text]], [[Note#Heading]] and
+// embeds such as ![[Note]]
+var wikilinkRegex = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// IsMarkdown reports whether a file is a Markdown note, whose frontmatter
+// and wikilinks are read
+func IsMarkdown(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseFrontmatter splits a YAML frontmatter block delimited by --- lines
+// off the start of a Markdown note. It returns the title, date, tags and
+// aliases it contains, or nil if there is no frontmatter, along with the
+// rest of the note. Only the flat subset of YAML used by Obsidian and most
+// static site generators is understood: scalars, [a, b] lists and indented
+// "- item" lists.
+func ParseFrontmatter(text string) (*database.DocumentMetadata, string) {
+	lines := strings.Split(text, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \r") != "---" {
+		return nil, text
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \r")
+		if line == "---" || line == "..." {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, text
+	}
+
+	fields := make(map[string][]string)
+	var key string
+	for _, line := range lines[1:end] {
+		line = strings.TrimRight(line, " \r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if key != "" {
+				fields[key] = append(fields[key], unquoteYAML(strings.TrimPrefix(trimmed, "-")))
+			}
+			continue
+		}
+		if line != trimmed {
+			// An indented line that isn't a list item belongs to a nested
+			// mapping, which none of the fields read here use
+			continue
+		}
+
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			key = ""
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			fields[key] = nil
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				fields[key] = append(fields[key], unquoteYAML(item))
+			}
+		default:
+			fields[key] = []string{unquoteYAML(value)}
+		}
+	}
+
+	metadata := &database.DocumentMetadata{
+		Title:   firstValue(fields["title"]),
+		Date:    firstValue(fields["date"]),
+		Tags:    splitTags(append(fields["tags"], fields["tag"]...)),
+		Aliases: nonEmpty(append(fields["aliases"], fields["alias"]...)),
+	}
+	body := strings.Join(lines[end+1:], "\n")
+	return metadata, body
+}
+
+// unquoteYAML trims whitespace and one pair of surrounding quotes
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return strings.TrimSpace(value)
+}
+
+func firstValue(values []string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// splitTags normalizes tags written as a list or as one string separated
+// by commas or spaces, dropping the leading # Obsidian allows
+func splitTags(values []string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			tag = strings.TrimPrefix(unquoteYAML(tag), "#")
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// ExtractWikilinks returns the notes linked from text with [[wikilinks]],
+// without any heading, block reference or display text
+func ExtractWikilinks(text string) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	for _, match := range wikilinkRegex.FindAllStringSubmatch(text, -1) {
+		target, _, _ := strings.Cut(match[1], "|")
+		target, _, _ = strings.Cut(target, "#")
+		target = strings.TrimSpace(target)
+		if target != "" && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// noteKey normalizes a note name so links match regardless of case, folder
+// or a trailing .md
+func noteKey(name string) string {
+	name = strings.TrimSpace(name)
+	if IsMarkdown(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// WikilinkEdges links every chunk containing a [[wikilink]] to the first
+// chunk of the note it names. Links are resolved against the title and
+// aliases in each run's frontmatter, the citation key of documents from a
+// bibliography and the file name of its source, so notes processed into
+// the same database in any order link up. Links to notes that aren't in
+// the database are ignored.
+func WikilinkEdges(chunks []database.TextChunk, runs []database.Run) []database.ChunkEdge {
+	first := make(map[int]database.TextChunk)
+	for _, chunk := range chunks {
+		if current, ok := first[chunk.RunID]; !ok || chunk.ChunkIndex < current.ChunkIndex {
+			first[chunk.RunID] = chunk
+		}
+	}
+
+	notes := make(map[string]int)
+	for _, run := range runs {
+		source := filepath.Base(run.Source)
+		names := []string{strings.TrimSuffix(source, filepath.Ext(source))}
+		if run.Metadata != nil {
+			names = append(names, run.Metadata.Title)
+			names = append(names, run.Metadata.Aliases...)
+			if run.Metadata.Citation != nil {
+				// Literature notes link to papers as [[@key]] or [[key]]
+				names = append(names, run.Metadata.Citation.Key, "@"+run.Metadata.Citation.Key)
+			}
+		}
+		for _, name := range names {
+			// Runs are oldest first, so a re-processed note resolves to
+			// its latest run
+			if key := noteKey(name); key != "" {
+				notes[key] = run.ID
+			}
+		}
+	}
+
+	var edges []database.ChunkEdge
+	for _, chunk := range chunks {
+		for _, target := range ExtractWikilinks(chunk.Text) {
+			runID, ok := notes[noteKey(target)]
+			if !ok {
+				continue
+			}
+			targetChunk, ok := first[runID]
+			if !ok || targetChunk.ID == chunk.ID {
+				continue
+			}
+			edges = append(edges, database.ChunkEdge{
+				SourceID: chunk.ID,
+				TargetID: targetChunk.ID,
+				Type:     database.EdgeTypeWikilink,
+				Weight:   1,
+				Label:    target,
+			})
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].SourceID != edges[j].SourceID {
+			return edges[i].SourceID < edges[j].SourceID
+		}
+		return edges[i].TargetID < edges[j].TargetID
+	})
+	return edges
+}
@@ -0,0 +1,105 @@
+package textproc
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopwords are common English words that never make useful keywords
+var stopwords = makeSet(`a about above after again against all also am an and any are as at be
+because been before being below between both but by can could did do does doing down during each
+even ever every few for from further had has have having he her here hers herself him himself his
+how however i if in into is it its itself just like made make many may me might more most much must
+my myself never no nor not now of off on once one only or other our ours ourselves out over own
+said same say says shall she should since so some still such than that the their theirs them
+themselves then there these they this those though through thus to too under until up upon us very
+was we were what when where whether which while who whom whose why will with within without would
+yet you your yours yourself yourselves`)
+
+func makeSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// Tokenize splits text into lowercase words, dropping stopwords, numbers,
+// and words shorter than three letters
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if len([]rune(word)) < 3 || stopwords[word] {
+			continue
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// Keyword is a term with its relevance score for a chunk
+type Keyword struct {
+	Term  string
+	Score float64
+}
+
+// TFIDF scores terms by how characteristic they are of one text compared
+// with the rest of a corpus
+type TFIDF struct {
+	docFreq map[string]int
+	docs    int
+}
+
+// NewTFIDF builds document frequencies from a corpus of texts
+func NewTFIDF(corpus []string) *TFIDF {
+	model := &TFIDF{docFreq: make(map[string]int), docs: len(corpus)}
+	for _, text := range corpus {
+		seen := make(map[string]bool)
+		for _, token := range Tokenize(text) {
+			if !seen[token] {
+				seen[token] = true
+				model.docFreq[token]++
+			}
+		}
+	}
+	return model
+}
+
+// Keywords returns the n highest scoring terms in text
+func (m *TFIDF) Keywords(text string, n int) []Keyword {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, token := range tokens {
+		counts[token]++
+	}
+
+	keywords := make([]Keyword, 0, len(counts))
+	for term, count := range counts {
+		tf := float64(count) / float64(len(tokens))
+		idf := math.Log(float64(1+m.docs)/float64(1+m.docFreq[term])) + 1
+		keywords = append(keywords, Keyword{Term: term, Score: tf * idf})
+	}
+
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Score != keywords[j].Score {
+			return keywords[i].Score > keywords[j].Score
+		}
+		return keywords[i].Term < keywords[j].Term
+	})
+
+	if len(keywords) > n {
+		keywords = keywords[:n]
+	}
+	return keywords
+}
@@ -0,0 +1,65 @@
+package textproc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageStopwords holds frequent function words of each supported
+// language. Words that belong to several languages are split between them
+// when scoring.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "that", "it", "was", "for", "with", "as", "his", "they", "be", "at", "this", "have", "from", "or", "which", "were", "are", "but", "not", "by", "had", "she", "their", "would", "there", "what", "been", "when", "who", "will"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "des", "auf", "für", "im", "dem", "auch", "es", "wird", "als", "wie", "oder", "aber", "vom", "noch", "nach", "bei", "einer", "sind", "wurde", "werden", "dass", "ich", "sie"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "du", "des", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "ce", "il", "elle", "sont", "mais", "ou", "nous", "vous", "leur", "été", "cette", "aux", "par"},
+	"es": {"el", "los", "las", "y", "que", "es", "un", "una", "por", "con", "para", "del", "se", "su", "al", "lo", "como", "más", "pero", "sus", "le", "ya", "fue", "este", "está", "muy", "sin", "sobre", "también"},
+	"it": {"il", "di", "che", "è", "per", "gli", "con", "del", "della", "non", "sono", "alla", "nel", "una", "anche", "come", "più", "dei", "delle", "questo", "ma", "ha", "nella", "essere"},
+	"nl": {"het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "voor", "met", "niet", "aan", "er", "ook", "als", "bij", "door", "wordt", "naar", "maar", "om", "deze", "werd", "nog", "heeft"},
+	"pt": {"o", "os", "as", "e", "que", "um", "uma", "do", "da", "dos", "das", "em", "não", "para", "com", "por", "mais", "ao", "como", "mas", "foi", "ele", "ela", "seu", "sua", "são", "também"},
+}
+
+// minLanguageHits is the fewest stopword matches needed to name a language;
+// shorter or unusual texts are reported as undetermined
+const minLanguageHits = 3
+
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range languageStopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// DetectLanguage guesses the language of text from its most frequent
+// function words and returns an ISO 639-1 code (en, de, fr, es, it, nl,
+// pt), or "" if no language stands out.
+func DetectLanguage(text string) string {
+	scores := make(map[string]float64)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		languages := stopwordLanguages[word]
+		for _, language := range languages {
+			scores[language] += 1 / float64(len(languages))
+		}
+	}
+
+	best, bestScore, runnerUp := "", 0.0, 0.0
+	for _, language := range []string{"en", "de", "fr", "es", "it", "nl", "pt"} {
+		score := scores[language]
+		switch {
+		case score > bestScore:
+			best, bestScore, runnerUp = language, score, bestScore
+		case score > runnerUp:
+			runnerUp = score
+		}
+	}
+
+	if bestScore < minLanguageHits || bestScore < runnerUp*1.2 {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,361 @@
+package textproc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// latexHeadingRegex matches the start of a sectioning command up to the
+// brace opening its title
+var latexHeadingRegex = regexp.MustCompile(`\\(?:part|chapter|section|subsection|subsubsection|paragraph)\*?\s*(?:\[[^\]]*\])?\s*\{`)
+
+// latexSkippedEnvironments hold markup, code or display math rather than
+// prose, and are left out entirely
+var latexSkippedEnvironments = []string{
+	"equation", "equation*", "align", "align*", "gather", "gather*", "multline", "multline*",
+	"eqnarray", "eqnarray*", "displaymath", "tabular", "tabular*", "tikzpicture",
+	"verbatim", "lstlisting", "minted", "thebibliography", "comment",
+}
+
+// latexDroppedCommands are removed along with their arguments. The value
+// is how many brace arguments they take.
+var latexDroppedCommands = map[string]int{
+	"label": 1, "ref": 1, "eqref": 1, "pageref": 1, "cref": 1, "Cref": 1, "autoref": 1,
+	"cite": 1, "citep": 1, "citet": 1, "citeauthor": 1, "citeyear": 1, "nocite": 1,
+	"includegraphics": 1, "bibliography": 1, "bibliographystyle": 1, "addbibresource": 1,
+	"input": 1, "include": 1, "index": 1, "thanks": 1, "vspace": 1, "hspace": 1,
+	"setlength": 2, "end": 1,
+}
+
+// latexTextCommands format their last argument, which is kept. The value
+// is how many brace arguments they take.
+var latexTextCommands = map[string]int{
+	"emph": 1, "textbf": 1, "textit": 1, "texttt": 1, "textsc": 1, "textrm": 1, "textsf": 1,
+	"underline": 1, "text": 1, "mbox": 1, "caption": 1, "url": 1, "href": 2,
+}
+
+// ExtractLaTeX reads a .tex file and returns its prose split into sections
+// at \chapter, \section and the other sectioning commands, along with the
+// \title and \date of the preamble. Commands are stripped, keeping the text
+// of formatting commands such as \emph; equations, tables, code listings,
+// citations and cross-references are left out.
+func ExtractLaTeX(filename string) ([]Section, *database.DocumentMetadata, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	source := stripLaTeXComments(string(content))
+
+	var metadata *database.DocumentMetadata
+	title := latexText(latexArgument(source, "title"))
+	date := latexText(latexArgument(source, "date"))
+	if title != "" || date != "" {
+		metadata = &database.DocumentMetadata{Title: title, Date: date}
+	}
+
+	body := source
+	if start := strings.Index(body, `\begin{document}`); start >= 0 {
+		body = body[start+len(`\begin{document}`):]
+		if end := strings.Index(body, `\end{document}`); end >= 0 {
+			body = body[:end]
+		}
+	}
+	for _, name := range latexSkippedEnvironments {
+		body = removeLaTeXEnvironment(body, name)
+	}
+	body = strings.ReplaceAll(body, `\begin{abstract}`, `\section*{Abstract}`)
+
+	var builder sectionBuilder
+	addParagraphs := func(text string) {
+		for _, paragraph := range blankLineRegex.Split(text, -1) {
+			builder.paragraph(latexText(paragraph))
+		}
+	}
+	for {
+		match := latexHeadingRegex.FindStringIndex(body)
+		if match == nil {
+			break
+		}
+		addParagraphs(body[:match[0]])
+
+		open := match[1] - 1
+		end := matchingBrace(body, open)
+		if end < 0 {
+			return nil, nil, fmt.Errorf("unclosed brace in the heading %q", strings.SplitN(body[match[0]:], "\n", 2)[0])
+		}
+		builder.heading(latexText(body[open+1 : end]))
+		body = body[end+1:]
+	}
+	addParagraphs(body)
+
+	return builder.result(), metadata, nil
+}
+
+// blankLineRegex separates paragraphs
+var blankLineRegex = regexp.MustCompile(`\n[ \t]*\n`)
+
+// stripLaTeXComments removes everything from an unescaped % to the end of
+// its line
+func stripLaTeXComments(source string) string {
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '%' {
+				lines[i] = line[:j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// latexArgument returns the first brace argument of the first \name
+// command in source
+func latexArgument(source, name string) string {
+	match := regexp.MustCompile(`\\` + name + `\s*(?:\[[^\]]*\])?\s*\{`).FindStringIndex(source)
+	if match == nil {
+		return ""
+	}
+	end := matchingBrace(source, match[1]-1)
+	if end < 0 {
+		return ""
+	}
+	return source[match[1]:end]
+}
+
+func removeLaTeXEnvironment(body, name string) string {
+	return removeDelimited(body, `\begin{`+name+`}`, `\end{`+name+`}`)
+}
+
+// removeDelimited removes every span from start to the next end,
+// inclusive. An unclosed span runs to the end of the text.
+func removeDelimited(text, start, end string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, start)
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:i])
+		rest := text[i+len(start):]
+		j := strings.Index(rest, end)
+		if j < 0 {
+			return b.String()
+		}
+		// Keep the paragraph break a display around it implies
+		b.WriteString("\n")
+		text = rest[j+len(end):]
+	}
+}
+
+// matchingBrace returns the index of the brace closing the one at open, or
+// -1 if it isn't closed
+func matchingBrace(text string, open int) int {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// latexText converts a LaTeX fragment to plain text: formatting commands
+// keep their text, other commands and their arguments are dropped, and
+// \item starts a "- " line. Inline math is kept as written.
+func latexText(source string) string {
+	var b strings.Builder
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case strings.HasPrefix(source[i:], `\[`):
+			// Display math is left out like equation environments
+			i = skipPast(source, i+2, `\]`)
+		case strings.HasPrefix(source[i:], "$$"):
+			i = skipPast(source, i+2, "$$")
+		case c == '\\' && i+1 < len(source) && !isLetter(source[i+1]):
+			b.WriteString(latexSymbol(source[i+1]))
+			i += 2
+			if source[i-1] == '\\' && i < len(source) && source[i] == '[' {
+				// A line break may add space, as in \\[2pt]
+				i = skipPast(source, i, "]")
+			}
+		case c == '\\':
+			j := i + 1
+			for j < len(source) && isLetter(source[j]) {
+				j++
+			}
+			name := source[i+1 : j]
+			if j < len(source) && source[j] == '*' {
+				j++
+			}
+			var args []string
+			args, i = latexArguments(source, j, latexArgumentCount(name))
+			b.WriteString(latexCommand(name, args))
+		case c == '$':
+			end := strings.IndexByte(source[i+1:], '$')
+			if end < 0 {
+				i++
+				continue
+			}
+			b.WriteString(source[i : i+end+2])
+			i += end + 2
+		case c == '{' || c == '}':
+			i++
+		case c == '~':
+			b.WriteByte(' ')
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	text := strings.NewReplacer("``", `"`, "''", `"`, "---", "—", "--", "–").Replace(b.String())
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	// Only items are kept on lines of their own
+	var merged []string
+	for _, line := range lines {
+		if len(merged) > 0 && !strings.HasPrefix(line, "- ") {
+			merged[len(merged)-1] += " " + line
+			continue
+		}
+		merged = append(merged, line)
+	}
+	// Dropped citations and references leave a space before punctuation
+	return spaceBeforePunctuationRegex.ReplaceAllString(strings.Join(merged, "\n"), "$1")
+}
+
+var spaceBeforePunctuationRegex = regexp.MustCompile(` +([.,;:!?)])`)
+
+// skipPast returns the index after the first end at or after i, or the
+// end of source if there is none
+func skipPast(source string, i int, end string) int {
+	j := strings.Index(source[i:], end)
+	if j < 0 {
+		return len(source)
+	}
+	return i + j + len(end)
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// latexSymbol converts a control symbol such as \% or \\. Accents are
+// dropped, keeping the letter they apply to.
+func latexSymbol(c byte) string {
+	switch c {
+	case '\\':
+		return "\n"
+	case '%', '&', '$', '#', '_', '{', '}':
+		return string(c)
+	case ',', ';', ' ':
+		return " "
+	default:
+		return ""
+	}
+}
+
+// latexArgumentCount is how many brace arguments a command takes: known
+// ones say, and -1 takes whatever arguments follow it directly
+func latexArgumentCount(name string) int {
+	if n, ok := latexDroppedCommands[name]; ok {
+		return n
+	}
+	if n, ok := latexTextCommands[name]; ok {
+		return n
+	}
+	return -1
+}
+
+// latexArguments reads up to n brace arguments starting at i, skipping
+// optional [...] arguments, and returns them with the index after the last.
+// With n = -1 it reads every argument directly after the command, without
+// skipping spaces, so a command without arguments keeps the space after it.
+func latexArguments(source string, i, n int) ([]string, int) {
+	var args []string
+	for n < 0 || len(args) < n {
+		j := i
+		if n >= 0 {
+			for j < len(source) && (source[j] == ' ' || source[j] == '\t' || source[j] == '\n') {
+				j++
+			}
+		}
+		if j >= len(source) {
+			break
+		}
+		switch source[j] {
+		case '[':
+			end := strings.IndexByte(source[j:], ']')
+			if end < 0 {
+				return args, i
+			}
+			i = j + end + 1
+		case '{':
+			end := matchingBrace(source, j)
+			if end < 0 {
+				return args, i
+			}
+			args = append(args, source[j+1:end])
+			i = end + 1
+		default:
+			return args, i
+		}
+	}
+	return args, i
+}
+
+// latexCommand returns the text a command with its arguments stands for
+func latexCommand(name string, args []string) string {
+	switch {
+	case name == "item":
+		return "\n- "
+	case name == "par":
+		return "\n"
+	case name == "footnote" && len(args) > 0:
+		return " (" + latexText(args[len(args)-1]) + ")"
+	case name == "begin":
+		// Skipped environments are already gone; the rest, such as
+		// itemize or quote, keep their content
+		return ""
+	}
+	if _, ok := latexDroppedCommands[name]; ok {
+		return ""
+	}
+	if _, ok := latexTextCommands[name]; ok && len(args) > 0 {
+		return latexText(args[len(args)-1])
+	}
+
+	// Unknown commands keep the text of their arguments, so user macros
+	// such as \term{...} don't lose it
+	texts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if text := latexText(arg); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
@@ -0,0 +1,102 @@
+package textproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// markdownHeadingRegex matches an ATX heading line such as "## Results"
+var markdownHeadingRegex = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*\s*$`)
+
+// notebook covers the parts of an nbformat 4 Jupyter notebook that are read
+type notebook struct {
+	Cells []struct {
+		CellType string         `json:"cell_type"`
+		Source   notebookSource `json:"source"`
+	} `json:"cells"`
+	Metadata struct {
+		Title string `json:"title"`
+	} `json:"metadata"`
+}
+
+// notebookSource is a cell's source, which nbformat allows to be either a
+// string or a list of lines
+type notebookSource string
+
+func (s *notebookSource) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*s = notebookSource(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*s = notebookSource(text)
+	return nil
+}
+
+// ExtractNotebook reads a Jupyter notebook and returns its markdown cells
+// as sections of kind markdown, starting a new section at every Markdown
+// heading. With code set, code cells become sections of kind code under the
+// current heading, so prose and code are never chunked together. Outputs
+// and raw cells are skipped.
+func ExtractNotebook(filename string, code bool) ([]Section, *database.DocumentMetadata, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse notebook JSON: %w", err)
+	}
+	if nb.Cells == nil {
+		return nil, nil, fmt.Errorf("no cells found; only nbformat 4 notebooks are supported")
+	}
+
+	var metadata *database.DocumentMetadata
+	if title := strings.TrimSpace(nb.Metadata.Title); title != "" {
+		metadata = &database.DocumentMetadata{Title: title}
+	}
+
+	var builder sectionBuilder
+	for _, cell := range nb.Cells {
+		source := strings.ReplaceAll(string(cell.Source), "\r\n", "\n")
+		switch cell.CellType {
+		case "markdown":
+			builder.setKind(database.ChunkKindMarkdown)
+			var paragraph []string
+			flush := func() {
+				builder.paragraph(strings.Join(paragraph, "\n"))
+				paragraph = nil
+			}
+			for _, line := range strings.Split(source, "\n") {
+				if heading := markdownHeadingRegex.FindStringSubmatch(line); heading != nil {
+					flush()
+					builder.heading(heading[1])
+					continue
+				}
+				if strings.TrimSpace(line) == "" {
+					flush()
+					continue
+				}
+				paragraph = append(paragraph, line)
+			}
+			flush()
+		case "code":
+			if code {
+				builder.setKind(database.ChunkKindCode)
+				builder.paragraph(source)
+			}
+		}
+	}
+
+	return builder.result(), metadata, nil
+}
@@ -0,0 +1,119 @@
+package textproc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Redaction kinds recognized by NewRedactor
+const (
+	RedactEmail = "email"
+	RedactPhone = "phone"
+	RedactSSN   = "ssn"
+)
+
+// RedactionMask replaces matches of custom patterns
+const RedactionMask = "[REDACTED]"
+
+// redactionKinds lists the built-in kinds in the order they are applied.
+// SSNs go before phone numbers so their digits are not taken for one.
+var redactionKinds = []struct {
+	kind  string
+	regex *regexp.Regexp
+	mask  string
+}{
+	{RedactEmail, regexp.MustCompile(`(?i)\b[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}\b`), "[EMAIL]"},
+	{RedactSSN, regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), "[SSN]"},
+	{RedactPhone, regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.\-])\d{3}[\s.\-]\d{4}\b`), "[PHONE]"},
+}
+
+type redactionRule struct {
+	regex *regexp.Regexp
+	mask  string
+}
+
+// Redactor masks personal data in text before it is embedded and stored
+type Redactor struct {
+	rules []redactionRule
+}
+
+// NewRedactor returns a Redactor for the given built-in kinds (email,
+// phone, ssn, or all) and custom regular expressions, whose matches are
+// replaced with RedactionMask
+func NewRedactor(kinds []string, patterns []string) (*Redactor, error) {
+	wanted := make(map[string]bool)
+	for _, kind := range kinds {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "all" {
+			for _, builtin := range redactionKinds {
+				wanted[builtin.kind] = true
+			}
+			continue
+		}
+		known := false
+		for _, builtin := range redactionKinds {
+			if builtin.kind == kind {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown redaction kind %q (valid kinds: %s, %s, %s, all)", kind, RedactEmail, RedactPhone, RedactSSN)
+		}
+		wanted[kind] = true
+	}
+
+	r := &Redactor{}
+	for _, builtin := range redactionKinds {
+		if wanted[builtin.kind] {
+			r.rules = append(r.rules, redactionRule{regex: builtin.regex, mask: builtin.mask})
+		}
+	}
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.rules = append(r.rules, redactionRule{regex: regex, mask: RedactionMask})
+	}
+	return r, nil
+}
+
+// Empty reports whether the Redactor has nothing to mask
+func (r *Redactor) Empty() bool {
+	return len(r.rules) == 0
+}
+
+// Redact returns text with every match masked, and the number of matches
+func (r *Redactor) Redact(text string) (string, int) {
+	count := 0
+	for _, rule := range r.rules {
+		text = rule.regex.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return rule.mask
+		})
+	}
+	return text, count
+}
+
+// RedactChunks masks the text and section of each chunk in place, marks
+// the chunks that changed as Redacted, and returns the number of matches
+// masked
+func (r *Redactor) RedactChunks(chunks []database.TextChunk) int {
+	total := 0
+	for i := range chunks {
+		text, inText := r.Redact(chunks[i].Text)
+		section, inSection := r.Redact(chunks[i].Section)
+		if inText+inSection == 0 {
+			continue
+		}
+		chunks[i].Text = text
+		chunks[i].Section = section
+		chunks[i].Redacted = true
+		total += inText + inSection
+	}
+	return total
+}
@@ -0,0 +1,271 @@
+package textproc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Cue is a timed line of a transcript or subtitle file. Start and End are
+// in seconds from the beginning of the recording.
+type Cue struct {
+	Start   float64
+	End     float64
+	Speaker string
+	Text    string
+}
+
+var (
+	// cueTiming matches the timing line of an SRT or VTT cue. Hours are
+	// optional in VTT, and SRT separates milliseconds with a comma.
+	cueTiming = regexp.MustCompile(`^((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	// voiceTag matches a VTT voice span, <v Speaker> or <v.class Speaker>
+	voiceTag = regexp.MustCompile(`<v(?:\.[^ >]*)?\s+([^>]+)>`)
+	// markupTag matches any other VTT or SRT markup, such as <i> or <c>
+	markupTag = regexp.MustCompile(`<[^>]*>`)
+	// speakerPrefix matches a "Name:" label at the start of a cue, with
+	// the ">>" some captioners put before a new speaker
+	speakerPrefix = regexp.MustCompile(`^(?:>>\s*)?([\p{Lu}][\p{L}\p{N} .'\-]{0,39}):\s+(.+)$`)
+)
+
+// IsTranscript reports whether a format is read as timed cues
+func IsTranscript(format string) bool {
+	return format == FormatSRT || format == FormatVTT || format == FormatWhisperJSON
+}
+
+// ExtractCues reads an SRT, WebVTT or Whisper JSON file. Speakers come from
+// VTT voice tags, Whisper segment speakers (as written by diarizing tools
+// such as WhisperX), or a "Name:" label at the start of a cue; a cue
+// without one keeps the speaker of the cue before it.
+func ExtractCues(filename string) ([]Cue, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF})
+
+	var cues []Cue
+	switch DocumentFormat(filename) {
+	case FormatSRT, FormatVTT:
+		cues, err = parseSubtitles(content)
+	case FormatWhisperJSON:
+		cues, err = parseWhisperJSON(content)
+	default:
+		return nil, fmt.Errorf("unsupported transcript format: %s", DocumentFormat(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	speaker := ""
+	kept := cues[:0]
+	for _, cue := range cues {
+		if cue.Speaker == "" {
+			if match := speakerPrefix.FindStringSubmatch(cue.Text); match != nil {
+				cue.Speaker, cue.Text = strings.TrimSpace(match[1]), match[2]
+			}
+		}
+		if cue.Speaker == "" {
+			cue.Speaker = speaker
+		}
+		speaker = cue.Speaker
+		cue.Text = collapseSpace(cue.Text)
+		if cue.Text != "" {
+			kept = append(kept, cue)
+		}
+	}
+	return kept, nil
+}
+
+// parseSubtitles reads SRT and WebVTT cues: blocks separated by blank lines
+// whose timing line is followed by the cue text. Cue numbers, identifiers
+// and VTT header, NOTE and STYLE blocks have no timing line and are skipped.
+func parseSubtitles(content []byte) ([]Cue, error) {
+	var cues []Cue
+	var block []string
+	flush := func() error {
+		defer func() { block = block[:0] }()
+		for i, line := range block {
+			match := cueTiming.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			start, err := parseTimestamp(match[1])
+			if err != nil {
+				return err
+			}
+			end, err := parseTimestamp(match[2])
+			if err != nil {
+				return err
+			}
+			cue := Cue{Start: start, End: end}
+			var lines []string
+			for _, text := range block[i+1:] {
+				if voice := voiceTag.FindStringSubmatch(text); voice != nil && cue.Speaker == "" {
+					cue.Speaker = strings.TrimSpace(voice[1])
+				}
+				lines = append(lines, markupTag.ReplaceAllString(text, ""))
+			}
+			cue.Text = strings.Join(lines, " ")
+			cues = append(cues, cue)
+			return nil
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no timed cues found")
+	}
+	return cues, nil
+}
+
+// parseTimestamp converts hh:mm:ss,mmm or mm:ss.mmm to seconds
+func parseTimestamp(value string) (float64, error) {
+	value = strings.Replace(value, ",", ".", 1)
+	parts := strings.Split(value, ":")
+	var seconds float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// whisperTranscript covers the JSON written by openai-whisper and WhisperX
+// (segments in seconds) and by whisper.cpp (transcription with offsets in
+// milliseconds)
+type whisperTranscript struct {
+	Segments []struct {
+		Start   float64 `json:"start"`
+		End     float64 `json:"end"`
+		Text    string  `json:"text"`
+		Speaker string  `json:"speaker"`
+	} `json:"segments"`
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+func parseWhisperJSON(content []byte) ([]Cue, error) {
+	var transcript whisperTranscript
+	if err := json.Unmarshal(content, &transcript); err != nil {
+		return nil, fmt.Errorf("invalid Whisper JSON: %w", err)
+	}
+
+	var cues []Cue
+	for _, segment := range transcript.Segments {
+		cues = append(cues, Cue{Start: segment.Start, End: segment.End, Speaker: segment.Speaker, Text: segment.Text})
+	}
+	for _, segment := range transcript.Transcription {
+		cues = append(cues, Cue{
+			Start: float64(segment.Offsets.From) / 1000,
+			End:   float64(segment.Offsets.To) / 1000,
+			Text:  segment.Text,
+		})
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no segments found; expected Whisper JSON with a segments or transcription array")
+	}
+	return cues, nil
+}
+
+// chunkCues groups cues into chunks. With a window, each chunk holds the
+// cues starting in one window of that length and a change of speaker
+// starts a new "Speaker:" line; otherwise each speaker turn is a chunk.
+// Either way a chunk is closed before it grows past opts.Size characters.
+// Overlap does not apply: cues are never split. Every chunk records the
+// time span of its cues and its speakers.
+func chunkCues(cues []Cue, opts ChunkOptions) []database.TextChunk {
+	var chunks []database.TextChunk
+	var text strings.Builder
+	var speakers []string
+	var start, end float64
+	lineSpeaker := ""
+
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		chunkStart, chunkEnd := start, end
+		chunks = append(chunks, database.TextChunk{
+			Text:         text.String(),
+			ChunkIndex:   len(chunks),
+			Speaker:      strings.Join(speakers, ", "),
+			StartSeconds: &chunkStart,
+			EndSeconds:   &chunkEnd,
+		})
+		text.Reset()
+		speakers = nil
+		lineSpeaker = ""
+	}
+
+	window := opts.Window.Seconds()
+	for _, cue := range cues {
+		if text.Len() > 0 {
+			boundary := text.Len()+1+len(cue.Text) > opts.Size
+			if window > 0 {
+				boundary = boundary || int(cue.Start/window) != int(start/window)
+			} else {
+				boundary = boundary || cue.Speaker != lineSpeaker
+			}
+			if boundary {
+				flush()
+			}
+		}
+
+		if text.Len() == 0 {
+			start, end = cue.Start, cue.End
+		}
+		end = max(end, cue.End)
+		if cue.Speaker != "" && !slices.Contains(speakers, cue.Speaker) {
+			speakers = append(speakers, cue.Speaker)
+		}
+
+		switch {
+		case text.Len() == 0 && window > 0 && cue.Speaker != "":
+			text.WriteString(cue.Speaker + ": ")
+		case text.Len() == 0:
+		case window > 0 && cue.Speaker != lineSpeaker:
+			text.WriteString("\n" + cue.Speaker + ": ")
+		default:
+			text.WriteString(" ")
+		}
+		text.WriteString(cue.Text)
+		lineSpeaker = cue.Speaker
+	}
+	flush()
+	return chunks
+}
@@ -0,0 +1,259 @@
+package textproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Encodings detected by ValidateFile
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin-1"
+)
+
+// binarySniffLen is how much of the file is inspected for NUL bytes, the same
+// heuristic git uses to decide whether a file is binary
+const binarySniffLen = 8000
+
+// ValidationReport describes an input file that passed validation
+type ValidationReport struct {
+	Path       string
+	Size       int64
+	Format     string
+	Sections   int
+	Cues       int
+	Encoding   string
+	Transcoded bool
+	// Metadata is the frontmatter of a Markdown note, if it has any
+	Metadata *database.DocumentMetadata
+	Chunks   []database.TextChunk
+
+	// Skipped counts the chunks a ChunkFilter dropped from Chunks
+	Skipped SkippedChunks
+}
+
+// ValidateFile checks that a file contains usable text before any expensive
+// work is done on it. Binary files, empty files, and files that produce no
+// chunks are rejected. Files in UTF-16 or Latin-1 are rejected unless
+// transcode is set, in which case they are converted to UTF-8.
+func ValidateFile(filename string, transcode bool, chunking ChunkOptions) (*ValidationReport, error) {
+	if err := chunking.Validate(); err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationReport{
+		Path:   filename,
+		Size:   int64(len(content)),
+		Format: DocumentFormat(filename),
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, fmt.Errorf("%s is empty; add some text to it or choose a different file", filename)
+	}
+
+	if IsTranscript(report.Format) {
+		return validateTranscript(report, chunking)
+	}
+	if report.Format == FormatLaTeX || report.Format == FormatNotebook {
+		return validateSource(report, chunking)
+	}
+	if report.Format != FormatText {
+		return validateDocument(report, chunking)
+	}
+
+	text, encoding, err := decodeText(content, transcode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	report.Encoding = encoding
+	report.Transcoded = encoding != EncodingUTF8
+
+	if IsMarkdown(filename) {
+		// Frontmatter is metadata, not prose to embed
+		report.Metadata, text = ParseFrontmatter(text)
+	}
+
+	chunks, err := chunkTextWithSplitter(text, chunking)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk %s: %w", filename, err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%s produced no text chunks; check that it contains readable paragraphs", filename)
+	}
+	report.Chunks = chunks
+
+	return report, nil
+}
+
+func validateDocument(report *ValidationReport, chunking ChunkOptions) (*ValidationReport, error) {
+	sections, err := ExtractSections(report.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read as %s: %w", report.Path, report.Format, err)
+	}
+	report.Sections = len(sections)
+	report.Encoding = EncodingUTF8
+
+	chunks, err := chunkSections(sections, chunking)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk %s: %w", report.Path, err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%s produced no text chunks; it may contain only images or be DRM-protected", report.Path)
+	}
+	report.Chunks = chunks
+
+	return report, nil
+}
+
+// validateSource reads LaTeX and notebooks, text formats with sections
+// and metadata of their own
+func validateSource(report *ValidationReport, chunking ChunkOptions) (*ValidationReport, error) {
+	var sections []Section
+	var err error
+	if report.Format == FormatLaTeX {
+		sections, report.Metadata, err = ExtractLaTeX(report.Path)
+	} else {
+		sections, report.Metadata, err = ExtractNotebook(report.Path, chunking.NotebookCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read as %s: %w", report.Path, report.Format, err)
+	}
+	report.Sections = len(sections)
+	report.Encoding = EncodingUTF8
+
+	chunks, err := chunkSections(sections, chunking)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk %s: %w", report.Path, err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%s produced no text chunks; check that it contains prose (or code cells, with --notebook-code)", report.Path)
+	}
+	report.Chunks = chunks
+
+	return report, nil
+}
+
+func validateTranscript(report *ValidationReport, chunking ChunkOptions) (*ValidationReport, error) {
+	cues, err := ExtractCues(report.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read as %s: %w", report.Path, report.Format, err)
+	}
+	report.Cues = len(cues)
+	report.Encoding = EncodingUTF8
+
+	report.Chunks = chunkCues(cues, chunking)
+	if len(report.Chunks) == 0 {
+		return nil, fmt.Errorf("%s produced no text chunks; its cues are all empty", report.Path)
+	}
+
+	return report, nil
+}
+
+func decodeText(content []byte, transcode bool) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		content = content[3:]
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return decodeUTF16(content[2:], binary.LittleEndian, EncodingUTF16LE, transcode)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return decodeUTF16(content[2:], binary.BigEndian, EncodingUTF16BE, transcode)
+	}
+
+	sniff := content
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	if nul := bytes.IndexByte(sniff, 0); nul >= 0 {
+		// UTF-16 text without a byte order mark is mostly ASCII with every
+		// other byte zeroed, so check for that before declaring it binary
+		if order, encoding, ok := guessUTF16(sniff); ok {
+			return decodeUTF16(content, order, encoding, transcode)
+		}
+		return "", "", fmt.Errorf("appears to be a binary file (NUL byte at offset %d); bluffy reads plain text (.txt, .md), .docx, .epub, .tex, .ipynb, and transcript (.srt, .vtt, Whisper .json) files", nul)
+	}
+
+	if utf8.Valid(content) {
+		return string(content), EncodingUTF8, nil
+	}
+
+	if !transcode {
+		return "", "", fmt.Errorf("is not valid UTF-8 (first invalid byte at offset %d); re-save it as UTF-8 or re-run with --transcode to read it as Latin-1", firstInvalidUTF8(content))
+	}
+
+	return decodeLatin1(content), EncodingLatin1, nil
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder, encoding string, transcode bool) (string, string, error) {
+	if !transcode {
+		return "", "", fmt.Errorf("is %s encoded; re-save it as UTF-8 or re-run with --transcode to convert it", encoding)
+	}
+	if len(content)%2 != 0 {
+		return "", "", fmt.Errorf("is truncated %s (odd number of bytes)", encoding)
+	}
+
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[i*2:])
+	}
+
+	return string(utf16.Decode(units)), encoding, nil
+}
+
+func guessUTF16(sample []byte) (binary.ByteOrder, string, bool) {
+	var evenNUL, oddNUL int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenNUL++
+		} else {
+			oddNUL++
+		}
+	}
+
+	half := len(sample) / 2
+	if half == 0 {
+		return nil, "", false
+	}
+	switch {
+	case oddNUL*10 >= half*4 && evenNUL*10 < half:
+		return binary.LittleEndian, EncodingUTF16LE, true
+	case evenNUL*10 >= half*4 && oddNUL*10 < half:
+		return binary.BigEndian, EncodingUTF16BE, true
+	}
+
+	return nil, "", false
+}
+
+func decodeLatin1(content []byte) string {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func firstInvalidUTF8(content []byte) int {
+	for offset := 0; offset < len(content); {
+		r, size := utf8.DecodeRune(content[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return offset
+		}
+		offset += size
+	}
+	return -1
+}
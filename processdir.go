@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/pipeline"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// defaultIncludePatterns are the files processed from a directory when no
+// --include is given. Whisper .json transcripts have to be included
+// explicitly, since most JSON files aren't transcripts.
+var defaultIncludePatterns = []string{"*.txt", "*.md", "*.markdown", "*.docx", "*.epub", "*.tex", "*.ipynb", "*.srt", "*.vtt"}
+
+// dirFile is one file of a directory being processed
+type dirFile struct {
+	path   string
+	rel    string
+	report *textproc.ValidationReport
+	result *pipeline.Result
+	err    error
+	// note is shown in the summary of a file processed without problems
+	note string
+}
+
+// processDir processes every file under opts.dir matching the include
+// patterns and none of the exclude patterns into one database, one run
+// per file. Files are processed concurrently, sharing the embedding and
+// summary workers; a file that fails doesn't stop the others.
+func processDir(opts processOptions) error {
+	paths, err := findInputFiles(opts.dir, opts.include, opts.exclude)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no files under %s match the include patterns", opts.dir)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// Reading every file first reports unreadable ones before any work
+	// starts
+	files := make([]*dirFile, len(paths))
+	for i, rel := range paths {
+		file := &dirFile{path: filepath.Join(opts.dir, filepath.FromSlash(rel)), rel: rel}
+		file.report, file.err = readInput(file.path, opts)
+		files[i] = file
+	}
+	return processFiles(opts, files, opts.dir, "Directory")
+}
+
+// processFiles stores the files that could be read into one database,
+// named after source, with a run per file named by its rel path. kind
+// describes source in the dry run summary.
+func processFiles(opts processOptions, files []*dirFile, source, kind string) error {
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	tokenModel := opts.embedder.model(opts.embeddingModel)
+	tokenLimit := contextTokens(tokenModel, clientOptions, opts.embedder.hosted())
+
+	var ready []*dirFile
+	totalChunks := 0
+	for _, file := range files {
+		if file.report == nil {
+			continue
+		}
+		if over := countTokens(file.report.Chunks, tokenModel, tokenLimit); len(over) > 0 {
+			fmt.Printf("%s: ", file.rel)
+			printTruncationWarning(file.report.Chunks, over, tokenModel, tokenLimit, opts.embedder.hosted())
+		}
+		totalChunks += len(file.report.Chunks)
+		ready = append(ready, file)
+	}
+
+	if opts.dryRun {
+		fmt.Println("Dry run: nothing will be embedded or written")
+		fmt.Printf("%-17s%s (%d files, %d chunks)\n", kind+":", source, len(ready), totalChunks)
+		return printDirSummary(files, true)
+	}
+	if len(ready) == 0 {
+		printDirSummary(files, false)
+		return fmt.Errorf("none of the %d files of %s could be read", len(files), source)
+	}
+
+	// The database is named after the source, so "." needs resolving
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	db, err := database.NewDB(absSource, opts.outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer db.Close()
+
+	backend, err := newProcessBackend(db, opts, clientOptions)
+	if err != nil {
+		return err
+	}
+	defer backend.close()
+	backend.linkLater = true
+
+	embedWorkers, summaryWorkers := (&pipeline.Pipeline{
+		Workers:        opts.maxWorkers,
+		EmbedWorkers:   opts.embedWorkers,
+		SummaryWorkers: opts.summaryWorkers,
+	}).StageWorkers()
+	budget := pipeline.NewBudget(embedWorkers, summaryWorkers)
+	if opts.adaptiveWorkers {
+		budget = pipeline.NewAdaptiveBudget(embedWorkers, summaryWorkers, func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		})
+	}
+	// A file in flight needs a free worker to make progress, so there is
+	// no point in starting more files than there are workers
+	fileSlots := make(chan struct{}, max(embedWorkers, summaryWorkers))
+	fmt.Printf("Processing %d files (%d chunks) into %s with up to %d embedding and %d summary workers\n",
+		len(ready), totalChunks, db.Path(), embedWorkers, summaryWorkers)
+
+	reporter := newProgress(os.Stdout)
+	var (
+		mu   sync.Mutex
+		done int
+		wg   sync.WaitGroup
+	)
+	for _, file := range ready {
+		wg.Add(1)
+		fileSlots <- struct{}{}
+		go func(file *dirFile) {
+			defer wg.Done()
+			defer func() { <-fileSlots }()
+
+			runName := file.rel
+			if opts.runName != "" {
+				runName = opts.runName + "/" + file.rel
+			}
+			p := backend.pipeline(db, file.report, runName, budget)
+			file.result, file.err = p.Run(context.Background())
+			if file.err == nil {
+				file.err = backend.recordRun(db, file.result)
+			}
+
+			mu.Lock()
+			done++
+			reporter.Report("Files", done, len(ready))
+			mu.Unlock()
+		}(file)
+	}
+	wg.Wait()
+
+	// Files were linked within themselves as they finished; link them
+	// with each other now that all of them are stored
+	similarities := 0
+	for _, groups := range crossSimilarityGroups(files, opts.languageModels) {
+		stored, err := storeCrossSimilarities(db, groups)
+		if err != nil {
+			return fmt.Errorf("failed to store similarities between files: %w", err)
+		}
+		similarities += stored
+	}
+	linked, err := storeWikilinks(db)
+	if err != nil {
+		return err
+	}
+	if err := storeNeighbors(db, opts.neighborsK); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if err := printDirSummary(files, false); err != nil {
+		return err
+	}
+	fmt.Printf("Stored %d similarities between files and %d wikilink edges\n", similarities, linked)
+	backend.printCacheStats()
+
+	failed, skipped := 0, 0
+	for _, file := range files {
+		switch {
+		case file.report == nil:
+			skipped++
+		case file.err != nil:
+			failed++
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipped %d files that could not be read\n", skipped)
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d files failed; chunks finished so far are saved, re-run with --resume to continue\n", failed, len(ready))
+		return fmt.Errorf("%d files could not be processed", failed)
+	}
+	fmt.Printf("Successfully processed %d files into database: %s\n", len(ready), db.Path())
+	return nil
+}
+
+// crossSimilarityGroups returns the stored chunks of each processed file,
+// in sets whose groups are compared with each other. Without
+// --language-model there is one set. With it, chunks embedded by different
+// models can't be compared, so there is a set per language that has its
+// own model and one for every other language.
+func crossSimilarityGroups(files []*dirFile, languageModels map[string]string) [][][]database.TextChunk {
+	sets := make(map[string][][]database.TextChunk)
+	var order []string
+	for _, file := range files {
+		if file.result == nil {
+			continue
+		}
+		byModel := make(map[string][]database.TextChunk)
+		for _, chunk := range file.result.Chunks {
+			key := ""
+			if _, ok := languageModels[chunk.Language]; ok {
+				key = chunk.Language
+			}
+			byModel[key] = append(byModel[key], chunk)
+		}
+		for key, chunks := range byModel {
+			if _, ok := sets[key]; !ok {
+				order = append(order, key)
+			}
+			sets[key] = append(sets[key], chunks)
+		}
+	}
+
+	sort.Strings(order)
+	result := make([][][]database.TextChunk, len(order))
+	for i, key := range order {
+		result[i] = sets[key]
+	}
+	return result
+}
+
+// printDirSummary prints one line per file: its chunks and whether it was
+// processed, failed or skipped
+func printDirSummary(files []*dirFile, planned bool) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "File\tStatus\tChunks\tDetails\n")
+	for _, file := range files {
+		chunks := 0
+		if file.report != nil {
+			chunks = len(file.report.Chunks)
+		}
+		status, details := "ok", file.note
+		switch {
+		case file.report == nil:
+			status, details = "skipped", file.err.Error()
+		case file.err != nil:
+			status, details = "failed", file.err.Error()
+		case planned:
+			status = "planned"
+		case len(file.result.Failed) > 0:
+			status = "partial"
+			details = fmt.Sprintf("%d chunks failed", len(file.result.Failed))
+		case file.result.Resumed > 0:
+			details = fmt.Sprintf("resumed after %d chunks", file.result.Resumed)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", file.rel, status, chunks, details)
+	}
+	return w.Flush()
+}
+
+// findInputFiles walks dir and returns the slash-separated paths, relative
+// to dir, of the files matching an include pattern and no exclude pattern.
+// Hidden files and directories, such as .git and .obsidian, are skipped.
+func findInputFiles(dir string, include, exclude []string) ([]string, error) {
+	if len(include) == 0 {
+		include = defaultIncludePatterns
+	}
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchAnyGlob(include, rel) && !matchAnyGlob(exclude, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated relative path against a glob in
+// which ** matches any number of directories. Like .gitignore, a pattern
+// without a slash matches the file name at any depth.
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(parts); skip++ {
+				if matchSegments(pattern[1:], parts[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+)
+
+// Progress modes of the --progress flag
+const (
+	progressAuto  = "auto"
+	progressBar   = "bar"
+	progressPlain = "plain"
+	progressJSON  = "json"
+	progressNone  = "none"
+)
+
+// progressMode is how every command reports progress, set by --progress
+var progressMode = progressAuto
+
+func validateProgressMode(mode string) error {
+	switch mode {
+	case progressAuto, progressBar, progressPlain, progressJSON, progressNone:
+		return nil
+	}
+	return fmt.Errorf("unknown --progress mode %q (valid: %s, %s, %s, %s, %s)", mode, progressAuto, progressBar, progressPlain, progressJSON, progressNone)
+}
+
+// newProgress returns the reporter of the --progress mode for output
+// written to w. JSON lines go to stderr, so they can be read apart from
+// the rest of the output.
+func newProgress(w io.Writer) progress.Reporter {
+	switch progressMode {
+	case progressBar:
+		return progress.Terminal(w)
+	case progressPlain:
+		return progress.Plain(w)
+	case progressJSON:
+		return progress.JSONLines(os.Stderr)
+	case progressNone:
+		return progress.Noop
+	}
+	if isTerminal(w) {
+		return progress.Terminal(w)
+	}
+	return progress.Plain(w)
+}
+
+// isTerminal reports whether w is a terminal rather than a file or pipe
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+// defaultProjectDimensions keeps a third of nomic-embed-text's 768
+const defaultProjectDimensions = 256
+
+// projectOptions holds the settings for reducing the embeddings of a
+// database
+type projectOptions struct {
+	dbPath     string
+	dimensions int
+	vacuum     bool
+}
+
+func createProjectCommand() *cobra.Command {
+	var opts projectOptions
+
+	cmd := &cobra.Command{
+		Use:   "project <database.db>",
+		Short: "Reduce the stored embeddings to fewer dimensions with PCA",
+		Long:  "Fit a principal component analysis to the stored embeddings and replace every chunk's and passage's embedding with its first --dimensions components, e.g. 768 -> 256, then recalculate the similarities as recalc does. Smaller embeddings shrink the database and speed up similarity calculation and search on large corpora, at the cost of the variance the dropped components held, which is printed and shown by stats. The projection is recorded in the database, so chunks added later, search queries and edits are projected the same way. It can't be undone except by re-embedding with embed --all, so take a backup first.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := projectDatabase(opts); err != nil {
+				log.Fatalf("Error projecting embeddings: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.dimensions, "dimensions", defaultProjectDimensions, "Number of dimensions to keep")
+	cmd.Flags().BoolVar(&opts.vacuum, "vacuum", true, "Rebuild the database file afterwards to reclaim the space the smaller embeddings free")
+
+	return cmd
+}
+
+func projectDatabase(opts projectOptions) error {
+	if opts.dimensions <= 0 {
+		return fmt.Errorf("--dimensions must be positive, got %d", opts.dimensions)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	before := databaseSize(opts.dbPath)
+	projection, err := applyProjection(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := recalculate(recalcOptions{dbPath: opts.dbPath, keepSequential: true}); err != nil {
+		return err
+	}
+	if opts.vacuum {
+		db, err := database.OpenExistingDB(opts.dbPath)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Vacuuming database...")
+		err = db.Vacuum()
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+	after := databaseSize(opts.dbPath)
+
+	fmt.Printf("Projected embeddings from %d to %d dimensions, keeping %.1f%% of their variance\n",
+		projection.SourceDimensions, projection.Dimensions(), projection.ExplainedVariance*100)
+	fmt.Printf("Database size: %s -> %s\n", formatBytes(before), formatBytes(after))
+	return nil
+}
+
+// applyProjection fits the projection to the stored embeddings and stores
+// the projected ones
+func applyProjection(opts projectOptions) (*database.Projection, error) {
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	existing, err := db.Projection()
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%s is already projected from %d to %d dimensions; re-embed it with \"bluffy embed --all\" to start over from full embeddings", opts.dbPath, existing.SourceDimensions, existing.Dimensions())
+	}
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+	passages, err := db.GetPassages()
+	if err != nil {
+		return nil, err
+	}
+	chunks = append(chunks, passages...)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%s has no chunks to project", opts.dbPath)
+	}
+
+	runs, err := db.GetRuns()
+	if err != nil {
+		return nil, err
+	}
+	normalized := make(map[int]bool, len(runs))
+	for _, run := range runs {
+		normalized[run.ID] = run.Normalized
+	}
+
+	embeddings := make([][]float64, len(chunks))
+	for i, chunk := range chunks {
+		embeddings[i] = chunk.Embedding
+	}
+	fmt.Printf("Fitting a %d-dimensional projection to %d embeddings...\n", opts.dimensions, len(embeddings))
+	projection, err := similarity.FitPCA(embeddings, opts.dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range chunks {
+		projected, err := projection.Project(chunks[i].Embedding)
+		if err != nil {
+			return nil, err
+		}
+		// Chunks of a --normalize run stay unit length
+		if normalized[chunks[i].RunID] {
+			projected = similarity.Normalize(projected)
+		}
+		chunks[i].Embedding = projected
+	}
+	if err := db.ApplyProjection(projection, chunks); err != nil {
+		return nil, err
+	}
+	return projection, nil
+}
+
+// projectEmbedding reduces an embedding to be compared with the stored
+// ones, if the database was projected
+func projectEmbedding(db *database.DB, embedding []float64) ([]float64, error) {
+	projection, err := db.Projection()
+	if err != nil || projection == nil {
+		return embedding, err
+	}
+	return projection.Project(embedding)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+// pruneOptions holds the settings for pruning a database
+type pruneOptions struct {
+	dbPath         string
+	minSimilarity  float64
+	keepSequential bool
+	vacuum         bool
+}
+
+func createPruneCommand() *cobra.Command {
+	var opts pruneOptions
+
+	cmd := &cobra.Command{
+		Use:   "prune <database.db>",
+		Short: "Shrink a database by deleting weak similarities and orphaned rows",
+		Long:  "Delete similarity rows below --min-similarity, remove orphaned rows as gc does, refresh the query planner statistics with ANALYZE, and with --vacuum rebuild the file to return the freed space. Databases that store every pair of chunks are mostly weak similarities the graph never draws.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := pruneDatabase(opts); err != nil {
+				log.Fatalf("Error pruning database: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().Float64Var(&opts.minSimilarity, "min-similarity", 0, "Delete similarities below this value (0 = keep every similarity)")
+	cmd.Flags().BoolVar(&opts.keepSequential, "keep-sequential", true, "Keep the similarity between consecutive chunks of a run, used by sequence links and /api/timeline")
+	cmd.Flags().BoolVar(&opts.vacuum, "vacuum", false, "Rebuild the database file afterwards to reclaim disk space")
+
+	return cmd
+}
+
+func pruneDatabase(opts pruneOptions) error {
+	if opts.minSimilarity < 0 || opts.minSimilarity > 1 {
+		return fmt.Errorf("--min-similarity must be between 0 and 1, got %g", opts.minSimilarity)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	before := databaseSize(opts.dbPath)
+	free, err := prune(opts)
+	if err != nil {
+		return err
+	}
+	after := databaseSize(opts.dbPath)
+
+	if opts.vacuum {
+		fmt.Printf("Database size: %s -> %s (reclaimed %s)\n", formatBytes(before), formatBytes(after), formatBytes(max(before-after, 0)))
+	} else if free > 0 {
+		fmt.Printf("%s is free inside the database file; run with --vacuum to reclaim it\n", formatBytes(free))
+	}
+	return nil
+}
+
+// prune deletes and analyzes, closing the database before its size is
+// measured. It returns the free space left inside the file.
+func prune(opts pruneOptions) (int64, error) {
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if opts.minSimilarity > 0 {
+		deleted, err := db.PruneSimilarities(opts.minSimilarity, opts.keepSequential)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Printf("Deleted %d similarities below %g\n", deleted, opts.minSimilarity)
+	}
+
+	report, err := db.CollectGarbage()
+	if err != nil {
+		return 0, err
+	}
+	printGCReport(report)
+
+	if err := db.RefreshNeighbors(); err != nil {
+		return 0, err
+	}
+
+	fmt.Println("Analyzing database...")
+	if err := db.Analyze(); err != nil {
+		return 0, err
+	}
+
+	if opts.vacuum {
+		fmt.Println("Vacuuming database...")
+		if err := db.Vacuum(); err != nil {
+			return 0, err
+		}
+	}
+	return db.FreeBytes()
+}
+
+// databaseSize returns the size of the database file and its write-ahead
+// log
+func databaseSize(dbPath string) int64 {
+	var size int64
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+// Output formats for the quick command
+const (
+	quickFormatTSV  = "tsv"
+	quickFormatJSON = "json"
+)
+
+// quickIndex is a compact copy of a database's chunks, cached on disk so
+// repeated queries skip opening SQLite. It is rebuilt whenever the database
+// size or modification time changes.
+type quickIndex struct {
+	DBSize    int64
+	DBModTime time.Time
+	Entries   []quickEntry
+	// Projection reduces queries like the database's embeddings, if they
+	// were projected
+	Projection *database.Projection
+}
+
+type quickEntry struct {
+	ID        int
+	StableID  string
+	Index     int
+	Summary   string
+	Text      string
+	Embedding []float64
+	// Model embedded the chunk; empty in indexes cached before it was
+	// recorded
+	Model string
+}
+
+// QuickResult is a single quick query match
+type QuickResult struct {
+	ID          int     `json:"id"`
+	StableID    string  `json:"stable_id"`
+	Index       int     `json:"index"`
+	Similarity  float64 `json:"similarity"`
+	RerankScore float64 `json:"rerank_score,omitempty"`
+	Summary     string  `json:"summary"`
+	Text        string  `json:"text"`
+	// ParentID and Parent are set for passage hits; Parent only when
+	// expanded
+	ParentID int   `json:"parent_chunk_id,omitempty"`
+	Parent   *Node `json:"parent,omitempty"`
+}
+
+// quickOptions holds the settings for a quick query
+type quickOptions struct {
+	dbPath         string
+	query          string
+	format         string
+	top            int
+	ollamaHost     string
+	embeddingModel string
+	ollama         ollamaFlags
+
+	rerank           bool
+	rerankCandidates int
+	rerankModel      string
+}
+
+func createQuickCommand() *cobra.Command {
+	var opts quickOptions
+
+	cmd := &cobra.Command{
+		Use:   "quick <database.db> <query>",
+		Short: "Print the chunks closest to a query, for launcher integrations",
+		Long:  "Embed a query and print the closest chunks as TSV (score, id, summary) or JSON. Chunk embeddings are kept in an index cache so repeated queries do not reopen the database.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath, opts.query = args[0], args[1]
+			if err := runQuick(os.Stdout, opts); err != nil {
+				log.Fatalf("Error running query: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.format, "format", "f", quickFormatTSV, "Output format: tsv or json")
+	cmd.Flags().IntVarP(&opts.top, "top", "n", 5, "Number of results")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", embedding.DefaultEmbeddingModel, "Ollama model used to embed the query; must match the model the database was built with")
+	addOllamaFlags(cmd, &opts.ollama, true)
+	cmd.Flags().BoolVar(&opts.rerank, "rerank", false, "Re-score the closest chunks by asking a generation model how relevant each is to the query")
+	cmd.Flags().IntVar(&opts.rerankCandidates, "rerank-candidates", 50, "Number of embedding hits passed to the reranker")
+	cmd.Flags().StringVar(&opts.rerankModel, "rerank-model", embedding.DefaultGenerationModel, "Ollama model used for reranking")
+
+	return cmd
+}
+
+func runQuick(out io.Writer, opts quickOptions) error {
+	if opts.format != quickFormatTSV && opts.format != quickFormatJSON {
+		return fmt.Errorf("unknown format %q (expected tsv or json)", opts.format)
+	}
+	if opts.top <= 0 {
+		return fmt.Errorf("top must be positive, got %d", opts.top)
+	}
+
+	index, err := loadQuickIndex(opts.dbPath)
+	if err != nil {
+		return err
+	}
+
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+	client := newOllamaClient(opts.ollamaHost, opts.embeddingModel, opts.rerankModel, clientOptions)
+	queryEmbedding, err := client.GetEmbedding(opts.query)
+	if err != nil {
+		return fmt.Errorf("failed to embed query: %w", err)
+	}
+	if index.Projection != nil {
+		if queryEmbedding, err = index.Projection.Project(queryEmbedding); err != nil {
+			return err
+		}
+	}
+
+	results := make([]QuickResult, 0, len(index.Entries))
+	for _, entry := range index.Entries {
+		// Chunks of other models, such as those of --language-model, can't
+		// be compared with the query
+		if entry.Model != "" && entry.Model != client.Model() {
+			continue
+		}
+		sim, err := similarity.CosineSimilarity(queryEmbedding, entry.Embedding)
+		if err != nil {
+			continue
+		}
+		results = append(results, QuickResult{
+			ID:         entry.ID,
+			StableID:   entry.StableID,
+			Index:      entry.Index,
+			Similarity: sim,
+			Summary:    entry.Summary,
+			Text:       entry.Text,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if opts.rerank {
+		candidates := min(max(opts.rerankCandidates, opts.top), len(results))
+		results, err = rerankResults(embedding.NewLLMReranker(client, 0), opts.query, results[:candidates])
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(results) > opts.top {
+		results = results[:opts.top]
+	}
+
+	return writeQuickResults(out, results, opts.format, opts.rerank)
+}
+
+// writeQuickResults prints results as JSON or as TSV lines of score, ID and
+// summary, where the score is the rerank score if reranked is set. Passages
+// have no summary of their own and show their parent's.
+func writeQuickResults(out io.Writer, results []QuickResult, format string, reranked bool) error {
+	if format == quickFormatJSON {
+		return json.NewEncoder(out).Encode(results)
+	}
+	for _, result := range results {
+		score := result.Similarity
+		if reranked {
+			score = result.RerankScore
+		}
+		summary := result.Summary
+		if summary == "" && result.Parent != nil {
+			summary = result.Parent.Summary
+		}
+		fmt.Fprintf(out, "%.4f\t%d\t%s\n", score, result.ID, tsvField(summary))
+	}
+	return nil
+}
+
+// rerankResults orders results by reranker score
+func rerankResults(reranker embedding.Reranker, query string, results []QuickResult) ([]QuickResult, error) {
+	byID := make(map[int]QuickResult, len(results))
+	candidates := make([]embedding.RerankCandidate, len(results))
+	for i, result := range results {
+		byID[result.ID] = result
+		candidates[i] = embedding.RerankCandidate{
+			ID:         result.ID,
+			Text:       result.Text,
+			Similarity: result.Similarity,
+		}
+	}
+
+	ranked, err := reranker.Rerank(query, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank results: %w", err)
+	}
+
+	reranked := make([]QuickResult, len(ranked))
+	for i, candidate := range ranked {
+		reranked[i] = byID[candidate.ID]
+		reranked[i].RerankScore = candidate.Score
+	}
+	return reranked, nil
+}
+
+// loadQuickIndex returns the cached index for dbPath, rebuilding it from the
+// database only when the cache is missing or stale
+func loadQuickIndex(dbPath string) (*quickIndex, error) {
+	info, err := os.Stat(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+
+	cachePath := quickIndexPath(dbPath)
+	if cachePath != "" {
+		if index, err := readQuickIndex(cachePath); err == nil &&
+			index.DBSize == info.Size() && index.DBModTime.Equal(info.ModTime()) {
+			return index, nil
+		}
+	}
+
+	db, err := database.OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+	projection, err := db.Projection()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &quickIndex{
+		DBSize:     info.Size(),
+		DBModTime:  info.ModTime(),
+		Entries:    make([]quickEntry, len(chunks)),
+		Projection: projection,
+	}
+	for i, chunk := range chunks {
+		index.Entries[i] = quickEntry{
+			ID:        chunk.ID,
+			StableID:  chunk.StableID,
+			Index:     chunk.ChunkIndex,
+			Summary:   chunk.Summary,
+			Text:      chunk.Text,
+			Embedding: chunk.Embedding,
+			Model:     chunk.EmbeddingModel,
+		}
+	}
+
+	// A cache that cannot be written only costs speed on the next run
+	if cachePath != "" {
+		if err := writeQuickIndex(cachePath, index); err != nil {
+			log.Printf("Warning: failed to write index cache: %v", err)
+		}
+	}
+
+	return index, nil
+}
+
+// quickIndexPath returns where the index for dbPath is cached, or "" if the
+// user cache directory is unavailable
+func quickIndexPath(dbPath string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(cacheDir, "bluffy", "quick-"+hex.EncodeToString(sum[:8])+".idx")
+}
+
+func readQuickIndex(path string) (*quickIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var index quickIndex
+	if err := gob.NewDecoder(file).Decode(&index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+func writeQuickIndex(path string, index *quickIndex) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".quick-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(index); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// tsvField flattens tabs and newlines so a value stays in one TSV column
+func tsvField(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
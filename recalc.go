@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/analysis"
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+// recalcOptions holds the settings for recalculating similarities
+type recalcOptions struct {
+	dbPath         string
+	metric         string
+	storeTopK      int
+	minSimilarity  float64
+	keepSequential bool
+	// separateLanguages were embedded with models of their own by process
+	// --language-model
+	separateLanguages []string
+	// allRuns compares the chunks of every run with each other
+	allRuns bool
+	// minSimilaritySet is true when --min-similarity was given; the range
+	// of similarities depends on the metric, so there is no neutral default
+	minSimilaritySet bool
+
+	// out and reporter receive the messages and progress, by default on
+	// the terminal
+	out      io.Writer
+	reporter progress.Reporter
+}
+
+// recalcResult is what recalculating the similarities stored
+type recalcResult struct {
+	Chunks         int    `json:"chunks"`
+	Compared       int    `json:"compared"`
+	Stored         int    `json:"stored"`
+	Metric         string `json:"metric"`
+	PreviousMetric string `json:"previous_metric"`
+}
+
+func createRecalcCommand() *cobra.Command {
+	var opts recalcOptions
+
+	cmd := &cobra.Command{
+		Use:   "recalc <database.db>",
+		Short: "Recalculate the similarity table from the stored embeddings",
+		Long:  "Replace every stored similarity by comparing the stored embeddings again, with a different metric, keeping only each chunk's most similar chunks, or dropping weak similarities, without embedding anything. Chunks are compared as processing compared them: within each run, and across the runs that stored similarities already link, or across every run with --all-runs. The metric is recorded in the database, so chunks added later are scored with it too.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			opts.minSimilaritySet = cmd.Flags().Changed("min-similarity")
+			if _, err := recalculate(opts); err != nil {
+				log.Fatalf("Error recalculating similarities: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.metric, "metric", "", "Similarity metric: cosine, dot or euclidean (default: the metric the database uses, cosine unless recalculated)")
+	cmd.Flags().IntVar(&opts.storeTopK, "store-top-k", 0, "Only store the similarities among each chunk's k most similar chunks (0 = every pair)")
+	cmd.Flags().Float64Var(&opts.minSimilarity, "min-similarity", 0, "Only store similarities at or above this value (default: keep them regardless of value)")
+	cmd.Flags().BoolVar(&opts.allRuns, "all-runs", false, "Compare the chunks of every run with each other, including runs no stored similarity links, e.g. after pruning")
+	cmd.Flags().StringSliceVar(&opts.separateLanguages, "separate-languages", nil, "Languages processed with --language-model, e.g. de, whose chunks are only compared with each other (repeatable)")
+	cmd.Flags().BoolVar(&opts.keepSequential, "keep-sequential", true, "Keep the similarity between consecutive chunks of a run, used by sequence links and /api/timeline")
+
+	return cmd
+}
+
+func recalculate(opts recalcOptions) (*recalcResult, error) {
+	if err := similarity.ValidateMetric(opts.metric); err != nil {
+		return nil, err
+	}
+	if opts.storeTopK < 0 {
+		return nil, fmt.Errorf("--store-top-k must not be negative, got %d", opts.storeTopK)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return nil, fmt.Errorf("cannot access database: %w", err)
+	}
+	out := opts.out
+	if out == nil {
+		out = os.Stdout
+	}
+	reporter := opts.reporter
+	if reporter == nil {
+		reporter = newProgress(out)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	previous, err := db.SimilarityMetric()
+	if err != nil {
+		return nil, err
+	}
+	if previous == "" {
+		previous = similarity.MetricCosine
+	}
+	metric := opts.metric
+	if metric == "" {
+		metric = previous
+	}
+
+	groups, err := db.ComparedChunkGroups(opts.separateLanguages, opts.allRuns)
+	if err != nil {
+		return nil, err
+	}
+	chunks := 0
+	for _, group := range groups {
+		chunks += len(group)
+	}
+	fmt.Fprintf(out, "Comparing %d chunks by %s similarity", chunks, metric)
+	if len(groups) > 1 {
+		fmt.Fprintf(out, " in %d separately compared groups", len(groups))
+	}
+	fmt.Fprintln(out, "...")
+
+	all, err := groupSimilarities(groups, metric, reporter)
+	if err != nil {
+		return nil, err
+	}
+	kept, err := selectSimilarities(all, groups, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.ReplaceSimilarities(kept, metric); err != nil {
+		return nil, err
+	}
+	if err := db.RefreshNeighbors(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Stored %d of %d similarities", len(kept), len(all))
+	if metric != previous {
+		fmt.Fprintf(out, ", now scored by %s instead of %s", metric, previous)
+	}
+	fmt.Fprintln(out)
+	return &recalcResult{Chunks: chunks, Compared: len(all), Stored: len(kept), Metric: metric, PreviousMetric: previous}, nil
+}
+
+// groupSimilarities compares every pair of chunks within each group,
+// reporting progress per chunk
+func groupSimilarities(groups [][]database.TextChunk, metric string, reporter progress.Reporter) ([]database.ChunkSimilarity, error) {
+	total := 0
+	for _, group := range groups {
+		total += len(group)
+	}
+
+	var similarities []database.ChunkSimilarity
+	done := 0
+	for _, group := range groups {
+		for i, chunk := range group {
+			// Compared against earlier chunks, each pair keeps the earlier
+			// chunk as ChunkID1
+			chunkSimilarities, err := similarity.SimilaritiesTo(chunk, group[:i], metric)
+			if err != nil {
+				return nil, err
+			}
+			similarities = append(similarities, chunkSimilarities...)
+			done++
+			reporter.Report("Similarities", done, total)
+		}
+	}
+	return similarities, nil
+}
+
+// selectSimilarities returns the similarities to store: with --store-top-k
+// those among each chunk's k most similar, with --min-similarity those at
+// or above it, and with --keep-sequential those between consecutive chunks
+// of a run whatever their value
+func selectSimilarities(similarities []database.ChunkSimilarity, groups [][]database.TextChunk, opts recalcOptions) ([]database.ChunkSimilarity, error) {
+	minSimilarity := math.Inf(-1)
+	if opts.minSimilaritySet {
+		minSimilarity = opts.minSimilarity
+	}
+	if opts.storeTopK == 0 && !opts.minSimilaritySet {
+		return similarities, nil
+	}
+
+	strategy := analysis.StrategyThreshold
+	if opts.storeTopK > 0 {
+		strategy = analysis.StrategyKNN
+	}
+	kept, err := analysis.PruneSimilarities(similarities, strategy, opts.storeTopK, minSimilarity)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.keepSequential {
+		return kept, nil
+	}
+
+	type position struct{ run, index int }
+	positions := make(map[int]position)
+	for _, group := range groups {
+		for _, chunk := range group {
+			positions[chunk.ID] = position{chunk.RunID, chunk.ChunkIndex}
+		}
+	}
+	stored := make(map[[2]int]bool, len(kept))
+	for _, sim := range kept {
+		stored[[2]int{sim.ChunkID1, sim.ChunkID2}] = true
+	}
+	for _, sim := range similarities {
+		a, b := positions[sim.ChunkID1], positions[sim.ChunkID2]
+		sequential := a.run == b.run && (a.index-b.index == 1 || b.index-a.index == 1)
+		if sequential && !stored[[2]int{sim.ChunkID1, sim.ChunkID2}] {
+			kept = append(kept, sim)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/tracing"
+)
+
+// serveState is everything serve builds from one set of options. A reload
+// builds a new one and swaps it in whole.
+type serveState struct {
+	opts            serveOptions
+	handler         http.Handler
+	dir             bool
+	refreshInterval time.Duration
+	stop            func()
+}
+
+// newServeState opens the database or directory named by opts and builds
+// its handler
+func newServeState(opts serveOptions) (*serveState, error) {
+	refreshInterval, err := parseSchedule(opts.refreshSchedule)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(opts.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access %s: %w", opts.dbPath, err)
+	}
+
+	opts.clientOptions, err = opts.ollama.options()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := newCORSPolicy(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := configureDatabases(opts); err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		// Report a wrong passphrase or a damaged database now rather than
+		// on every request
+		if err := checkDatabase(opts.dbPath, opts.readonly); err != nil {
+			return nil, err
+		}
+	}
+
+	state := &serveState{opts: opts, dir: info.IsDir(), refreshInterval: refreshInterval}
+	if state.dir {
+		directory := newDatabaseDirectory(opts, refreshInterval)
+		state.handler = directory.routes()
+		state.stop = directory.stop
+	} else {
+		server := newAPIServer(opts.dbPath, opts)
+		if refreshInterval > 0 {
+			server.scheduleRefresh(refreshInterval)
+		}
+		if opts.watchInterval > 0 {
+			server.watchDatabase(opts.watchInterval)
+		}
+		state.handler = server.routes()
+		state.stop = server.stop
+	}
+	state.handler = withSettings(state.handler)
+	rememberServed(opts.dbPath)
+
+	if opts.compress {
+		state.handler = compressResponses(state.handler)
+	}
+	if opts.debugSQL {
+		state.handler = logRequests(state.handler)
+	}
+	if tracing.Enabled() {
+		state.handler = traceRequests(state.handler)
+	}
+	cors.Store(policy)
+	return state, nil
+}
+
+// configureDatabases sets how every database is opened from now on: with
+// the vector extension, passphrase and query logging of opts, or without
+// them
+func configureDatabases(opts serveOptions) error {
+	if opts.vecExtension != "" || database.VectorSearchEnabled() {
+		database.LoadVectorExtension(opts.vecExtension)
+	}
+	useQueryLogger(opts.debugSQL)
+	return usePassphrase(opts.passphrase)
+}
+
+// serveReloader serves requests with the current serveState. Reloading
+// swaps in a state built from the re-read config file; requests already
+// being handled finish with the state they started with.
+type serveReloader struct {
+	current atomic.Pointer[serveState]
+	load    func() (serveOptions, error)
+
+	// mu serializes reloads
+	mu sync.Mutex
+}
+
+// ReloadResult is the response of POST /api/admin/reload
+type ReloadResult struct {
+	ReloadedAt time.Time `json:"reloaded_at"`
+	// Changed lists the flags whose values changed
+	Changed []string `json:"changed"`
+}
+
+func newServeReloader(state *serveState, load func() (serveOptions, error)) *serveReloader {
+	r := &serveReloader{load: load}
+	r.current.Store(state)
+	return r
+}
+
+func (r *serveReloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/api/admin/reload" {
+		r.handleReload(w, req)
+		return
+	}
+	r.current.Load().handler.ServeHTTP(w, req)
+}
+
+// reload re-reads the configuration and swaps in a new state. If the new
+// configuration can't be loaded, the current one stays in place.
+func (r *serveReloader) reload() (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	opts, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	old := r.current.Load()
+	if opts.port != old.opts.port {
+		log.Printf("Port changed to %d; restart the server to listen on it", opts.port)
+	}
+
+	state, err := newServeState(opts)
+	if err != nil {
+		// The current state keeps opening databases the way it did
+		configureDatabases(old.opts)
+		return nil, err
+	}
+	r.current.Store(state)
+	old.stop()
+
+	changed := []string{}
+	for name, value := range opts.flagValues {
+		if old.opts.flagValues[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	if len(changed) > 0 {
+		log.Printf("Reloaded configuration; changed: %s", strings.Join(changed, ", "))
+	} else {
+		log.Printf("Reloaded configuration; nothing changed")
+	}
+	return &ReloadResult{ReloadedAt: time.Now().UTC(), Changed: changed}, nil
+}
+
+// reloadOnSignal reloads the configuration whenever the process receives
+// SIGHUP, as sent by systemctl reload
+func (r *serveReloader) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if _, err := r.reload(); err != nil {
+				log.Printf("Reload failed, keeping the current configuration: %v", err)
+			}
+		}
+	}()
+}
+
+// handleReload serves POST /api/admin/reload, which is only enabled when
+// the server has an --admin-token
+func (r *serveReloader) handleReload(w http.ResponseWriter, req *http.Request) {
+	token := r.current.Load().opts.adminToken
+	if token == "" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		respondWithError(w, "Invalid or missing admin token", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := r.reload()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Reload failed, keeping the current configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, result)
+}
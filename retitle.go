@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// retitleOptions holds the settings for generating chunk titles
+type retitleOptions struct {
+	dbPath       string
+	maxWorkers   int
+	ollamaHost   string
+	summaryModel string
+	runName      string
+	missing      bool
+	ollama       ollamaFlags
+}
+
+func createRetitleCommand() *cobra.Command {
+	var opts retitleOptions
+
+	cmd := &cobra.Command{
+		Use:   "retitle <database.db>",
+		Short: "Generate a readable title for every chunk in a database",
+		Long:  "Ask the LLM for a short heading-style title for each chunk and store it in the title column, where it is used as the chunk's node label instead of the topic keywords. Use it to backfill databases processed without --titles, or --missing to title only new chunks. Chunks summarized with --summary-language are titled in that language.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runRetitle(opts); err != nil {
+				log.Fatalf("Error generating titles: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers (0 = number of CPUs)")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used to write titles")
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only title the chunks of this run")
+	cmd.Flags().BoolVar(&opts.missing, "missing", false, "Only title chunks that have no title yet")
+	addOllamaFlags(cmd, &opts.ollama, false)
+	addAutoPullFlag(cmd, &opts.ollama)
+
+	return cmd
+}
+
+func runRetitle(opts retitleOptions) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var chunks []database.TextChunk
+	if opts.runName != "" {
+		run, err := db.GetRunByName(opts.runName)
+		if err != nil {
+			return err
+		}
+		chunks, err = db.GetChunksByRun(run.ID)
+		if err != nil {
+			return err
+		}
+	} else {
+		chunks, err = db.GetAllChunks()
+		if err != nil {
+			return err
+		}
+	}
+	if opts.missing {
+		var untitled []database.TextChunk
+		for _, chunk := range chunks {
+			if chunk.Title == "" {
+				untitled = append(untitled, chunk)
+			}
+		}
+		chunks = untitled
+	}
+	if len(chunks) == 0 {
+		fmt.Println("No chunks to title")
+		return nil
+	}
+
+	client := newOllamaClient(opts.ollamaHost, "", opts.summaryModel, clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return err
+	}
+	if err := client.CheckModelsAvailable(); err != nil {
+		return err
+	}
+
+	if err := generateTitles(db, client, chunks, opts.maxWorkers); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored titles for %d chunks in %s\n", len(chunks), db.Path())
+	return nil
+}
+
+// generateTitles asks the LLM for a title for each chunk and stores them.
+// Chunks are titled in the language their summaries were written in.
+func generateTitles(db *database.DB, client *embedding.OllamaClient, chunks []database.TextChunk, maxWorkers int) error {
+	fmt.Println("Generating titles with the LLM...")
+
+	byLanguage := make(map[string][]database.TextChunk)
+	var languages []string
+	for _, chunk := range chunks {
+		if _, ok := byLanguage[chunk.SummaryLanguage]; !ok {
+			languages = append(languages, chunk.SummaryLanguage)
+		}
+		byLanguage[chunk.SummaryLanguage] = append(byLanguage[chunk.SummaryLanguage], chunk)
+	}
+
+	reporter := newProgress(os.Stdout)
+	titles := make(map[int]string, len(chunks))
+	for _, language := range languages {
+		group := byLanguage[language]
+		texts := make([]string, len(group))
+		for i, chunk := range group {
+			texts[i] = chunk.Text
+		}
+
+		done := len(titles)
+		results, err := client.WithSummaryLanguage(language).GetTitlesConcurrent(texts, maxWorkers, func(completed, total int) {
+			reporter.Report("Titles", done+completed, len(chunks))
+		})
+		if err != nil {
+			return err
+		}
+		for i, chunk := range group {
+			titles[chunk.ID] = results[i]
+		}
+	}
+
+	if err := db.SetTitles(titles); err != nil {
+		return fmt.Errorf("failed to store titles: %w", err)
+	}
+	return nil
+}
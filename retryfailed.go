@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+// retryFailedOptions holds the settings for retrying failed chunks
+type retryFailedOptions struct {
+	dbPath         string
+	runName        string
+	maxWorkers     int
+	embedWorkers   int
+	summaryWorkers int
+	ollamaHost     string
+	embeddingModel string
+	summaryModel   string
+	summaryStyles  []string
+	ollama         ollamaFlags
+	embedder       embedderFlags
+	// providerSet is true when --embed-provider was given, overriding the
+	// provider recorded on each run
+	providerSet bool
+	// summaryLanguage is the ISO 639-1 code summaries are written in
+	summaryLanguage string
+}
+
+func createRetryFailedCommand() *cobra.Command {
+	var opts retryFailedOptions
+
+	cmd := &cobra.Command{
+		Use:   "retry-failed <database.db>",
+		Short: "Process the chunks that failed in runs with --continue-on-error",
+		Long:  "Embed and summarize the chunks recorded in the failed_chunks table by process --continue-on-error, add them to their runs, and update each run's similarities. Chunks are embedded with the provider and model recorded on their run unless --embed-provider or --embedding-model is given. Chunks that fail again stay recorded for another retry.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			opts.providerSet = cmd.Flags().Changed("embed-provider")
+			if err := retryFailed(opts); err != nil {
+				log.Fatalf("Error retrying failed chunks: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only retry the failed chunks of this run (default: every run)")
+	cmd.Flags().IntVarP(&opts.maxWorkers, "workers", "w", 1, "Maximum number of concurrent workers")
+	cmd.Flags().IntVar(&opts.embedWorkers, "embed-workers", 0, "Maximum number of chunks embedded at once (0 = --workers)")
+	cmd.Flags().IntVar(&opts.summaryWorkers, "summary-workers", 0, "Maximum number of chunks summarized at once (0 = --workers)")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", "", "Model used for embeddings (default: the model recorded on each run)")
+	cmd.Flags().StringVar(&opts.summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used for summaries")
+	cmd.Flags().StringSliceVar(&opts.summaryStyles, "summary-style", []string{embedding.SummaryTopic}, "Summary styles to generate: topic, sentence, paragraph, bullets (repeatable; the topic label is always generated)")
+	cmd.Flags().StringVar(&opts.summaryLanguage, "summary-language", "", "Write summaries and titles in this language, e.g. de or ja, whatever the language of the text (default: the model's choice)")
+	addOllamaFlags(cmd, &opts.ollama, true)
+	addAutoPullFlag(cmd, &opts.ollama)
+	addEmbedderFlags(cmd, &opts.embedder)
+
+	return cmd
+}
+
+func retryFailed(opts retryFailedOptions) error {
+	if err := embedding.ValidateSummaryStyles(opts.summaryStyles); err != nil {
+		return err
+	}
+	if err := embedding.ValidateSummaryLanguage(opts.summaryLanguage); err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	failures, err := db.GetFailedChunks()
+	if err != nil {
+		return err
+	}
+	runs, err := db.GetRuns()
+	if err != nil {
+		return err
+	}
+
+	byRun := make(map[int][]database.TextChunk)
+	for _, failure := range failures {
+		byRun[failure.RunID] = append(byRun[failure.RunID], failure.Chunk)
+	}
+
+	retried := 0
+	for _, run := range runs {
+		chunks := byRun[run.ID]
+		if len(chunks) == 0 || (opts.runName != "" && run.Name != opts.runName) {
+			continue
+		}
+		retried++
+		fmt.Printf("Retrying %d failed chunks of run %q\n", len(chunks), run.Name)
+		if err := retryRun(db, run, chunks, opts); err != nil {
+			return fmt.Errorf("run %q: %w", run.Name, err)
+		}
+	}
+
+	if retried == 0 {
+		if opts.runName != "" {
+			fmt.Printf("Run %q has no failed chunks\n", opts.runName)
+		} else {
+			fmt.Println("No failed chunks to retry")
+		}
+	}
+	return nil
+}
+
+// retryRun resumes a run with its failed chunks, so they are stored in the
+// run and its similarities are brought up to date
+func retryRun(db *database.DB, run database.Run, chunks []database.TextChunk, opts retryFailedOptions) error {
+	embedder := opts.embedder
+	if !opts.providerSet && run.EmbeddingProvider != "" {
+		embedder.provider = run.EmbeddingProvider
+	}
+	if err := embedder.validate(); err != nil {
+		return err
+	}
+	model := opts.embeddingModel
+	if model == "" {
+		model = run.EmbeddingModel
+	}
+	if model == "" {
+		model = embedding.DefaultEmbeddingModel
+	}
+
+	metric, err := db.SimilarityMetric()
+	if err != nil {
+		return err
+	}
+	projection, err := db.Projection()
+	if err != nil {
+		return err
+	}
+
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+	clientOptions.GenerationOnly = embedder.hosted()
+	client := newOllamaClient(opts.ollamaHost, model, opts.summaryModel, clientOptions)
+	client.SetSummaryLanguage(opts.summaryLanguage)
+	ollama := &pipeline.Ollama{Client: client, Styles: opts.summaryStyles}
+
+	var stepEmbedder pipeline.Embedder = ollama
+	if embedder.hosted() {
+		hosted, err := embedder.hostedClient(model, opts.ollama.truncate)
+		if err != nil {
+			return err
+		}
+		stepEmbedder = &pipeline.Hosted{Client: hosted}
+	}
+
+	p := &pipeline.Pipeline{
+		Chunker:         pipeline.Chunks(chunks),
+		Embedder:        stepEmbedder,
+		Summarizer:      ollama,
+		Store:           db,
+		Workers:         opts.maxWorkers,
+		EmbedWorkers:    opts.embedWorkers,
+		SummaryWorkers:  opts.summaryWorkers,
+		Source:          run.Source,
+		RunName:         run.Name,
+		Resume:          true,
+		ContinueOnError: true,
+		Normalize:       run.Normalized,
+		Projection:      projection,
+		Metric:          metric,
+		Progress:        newProgress(os.Stdout),
+		Logf: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
+	}
+	result, err := p.Run(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := db.RefreshNeighbors(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored %d of %d chunks", len(chunks)-len(result.Failed), len(chunks))
+	if len(result.Failed) > 0 {
+		fmt.Printf("; %d failed again and stay recorded", len(result.Failed))
+	}
+	fmt.Printf(" (%d similarities)\n", result.Similarities)
+	return nil
+}
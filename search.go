@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 100
+)
+
+// searchOptions holds the settings for a search
+type searchOptions struct {
+	dbPath         string
+	query          string
+	format         string
+	top            int
+	ollamaHost     string
+	embeddingModel string
+	vecExtension   string
+	reindex        bool
+	ollama         ollamaFlags
+	embedder       embedderFlags
+}
+
+func createSearchCommand() *cobra.Command {
+	var opts searchOptions
+
+	cmd := &cobra.Command{
+		Use:   "search <database.db> <query>",
+		Short: "Find the chunks most similar to a query",
+		Long:  "Embed a query and print the most similar chunks. With --vec-extension the nearest-neighbor query runs inside SQLite using the sqlite-vec extension, which keeps a vector index in the database and avoids loading every embedding into memory.",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath, opts.query = args[0], args[1]
+			if err := runSearch(opts); err != nil {
+				log.Fatalf("Error searching: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.format, "format", "f", quickFormatTSV, "Output format: tsv or json")
+	cmd.Flags().IntVarP(&opts.top, "top", "n", defaultSearchLimit, "Number of results")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.embeddingModel, "embedding-model", embedding.DefaultEmbeddingModel, "Model used to embed the query; must match the model the database was built with")
+	addOllamaFlags(cmd, &opts.ollama, true)
+	addEmbedderFlags(cmd, &opts.embedder)
+	cmd.Flags().StringVar(&opts.vecExtension, "vec-extension", "", "Path to the sqlite-vec loadable extension (e.g. ./vec0.so) to search with an in-database vector index")
+	cmd.Flags().BoolVar(&opts.reindex, "reindex", false, "Rebuild the sqlite-vec index from scratch, e.g. after switching embedding models")
+
+	return cmd
+}
+
+func runSearch(opts searchOptions) error {
+	if opts.format != quickFormatTSV && opts.format != quickFormatJSON {
+		return fmt.Errorf("unknown format %q (expected tsv or json)", opts.format)
+	}
+	if opts.top <= 0 {
+		return fmt.Errorf("top must be positive, got %d", opts.top)
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	if opts.vecExtension != "" {
+		database.LoadVectorExtension(opts.vecExtension)
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if opts.reindex {
+		if !database.VectorSearchEnabled() {
+			return fmt.Errorf("--reindex requires --vec-extension")
+		}
+		if err := db.DropVectorIndex(); err != nil {
+			return err
+		}
+	}
+
+	embed, err := queryEmbedder(opts.ollamaHost, opts.embeddingModel, opts.ollama, opts.embedder)
+	if err != nil {
+		return err
+	}
+	queryEmbedding, err := embed(opts.query)
+	if err != nil {
+		return fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	results, err := searchChunks(db, queryEmbedding, opts.embedder.model(opts.embeddingModel), opts.top)
+	if err != nil {
+		return err
+	}
+	if err := expandParents(db, results); err != nil {
+		return err
+	}
+	return writeQuickResults(os.Stdout, results, opts.format, false)
+}
+
+// searchChunks returns the k chunks or passages most similar to a query
+// embedding computed by model. Chunks embedded by other models, such as
+// those routed with process --language-model, are skipped. When the
+// sqlite-vec extension is loaded the vector index is brought up to date and
+// queried in SQL; otherwise every embedding is loaded and compared. A
+// read-only database can't update the index, so an outdated one is passed
+// over for comparing every embedding, as is the index of a database with
+// chunks of several models. The query is projected first if the database's
+// embeddings were.
+func searchChunks(db *database.DB, queryEmbedding []float64, model string, k int) ([]QuickResult, error) {
+	queryEmbedding, err := projectEmbedding(db, queryEmbedding)
+	if err != nil {
+		return nil, err
+	}
+	models, err := db.EmbeddingModels()
+	if err != nil {
+		return nil, err
+	}
+	indexed, comparable := database.VectorSearchEnabled(), false
+	for _, stored := range models {
+		if stored == "" || stored == model {
+			comparable = true
+		} else {
+			// The index holds every chunk and can't skip other models'
+			indexed = false
+		}
+	}
+	if len(models) > 0 && !comparable {
+		return nil, fmt.Errorf("the chunks were embedded with %s, not %s; embed the query with the same model", strings.Join(models, ", "), model)
+	}
+	if indexed && db.ReadOnly() {
+		indexed, err = db.VectorIndexCurrent()
+	} else if indexed {
+		_, err = db.SyncVectorIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if indexed {
+		matches, err := db.SearchVectorIndex(queryEmbedding, k)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]int, len(matches))
+		for i, match := range matches {
+			ids[i] = match.ChunkID
+		}
+		chunks, err := db.GetChunksByID(ids)
+		if err != nil {
+			return nil, err
+		}
+		similarities := make(map[int]float64, len(matches))
+		for _, match := range matches {
+			similarities[match.ChunkID] = match.Similarity
+		}
+
+		results := make([]QuickResult, len(chunks))
+		for i, chunk := range chunks {
+			results[i] = newQuickResult(chunk, similarities[chunk.ID])
+		}
+		return results, nil
+	}
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return nil, err
+	}
+	passages, err := db.GetPassages()
+	if err != nil {
+		return nil, err
+	}
+	chunks = embeddedWith(append(chunks, passages...), model)
+
+	results := make([]QuickResult, 0, len(chunks))
+	for _, chunk := range chunks {
+		sim, err := similarity.CosineSimilarity(queryEmbedding, chunk.Embedding)
+		if err != nil {
+			continue
+		}
+		results = append(results, newQuickResult(chunk, sim))
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func newQuickResult(chunk database.TextChunk, sim float64) QuickResult {
+	return QuickResult{
+		ID:         chunk.ID,
+		StableID:   chunk.StableID,
+		Index:      chunk.ChunkIndex,
+		Similarity: sim,
+		Summary:    chunk.Summary,
+		Text:       chunk.Text,
+		ParentID:   chunk.ParentID,
+	}
+}
+
+// expandParents attaches the chunk each passage was split from, so a
+// precise hit can be shown with its surrounding section
+func expandParents(db *database.DB, results []QuickResult) error {
+	var ids []int
+	for _, result := range results {
+		if result.ParentID != 0 {
+			ids = append(ids, result.ParentID)
+		}
+	}
+	parents, err := db.GetChunksByID(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]database.TextChunk, len(parents))
+	for _, parent := range parents {
+		byID[parent.ID] = parent
+	}
+
+	for i, result := range results {
+		if parent, ok := byID[result.ParentID]; ok {
+			node := newNode(parent)
+			results[i].Parent = &node
+		}
+	}
+	return nil
+}
+
+func (s *APIServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			respondWithError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	queryEmbedding, err := s.client.GetEmbedding(query)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to embed query: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	// Searching may update the vector index
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	results, err := searchChunks(db, queryEmbedding, s.client.Model(), limit)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("expand") == "parent" {
+		if err := expandParents(db, results); err != nil {
+			respondWithError(w, fmt.Sprintf("Failed to load parent chunks: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	respondWithJSON(w, results)
+}
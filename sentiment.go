@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/spf13/cobra"
+)
+
+// sentimentOptions holds the settings for scoring sentiment
+type sentimentOptions struct {
+	dbPath       string
+	maxWorkers   int
+	ollamaHost   string
+	summaryModel string
+	runName      string
+	missing      bool
+	ollama       ollamaFlags
+}
+
+func createSentimentCommand() *cobra.Command {
+	var opts sentimentOptions
+
+	cmd := &cobra.Command{
+		Use:   "sentiment <database.db>",
+		Short: "Score the emotional tone of every chunk in a database",
+		Long:  "Ask the LLM to rate the emotional valence of each chunk from -1 (negative) to 1 (positive) and store it in the sentiment column, so the graph can be colored by tone and the emotional arc of a memoir or novel plotted over its chunks.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runSentiment(opts); err != nil {
+				log.Fatalf("Error scoring sentiment: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers (0 = number of CPUs)")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used to score sentiment")
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only score the chunks of this run")
+	cmd.Flags().BoolVar(&opts.missing, "missing", false, "Only score chunks that have no sentiment yet")
+	addOllamaFlags(cmd, &opts.ollama, false)
+	addAutoPullFlag(cmd, &opts.ollama)
+
+	return cmd
+}
+
+func runSentiment(opts sentimentOptions) error {
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var chunks []database.TextChunk
+	if opts.runName != "" {
+		run, err := db.GetRunByName(opts.runName)
+		if err != nil {
+			return err
+		}
+		chunks, err = db.GetChunksByRun(run.ID)
+		if err != nil {
+			return err
+		}
+	} else {
+		chunks, err = db.GetAllChunks()
+		if err != nil {
+			return err
+		}
+	}
+	if opts.missing {
+		var unscored []database.TextChunk
+		for _, chunk := range chunks {
+			if chunk.Sentiment == nil {
+				unscored = append(unscored, chunk)
+			}
+		}
+		chunks = unscored
+	}
+	if len(chunks) == 0 {
+		fmt.Println("No chunks to score")
+		return nil
+	}
+
+	client := newOllamaClient(opts.ollamaHost, "", opts.summaryModel, clientOptions)
+	if err := client.CheckConnection(); err != nil {
+		return err
+	}
+	if err := client.CheckModelsAvailable(); err != nil {
+		return err
+	}
+
+	if err := scoreSentiment(db, client, chunks, opts.maxWorkers); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored sentiment for %d chunks in %s\n", len(chunks), db.Path())
+	return nil
+}
+
+// scoreSentiment asks the LLM for the emotional valence of each chunk and
+// stores the scores
+func scoreSentiment(db *database.DB, client *embedding.OllamaClient, chunks []database.TextChunk, maxWorkers int) error {
+	fmt.Println("Scoring sentiment with the LLM...")
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	reporter := newProgress(os.Stdout)
+	results, err := client.GetSentimentConcurrent(texts, maxWorkers, func(completed, total int) {
+		reporter.Report("Sentiment", completed, total)
+	})
+	if err != nil {
+		return err
+	}
+
+	scores := make(map[int]float64, len(chunks))
+	for i, chunk := range chunks {
+		scores[chunk.ID] = results[i]
+	}
+	if err := db.SetSentiments(scores); err != nil {
+		return fmt.Errorf("failed to store sentiment: %w", err)
+	}
+	return nil
+}
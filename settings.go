@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecentDatabases is how many databases the recents list keeps
+const maxRecentDatabases = 10
+
+// maxSettingsBytes limits the body of PUT /api/settings
+const maxSettingsBytes = 64 << 10
+
+// Settings are the visualizer's preferences, kept between launches in the
+// user's config directory
+type Settings struct {
+	OllamaHost     string `json:"ollama_host,omitempty"`
+	Workers        int    `json:"workers,omitempty"`
+	EmbedWorkers   int    `json:"embed_workers,omitempty"`
+	SummaryWorkers int    `json:"summary_workers,omitempty"`
+	// MinSimilarity is the graph threshold last chosen
+	MinSimilarity *float64 `json:"min_similarity,omitempty"`
+}
+
+// RecentDatabase is a database serve opened, most recent first
+type RecentDatabase struct {
+	Path     string    `json:"path"`
+	OpenedAt time.Time `json:"opened_at"`
+	// Exists is false once the file has been moved or deleted
+	Exists bool `json:"exists"`
+}
+
+// recentDatabase is an entry of the recents list as stored
+type recentDatabase struct {
+	Path     string    `json:"path"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// settingsFile is the JSON stored at settingsPath
+type settingsFile struct {
+	Settings        Settings         `json:"settings"`
+	RecentDatabases []recentDatabase `json:"recent_databases,omitempty"`
+}
+
+// settingsMu serializes reading and rewriting the settings file
+var settingsMu sync.Mutex
+
+// settingsPath is where settings and recent databases are stored
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "bluffy", "settings.json"), nil
+}
+
+// readSettingsFile returns the stored settings, or empty ones if none
+// were saved yet
+func readSettingsFile() (settingsFile, error) {
+	var file settingsFile
+	path, err := settingsPath()
+	if err != nil {
+		return file, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse settings file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// writeSettingsFile replaces the settings file, through a temporary file so
+// a crash doesn't leave it half written
+func writeSettingsFile(file settingsFile) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create settings directory: %w", err)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// loadSettings returns the saved settings
+func loadSettings() (Settings, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	file, err := readSettingsFile()
+	return file.Settings, err
+}
+
+// saveSettings stores settings, keeping the recents list
+func saveSettings(settings Settings) error {
+	if err := settings.validate(); err != nil {
+		return err
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	file, err := readSettingsFile()
+	if err != nil {
+		return err
+	}
+	file.Settings = settings
+	return writeSettingsFile(file)
+}
+
+func (s Settings) validate() error {
+	if s.OllamaHost != "" {
+		if u, err := url.Parse(s.OllamaHost); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid ollama_host %q: use a URL such as http://localhost:11434", s.OllamaHost)
+		}
+	}
+	if s.Workers < 0 || s.EmbedWorkers < 0 || s.SummaryWorkers < 0 {
+		return fmt.Errorf("worker counts must not be negative")
+	}
+	if s.MinSimilarity != nil && (*s.MinSimilarity < -1 || *s.MinSimilarity > 1) {
+		return fmt.Errorf("min_similarity must be between -1 and 1, got %g", *s.MinSimilarity)
+	}
+	return nil
+}
+
+// recentDatabases returns the databases serve opened, most recent first
+func recentDatabases() ([]RecentDatabase, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	file, err := readSettingsFile()
+	if err != nil {
+		return nil, err
+	}
+	recent := make([]RecentDatabase, len(file.RecentDatabases))
+	for i, db := range file.RecentDatabases {
+		_, err := os.Stat(db.Path)
+		recent[i] = RecentDatabase{Path: db.Path, OpenedAt: db.OpenedAt, Exists: err == nil}
+	}
+	return recent, nil
+}
+
+// rememberDatabase moves path to the front of the recents list
+func rememberDatabase(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	file, err := readSettingsFile()
+	if err != nil {
+		return err
+	}
+	recent := []recentDatabase{{Path: abs, OpenedAt: time.Now().UTC()}}
+	for _, db := range file.RecentDatabases {
+		if db.Path != abs && len(recent) < maxRecentDatabases {
+			recent = append(recent, db)
+		}
+	}
+	file.RecentDatabases = recent
+	return writeSettingsFile(file)
+}
+
+// withSettings serves /api/settings and /api/recent-databases, which
+// belong to the user rather than to a database, in front of handler.
+// Only pages of this machine may change settings or read the recents list,
+// which names paths on it. --readonly doesn't apply, since neither touches
+// a database.
+func withSettings(handler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/settings", enableCORS(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			sameOrigin(handleSettings)(w, r)
+			return
+		}
+		handleSettings(w, r)
+	}))
+	mux.HandleFunc("/api/recent-databases", sameOrigin(handleRecentDatabases))
+	mux.Handle("/", handler)
+	return mux
+}
+
+// sameOrigin rejects requests a browser sends from a page of another site.
+// A page is let through if it has the server's own origin, or if both it
+// and the server are on a loopback address, like the visualizer's
+// development server calling a local serve. Web sites can't have either
+// origin, so they can't use the handler.
+func sameOrigin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !(strings.EqualFold(u.Host, r.Host) || isLoopback(u.Hostname()) && isLoopback(hostname(r.Host))) {
+				respondWithError(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// hostname strips the port from a Host header
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// isLoopback reports whether host names this machine
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleSettings serves GET /api/settings, and PUT /api/settings, which
+// updates the fields given and keeps the others
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		settings, err := loadSettings()
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBytes)).Decode(&settings); err != nil {
+			respondWithError(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := settings.validate(); err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := saveSettings(settings); err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := loadSettings()
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, settings)
+}
+
+// handleRecentDatabases serves GET /api/recent-databases
+func handleRecentDatabases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	recent, err := recentDatabases()
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, recent)
+}
+
+// rememberServed adds the database or directory serve opened to the
+// recents list. Failing to is not worth refusing to serve over.
+func rememberServed(path string) {
+	if err := rememberDatabase(path); err != nil {
+		log.Printf("Warning: failed to record %s in recent databases: %v", path, err)
+	}
+}
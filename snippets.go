@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+	"github.com/jcpsimmons/bluffy/pkg/similarity"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+const (
+	// snippetRunName is the run that chunks added through the API belong to
+	snippetRunName = "snippets"
+
+	maxSnippetBytes         = 64 << 10
+	defaultSnippetNeighbors = 5
+)
+
+type snippetRequest struct {
+	Text      string `json:"text"`
+	Neighbors int    `json:"neighbors,omitempty"`
+}
+
+// Neighbor is a stored chunk ranked by similarity to another chunk or query
+type Neighbor struct {
+	ID         int     `json:"id"`
+	StableID   string  `json:"stable_id"`
+	Index      int     `json:"index"`
+	Summary    string  `json:"summary"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"`
+}
+
+type snippetResponse struct {
+	Chunk     Node       `json:"chunk"`
+	Neighbors []Neighbor `json:"neighbors"`
+}
+
+func (s *APIServer) handleSnippets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req snippetRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		respondWithError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	chunk, neighbors, err := s.ingestSnippet(req.Text, "", snippetRunName, req.Neighbors)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, snippetResponse{
+		Chunk:     newNode(*chunk),
+		Neighbors: neighbors,
+	})
+}
+
+// ingestSnippet embeds and summarizes a short text, stores it as a chunk of
+// the named run, links it into the similarity graph, and returns its k
+// nearest neighbors
+func (s *APIServer) ingestSnippet(text, section, runName string, k int) (*database.TextChunk, []Neighbor, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil, fmt.Errorf("text is required")
+	}
+	if k <= 0 {
+		k = defaultSnippetNeighbors
+	}
+
+	stored, existing, similarities, err := s.ingestChunks([]string{text}, section, runName, progress.Noop)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &stored[0], nearestNeighbors(existing, similarities[0], k), nil
+}
+
+// ingestChunks embeds and summarizes texts, stores them as consecutive
+// chunks of the named run and links each into the similarity graph. It
+// returns the new chunks, the chunks stored before them with the same
+// embedding model, and the
+// similarities of each new chunk to every chunk stored before it, with the
+// earlier chunk as ChunkID1. Embedding and summarizing are reported to
+// reporter.
+func (s *APIServer) ingestChunks(texts []string, section, runName string, reporter progress.Reporter) ([]database.TextChunk, []database.TextChunk, [][]database.ChunkSimilarity, error) {
+	chunks := make([]database.TextChunk, len(texts))
+	for i, text := range texts {
+		embeddingVector, err := s.client.GetEmbedding(text)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to embed snippet: %w", err)
+		}
+		summary, err := s.client.GetSummary(text)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to summarize snippet: %w", err)
+		}
+		chunks[i] = database.TextChunk{
+			Text:       text,
+			Embedding:  embeddingVector,
+			Summary:    summary,
+			Section:    section,
+			Language:   textproc.DetectLanguage(text),
+			TokenCount: embedding.CountTokens(s.client.Model(), text),
+			// The API run has no model of its own
+			EmbeddingModel: s.client.Model(),
+		}
+		reporter.Report("Embedding and summarizing", i+1, len(texts))
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	db, err := s.openDB()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	existing, err := db.GetAllChunks()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Only chunks of the server's model can be compared with new ones
+	existing = embeddedWith(existing, s.client.Model())
+
+	run, err := db.GetOrCreateRun(runName, "api")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	index, err := db.NextChunkIndex(run.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	metric, err := db.SimilarityMetric()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Snippets added to a projected database are projected like its chunks
+	projection, err := db.Projection()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if projection != nil {
+		for i := range chunks {
+			if chunks[i].Embedding, err = projection.Project(chunks[i].Embedding); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	// Each chunk's similarities are computed before it is inserted so a
+	// dimension mismatch with the stored embeddings doesn't leave an unlinked
+	// chunk behind. New chunks share a model, so only the first can fail.
+	compared := existing[:len(existing):len(existing)]
+	similarities := make([][]database.ChunkSimilarity, len(chunks))
+	for i := range chunks {
+		chunks[i].RunID = run.ID
+		chunks[i].ChunkIndex = index + i
+		if similarities[i], err = similarity.SimilaritiesTo(chunks[i], compared, metric); err != nil {
+			return nil, nil, nil, err
+		}
+
+		if err := db.InsertChunk(&chunks[i]); err != nil {
+			return nil, nil, nil, err
+		}
+		for j := range similarities[i] {
+			similarities[i][j].ChunkID2 = chunks[i].ID
+		}
+		if err := db.BatchInsertSimilarities(similarities[i]); err != nil {
+			return nil, nil, nil, err
+		}
+		compared = append(compared, chunks[i])
+	}
+
+	ids := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunk.ID
+	}
+	if err := db.RefreshChunkNeighbors(ids); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return chunks, existing, similarities, nil
+}
+
+// nearestNeighbors returns the k chunks with the highest similarity, where
+// each similarity's ChunkID1 identifies the neighbor
+func nearestNeighbors(chunks []database.TextChunk, similarities []database.ChunkSimilarity, k int) []Neighbor {
+	byID := make(map[int]database.TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+
+	ranked := make([]database.ChunkSimilarity, len(similarities))
+	copy(ranked, similarities)
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Similarity != ranked[j].Similarity {
+			return ranked[i].Similarity > ranked[j].Similarity
+		}
+		return ranked[i].ChunkID1 < ranked[j].ChunkID1
+	})
+	if len(ranked) > k {
+		ranked = ranked[:k]
+	}
+
+	neighbors := make([]Neighbor, 0, len(ranked))
+	for _, sim := range ranked {
+		chunk := byID[sim.ChunkID1]
+		neighbors = append(neighbors, Neighbor{
+			ID:         chunk.ID,
+			StableID:   chunk.StableID,
+			Index:      chunk.ChunkIndex,
+			Summary:    chunk.Summary,
+			Text:       chunk.Text,
+			Similarity: sim.Similarity,
+		})
+	}
+	return neighbors
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// Stores process can write to
+const (
+	storeSQLite   = "sqlite"
+	storePostgres = "postgres"
+)
+
+// validateStore checks --store and --dsn. Postgres holds runs, chunks and
+// similarities only, so the options that store anything else are rejected
+// rather than silently dropped.
+func (opts processOptions) validateStore() error {
+	switch opts.store {
+	case storeSQLite:
+		return nil
+	case storePostgres:
+	default:
+		return fmt.Errorf("unknown store %q: must be %s or %s", opts.store, storeSQLite, storePostgres)
+	}
+
+	if opts.dsn == "" {
+		return fmt.Errorf("--store=postgres requires --dsn or $BLUFFY_DSN")
+	}
+	unsupported := []struct {
+		set  bool
+		flag string
+	}{
+		{opts.dir != "", "--dir"},
+		{opts.bib != "", "--bib"},
+		{opts.citations, "--citations"},
+		{opts.keywordMethod != "", "--keywords"},
+		{opts.entities, "--entities"},
+		{opts.sentiment, "--sentiment"},
+		{opts.titles, "--titles"},
+		{opts.passageSize > 0, "--passage-size"},
+		{opts.passphrase != "", "--passphrase"},
+		{opts.debugSQL, "--debug-sql"},
+	}
+	for _, option := range unsupported {
+		if option.set {
+			return fmt.Errorf("%s is not supported with --store=postgres", option.flag)
+		}
+	}
+	return nil
+}
+
+// openStore opens the database a process run stores into, creating or
+// upgrading its tables
+func (opts processOptions) openStore() (database.Store, error) {
+	if opts.store == storePostgres {
+		return database.OpenPostgres(opts.dsn)
+	}
+	db, err := database.NewDB(opts.inputFile, opts.outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database: %w", err)
+	}
+	return db, nil
+}
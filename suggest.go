@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+)
+
+// Suggestion kinds
+const (
+	suggestionKeyword = "keyword"
+	suggestionSummary = "summary"
+)
+
+// Suggestion is an autocomplete candidate drawn from the corpus. Count is
+// the number of chunks it occurs in.
+type Suggestion struct {
+	Text  string `json:"text"`
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+func (s *APIServer) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if prefix == "" {
+		respondWithError(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSuggestLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			respondWithError(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSuggestLimit)
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	keywords, err := db.GetAllKeywords()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get keywords: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, suggest(prefix, chunks, keywords, limit))
+}
+
+// suggest returns keywords starting with prefix and summaries containing a
+// word that starts with it, most frequent first. Keywords rank ahead of
+// summaries with the same count since they make shorter completions.
+func suggest(prefix string, chunks []database.TextChunk, keywords []database.ChunkKeyword, limit int) []Suggestion {
+	keywordCounts := make(map[string]int)
+	for _, keyword := range keywords {
+		if strings.HasPrefix(strings.ToLower(keyword.Keyword), prefix) {
+			keywordCounts[keyword.Keyword]++
+		}
+	}
+
+	summaryCounts := make(map[string]int)
+	for _, chunk := range chunks {
+		summary := strings.TrimSpace(chunk.Summary)
+		if summary == "" {
+			continue
+		}
+		for _, token := range textproc.Tokenize(summary) {
+			if strings.HasPrefix(token, prefix) {
+				summaryCounts[summary]++
+				break
+			}
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(keywordCounts)+len(summaryCounts))
+	for text, count := range keywordCounts {
+		suggestions = append(suggestions, Suggestion{Text: text, Kind: suggestionKeyword, Count: count})
+	}
+	for text, count := range summaryCounts {
+		suggestions = append(suggestions, Suggestion{Text: text, Kind: suggestionSummary, Count: count})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Kind != b.Kind {
+			return a.Kind == suggestionKeyword
+		}
+		return a.Text < b.Text
+	})
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
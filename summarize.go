@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+// summarizeOptions holds the settings for summarizing the chunks of a
+// database
+type summarizeOptions struct {
+	dbPath          string
+	maxWorkers      int
+	batchSize       int
+	ollamaHost      string
+	summaryModel    string
+	summaryStyles   []string
+	summaryLanguage string
+	runName         string
+	missing         bool
+	ollama          ollamaFlags
+}
+
+func createSummarizeCommand() *cobra.Command {
+	var opts summarizeOptions
+
+	cmd := &cobra.Command{
+		Use:   "summarize <database.db>",
+		Short: "Summarize the stored chunks of a database again, without embedding them",
+		Long:  "Generate summaries for the chunks of an existing database with the LLM, replacing the stored ones, without re-chunking or re-embedding anything. Use it to add sentence, paragraph or bullet summaries to a database processed without them, or to rewrite summaries with another model or language. Summaries are stored after every --batch-size chunks, so an interrupted run can be continued with --missing.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.dbPath = args[0]
+			if err := runSummarize(opts); err != nil {
+				log.Fatalf("Error summarizing chunks: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers (0 = number of CPUs)")
+	cmd.Flags().IntVar(&opts.batchSize, "batch-size", defaultBatchSize, "Store summaries after every this many chunks")
+	cmd.Flags().StringVar(&opts.ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&opts.summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used for summaries")
+	cmd.Flags().StringSliceVar(&opts.summaryStyles, "summary-style", []string{embedding.SummaryTopic}, "Summary styles to generate: topic, sentence, paragraph, bullets (repeatable; chunks without a topic label always get one)")
+	cmd.Flags().StringVar(&opts.summaryLanguage, "summary-language", "", "Write summaries in this language, e.g. de or ja, whatever the language of the text (default: the model's choice)")
+	cmd.Flags().StringVar(&opts.runName, "run-name", "", "Only summarize the chunks of this run")
+	cmd.Flags().BoolVar(&opts.missing, "missing", false, "Only generate the requested styles that a chunk has no summary in yet")
+	addOllamaFlags(cmd, &opts.ollama, false)
+	addAutoPullFlag(cmd, &opts.ollama)
+
+	return cmd
+}
+
+func runSummarize(opts summarizeOptions) error {
+	if err := embedding.ValidateSummaryStyles(opts.summaryStyles); err != nil {
+		return err
+	}
+	if err := embedding.ValidateSummaryLanguage(opts.summaryLanguage); err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.dbPath); err != nil {
+		return fmt.Errorf("cannot access database: %w", err)
+	}
+	clientOptions, err := opts.ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(opts.dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chunks, err := chunksOfRun(db, opts.runName)
+	if err != nil {
+		return err
+	}
+
+	// The styles each chunk is summarized in, keyed by chunk ID
+	styles := make(map[int][]string, len(chunks))
+	var pending []database.TextChunk
+	for _, chunk := range chunks {
+		var wanted []string
+		for _, style := range opts.summaryStyles {
+			if !opts.missing || summaryOf(chunk, style) == "" {
+				wanted = append(wanted, style)
+			}
+		}
+		if chunk.Summary == "" && !slices.Contains(wanted, embedding.SummaryTopic) {
+			wanted = append(wanted, embedding.SummaryTopic)
+		}
+		if len(wanted) > 0 {
+			styles[chunk.ID] = wanted
+			pending = append(pending, chunk)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Println("No chunks to summarize")
+		return nil
+	}
+
+	clientOptions.GenerationOnly = true
+	client := newOllamaClient(opts.ollamaHost, "", opts.summaryModel, clientOptions)
+	client.SetSummaryLanguage(opts.summaryLanguage)
+	summarizer := &pipeline.Ollama{Client: client}
+	if err := summarizer.Check(context.Background()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Summarizing %d chunks with %s...\n", len(pending), opts.summaryModel)
+	stored, err := processInBatches(pending, opts.batchSize, opts.maxWorkers, "Summaries", func(chunk *database.TextChunk) error {
+		summaries, err := client.GetSummaries(chunk.Text, styles[chunk.ID])
+		if err != nil {
+			return err
+		}
+		for style, summary := range summaries {
+			setSummary(chunk, style, summary)
+		}
+		chunk.SummaryLanguage = opts.summaryLanguage
+		return nil
+	}, db.SetSummaries)
+	if err != nil {
+		if stored > 0 {
+			fmt.Printf("\nStored summaries for %d of %d chunks; re-run with --missing to continue\n", stored, len(pending))
+		}
+		return err
+	}
+
+	fmt.Printf("Stored summaries for %d chunks in %s\n", stored, db.Path())
+	return nil
+}
+
+// chunksOfRun returns the chunks of the named run, or of every run when
+// runName is empty
+func chunksOfRun(db *database.DB, runName string) ([]database.TextChunk, error) {
+	if runName == "" {
+		return db.GetAllChunks()
+	}
+	run, err := db.GetRunByName(runName)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetChunksByRun(run.ID)
+}
+
+// summaryOf returns the stored summary of a chunk in one style
+func summaryOf(chunk database.TextChunk, style string) string {
+	switch style {
+	case embedding.SummarySentence:
+		return chunk.SummarySentence
+	case embedding.SummaryParagraph:
+		return chunk.SummaryParagraph
+	case embedding.SummaryBullets:
+		return chunk.SummaryBullets
+	default:
+		return chunk.Summary
+	}
+}
+
+// setSummary sets the summary of a chunk in one style
+func setSummary(chunk *database.TextChunk, style, summary string) {
+	switch style {
+	case embedding.SummarySentence:
+		chunk.SummarySentence = summary
+	case embedding.SummaryParagraph:
+		chunk.SummaryParagraph = summary
+	case embedding.SummaryBullets:
+		chunk.SummaryBullets = summary
+	default:
+		chunk.Summary = summary
+	}
+}
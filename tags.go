@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// maxTagLength bounds a single tag so the tag list stays readable
+const maxTagLength = 64
+
+type chunkTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// ChunkTags is a chunk's tags after a change
+type ChunkTags struct {
+	ChunkID int      `json:"chunk_id"`
+	Tags    []string `json:"tags"`
+}
+
+// TagSummary is a tag and the chunks it is attached to
+type TagSummary struct {
+	Tag      string `json:"tag"`
+	Count    int    `json:"count"`
+	ChunkIDs []int  `json:"chunk_ids"`
+}
+
+// normalizeTags lowercases and trims tags, drops duplicates, and rejects
+// tags that are empty, too long or contain a comma, which separates tags in
+// the ?tags= filter
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			return nil, errors.New("tags must not be empty")
+		case len(tag) > maxTagLength:
+			return nil, fmt.Errorf("tag %q is longer than %d bytes", tag, maxTagLength)
+		case strings.Contains(tag, ","):
+			return nil, fmt.Errorf("tag %q must not contain a comma", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("tags is required")
+	}
+	return normalized, nil
+}
+
+// handleChunkTags serves /api/chunks/{id}/tags: GET lists the chunk's tags,
+// POST adds the tags in the body and DELETE removes them
+func (s *APIServer) handleChunkTags(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tags []string
+	if r.Method != http.MethodGet {
+		var req chunkTagsRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetBytes)).Decode(&req); err != nil {
+			respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if tags, err = normalizeTags(req.Tags); err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunk, err := db.GetChunk(id)
+	if errors.Is(err, database.ErrChunkNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if chunk.ParentID != 0 {
+		respondWithError(w, fmt.Sprintf("chunk %d is a passage of chunk %d; tag that chunk instead", id, chunk.ParentID), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		added := make([]database.ChunkTag, len(tags))
+		for i, tag := range tags {
+			added[i] = database.ChunkTag{ChunkID: id, Tag: tag}
+		}
+		err = db.AddChunkTags(added)
+	case http.MethodDelete:
+		err = db.RemoveChunkTags(id, tags)
+	}
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to update tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	current, err := db.GetChunkTags(id)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, ChunkTags{ChunkID: id, Tags: current})
+}
+
+func (s *APIServer) handleTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	tags, err := db.GetAllTags()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	byTag := make(map[string]*TagSummary)
+	for _, tag := range tags {
+		summary, ok := byTag[tag.Tag]
+		if !ok {
+			summary = &TagSummary{Tag: tag.Tag}
+			byTag[tag.Tag] = summary
+		}
+		summary.Count++
+		summary.ChunkIDs = append(summary.ChunkIDs, tag.ChunkID)
+	}
+
+	result := make([]TagSummary, 0, len(byTag))
+	for _, summary := range byTag {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+
+	respondWithJSON(w, result)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+)
+
+// TimelinePoint is the similarity between a chunk and the one following it
+// in its document. A dip marks a change of topic.
+type TimelinePoint struct {
+	RunID   int    `json:"run_id"`
+	Index   int    `json:"index"`
+	ChunkID int    `json:"chunk_id"`
+	NextID  int    `json:"next_chunk_id"`
+	Section string `json:"section,omitempty"`
+	Summary string `json:"summary"`
+	// Similarity is null when no similarity is stored for the pair, such
+	// as between chunks embedded with different models
+	Similarity *float64 `json:"similarity"`
+	// Sentiment is the chunk's emotional valence, if it was scored
+	Sentiment *float64 `json:"sentiment,omitempty"`
+}
+
+// handleTimeline serves /api/timeline: the similarity of each chunk to its
+// successor (chunk i vs i+1) in narrative order, for plotting topic drift
+// over the course of a document
+func (s *APIServer) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get chunks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	similarities, err := db.GetAllSimilarities()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get similarities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if name := r.URL.Query().Get("run"); name != "" {
+		run, err := db.GetRunByName(name)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, database.ErrRunNotFound) {
+				status = http.StatusNotFound
+			}
+			respondWithError(w, err.Error(), status)
+			return
+		}
+		var inRun []database.TextChunk
+		for _, chunk := range chunks {
+			if chunk.RunID == run.ID {
+				inRun = append(inRun, chunk)
+			}
+		}
+		chunks = inRun
+	}
+
+	respondWithJSON(w, sequentialSimilarities(chunks, similarities))
+}
+
+// sequentialSimilarities lists the similarity of each chunk to its
+// successor, run by run in chunk order
+func sequentialSimilarities(chunks []database.TextChunk, similarities []database.ChunkSimilarity) []TimelinePoint {
+	byID := make(map[int]database.TextChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+
+	stored := make(map[[2]int]bool, len(similarities))
+	for _, sim := range similarities {
+		stored[[2]int{sim.ChunkID1, sim.ChunkID2}] = true
+		stored[[2]int{sim.ChunkID2, sim.ChunkID1}] = true
+	}
+
+	points := []TimelinePoint{}
+	for _, link := range sequenceLinks(chunks, similarities) {
+		chunk := byID[link.Source]
+		point := TimelinePoint{
+			RunID:     chunk.RunID,
+			Index:     chunk.ChunkIndex,
+			ChunkID:   link.Source,
+			NextID:    link.Target,
+			Section:   chunk.Section,
+			Summary:   chunk.Summary,
+			Sentiment: chunk.Sentiment,
+		}
+		if stored[[2]int{link.Source, link.Target}] {
+			similarity := link.Similarity
+			point.Similarity = &similarity
+		}
+		points = append(points, point)
+	}
+	return points
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+)
+
+// maxListedLongChunks is how many chunks over the context are named in the
+// truncation warning
+const maxListedLongChunks = 5
+
+// contextTokens returns how many tokens the embedding model reads: num_ctx
+// when it is set with --ollama-option, otherwise the model's known context
+func contextTokens(model string, options embedding.ClientOptions, hosted bool) int {
+	if !hosted {
+		if numCtx, ok := options.ModelOptions["num_ctx"].(int64); ok && numCtx > 0 {
+			return int(numCtx)
+		}
+	}
+	return embedding.LimitsFor(model).ContextTokens
+}
+
+// countTokens records the estimated token count of each chunk and returns
+// the indexes of the chunks longer than limit
+func countTokens(chunks []database.TextChunk, model string, limit int) []int {
+	var over []int
+	for i := range chunks {
+		chunks[i].TokenCount = embedding.CountTokens(model, chunks[i].Text)
+		if chunks[i].TokenCount > limit {
+			over = append(over, i)
+		}
+	}
+	return over
+}
+
+// printTruncationWarning warns about chunks longer than the model's
+// context. Ollama cuts them off without an error, so the end of each is
+// missing from its embedding.
+func printTruncationWarning(chunks []database.TextChunk, over []int, model string, limit int, hosted bool) {
+	if len(over) == 0 {
+		return
+	}
+
+	// Longest first, so the worst offenders are named
+	sorted := append([]int(nil), over...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return chunks[sorted[i]].TokenCount > chunks[sorted[j]].TokenCount
+	})
+	var listed []string
+	for _, i := range sorted[:min(len(sorted), maxListedLongChunks)] {
+		listed = append(listed, fmt.Sprintf("chunk %d (~%d tokens)", chunks[i].ChunkIndex, chunks[i].TokenCount))
+	}
+	if len(sorted) > maxListedLongChunks {
+		listed = append(listed, fmt.Sprintf("and %d more", len(sorted)-maxListedLongChunks))
+	}
+
+	fmt.Printf("Warning: %d of %d chunks exceed the %d-token context of %s and will be truncated when embedded: %s\n",
+		len(over), len(chunks), limit, model, strings.Join(listed, ", "))
+	if hosted {
+		fmt.Println("  Lower --chunk-size to embed all of their text")
+	} else {
+		fmt.Println("  Lower --chunk-size, or raise the context with --ollama-option num_ctx=N if the model supports it")
+	}
+}
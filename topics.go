@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/jcpsimmons/bluffy/pkg/database"
+	"github.com/jcpsimmons/bluffy/pkg/embedding"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+	"github.com/spf13/cobra"
+)
+
+// Keyword extraction methods
+const (
+	keywordMethodTFIDF = "tfidf"
+	keywordMethodLLM   = "llm"
+)
+
+func createTopicsCommand() *cobra.Command {
+	var method string
+	var count int
+	var maxWorkers int
+	var ollamaHost string
+	var summaryModel string
+	var ollama ollamaFlags
+
+	cmd := &cobra.Command{
+		Use:   "topics <database.db>",
+		Short: "Extract keywords for every chunk in a database",
+		Long:  "Extract 3-10 keywords per chunk, either statistically (TF-IDF across the corpus) or with the LLM, and store them in the chunk_keywords table for tag-based filtering.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runTopics(args[0], method, count, maxWorkers, ollamaHost, summaryModel, ollama); err != nil {
+				log.Fatalf("Error extracting topics: %v", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&method, "method", "m", keywordMethodTFIDF, "Keyword extraction method: tfidf or llm")
+	cmd.Flags().IntVarP(&count, "count", "n", 5, "Keywords per chunk (3-10)")
+	cmd.Flags().IntVarP(&maxWorkers, "workers", "w", 0, "Maximum number of concurrent workers for the llm method (0 = number of CPUs)")
+	cmd.Flags().StringVar(&ollamaHost, "ollama-host", "http://localhost:11434", "Ollama server host and port")
+	cmd.Flags().StringVar(&summaryModel, "summary-model", embedding.DefaultGenerationModel, "Ollama model used by the llm method")
+	addOllamaFlags(cmd, &ollama, false)
+	addAutoPullFlag(cmd, &ollama)
+
+	return cmd
+}
+
+func runTopics(dbPath, method string, count, maxWorkers int, ollamaHost, summaryModel string, ollama ollamaFlags) error {
+	clientOptions, err := ollama.options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenExistingDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	chunks, err := db.GetAllChunks()
+	if err != nil {
+		return err
+	}
+
+	client := newOllamaClient(ollamaHost, "", summaryModel, clientOptions)
+	if err := extractKeywords(db, client, chunks, chunks, method, count, maxWorkers); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stored keywords for %d chunks in %s\n", len(chunks), db.Path())
+	return nil
+}
+
+// validateKeywordOptions checks a keyword method and count before any
+// chunk is embedded or summarized
+func validateKeywordOptions(method string, count int) error {
+	switch method {
+	case keywordMethodTFIDF, keywordMethodLLM:
+	default:
+		return fmt.Errorf("unknown keyword method %q (use %s or %s)", method, keywordMethodTFIDF, keywordMethodLLM)
+	}
+	if count < 3 || count > 10 {
+		return fmt.Errorf("keyword count must be between 3 and 10, got %d", count)
+	}
+	return nil
+}
+
+// extractKeywords computes keywords for targets and stores them. TF-IDF
+// weights are computed against corpus, which should be every chunk in the
+// database so that scores reflect the whole collection.
+func extractKeywords(db *database.DB, client *embedding.OllamaClient, targets, corpus []database.TextChunk, method string, count, maxWorkers int) error {
+	if err := validateKeywordOptions(method, count); err != nil {
+		return err
+	}
+
+	var keywords []database.ChunkKeyword
+	chunkIDs := make([]int, len(targets))
+	for i, chunk := range targets {
+		chunkIDs[i] = chunk.ID
+	}
+
+	switch method {
+	case keywordMethodTFIDF:
+		fmt.Println("Extracting keywords with TF-IDF...")
+		texts := make([]string, len(corpus))
+		for i, chunk := range corpus {
+			texts[i] = chunk.Text
+		}
+		model := textproc.NewTFIDF(texts)
+		for _, chunk := range targets {
+			for _, keyword := range model.Keywords(chunk.Text, count) {
+				keywords = append(keywords, database.ChunkKeyword{ChunkID: chunk.ID, Keyword: keyword.Term, Score: keyword.Score})
+			}
+		}
+
+	case keywordMethodLLM:
+		if err := client.CheckConnection(); err != nil {
+			return err
+		}
+		if err := client.CheckModelsAvailable(); err != nil {
+			return err
+		}
+
+		fmt.Println("Extracting keywords with the LLM...")
+		texts := make([]string, len(targets))
+		for i, chunk := range targets {
+			texts[i] = chunk.Text
+		}
+		reporter := newProgress(os.Stdout)
+		results, err := client.GetKeywordsConcurrent(texts, count, maxWorkers, func(completed, total int) {
+			reporter.Report("Keywords", completed, total)
+		})
+		if err != nil {
+			return err
+		}
+		for i, chunk := range targets {
+			for _, keyword := range results[i] {
+				keywords = append(keywords, database.ChunkKeyword{ChunkID: chunk.ID, Keyword: keyword})
+			}
+		}
+	}
+
+	if err := db.ReplaceKeywords(chunkIDs, keywords); err != nil {
+		return fmt.Errorf("failed to store keywords: %w", err)
+	}
+
+	return nil
+}
+
+// KeywordCount is a keyword and the number of chunks tagged with it
+type KeywordCount struct {
+	Keyword string `json:"keyword"`
+	Count   int    `json:"count"`
+}
+
+func (s *APIServer) handleKeywords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	db, err := s.openDB()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to open database: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	keywords, err := db.GetAllKeywords()
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to get keywords: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, keyword := range keywords {
+		counts[keyword.Keyword]++
+	}
+
+	result := make([]KeywordCount, 0, len(counts))
+	for keyword, count := range counts {
+		result = append(result, KeywordCount{Keyword: keyword, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Keyword < result[j].Keyword
+	})
+
+	respondWithJSON(w, result)
+}
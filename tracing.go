@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jcpsimmons/bluffy/pkg/tracing"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// addTracingFlag registers --otlp-endpoint on commands whose work is traced
+func addTracingFlag(cmd *cobra.Command, endpoint *string) {
+	cmd.Flags().StringVar(endpoint, "otlp-endpoint", "", "Export OpenTelemetry traces over OTLP/HTTP to this collector, e.g. http://localhost:4318 (default: $OTEL_EXPORTER_OTLP_ENDPOINT, or no tracing)")
+}
+
+// startTracing exports spans to endpoint or the collector set in the
+// environment, and returns a function sending the spans still buffered
+func startTracing(endpoint string) (func(), error) {
+	shutdown, err := tracing.Setup(context.Background(), endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Printf("Warning: failed to export traces: %v", err)
+		}
+	}, nil
+}
+
+// traceRequests records a span per request, continuing the trace of a
+// traceparent header. Spans are named after the route that handled the
+// request rather than its path, so /api/chunks/1 and /api/chunks/2 are
+// grouped together.
+func traceRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method,
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(ctx)
+		handler.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route), attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jcpsimmons/bluffy/pkg/progress"
+	"github.com/jcpsimmons/bluffy/pkg/textproc"
+)
+
+// maxChunkTextBytes limits the body of POST /api/chunks, which is chunked
+// and may be much longer than a snippet
+const maxChunkTextBytes = 1 << 20
+
+type chunkCreateRequest struct {
+	Text    string `json:"text"`
+	Section string `json:"section,omitempty"`
+	Run     string `json:"run,omitempty"`
+}
+
+type chunkCreateResponse struct {
+	Chunks []Node `json:"chunks"`
+}
+
+// writable rejects requests that change the database unless the server was
+// started with --readonly=false
+func (s *APIServer) writable(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.readonly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			respondWithError(w, "Server is read-only; restart it with --readonly=false to enable writes", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleChunksCollection serves /api/chunks: GET lists chunks and POST adds
+// new text
+func (s *APIServer) handleChunksCollection() http.HandlerFunc {
+	list := s.cached(s.handleChunks)
+	create := s.writable(s.handleCreateChunks)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			create(w, r)
+			return
+		}
+		list(w, r)
+	}
+}
+
+// handleCreateChunks chunks the submitted text, embeds and summarizes each
+// chunk, and links the chunks into the similarity graph
+func (s *APIServer) handleCreateChunks(w http.ResponseWriter, r *http.Request) {
+	var req chunkCreateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxChunkTextBytes)).Decode(&req); err != nil {
+		respondWithError(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		respondWithError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	runName := strings.TrimSpace(req.Run)
+	if runName == "" {
+		runName = snippetRunName
+	}
+
+	pieces, err := textproc.ChunkText(req.Text, textproc.DefaultChunkOptions)
+	if err != nil {
+		respondWithError(w, fmt.Sprintf("Failed to chunk text: %v", err), http.StatusInternalServerError)
+		return
+	}
+	texts := make([]string, len(pieces))
+	for i, piece := range pieces {
+		texts[i] = piece.Text
+	}
+
+	stored, _, _, err := s.ingestChunks(texts, strings.TrimSpace(req.Section), runName, progress.Noop)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nodes := make([]Node, len(stored))
+	for i, chunk := range stored {
+		nodes[i] = newNode(chunk)
+	}
+	respondWithJSON(w, chunkCreateResponse{Chunks: nodes})
+}